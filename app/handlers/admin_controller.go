@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"log"
+	"time"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	aiService *service.AiService
+}
+
+func NewAdminHandler(aiService *service.AiService) *AdminHandler {
+	return &AdminHandler{aiService: aiService}
+}
+
+func (h *AdminHandler) GetBreakers(c *fiber.Ctx) error {
+	log.Println("GetBreakers")
+	return c.JSON(fiber.Map{
+		"breakers": h.aiService.Breakers().Snapshots(),
+	})
+}
+
+// GetTtsCache returns the TTS cache hit and miss counts and how full each tier is.
+func (h *AdminHandler) GetTtsCache(c *fiber.Ctx) error {
+	log.Println("GetTtsCache")
+	return c.JSON(fiber.Map{
+		"cache": h.aiService.AudioCache().Stats(),
+	})
+}
+
+// GetUsage returns the metered provider calls and their totals. Query params: email
+// (optional, all users when empty), from and to as RFC3339 or YYYY-MM-DD. A date-only
+// "to" includes that whole day. The range defaults to the last 30 days.
+func (h *AdminHandler) GetUsage(c *fiber.Ctx) error {
+	log.Println("GetUsage")
+	email := c.Query("email")
+	now := time.Now()
+	from, err := parseUsageTime(c.Query("from"), now.AddDate(0, 0, -30), false)
+	if err != nil {
+		return c.Status(400).SendString("invalid from: " + err.Error())
+	}
+	to, err := parseUsageTime(c.Query("to"), now, true)
+	if err != nil {
+		return c.Status(400).SendString("invalid to: " + err.Error())
+	}
+	if !from.Before(to) {
+		return c.Status(400).SendString("from must be before to")
+	}
+
+	records, err := h.aiService.Usage().GetUsage(email, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to load usage",
+		})
+	}
+	summary, err := h.aiService.Usage().SummarizeUsage(email, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to summarize usage",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"from":    from,
+		"to":      to,
+		"summary": summary,
+		"records": records,
+	})
+}
+
+func parseUsageTime(value string, fallback time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -2,10 +2,16 @@ package handler
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 	ai_model "up-it-aps-api/app/models/ai"
 	service "up-it-aps-api/app/services"
+	"up-it-aps-api/pkg/middleware"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2/middleware/session"
 
 	"github.com/gofiber/fiber/v2"
@@ -22,7 +28,7 @@ func NewAiHandler(aiService *service.AiService, helperService *service.HelperSer
 	return &AiHandler{
 		aiService:     aiService,
 		helperService: helperService,
-		userService:   aiService.userService, // Get userService from aiService
+		userService:   aiService.UserService(),
 		store:         store,
 	}
 }
@@ -41,15 +47,42 @@ func (h *AiHandler) ReceiveMessage(c *fiber.Ctx) error {
 
 }
 
+func (h *AiHandler) StreamMessage(c *fiber.Ctx) error {
+	log.Println("StreamMessage")
+	message := new(ai_model.MessageReceived)
+	if err := c.BodyParser(message); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	return h.aiService.AiStreamMessage(c, message)
+}
+
+// GetModels lists the chat models the registry knows, including self-hosted ones.
+func (h *AiHandler) GetModels(c *fiber.Ctx) error {
+	log.Println("GetModels")
+	return c.JSON(fiber.Map{
+		"models": h.aiService.ChatProviders().Models(),
+	})
+}
+
+// GetVoices lists the voices and output formats of each TTS model, for a voice picker.
+func (h *AiHandler) GetVoices(c *fiber.Ctx) error {
+	log.Println("GetVoices")
+	return c.JSON(fiber.Map{
+		"voices": h.aiService.SpeechSynthesizers().Catalogs(),
+	})
+}
+
 func (h *AiHandler) ChunkString(c *fiber.Ctx) error {
 	log.Println("ChunkString")
 	query := c.Query("text")
-	chunkedString := h.aiService.Chunking(query)
+	userSettings := h.userService.GetUserSettingsByEmail(c.Query("email"))
+	chunkedString := h.aiService.Chunking(query, userSettings.TtsModel)
 	return h.helperService.ChunkData(c, chunkedString)
 }
 
+// GenerateChunkedAudio streams the spoken message. The message is split into chunks that
+// are synthesised several at a time and written in order, each as soon as it is ready.
 func (h *AiHandler) GenerateChunkedAudio(ctx *fiber.Ctx) (err error) {
-	// TODO: refactor this, it's getting messy
 	log.Println("GenerateChunkedAudio")
 	message := new(ai_model.MessageReceived)
 	email := ctx.Query("email")
@@ -57,69 +90,176 @@ func (h *AiHandler) GenerateChunkedAudio(ctx *fiber.Ctx) (err error) {
 		log.Println(err)
 		return ctx.Status(400).SendString(err.Error())
 	}
-	chunkedMessage := h.aiService.Chunking(message.Message)
-	ctx.Set("Transfer-Encoding", "chunked")
+	if message.SessionID != 0 {
+		if _, err := h.aiService.Sessions().ActiveSession(message.SessionID, email); err != nil {
+			return sessionError(ctx, err)
+		}
+	}
 	userSettings := h.userService.GetUserSettingsByEmail(email)
+	chunks := h.aiService.Chunking(message.Message, userSettings.TtsModel)
+	ctx.Set("Transfer-Encoding", "chunked")
 
-	// Unreal is faster if it's not chunked, unless the responses are BIG
-	if userSettings.TtsModel == "unreal-speech" {
-		ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-			var audio = h.aiService.UnrealSpeechGenerateAudio([]byte(message.Message), email)
-			_, err := w.Write(audio)
-			if err != nil {
-				log.Printf("Error writing audio: %v", err)
-				return
+	ctx.Set("X-Tts-Provider", h.aiService.AvailableTtsModel(userSettings.TtsModel))
+	ctx.Set("Content-Type", service.AudioContentType(service.ChunkedAudioFormat))
+	voice := service.VoiceOptions(userSettings)
+	// the fiber context is recycled before the body is streamed
+	usageCtx := service.WithUsageScope(context.Background(), email, middleware.GetRequestID(ctx))
+	usageCtx = service.WithUsageSession(usageCtx, message.SessionID)
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		failures, err := h.aiService.GenerateChunkedAudio(usageCtx, userSettings.TtsModel, voice, chunks, email, func(index int, audio []byte, outcome service.FailoverOutcome) error {
+			logFailover(outcome)
+			if _, err := w.Write(audio); err != nil {
+				return err
 			}
-			_ = w.Flush()
+			return w.Flush()
 		})
-		return nil
+		for _, failure := range failures {
+			log.Printf("Error generating audio for chunk %d of %d: %v", failure.Index+1, len(chunks), failure.Err)
+		}
+		if err != nil {
+			log.Printf("Stopped streaming audio: %v", err)
+		}
+	})
+	return nil
+}
+
+func (h *AiHandler) WhisperGenerateTextFromSpeech(c *fiber.Ctx) error {
+	log.Println("WhisperGenerateTextFromSpeech")
+	email := c.Query("email")
+	var audio struct {
+		AudioData []byte `json:"audioData"`
+		SessionID uint   `json:"session_id"`
 	}
-	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-		doneCh := make(chan bool)
-
-		for i := 0; i < len(chunkedMessage); i++ {
-			go func(index int) {
-				var audio []byte
-				switch userSettings.TtsModel {
-				case "tts-1":
-					audio = h.aiService.OpenAiGenerateAudio(chunkedMessage[index], email)
-				case "vertex":
-					audio = h.aiService.VertexAiGenerateAudio(chunkedMessage[index])
-				case "elevenlabs-multilingual-v1":
-					audio = h.aiService.ElevenLabsGenerateAudio(chunkedMessage[index], email)
-				default:
-					audio = h.aiService.OpenAiGenerateAudio(chunkedMessage[index], email)
-				}
-				_, err := w.Write(audio)
+	if err := c.BodyParser(&audio); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	if audio.SessionID != 0 {
+		if _, err := h.aiService.Sessions().ActiveSession(audio.SessionID, email); err != nil {
+			return sessionError(c, err)
+		}
+	}
+	userSettings := h.userService.GetUserSettingsByEmail(email)
+	usageCtx := service.WithUsageScope(c.UserContext(), email, middleware.GetRequestID(c))
+	usageCtx = service.WithUsageSession(usageCtx, audio.SessionID)
+	transcription, err := h.aiService.Transcribe(usageCtx, userSettings.SttModel, audio.AudioData)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	if audio.SessionID != 0 {
+		// the transcript answers the session's open question, if it has one
+		turn, err := h.aiService.Sessions().RecordSpokenAnswer(audio.SessionID, transcription)
+		if err != nil {
+			log.Printf("Error recording session answer: %v", err)
+		}
+		transcription.SessionTurn = turn.Number
+	}
+	return c.JSON(transcription)
+}
+
+// streamIdleTimeout closes a speech stream the client has stopped sending to.
+const streamIdleTimeout = 30 * time.Second
+
+// streamReadLimit is the largest message a speech stream accepts, 30 seconds of 16 kHz PCM.
+const streamReadLimit = 1 << 20
+
+// StreamSpeechToText transcribes speech over a WebSocket while the candidate talks.
+// The client sends 16-bit little-endian mono PCM at sample_rate (default 16000) as
+// binary messages and {"type": "stop"} when the candidate is done. The server pushes
+// partial, final and error events as segments are transcribed, then a transcript event
+// with the merged transcription, and closes the connection. With session_id the
+// transcript is recorded as the answer to the session's open question. Closing the
+// connection without stop abandons the answer. Browsers, which cannot set the x-api-key
+// header, offer the key as a subprotocol: new WebSocket(url, ["x-api-key", key]).
+func (h *AiHandler) StreamSpeechToText(c *fiber.Ctx) error {
+	log.Println("StreamSpeechToText")
+	email := c.Query("email")
+	sessionID := uint(c.QueryInt("session_id"))
+	if sessionID != 0 {
+		if _, err := h.aiService.Sessions().ActiveSession(sessionID, email); err != nil {
+			return sessionError(c, err)
+		}
+	}
+	settings := service.StreamSettings{SampleRate: c.QueryInt("sample_rate", service.DefaultStreamSampleRate)}
+	if settings.SampleRate < service.MinStreamSampleRate || settings.SampleRate > service.MaxStreamSampleRate {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   true,
+			"message": fmt.Sprintf("sample_rate must be between %d and %d", service.MinStreamSampleRate, service.MaxStreamSampleRate),
+		})
+	}
+	userSettings := h.userService.GetUserSettingsByEmail(email)
+	// the fiber context is recycled once the connection is upgraded
+	usageCtx := service.WithUsageScope(context.Background(), email, middleware.GetRequestID(c))
+	usageCtx = service.WithUsageSession(usageCtx, sessionID)
+
+	return websocket.New(func(conn *websocket.Conn) {
+		conn.SetReadLimit(streamReadLimit)
+		ctx, cancel := context.WithCancel(usageCtx)
+		defer cancel()
+		frames := make(chan []byte, 16)
+		go func() {
+			defer close(frames)
+			for {
+				conn.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+				messageType, data, err := conn.ReadMessage()
 				if err != nil {
-					doneCh <- false
-					log.Fatal(err)
+					cancel()
 					return
 				}
-				err = w.Flush()
-				log.Println("Sending chunk")
-				if err != nil {
-					log.Printf("Error flushing chunk: %v", err)
-					doneCh <- false
+				if messageType == websocket.TextMessage {
+					var control struct {
+						Type string `json:"type"`
+					}
+					if json.Unmarshal(data, &control) == nil && control.Type == "stop" {
+						return
+					}
+					continue
+				}
+				select {
+				case frames <- data:
+				case <-ctx.Done():
 					return
 				}
-				doneCh <- true
-			}(i)
+			}
+		}()
 
-			if !<-doneCh { // wait for the goroutine to signal completion
-				return
+		transcription, err := h.aiService.StreamTranscription(ctx, userSettings.SttModel, settings, frames, func(event ai_model.TranscriptEvent) error {
+			return conn.WriteJSON(event)
+		})
+		if err != nil {
+			log.Printf("Stopped streaming transcription: %v", err)
+			closeStream(conn, websocket.CloseGoingAway)
+			return
+		}
+		// the client went away before stop, so the answer was abandoned
+		if ctx.Err() != nil {
+			return
+		}
+		if sessionID != 0 && transcription.Text != "" {
+			turn, err := h.aiService.Sessions().RecordSpokenAnswer(sessionID, transcription)
+			if err != nil {
+				log.Printf("Error recording session answer: %v", err)
 			}
+			transcription.SessionTurn = turn.Number
 		}
-	})
-	return nil
+		if err := conn.WriteJSON(ai_model.TranscriptEvent{Type: ai_model.TranscriptDone, Transcription: transcription}); err != nil {
+			log.Printf("Error sending transcript: %v", err)
+		}
+		closeStream(conn, websocket.CloseNormalClosure)
+	}, websocket.Config{Subprotocols: []string{middleware.APIKeyProtocol}})(c)
 }
 
-func (h *AiHandler) WhisperGenerateTextFromSpeech(c *fiber.Ctx) error {
-	log.Println("WhisperGenerateTextFromSpeech")
-	email := c.Query("email")
-	userSettings := h.userService.GetUserSettingsByEmail(email)
-	if userSettings.SttModel == "vertex" {
-		return h.aiService.VertexAiCreateTranscription(c)
+// closeStream sends the client a close frame with code. No frame is sent if one already
+// was, as when the client closed first and its close was echoed back.
+func closeStream(conn *websocket.Conn, code int) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+}
+
+func logFailover(outcome service.FailoverOutcome) {
+	if len(outcome.FailedOver) > 0 {
+		log.Printf("Failed over from %v to %s", outcome.FailedOver, outcome.Model)
 	}
-	return h.aiService.OpenAiCreateTranscription(c)
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ConversationHandler struct {
+	conversationService *service.ConversationService
+}
+
+func NewConversationHandler(conversationService *service.ConversationService) *ConversationHandler {
+	return &ConversationHandler{conversationService: conversationService}
+}
+
+func (h *ConversationHandler) GetConversations(c *fiber.Ctx) error {
+	log.Println("GetConversations")
+	email := c.Query("email")
+	conversations := h.conversationService.GetConversationsByEmail(email)
+	return c.JSON(conversations)
+}
+
+func (h *ConversationHandler) GetConversation(c *fiber.Ctx) error {
+	log.Println("GetConversation")
+	email := c.Query("email")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid conversation id")
+	}
+	conversation, err := h.conversationService.GetConversation(uint(id), email)
+	if errors.Is(err, service.ErrConversationNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error":   true,
+			"message": "failed to load conversation",
+		})
+	}
+	return c.JSON(conversation)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	persona_model "up-it-aps-api/app/models/persona"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PersonaHandler struct {
+	personaService *service.PersonaService
+}
+
+func NewPersonaHandler(personaService *service.PersonaService) *PersonaHandler {
+	return &PersonaHandler{personaService: personaService}
+}
+
+func (h *PersonaHandler) GetPersonas(c *fiber.Ctx) error {
+	log.Println("GetPersonas")
+	return c.JSON(h.personaService.GetPersonas())
+}
+
+func (h *PersonaHandler) GetPersona(c *fiber.Ctx) error {
+	log.Println("GetPersona")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid persona id")
+	}
+	persona, err := h.personaService.GetPersona(uint(id))
+	if err != nil {
+		return personaError(c, err)
+	}
+	return c.JSON(persona)
+}
+
+func (h *PersonaHandler) GetPersonaVersions(c *fiber.Ctx) error {
+	log.Println("GetPersonaVersions")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid persona id")
+	}
+	versions, err := h.personaService.GetPersonaVersions(uint(id))
+	if err != nil {
+		return personaError(c, err)
+	}
+	return c.JSON(versions)
+}
+
+func (h *PersonaHandler) GetPersonaVersion(c *fiber.Ctx) error {
+	log.Println("GetPersonaVersion")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid persona id")
+	}
+	version, err := c.ParamsInt("version")
+	if err != nil || version <= 0 {
+		return c.Status(400).SendString("invalid persona version")
+	}
+	personaVersion, err := h.personaService.GetPersonaVersion(uint(id), uint(version))
+	if err != nil {
+		return personaError(c, err)
+	}
+	return c.JSON(personaVersion)
+}
+
+func (h *PersonaHandler) CreatePersona(c *fiber.Ctx) error {
+	log.Println("CreatePersona")
+	input := new(persona_model.InputPersona)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	persona, err := h.personaService.CreatePersona(input)
+	if err != nil {
+		return personaError(c, err)
+	}
+	return c.Status(201).JSON(persona)
+}
+
+func (h *PersonaHandler) UpdatePersona(c *fiber.Ctx) error {
+	log.Println("UpdatePersona")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid persona id")
+	}
+	input := new(persona_model.InputPersona)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	persona, err := h.personaService.UpdatePersona(uint(id), input)
+	if err != nil {
+		return personaError(c, err)
+	}
+	return c.JSON(persona)
+}
+
+func (h *PersonaHandler) DeletePersona(c *fiber.Ctx) error {
+	log.Println("DeletePersona")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid persona id")
+	}
+	if err := h.personaService.DeletePersona(uint(id)); err != nil {
+		return personaError(c, err)
+	}
+	return c.SendStatus(204)
+}
+
+func personaError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to process persona"
+	switch {
+	case errors.Is(err, service.ErrPersonaNotFound):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrPersonaSlugTaken):
+		status, message = 409, err.Error()
+	case errors.Is(err, service.ErrInvalidPersona), errors.Is(err, service.ErrDefaultPersona):
+		status, message = 400, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"time"
+	session_model "up-it-aps-api/app/models/session"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PracticeHandler struct {
+	practiceService *service.PracticeService
+}
+
+func NewPracticeHandler(practiceService *service.PracticeService) *PracticeHandler {
+	return &PracticeHandler{practiceService: practiceService}
+}
+
+// GetSchedule lists when each of the user's questions and competencies is next due.
+func (h *PracticeHandler) GetSchedule(c *fiber.Ctx) error {
+	log.Println("GetPracticeSchedule")
+	items, err := h.practiceService.GetSchedule(c.Query("email"))
+	if err != nil {
+		return practiceError(c, err)
+	}
+	return c.JSON(items)
+}
+
+// GetDue lists the questions and competencies due for practice now.
+func (h *PracticeHandler) GetDue(c *fiber.Ctx) error {
+	log.Println("GetPracticeDue")
+	items, err := h.practiceService.GetDue(c.Query("email"), time.Now())
+	if err != nil {
+		return practiceError(c, err)
+	}
+	return c.JSON(items)
+}
+
+// StartPracticeSession starts a session from the due queue. It takes the same body as
+// starting a session; questions and question_count narrow and cap what is asked.
+func (h *PracticeHandler) StartPracticeSession(c *fiber.Ctx) error {
+	log.Println("StartPracticeSession")
+	input := new(session_model.InputSession)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	interview, err := h.practiceService.StartPracticeSession(c.Query("email"), input)
+	if err != nil {
+		return practiceError(c, err)
+	}
+	return c.Status(201).JSON(interview)
+}
+
+// Rebuild recomputes the user's whole schedule from their scored answers.
+func (h *PracticeHandler) Rebuild(c *fiber.Ctx) error {
+	log.Println("RebuildPracticeSchedule")
+	items, err := h.practiceService.Rebuild(c.Query("email"))
+	if err != nil {
+		return practiceError(c, err)
+	}
+	return c.JSON(items)
+}
+
+func practiceError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to process practice schedule"
+	switch {
+	case errors.Is(err, service.ErrNothingDue):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrInvalidSession):
+		status, message = 400, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"strings"
+	question_model "up-it-aps-api/app/models/question"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type QuestionHandler struct {
+	questionService *service.QuestionService
+	// hideTests leaves the hidden test cases of coding questions out of every answer.
+	hideTests bool
+}
+
+func NewQuestionHandler(questionService *service.QuestionService) *QuestionHandler {
+	return &QuestionHandler{questionService: questionService}
+}
+
+// NewPublicQuestionHandler serves questions to candidates, without hidden test cases.
+func NewPublicQuestionHandler(questionService *service.QuestionService) *QuestionHandler {
+	return &QuestionHandler{questionService: questionService, hideTests: true}
+}
+
+// GetQuestions lists the questions matching ?tags=a,b&competency=&role_family=&source=
+// &type=&min_difficulty=&max_difficulty=.
+func (h *QuestionHandler) GetQuestions(c *fiber.Ctx) error {
+	log.Println("GetQuestions")
+	questions, err := h.questionService.GetQuestions(questionFilter(c))
+	if err != nil {
+		return questionError(c, err)
+	}
+	if h.hideTests {
+		for i := range questions {
+			questions[i] = questions[i].WithoutHiddenTests()
+		}
+	}
+	return c.JSON(questions)
+}
+
+func (h *QuestionHandler) GetQuestion(c *fiber.Ctx) error {
+	log.Println("GetQuestion")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid question id")
+	}
+	question, err := h.questionService.GetQuestion(uint(id))
+	if err != nil {
+		return questionError(c, err)
+	}
+	if h.hideTests {
+		question = question.WithoutHiddenTests()
+	}
+	return c.JSON(question)
+}
+
+func (h *QuestionHandler) CreateQuestion(c *fiber.Ctx) error {
+	log.Println("CreateQuestion")
+	input := new(question_model.InputQuestion)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	question, err := h.questionService.CreateQuestion(input)
+	if err != nil {
+		return questionError(c, err)
+	}
+	return c.Status(201).JSON(question)
+}
+
+func (h *QuestionHandler) UpdateQuestion(c *fiber.Ctx) error {
+	log.Println("UpdateQuestion")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid question id")
+	}
+	input := new(question_model.InputQuestion)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	question, err := h.questionService.UpdateQuestion(uint(id), input)
+	if err != nil {
+		return questionError(c, err)
+	}
+	return c.JSON(question)
+}
+
+func (h *QuestionHandler) DeleteQuestion(c *fiber.Ctx) error {
+	log.Println("DeleteQuestion")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid question id")
+	}
+	if err := h.questionService.DeleteQuestion(uint(id)); err != nil {
+		return questionError(c, err)
+	}
+	return c.SendStatus(204)
+}
+
+// ImportQuestions reads the raw body as ?format=json|yaml|csv (taken from the
+// Content-Type when missing) and answers with the validation report. ?dry_run=true only
+// validates.
+func (h *QuestionHandler) ImportQuestions(c *fiber.Ctx) error {
+	log.Println("ImportQuestions")
+	report, err := h.questionService.ImportQuestions(questionFormat(c), c.Body(), c.QueryBool("dry_run"))
+	if err != nil {
+		return questionError(c, err)
+	}
+	status := 200
+	if report.Imported == 0 && len(report.Errors) > 0 {
+		status = 422
+	}
+	return c.Status(status).JSON(report)
+}
+
+// ExportQuestions downloads the questions matching the GetQuestions filters as
+// ?format=json|yaml|csv, in a form ImportQuestions accepts.
+func (h *QuestionHandler) ExportQuestions(c *fiber.Ctx) error {
+	log.Println("ExportQuestions")
+	format := c.Query("format", question_model.FormatJSON)
+	data, err := h.questionService.ExportQuestions(format, questionFilter(c))
+	if err != nil {
+		return questionError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, service.QuestionContentType(format))
+	c.Attachment("questions." + format)
+	return c.Send(data)
+}
+
+func questionFilter(c *fiber.Ctx) question_model.QuestionFilter {
+	filter := question_model.QuestionFilter{
+		Competency:    c.Query("competency"),
+		RoleFamily:    c.Query("role_family"),
+		Source:        c.Query("source"),
+		Type:          c.Query("type"),
+		MinDifficulty: c.QueryInt("min_difficulty"),
+		MaxDifficulty: c.QueryInt("max_difficulty"),
+	}
+	if tags := c.Query("tags"); tags != "" {
+		filter.Tags = strings.Split(tags, ",")
+	}
+	return filter
+}
+
+func questionFormat(c *fiber.Ctx) string {
+	if format := c.Query("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	switch {
+	case strings.Contains(contentType, "yaml"):
+		return question_model.FormatYAML
+	case strings.Contains(contentType, "csv"):
+		return question_model.FormatCSV
+	}
+	return question_model.FormatJSON
+}
+
+func questionError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to process question"
+	switch {
+	case errors.Is(err, service.ErrQuestionNotFound):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrInvalidQuestion), errors.Is(err, service.ErrQuestionFormat):
+		status, message = 400, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReportHandler struct {
+	reportService *service.ReportService
+}
+
+func NewReportHandler(reportService *service.ReportService) *ReportHandler {
+	return &ReportHandler{reportService: reportService}
+}
+
+// GetReport downloads the session's report in ?format= (md, html or pdf). Without a
+// format, or while the report is still being generated, it returns the report's status.
+func (h *ReportHandler) GetReport(c *fiber.Ctx) error {
+	log.Println("GetReport")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	report, err := h.reportService.GetReport(uint(id), c.Query("email"))
+	if err != nil {
+		return reportError(c, err)
+	}
+	format := c.Query("format")
+	if format == "" {
+		return c.JSON(report)
+	}
+	content, contentType, err := service.ReportContent(report, format)
+	if errors.Is(err, service.ErrReportNotReady) {
+		return c.Status(202).JSON(report)
+	}
+	if err != nil {
+		return reportError(c, err)
+	}
+	c.Attachment(fmt.Sprintf("session-%d-report.%s", report.SessionID, format))
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(content)
+}
+
+// RegenerateReport queues the report of a completed session again, for example after
+// more answers have been scored.
+func (h *ReportHandler) RegenerateReport(c *fiber.Ctx) error {
+	log.Println("RegenerateReport")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	report, err := h.reportService.RegenerateReport(uint(id), c.Query("email"))
+	if err != nil {
+		return reportError(c, err)
+	}
+	return c.Status(202).JSON(report)
+}
+
+func reportError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to get report"
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrReportNotFound):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrSessionNotEnded):
+		status, message = 409, err.Error()
+	case errors.Is(err, service.ErrReportFormat):
+		status, message = 400, err.Error()
+	case errors.Is(err, service.ErrReportFailed):
+		message = err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
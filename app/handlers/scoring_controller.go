@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	service "up-it-aps-api/app/services"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScoringHandler struct {
+	scoringService *service.ScoringService
+}
+
+func NewScoringHandler(scoringService *service.ScoringService) *ScoringHandler {
+	return &ScoringHandler{scoringService: scoringService}
+}
+
+// ScoreTurn has the judge model score a session turn. ?rubric= picks a rubric by slug,
+// otherwise the session type's rubric is used.
+func (h *ScoringHandler) ScoreTurn(c *fiber.Ctx) error {
+	log.Println("ScoreTurn")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	email := c.Query("email")
+	ctx := service.WithUsageSession(service.WithUsageScope(c.UserContext(), email, middleware.GetRequestID(c)), uint(id))
+	score, err := h.scoringService.ScoreTurn(ctx, uint(id), email, turn, c.Query("rubric"))
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.Status(201).JSON(score)
+}
+
+// GetTurnScores lists every score given to a session turn, newest first.
+func (h *ScoringHandler) GetTurnScores(c *fiber.Ctx) error {
+	log.Println("GetTurnScores")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	scores, err := h.scoringService.GetTurnScores(uint(id), c.Query("email"), turn)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	if len(scores) == 0 {
+		return scoringError(c, service.ErrTurnNotScoredYet)
+	}
+	return c.JSON(scores)
+}
+
+// AnalyseTurn splits the answer of a behavioural session turn into its STAR components
+// and stores the analysis, with flags and coaching tips, on the turn.
+func (h *ScoringHandler) AnalyseTurn(c *fiber.Ctx) error {
+	log.Println("AnalyseTurn")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	email := c.Query("email")
+	ctx := service.WithUsageSession(service.WithUsageScope(c.UserContext(), email, middleware.GetRequestID(c)), uint(id))
+	analysis, err := h.scoringService.AnalyseTurn(ctx, uint(id), email, turn)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.Status(201).JSON(analysis)
+}
+
+func (h *ScoringHandler) GetStarAnalysis(c *fiber.Ctx) error {
+	log.Println("GetStarAnalysis")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	analysis, err := h.scoringService.GetStarAnalysis(uint(id), c.Query("email"), turn)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.JSON(analysis)
+}
+
+// GenerateFollowUps writes probing questions about the gaps in the scored answer of the
+// session's latest turn. The interviewer asks them before moving on.
+func (h *ScoringHandler) GenerateFollowUps(c *fiber.Ctx) error {
+	log.Println("GenerateFollowUps")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	email := c.Query("email")
+	ctx := service.WithUsageSession(service.WithUsageScope(c.UserContext(), email, middleware.GetRequestID(c)), uint(id))
+	followUps, err := h.scoringService.GenerateFollowUps(ctx, uint(id), email, turn)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.Status(201).JSON(followUps)
+}
+
+func (h *ScoringHandler) GetRubrics(c *fiber.Ctx) error {
+	log.Println("GetRubrics")
+	return c.JSON(h.scoringService.GetRubrics())
+}
+
+func (h *ScoringHandler) GetRubric(c *fiber.Ctx) error {
+	log.Println("GetRubric")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid rubric id")
+	}
+	rubric, err := h.scoringService.GetRubric(uint(id))
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.JSON(rubric)
+}
+
+func (h *ScoringHandler) CreateRubric(c *fiber.Ctx) error {
+	log.Println("CreateRubric")
+	input := new(scoring_model.InputRubric)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	rubric, err := h.scoringService.CreateRubric(input)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.Status(201).JSON(rubric)
+}
+
+func (h *ScoringHandler) UpdateRubric(c *fiber.Ctx) error {
+	log.Println("UpdateRubric")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid rubric id")
+	}
+	input := new(scoring_model.InputRubric)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	rubric, err := h.scoringService.UpdateRubric(uint(id), input)
+	if err != nil {
+		return scoringError(c, err)
+	}
+	return c.JSON(rubric)
+}
+
+func scoringError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to score answer"
+	var providerErr *service.ProviderError
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrSessionTurnNotFound),
+		errors.Is(err, service.ErrRubricNotFound), errors.Is(err, service.ErrTurnNotScoredYet),
+		errors.Is(err, service.ErrTurnNotAnalysedYet):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrTurnNotAnswered), errors.Is(err, service.ErrRubricSlugTaken),
+		errors.Is(err, service.ErrStarSessionType), errors.Is(err, service.ErrSessionNotActive),
+		errors.Is(err, service.ErrFollowUpLimit), errors.Is(err, service.ErrFollowUpTooLate):
+		status, message = 409, err.Error()
+	case errors.Is(err, service.ErrInvalidRubric):
+		status, message = 400, err.Error()
+	case errors.Is(err, service.ErrJudgeOutput), errors.Is(err, service.ErrStarOutput),
+		errors.Is(err, service.ErrFollowUpOutput), errors.As(err, &providerErr):
+		status, message = 502, err.Error()
+	case errors.Is(err, breaker.ErrOpen):
+		status, message = 503, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
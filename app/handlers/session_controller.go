@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"time"
+	session_model "up-it-aps-api/app/models/session"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionHandler struct {
+	sessionService *service.SessionService
+	reportService  *service.ReportService
+}
+
+func NewSessionHandler(sessionService *service.SessionService, reportService *service.ReportService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService, reportService: reportService}
+}
+
+func (h *SessionHandler) GetSessions(c *fiber.Ctx) error {
+	log.Println("GetSessions")
+	sessions := h.sessionService.GetSessions(c.Query("email"), c.Query("status"))
+	return c.JSON(sessions)
+}
+
+func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
+	log.Println("GetSession")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	interview, err := h.sessionService.GetSession(uint(id), c.Query("email"))
+	if err != nil {
+		return sessionError(c, err)
+	}
+	return c.JSON(interview)
+}
+
+func (h *SessionHandler) StartSession(c *fiber.Ctx) error {
+	log.Println("StartSession")
+	input := new(session_model.InputSession)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	interview, err := h.sessionService.StartSession(c.Query("email"), input)
+	if err != nil {
+		return sessionError(c, err)
+	}
+	return c.Status(201).JSON(interview)
+}
+
+func (h *SessionHandler) StartScheduledSession(c *fiber.Ctx) error {
+	log.Println("StartScheduledSession")
+	return h.transition(c, h.sessionService.StartScheduledSession)
+}
+
+func (h *SessionHandler) PauseSession(c *fiber.Ctx) error {
+	log.Println("PauseSession")
+	return h.transition(c, h.sessionService.PauseSession)
+}
+
+func (h *SessionHandler) ResumeSession(c *fiber.Ctx) error {
+	log.Println("ResumeSession")
+	return h.transition(c, h.sessionService.ResumeSession)
+}
+
+// EndSession completes the session and queues its report, which is generated in the
+// background and downloaded from /report once it is ready. Only the request that ends
+// the session queues it; the others get a conflict.
+func (h *SessionHandler) EndSession(c *fiber.Ctx) error {
+	log.Println("EndSession")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	interview, err := h.sessionService.EndSession(uint(id), c.Query("email"))
+	if err != nil {
+		return sessionError(c, err)
+	}
+	if _, err := h.reportService.QueueReport(interview); err != nil {
+		log.Printf("queueing report for session %d failed: %v", interview.ID, err)
+	}
+	return c.JSON(interview)
+}
+
+// GetTimer returns where a timed session stands against its question and total time
+// budgets, with any warnings, for clients that poll.
+func (h *SessionHandler) GetTimer(c *fiber.Ctx) error {
+	log.Println("GetTimer")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	timer, err := h.sessionService.GetTimer(uint(id), c.Query("email"))
+	if err != nil {
+		return sessionError(c, err)
+	}
+	return c.JSON(timer)
+}
+
+// maxTimerStream is how long a timer stream stays open. Clients reconnect to carry on
+// watching.
+const maxTimerStream = time.Hour
+
+// StreamTimer sends the session's timer as server-sent events: "timer" when the turn on
+// the clock changes, "warning" as each threshold is reached, "time_up" when the server
+// closes a turn or the session, and "end" once the session is over. Quiet seconds send
+// a ": ping" comment.
+func (h *SessionHandler) StreamTimer(c *fiber.Ctx) error {
+	log.Println("StreamTimer")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	email := c.Query("email")
+	if _, err := h.sessionService.GetSession(uint(id), email); err != nil {
+		return sessionError(c, err)
+	}
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// a failed write means the client has gone, which ends the stream; pings are
+		// written as comments so one is noticed even while nothing else happens
+		ctx, cancel := context.WithTimeout(context.Background(), maxTimerStream)
+		defer cancel()
+		err := h.sessionService.WatchTimer(ctx, uint(id), email, time.Second, func(event string, data interface{}) error {
+			if event == service.TimerPing {
+				return service.WriteSSEComment(w, event)
+			}
+			return service.WriteSSE(w, event, data)
+		})
+		if err != nil {
+			log.Printf("Timer stream for session %d ended: %v", id, err)
+		}
+	})
+	return nil
+}
+
+func (h *SessionHandler) AbandonSession(c *fiber.Ctx) error {
+	log.Println("AbandonSession")
+	return h.transition(c, h.sessionService.AbandonSession)
+}
+
+func (h *SessionHandler) transition(c *fiber.Ctx, change func(uint, string) (session_model.InterviewSession, error)) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	interview, err := change(uint(id), c.Query("email"))
+	if err != nil {
+		return sessionError(c, err)
+	}
+	return c.JSON(interview)
+}
+
+func sessionError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to process session"
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrSessionTurnNotFound):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrSessionTransition), errors.Is(err, service.ErrSessionNotActive):
+		status, message = 409, err.Error()
+	case errors.Is(err, service.ErrInvalidSession):
+		status, message = 400, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SkillHandler struct {
+	skillService *service.SkillService
+}
+
+func NewSkillHandler(skillService *service.SkillService) *SkillHandler {
+	return &SkillHandler{skillService: skillService}
+}
+
+// GetSkills lists the user's skill estimate per competency.
+func (h *SkillHandler) GetSkills(c *fiber.Ctx) error {
+	log.Println("GetSkills")
+	estimates, err := h.skillService.GetEstimates(c.Query("email"))
+	if err != nil {
+		return skillError(c, err)
+	}
+	return c.JSON(estimates)
+}
+
+// NextQuestion picks the question that suits the user best from the bank entries
+// matching the same filters as /questions, and explains why.
+func (h *SkillHandler) NextQuestion(c *fiber.Ctx) error {
+	log.Println("NextQuestion")
+	selection, err := h.skillService.SelectQuestion(c.Query("email"), questionFilter(c), nil)
+	if err != nil {
+		return skillError(c, err)
+	}
+	return c.JSON(selection)
+}
+
+func skillError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to get skills"
+	if errors.Is(err, service.ErrNoQuestions) {
+		status, message = 404, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	submission_model "up-it-aps-api/app/models/submission"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SubmissionHandler struct {
+	submissionService *service.SubmissionService
+}
+
+func NewSubmissionHandler(submissionService *service.SubmissionService) *SubmissionHandler {
+	return &SubmissionHandler{submissionService: submissionService}
+}
+
+// Submit runs the candidate's code for a coding question against its test cases. Hidden
+// test cases only report whether they passed.
+func (h *SubmissionHandler) Submit(c *fiber.Ctx) error {
+	log.Println("Submit")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	input := new(submission_model.InputSubmission)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(400).SendString(err.Error())
+	}
+	submission, err := h.submissionService.Submit(c.UserContext(), uint(id), c.Query("email"), turn, input)
+	if err != nil {
+		return submissionError(c, err)
+	}
+	return c.Status(201).JSON(submission)
+}
+
+// GetSubmissions lists every submission for a session turn, newest first.
+func (h *SubmissionHandler) GetSubmissions(c *fiber.Ctx) error {
+	log.Println("GetSubmissions")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).SendString("invalid session id")
+	}
+	turn, err := c.ParamsInt("turn")
+	if err != nil || turn <= 0 {
+		return c.Status(400).SendString("invalid turn number")
+	}
+	submissions, err := h.submissionService.GetSubmissions(uint(id), c.Query("email"), turn)
+	if err != nil {
+		return submissionError(c, err)
+	}
+	return c.JSON(submissions)
+}
+
+func submissionError(c *fiber.Ctx, err error) error {
+	status := 500
+	message := "failed to run submission"
+	switch {
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, service.ErrSessionTurnNotFound),
+		errors.Is(err, service.ErrQuestionNotFound):
+		status, message = 404, err.Error()
+	case errors.Is(err, service.ErrSessionNotActive), errors.Is(err, service.ErrNotCodingQuestion):
+		status, message = 409, err.Error()
+	case errors.Is(err, service.ErrInvalidSubmission):
+		status, message = 400, err.Error()
+	case errors.Is(err, service.ErrSandboxUnavailable):
+		status, message = 503, err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":   true,
+		"message": message,
+	})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	user_model "up-it-aps-api/app/models/user"
 	service "up-it-aps-api/app/services"
@@ -49,11 +50,17 @@ func (h *UserHandler) GetUserSettingsByEmail(c *fiber.Ctx) error {
 func (h *UserHandler) UpdateUserSettings(c *fiber.Ctx) error {
 	log.Println("UpdateUserSettings")
 	email := c.Query("email")
-	newUserSettings := new(user_model.UserSettings)
+	newUserSettings := new(user_model.InputUserSettings)
 	if err := c.BodyParser(newUserSettings); err != nil {
 		return c.Status(400).SendString(err.Error())
 	}
 	userSettings, err := h.userService.UpdateUserSettings(email, newUserSettings)
+	if errors.Is(err, service.ErrInvalidSettings) {
+		return c.Status(400).JSON(fiber.Map{
+			"error":   true,
+			"message": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -10,4 +10,5 @@ type ElevenLabsRequest struct {
 type ElevenLabsVoiceSettings struct {
 	Stability       float32 `json:"stability"`
 	SimilarityBoost float32 `json:"similarity_boost"`
+	Speed           float32 `json:"speed,omitempty"`
 }
@@ -1,9 +1,167 @@
 package ai_model
 
 type MessageReceived struct {
-	Message string `json:"message"`
+	Message        string `json:"message"`
+	ConversationID uint   `json:"conversation_id"`
+	// Persona picks the interviewer for a new conversation, overriding the user setting.
+	Persona string `json:"persona,omitempty"`
+	// SessionID attaches the call to an interview session that is in progress.
+	SessionID uint `json:"session_id,omitempty"`
 }
 
 type Response struct {
 	MessageRetrieved string
 }
+
+// ChatRequest is the provider-agnostic input for a single chat completion.
+type ChatRequest struct {
+	ConversationID uint
+	Model          string
+	SystemPrompt   string
+	// Temperature is left to the provider default when nil.
+	Temperature *float32
+	// MaxTokens caps the reply; zero keeps the provider default.
+	MaxTokens int
+	// JSONOutput asks providers that support it to reply with a JSON object only.
+	JSONOutput bool
+	Messages   []MessageRequest
+}
+
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatResult is what every ChatProvider returns, independent of the HTTP layer.
+type ChatResult struct {
+	Text         string     `json:"text"`
+	Provider     string     `json:"provider"`
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason"`
+	Usage        TokenUsage `json:"usage"`
+	FailedOver   []string   `json:"failed_over,omitempty"`
+}
+
+type Transcription struct {
+	Text         string   `json:"text"`
+	Provider     string   `json:"provider"`
+	AudioSeconds float64  `json:"audio_seconds,omitempty"`
+	FailedOver   []string `json:"failed_over,omitempty"`
+	// SessionTurn is the session turn the transcript was recorded as the answer to.
+	SessionTurn int `json:"session_turn,omitempty"`
+	// Segments is how many pauses apart the speech was transcribed in, when streamed.
+	Segments int `json:"segments,omitempty"`
+	// Delivery is how the speech was delivered, when the provider timed the words.
+	Delivery *Delivery `json:"delivery,omitempty"`
+	// Words are the timed words Delivery was worked out from.
+	Words []TimedWord `json:"-"`
+}
+
+// TimedWord is a transcribed word and when it was spoken, in seconds from the start of
+// the audio. Confidence is between 0 and 1, or 0 when the provider gave none.
+type TimedWord struct {
+	Word       string  `json:"word"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// How finely the words behind a Delivery were timed. Google times every word, Whisper
+// only whole segments, so pauses inside a Whisper segment cannot be seen.
+const (
+	TimingWords    = "words"
+	TimingSegments = "segments"
+)
+
+const (
+	PaceSlow   = "slow"
+	PaceSteady = "steady"
+	PaceFast   = "fast"
+)
+
+// Delivery is how an answer was spoken rather than what it said: pace, long pauses,
+// filler words, hedging phrases and the words the provider was unsure it heard.
+type Delivery struct {
+	Timing          string  `json:"timing"`
+	Words           int     `json:"words"`
+	SpeakingSeconds float64 `json:"speaking_seconds"`
+	WordsPerMinute  float64 `json:"words_per_minute"`
+	Pace            string  `json:"pace"`
+	Pauses          []Pause `json:"pauses,omitempty"`
+	// PauseSeconds is the total length of the long pauses.
+	PauseSeconds     float64       `json:"pause_seconds"`
+	Fillers          []PhraseCount `json:"fillers,omitempty"`
+	FillerCount      int           `json:"filler_count"`
+	FillersPerMinute float64       `json:"fillers_per_minute"`
+	Hedges           []PhraseCount `json:"hedges,omitempty"`
+	HedgeCount       int           `json:"hedge_count"`
+	// LowConfidence is only known when each word was timed; a segment's confidence
+	// says nothing about which of its words was unclear.
+	LowConfidence []TimedWord `json:"low_confidence_words,omitempty"`
+}
+
+// Pause is a long silence between two words, starting At seconds in.
+type Pause struct {
+	At      float64 `json:"at"`
+	Seconds float64 `json:"seconds"`
+	After   string  `json:"after"`
+}
+
+type PhraseCount struct {
+	Phrase string `json:"phrase"`
+	Count  int    `json:"count"`
+}
+
+// Events pushed to the client while speech is streamed for transcription.
+const (
+	TranscriptPartial = "partial"
+	TranscriptFinal   = "final"
+	TranscriptError   = "error"
+	TranscriptDone    = "transcript"
+)
+
+// TranscriptEvent is one message pushed to the client while speech is streamed. Partial
+// and final events carry the text of one segment, and the transcript event that ends
+// the stream carries the whole transcription.
+type TranscriptEvent struct {
+	Type          string         `json:"type"`
+	Segment       int            `json:"segment,omitempty"`
+	Text          string         `json:"text,omitempty"`
+	AudioSeconds  float64        `json:"audio_seconds,omitempty"`
+	Message       string         `json:"message,omitempty"`
+	Transcription *Transcription `json:"transcription,omitempty"`
+}
+
+// VoiceOptions is how a SpeechSynthesizer should speak, independent of the provider.
+// SpeakingRate is a multiple of normal speed and Pitch is in semitones; each provider
+// maps them onto its own range. An empty VoiceID or Format uses the provider default.
+type VoiceOptions struct {
+	VoiceID      string
+	SpeakingRate float64
+	Pitch        float64
+	Format       string
+}
+
+// Voice is one voice a TTS provider offers. Accent is a BCP 47 tag such as en-AU.
+type Voice struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Accent string `json:"accent"`
+	Gender string `json:"gender"`
+}
+
+// VoiceCatalog describes the voices and output formats behind one TTS model.
+// CustomVoices is set when the provider also accepts voice IDs that are not listed,
+// such as cloned voices.
+type VoiceCatalog struct {
+	Model        string   `json:"model"`
+	Provider     string   `json:"provider"`
+	DefaultVoice string   `json:"default_voice"`
+	Formats      []string `json:"formats"`
+	Pitch        bool     `json:"pitch"`
+	CustomVoices bool     `json:"custom_voices"`
+	// MaxChunkChars is the most text the provider takes in one request.
+	MaxChunkChars int     `json:"max_chunk_chars"`
+	Voices        []Voice `json:"voices"`
+}
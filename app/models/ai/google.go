@@ -1,17 +1,19 @@
 package ai_model
 
 type GoogleGenerationConfig struct {
-	Temperature     float32  `json:"temperature"`
-	TopP            float32  `json:"topP"`
-	TopK            int64    `json:"topK"`
-	MaxOutputTokens int64    `json:"maxOutputTokens"`
-	StopSequences   []string `json:"stopSequences"`
+	Temperature      float32  `json:"temperature"`
+	TopP             float32  `json:"topP"`
+	TopK             int64    `json:"topK"`
+	MaxOutputTokens  int64    `json:"maxOutputTokens"`
+	StopSequences    []string `json:"stopSequences"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
 }
 
 type GoogleRequest struct {
-	Contents         []GoogleRequestContent `json:"contents"`
-	SafetySettings   []GoogleRequestSafety  `json:"safetySettings"`
-	GenerationConfig GoogleGenerationConfig `json:"generationConfig"`
+	SystemInstruction *GoogleRequestContent  `json:"systemInstruction,omitempty"`
+	Contents          []GoogleRequestContent `json:"contents"`
+	SafetySettings    []GoogleRequestSafety  `json:"safetySettings"`
+	GenerationConfig  GoogleGenerationConfig `json:"generationConfig"`
 }
 
 type GoogleRequestSafety struct {
@@ -24,6 +26,7 @@ type GoogleField struct {
 }
 
 type GoogleRequestContent struct {
+	Role  string              `json:"role,omitempty"`
 	Parts []GoogleRequestPart `json:"parts"`
 }
 type GoogleRequestPart struct {
@@ -39,11 +42,19 @@ type GoogleResponseError struct {
 }
 
 type GoogleResponseCandidate struct {
-	Content GoogleRequestContent `json:"content"`
+	Content      GoogleRequestContent `json:"content"`
+	FinishReason string               `json:"finishReason"`
+}
+
+type GoogleUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
 }
 
 type GoogleResponse struct {
-	Candidates []GoogleResponseCandidate `json:"candidates"`
+	Candidates    []GoogleResponseCandidate `json:"candidates"`
+	UsageMetadata GoogleUsageMetadata       `json:"usageMetadata"`
 }
 
 type GoogleVertexAiAudioRequestInput struct {
@@ -57,6 +68,7 @@ type GoogleVertexAiAudioRequestVoice struct {
 type GoogleVertexAiAudioRequestAudioConfig struct {
 	AudioEncoding string  `json:"audioEncoding"`
 	SpeakingRate  float32 `json:"speakingRate"`
+	Pitch         float32 `json:"pitch"`
 }
 type GoogleVertexAiRequest struct {
 	Input       GoogleVertexAiAudioRequestInput       `json:"input"`
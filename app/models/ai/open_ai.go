@@ -1,59 +1,71 @@
 package ai_model
 
-import "time"
-
 type OpenAiTtsRequest struct {
 	Model string `json:"model"`
 	Input string `json:"input"`
 	Voice string `json:"voice"`
+	// ResponseFormat and Speed are left to the provider default when empty.
+	ResponseFormat string  `json:"response_format,omitempty"`
+	Speed          float32 `json:"speed,omitempty"`
 }
 
-type OpenAiThread struct {
-	Messages []MessageRequest `json:"messages"`
+type OpenAiTranscriptionResponse struct {
+	Text     string                       `json:"text"`
+	Language string                       `json:"language"`
+	Duration float64                      `json:"duration"`
+	Segments []OpenAiTranscriptionSegment `json:"segments"`
 }
 
-type OpenAiThreadRequest struct {
-	AssistantID string       `json:"assistant_id"`
-	Thread      OpenAiThread `json:"thread"`
+// OpenAiTranscriptionSegment is a phrase of a verbose_json transcription. AvgLogprob is
+// the mean log probability of its tokens.
+type OpenAiTranscriptionSegment struct {
+	ID           int     `json:"id"`
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Text         string  `json:"text"`
+	AvgLogprob   float64 `json:"avg_logprob"`
+	NoSpeechProb float64 `json:"no_speech_prob"`
 }
 
 type OpenAiThreadResponse struct {
-	Id       string `json:"id"`
-	ThreadId string `json:"thread_id"`
+	ID string `json:"id"`
+}
+
+type OpenAiThreadMessageRequest struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
 
-type OpenAiThreadRunStepResponse struct {
-	Object  string       `json:"object"`
-	Data    []OpenAiStep `json:"data"`
-	FirstId string       `json:"first_id"`
-	LastId  string       `json:"last_id"`
-	HasMore bool         `json:"has_more"`
+type OpenAiRunRequest struct {
+	AssistantID string   `json:"assistant_id"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	// AdditionalInstructions are appended to the assistant's own instructions for one run.
+	AdditionalInstructions string `json:"additional_instructions,omitempty"`
 }
 
-type OpenAiStep struct {
+type OpenAiRun struct {
 	ID          string            `json:"id"`
-	Object      string            `json:"object"`
-	CreatedAt   int64             `json:"created_at"`
-	RunID       string            `json:"run_id"`
-	AssistantID string            `json:"assistant_id"`
 	ThreadID    string            `json:"thread_id"`
-	Type        string            `json:"type"`
+	AssistantID string            `json:"assistant_id"`
 	Status      string            `json:"status"`
-	CancelledAt *time.Time        `json:"cancelled_at"`
-	CompletedAt int64             `json:"completed_at"`
-	ExpiresAt   *time.Time        `json:"expires_at"`
-	FailedAt    *time.Time        `json:"failed_at"`
-	LastError   *string           `json:"last_error"`
-	StepDetails OpenAiStepDetails `json:"step_details"`
+	LastError   *OpenAiRunError   `json:"last_error"`
+	Incomplete  *OpenAiIncomplete `json:"incomplete_details"`
+	Usage       *OpenAiUsage      `json:"usage"`
+}
+
+type OpenAiRunError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
-type OpenAiStepDetails struct {
-	Type            string                `json:"type"`
-	MessageCreation OpenAiMessageCreation `json:"message_creation"`
+type OpenAiIncomplete struct {
+	Reason string `json:"reason"`
 }
 
-type OpenAiMessageCreation struct {
-	MessageID string `json:"message_id"`
+type OpenAiThreadMessageList struct {
+	Object  string                        `json:"object"`
+	Data    []OpenAiThreadMessageResponse `json:"data"`
+	HasMore bool                          `json:"has_more"`
 }
 
 type OpenAiThreadMessageResponse struct {
@@ -63,7 +75,6 @@ type OpenAiThreadMessageResponse struct {
 	ThreadID    string              `json:"thread_id"`
 	Role        string              `json:"role"`
 	Content     []OpenAiContentItem `json:"content"`
-	FileIDs     []string            `json:"file_ids"`
 	AssistantID string              `json:"assistant_id"`
 	RunID       string              `json:"run_id"`
 	Metadata    OpenAiMetadata      `json:"metadata"`
@@ -93,8 +104,34 @@ type MessageRequest struct {
 }
 
 type OpenAiRequest struct {
-	Model    string           `json:"model"`
-	Messages []MessageRequest `json:"messages"`
+	Model          string                `json:"model"`
+	Messages       []MessageRequest      `json:"messages"`
+	Temperature    *float32              `json:"temperature,omitempty"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	ResponseFormat *OpenAiResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *OpenAiStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type OpenAiResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type OpenAiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAiChatStreamChunk struct {
+	ID      string               `json:"id"`
+	Model   string               `json:"model"`
+	Choices []OpenAiStreamChoice `json:"choices"`
+	Usage   *OpenAiUsage         `json:"usage"`
+}
+
+type OpenAiStreamChoice struct {
+	Index        int             `json:"index"`
+	Delta        MessageResponse `json:"delta"`
+	FinishReason *string         `json:"finish_reason"`
 }
 
 type OpenAiChatResponse struct {
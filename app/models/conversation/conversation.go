@@ -0,0 +1,28 @@
+package conversation_model
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Conversation struct {
+	gorm.Model
+	Email             string                `json:"email" gorm:"index"`
+	LlmModel          string                `json:"llm_model"`
+	PersonaID         uint                  `json:"persona_id"`
+	AssistantThreadID string                `json:"-"`
+	Messages          []ConversationMessage `json:"messages,omitempty"`
+}
+
+type ConversationMessage struct {
+	gorm.Model
+	ConversationID uint   `json:"conversation_id" gorm:"index"`
+	Role           string `json:"role"`
+	Content        string `json:"content" gorm:"type:text"`
+	// PersonaVersion is the persona version that produced an assistant message.
+	PersonaVersion uint `json:"persona_version,omitempty"`
+}
@@ -0,0 +1,75 @@
+package persona_model
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StyleTutor          = "tutor"
+	StylePanel          = "panel"
+	StyleTechnical      = "technical"
+	StyleBehavioural    = "behavioural"
+	StyleConversational = "conversational"
+)
+
+// Persona is an interviewer the candidate practises against. Every change to the fields
+// that shape a reply bumps Version and stores a PersonaVersion snapshot.
+type Persona struct {
+	gorm.Model
+	Slug           string  `json:"slug" gorm:"uniqueIndex;size:64"`
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	SystemPrompt   string  `json:"system_prompt" gorm:"type:text"`
+	WordLimit      int     `json:"word_limit"`
+	Temperature    float32 `json:"temperature"`
+	PreferredVoice string  `json:"preferred_voice"`
+	InterviewStyle string  `json:"interview_style"`
+	Version        uint    `json:"version" gorm:"default:1"`
+}
+
+// PersonaVersion is an immutable copy of a persona as it was at one version.
+type PersonaVersion struct {
+	gorm.Model
+	PersonaID      uint    `json:"persona_id" gorm:"uniqueIndex:idx_persona_version"`
+	Version        uint    `json:"version" gorm:"uniqueIndex:idx_persona_version"`
+	SystemPrompt   string  `json:"system_prompt" gorm:"type:text"`
+	WordLimit      int     `json:"word_limit"`
+	Temperature    float32 `json:"temperature"`
+	PreferredVoice string  `json:"preferred_voice"`
+	InterviewStyle string  `json:"interview_style"`
+}
+
+// InputPersona is the admin payload for creating or updating a persona.
+type InputPersona struct {
+	Slug           string  `json:"slug"`
+	Name           string  `json:"name"`
+	Description    string  `json:"description"`
+	SystemPrompt   string  `json:"system_prompt"`
+	WordLimit      int     `json:"word_limit"`
+	Temperature    float32 `json:"temperature"`
+	PreferredVoice string  `json:"preferred_voice"`
+	InterviewStyle string  `json:"interview_style"`
+}
+
+// Prompt is the system prompt sent to the model, with the word limit appended.
+func (p Persona) Prompt() string {
+	if p.WordLimit <= 0 {
+		return p.SystemPrompt
+	}
+	return fmt.Sprintf("%s Never respond with more than %d words.", p.SystemPrompt, p.WordLimit)
+}
+
+// Snapshot copies the versioned fields into a PersonaVersion.
+func (p Persona) Snapshot() PersonaVersion {
+	return PersonaVersion{
+		PersonaID:      p.ID,
+		Version:        p.Version,
+		SystemPrompt:   p.SystemPrompt,
+		WordLimit:      p.WordLimit,
+		Temperature:    p.Temperature,
+		PreferredVoice: p.PreferredVoice,
+		InterviewStyle: p.InterviewStyle,
+	}
+}
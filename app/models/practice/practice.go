@@ -0,0 +1,41 @@
+package practice_model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	KindQuestion   = "question"
+	KindCompetency = "competency"
+)
+
+// ReviewItem is the SM-2 practice schedule of one bank question or one competency for
+// a user. It is rebuilt from the user's scored answers whenever a new score arrives:
+// each answer to the question, or each session's answers in the competency, counts as a
+// review. Competency items have no QuestionID; question items keep the question's
+// competency for reference.
+type ReviewItem struct {
+	gorm.Model
+	Email      string `json:"email" gorm:"uniqueIndex:idx_review;size:191"`
+	Kind       string `json:"kind" gorm:"uniqueIndex:idx_review;size:16"`
+	QuestionID uint   `json:"question_id,omitempty" gorm:"uniqueIndex:idx_review"`
+	Competency string `json:"competency" gorm:"uniqueIndex:idx_review;size:191"`
+	// EaseFactor grows the interval after each good review; poor reviews lower it.
+	EaseFactor float64 `json:"ease_factor"`
+	// IntervalDays is the gap between the last review and the next.
+	IntervalDays int `json:"interval_days"`
+	// Repetitions counts the good reviews since the last poor one, which restarts it.
+	Repetitions    int        `json:"repetitions"`
+	Lapses         int        `json:"lapses"`
+	Reviews        int        `json:"reviews"`
+	LastQuality    int        `json:"last_quality"`
+	LastScore      float64    `json:"last_score"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	DueAt          time.Time  `json:"due_at" gorm:"index"`
+	// Prompt is the question's prompt, filled in for question items in the due queue.
+	Prompt string `json:"prompt,omitempty" gorm:"-"`
+	// OverdueDays is how long ago the item fell due, in the due queue.
+	OverdueDays float64 `json:"overdue_days,omitempty" gorm:"-"`
+}
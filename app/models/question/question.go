@@ -0,0 +1,119 @@
+package question_model
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	MinDifficulty = 1
+	MaxDifficulty = 5
+)
+
+// A coding question is answered with a program, which is run against its test cases.
+const (
+	TypeOpen   = "open"
+	TypeCoding = "coding"
+)
+
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+// Question is a curated interview question. Tags are stored as a JSON array so they can
+// be filtered on without a join table.
+type Question struct {
+	gorm.Model
+	Type           string   `json:"type" gorm:"index;size:32;default:open"`
+	Prompt         string   `json:"prompt" gorm:"type:text"`
+	Tags           []string `json:"tags" gorm:"serializer:json;type:text"`
+	Competency     string   `json:"competency" gorm:"index;size:128"`
+	Difficulty     int      `json:"difficulty" gorm:"index"`
+	RoleFamily     string   `json:"role_family" gorm:"index;size:128"`
+	ExpectedAnswer string   `json:"expected_answer" gorm:"type:text"`
+	Source         string   `json:"source"`
+	// TestCases check the solutions to a coding question.
+	TestCases []TestCase `json:"test_cases,omitempty" gorm:"serializer:json;type:text"`
+}
+
+// TestCase is one input for a solution to read from stdin and the output it must print.
+// Hidden test cases are not shown to candidates, and neither is the output of a
+// solution on them.
+type TestCase struct {
+	Input          string `json:"input" yaml:"input"`
+	ExpectedOutput string `json:"expected_output" yaml:"expected_output"`
+	Hidden         bool   `json:"hidden" yaml:"hidden"`
+}
+
+// InputQuestion is the payload for creating or updating a question, and the record
+// format of bulk import and export.
+type InputQuestion struct {
+	Type           string     `json:"type" yaml:"type"`
+	Prompt         string     `json:"prompt" yaml:"prompt"`
+	Tags           []string   `json:"tags" yaml:"tags"`
+	Competency     string     `json:"competency" yaml:"competency"`
+	Difficulty     int        `json:"difficulty" yaml:"difficulty"`
+	RoleFamily     string     `json:"role_family" yaml:"role_family"`
+	ExpectedAnswer string     `json:"expected_answer" yaml:"expected_answer"`
+	Source         string     `json:"source" yaml:"source"`
+	TestCases      []TestCase `json:"test_cases,omitempty" yaml:"test_cases,omitempty"`
+}
+
+// QuestionFilter selects questions. Empty fields match everything; a question must carry
+// every listed tag.
+type QuestionFilter struct {
+	Tags          []string `json:"tags"`
+	Competency    string   `json:"competency"`
+	RoleFamily    string   `json:"role_family"`
+	Source        string   `json:"source"`
+	Type          string   `json:"type"`
+	MinDifficulty int      `json:"min_difficulty"`
+	MaxDifficulty int      `json:"max_difficulty"`
+}
+
+// ImportReport says what a bulk import did with each record. Rows count from 1 and, for
+// CSV, do not include the header.
+type ImportReport struct {
+	Format   string        `json:"format"`
+	DryRun   bool          `json:"dry_run"`
+	Total    int           `json:"total"`
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Errors   []ImportError `json:"errors"`
+}
+
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Input converts a stored question back into its import format.
+func (q Question) Input() InputQuestion {
+	return InputQuestion{
+		Type:           q.Type,
+		Prompt:         q.Prompt,
+		Tags:           q.Tags,
+		Competency:     q.Competency,
+		Difficulty:     q.Difficulty,
+		RoleFamily:     q.RoleFamily,
+		ExpectedAnswer: q.ExpectedAnswer,
+		Source:         q.Source,
+		TestCases:      q.TestCases,
+	}
+}
+
+// WithoutHiddenTests is the question as candidates may see it.
+func (q Question) WithoutHiddenTests() Question {
+	visible := []TestCase{}
+	for _, test := range q.TestCases {
+		if !test.Hidden {
+			visible = append(visible, test)
+		}
+	}
+	if len(q.TestCases) > 0 {
+		q.TestCases = visible
+	}
+	return q
+}
@@ -0,0 +1,83 @@
+package report_model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+	FormatPDF      = "pdf"
+)
+
+// Formats are the formats every ready report can be downloaded in.
+var Formats = []string{FormatMarkdown, FormatHTML, FormatPDF}
+
+// SessionReport is the end-of-interview report of a session, rendered once in every
+// format when it is generated. Generating it again replaces the content.
+type SessionReport struct {
+	gorm.Model
+	SessionID   uint       `json:"session_id" gorm:"uniqueIndex"`
+	Email       string     `json:"email" gorm:"index"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	GeneratedAt *time.Time `json:"generated_at"`
+	Markdown    string     `json:"-" gorm:"type:longtext"`
+	HTML        string     `json:"-" gorm:"type:longtext"`
+	PDF         []byte     `json:"-" gorm:"type:longblob"`
+}
+
+// ReportData is what the report templates are rendered from.
+type ReportData struct {
+	SessionID  uint
+	Type       string
+	TargetRole string
+	Persona    string
+	StartedAt  *time.Time
+	EndedAt    *time.Time
+	Minutes    int
+	// TimeLimits describes the budgets of a timed session, and is empty otherwise.
+	TimeLimits   string
+	Overall      *float64
+	Answers      []ReportAnswer
+	Competencies []ReportCompetency
+	Strengths    []ReportPoint
+	Improvements []ReportPoint
+	NextPractice []string
+}
+
+// ReportAnswer is one answered question. Score and Summary come from the turn's latest
+// judgement, Flags from its STAR analysis; both are empty if the turn was not assessed.
+type ReportAnswer struct {
+	Number     int
+	Question   string
+	Answer     string
+	Competency string
+	Score      *float64
+	Summary    string
+	Flags      []string
+	// Timing is how long the answer took against its time limit, if it had one.
+	Timing string
+}
+
+// ReportCompetency is the mean score of one rubric criterion over the answers it was
+// scored on, as a percentage.
+type ReportCompetency struct {
+	Key     string
+	Name    string
+	Score   float64
+	Answers int
+}
+
+type ReportPoint struct {
+	Title  string
+	Detail string
+}
@@ -0,0 +1,87 @@
+package scoring_model
+
+import (
+	"gorm.io/gorm"
+)
+
+// Rubric is what a judge model scores an answer against. Criteria are stored as JSON
+// because they are always read and written as a whole.
+type Rubric struct {
+	gorm.Model
+	Slug        string      `json:"slug" gorm:"uniqueIndex;size:64"`
+	Name        string      `json:"name"`
+	SessionType string      `json:"session_type" gorm:"index;size:32"`
+	Criteria    []Criterion `json:"criteria" gorm:"serializer:json;type:text"`
+}
+
+// Criterion is one scored dimension. Weights are relative to the other criteria of the
+// rubric; Levels describe what each score means, lowest first.
+type Criterion struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+	Levels      []Level `json:"levels"`
+}
+
+type Level struct {
+	Score      int    `json:"score"`
+	Descriptor string `json:"descriptor"`
+}
+
+// InputRubric is the admin payload for creating or updating a rubric.
+type InputRubric struct {
+	Slug        string      `json:"slug"`
+	Name        string      `json:"name"`
+	SessionType string      `json:"session_type"`
+	Criteria    []Criterion `json:"criteria"`
+}
+
+// TurnScore is one judgement of a session turn. Re-scoring a turn adds a new TurnScore,
+// so earlier judgements are kept.
+type TurnScore struct {
+	gorm.Model
+	SessionID  uint   `json:"session_id" gorm:"index:idx_turn_score"`
+	TurnNumber int    `json:"turn_number" gorm:"index:idx_turn_score"`
+	TurnID     uint   `json:"turn_id"`
+	RubricID   uint   `json:"rubric_id"`
+	RubricSlug string `json:"rubric"`
+	Provider   string `json:"provider"`
+	JudgeModel string `json:"judge_model"`
+	Attempts   int    `json:"attempts"`
+	// Overall is the weighted score as a percentage of the maximum.
+	Overall  float64          `json:"overall"`
+	Summary  string           `json:"summary" gorm:"type:text"`
+	Criteria []CriterionScore `json:"criteria" gorm:"foreignKey:TurnScoreID"`
+}
+
+type CriterionScore struct {
+	gorm.Model
+	TurnScoreID   uint    `json:"turn_score_id" gorm:"index"`
+	Criterion     string  `json:"criterion"`
+	Score         int     `json:"score"`
+	MaxScore      int     `json:"max_score"`
+	Weight        float64 `json:"weight"`
+	Justification string  `json:"justification" gorm:"type:text"`
+}
+
+// MaxScore is the highest level of the criterion.
+func (c Criterion) MaxScore() int {
+	max := 0
+	for i, level := range c.Levels {
+		if i == 0 || level.Score > max {
+			max = level.Score
+		}
+	}
+	return max
+}
+
+// HasLevel reports whether score is the score of one of the criterion's levels.
+func (c Criterion) HasLevel(score int) bool {
+	for _, level := range c.Levels {
+		if level.Score == score {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package session_model
+
+import (
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	question_model "up-it-aps-api/app/models/question"
+	skill_model "up-it-aps-api/app/models/skill"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TypeBehavioral   = "behavioral"
+	TypeTechnical    = "technical"
+	TypeSystemDesign = "system_design"
+)
+
+const (
+	StatusScheduled  = "scheduled"
+	StatusInProgress = "in_progress"
+	StatusPaused     = "paused"
+	StatusCompleted  = "completed"
+	StatusAbandoned  = "abandoned"
+)
+
+// TimeUp is what happens when a timed turn or session runs out of time. Advance closes
+// the turn and asks the next planned question or follow-up straight away, Close closes
+// the turn and leaves moving on to the interviewer, and Overtime lets the candidate
+// carry on and records how far over they went. Running out of total time ends the
+// session unless it allows overtime.
+const (
+	TimeUpAdvance  = "advance"
+	TimeUpClose    = "close"
+	TimeUpOvertime = "overtime"
+)
+
+// InterviewSession is one mock interview. Chat, audio and transcription calls that name
+// the session are attached to it, and every question the interviewer asks becomes a
+// SessionTurn.
+type InterviewSession struct {
+	gorm.Model
+	Email          string     `json:"email" gorm:"index"`
+	Type           string     `json:"type"`
+	TargetRole     string     `json:"target_role"`
+	PersonaID      uint       `json:"persona_id"`
+	Persona        string     `json:"persona"`
+	Status         string     `json:"status" gorm:"index"`
+	ConversationID uint       `json:"conversation_id"`
+	ScheduledAt    *time.Time `json:"scheduled_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	PausedAt       *time.Time `json:"paused_at"`
+	EndedAt        *time.Time `json:"ended_at"`
+	// PausedSeconds is the time spent paused, so it can be left out of durations.
+	PausedSeconds float64 `json:"paused_seconds"`
+	// QuestionIDs are the question bank entries the interviewer asks, in order.
+	QuestionIDs []uint `json:"question_ids,omitempty" gorm:"serializer:json;type:text"`
+	// Adaptive sessions pick each of their QuestionCount questions from QuestionFilter
+	// just before it is asked, from the candidate's skill estimates at the time.
+	// Selections explains each pick.
+	Adaptive       bool                           `json:"adaptive"`
+	QuestionCount  int                            `json:"question_count,omitempty"`
+	QuestionFilter *question_model.QuestionFilter `json:"question_filter,omitempty" gorm:"serializer:json;type:text"`
+	Selections     []skill_model.Selection        `json:"selections,omitempty" gorm:"serializer:json;type:text"`
+	// Practice sessions ask the questions that were due in the candidate's practice queue.
+	Practice bool `json:"practice,omitempty"`
+	// MaxFollowUps is how many follow-ups the interviewer may ask about each question.
+	MaxFollowUps int `json:"max_follow_ups"`
+	// Timed sessions give each turn QuestionSeconds and the whole interview TotalSeconds,
+	// not counting pauses; 0 leaves either untimed. The candidate is warned when
+	// WarningSeconds are left.
+	QuestionSeconds int           `json:"question_seconds,omitempty"`
+	TotalSeconds    int           `json:"total_seconds,omitempty"`
+	WarningSeconds  []int         `json:"warning_seconds,omitempty" gorm:"serializer:json;type:text"`
+	TimeUp          string        `json:"time_up,omitempty" gorm:"size:16"`
+	Turns           []SessionTurn `json:"turns,omitempty" gorm:"foreignKey:SessionID"`
+}
+
+// SessionTurn is one interviewer question and the candidate's answer to it. Number
+// counts from 1 within the session.
+type SessionTurn struct {
+	gorm.Model
+	SessionID  uint       `json:"session_id" gorm:"uniqueIndex:idx_session_turn"`
+	Number     int        `json:"number" gorm:"uniqueIndex:idx_session_turn"`
+	QuestionID uint       `json:"question_id,omitempty"`
+	Question   string     `json:"question" gorm:"type:text"`
+	Answer     string     `json:"answer" gorm:"type:text"`
+	AskedAt    time.Time  `json:"asked_at"`
+	AnsweredAt *time.Time `json:"answered_at"`
+	// FollowUpOf is the number of the turn whose question this turn probes further, or
+	// 0 when the turn asks a new question.
+	FollowUpOf int `json:"follow_up_of,omitempty"`
+	// FollowUps are the probing questions generated for this turn's question, asked in
+	// order before the interview moves on.
+	FollowUps []FollowUp `json:"follow_ups,omitempty" gorm:"serializer:json;type:text"`
+	// Delivery is how a spoken answer was delivered: pace, pauses, fillers and hedges.
+	Delivery *ai_model.Delivery `json:"delivery,omitempty" gorm:"serializer:json;type:text"`
+	// Star is the latest STAR breakdown of the answer, if it has been analysed.
+	Star *StarAnalysis `json:"star,omitempty" gorm:"foreignKey:TurnID"`
+	// LimitSeconds is the turn's time budget in a timed session. PausedSecondsAsked is
+	// the session's paused time when the turn was asked, so later pauses can be left out
+	// of its duration. Once the turn is answered or closed, DurationSeconds is how long it
+	// took and OvertimeSeconds how far over the budget that was. TimedOut is set when the
+	// server closed the turn because its time or the session's ran out.
+	LimitSeconds       int     `json:"limit_seconds,omitempty"`
+	PausedSecondsAsked float64 `json:"-"`
+	DurationSeconds    float64 `json:"duration_seconds,omitempty"`
+	OvertimeSeconds    float64 `json:"overtime_seconds,omitempty"`
+	TimedOut           bool    `json:"timed_out,omitempty"`
+	// SkillObserved is set by the first score of the answer, which alone updates the
+	// candidate's skill estimate.
+	SkillObserved bool `json:"-"`
+}
+
+const (
+	StarSituation = "situation"
+	StarTask      = "task"
+	StarAction    = "action"
+	StarResult    = "result"
+)
+
+// StarParts are the STAR components in the order an answer should cover them.
+var StarParts = []string{StarSituation, StarTask, StarAction, StarResult}
+
+const (
+	StarIssueMissing = "missing"
+	StarIssueWeak    = "weak"
+)
+
+// StarAnalysis splits a behavioural answer into Situation, Task, Action and Result and
+// records what is missing or weak. Analysing a turn again replaces its analysis.
+type StarAnalysis struct {
+	gorm.Model
+	TurnID     uint            `json:"turn_id" gorm:"uniqueIndex"`
+	SessionID  uint            `json:"session_id" gorm:"index"`
+	TurnNumber int             `json:"turn_number"`
+	Provider   string          `json:"provider"`
+	JudgeModel string          `json:"judge_model"`
+	Components []StarComponent `json:"components" gorm:"serializer:json;type:text"`
+	Flags      []StarFlag      `json:"flags" gorm:"serializer:json;type:text"`
+	Tips       []string        `json:"tips" gorm:"serializer:json;type:text"`
+	// Complete is true when every component is present, even if some are weak.
+	Complete bool `json:"complete"`
+}
+
+// StarComponent is the part of the answer quoted for one STAR component. Text is empty
+// when the answer does not cover it.
+type StarComponent struct {
+	Part  string `json:"part"`
+	Text  string `json:"text"`
+	Words int    `json:"words"`
+}
+
+type StarFlag struct {
+	Part    string `json:"part"`
+	Issue   string `json:"issue"`
+	Message string `json:"message"`
+}
+
+// FollowUp is a probing question aimed at one gap in the candidate's answers to a
+// question: a rubric criterion that fell short or a STAR component. Turn is the turn
+// that asked it, 0 while it is waiting.
+type FollowUp struct {
+	Question string `json:"question"`
+	Gap      string `json:"gap"`
+	Turn     int    `json:"turn,omitempty"`
+}
+
+// Asked reports whether the interviewer has put the follow-up to the candidate.
+func (f FollowUp) Asked() bool {
+	return f.Turn != 0
+}
+
+// InputSession is the payload for starting or scheduling a session. When Questions is
+// set, QuestionCount questions are drawn from the matching bank entries, at random or,
+// for an Adaptive session, to suit the candidate's skill. MaxFollowUps overrides the
+// user's setting for the session. QuestionSeconds or TotalSeconds make it a timed
+// session.
+type InputSession struct {
+	Type            string                         `json:"type"`
+	TargetRole      string                         `json:"target_role"`
+	Persona         string                         `json:"persona"`
+	ScheduledAt     *time.Time                     `json:"scheduled_at"`
+	Questions       *question_model.QuestionFilter `json:"questions"`
+	QuestionCount   int                            `json:"question_count"`
+	Adaptive        bool                           `json:"adaptive"`
+	MaxFollowUps    *int                           `json:"max_follow_ups"`
+	QuestionSeconds int                            `json:"question_seconds"`
+	TotalSeconds    int                            `json:"total_seconds"`
+	WarningSeconds  []int                          `json:"warning_seconds"`
+	TimeUp          string                         `json:"time_up"`
+}
+
+// Timed reports whether the session has a time budget.
+func (s InterviewSession) Timed() bool {
+	return s.QuestionSeconds > 0 || s.TotalSeconds > 0
+}
+
+// PausedSecondsAt is the time the session has spent paused as of now, including a pause
+// still going on.
+func (s InterviewSession) PausedSecondsAt(now time.Time) float64 {
+	paused := s.PausedSeconds
+	if s.PausedAt != nil && now.After(*s.PausedAt) {
+		paused += now.Sub(*s.PausedAt).Seconds()
+	}
+	return paused
+}
+
+// Timer is where a timed session stands against its budgets. Question is the countdown
+// of the turn waiting for an answer, if any.
+type Timer struct {
+	SessionID uint           `json:"session_id"`
+	Status    string         `json:"status"`
+	TimeUp    string         `json:"time_up"`
+	Question  *Countdown     `json:"question,omitempty"`
+	Session   *Countdown     `json:"session,omitempty"`
+	Warnings  []TimerWarning `json:"warnings"`
+}
+
+// Countdown is one time budget. Remaining goes negative in overtime. A turn's
+// countdown carries the question it asked.
+type Countdown struct {
+	Turn             int     `json:"turn,omitempty"`
+	Question         string  `json:"question,omitempty"`
+	LimitSeconds     int     `json:"limit_seconds"`
+	ElapsedSeconds   float64 `json:"elapsed_seconds"`
+	RemainingSeconds float64 `json:"remaining_seconds"`
+}
+
+const (
+	ScopeQuestion = "question"
+	ScopeSession  = "session"
+)
+
+// TimerWarning says a budget is down to SecondsLeft, the smallest warning threshold it
+// has reached, or has run out when SecondsLeft is 0. When the server closes a turn and
+// asks the next question itself, Question is that question.
+type TimerWarning struct {
+	Scope       string `json:"scope"`
+	Turn        int    `json:"turn,omitempty"`
+	SecondsLeft int    `json:"seconds_left"`
+	Message     string `json:"message"`
+	Question    string `json:"question,omitempty"`
+}
+
+// Active reports whether calls may still be attached to the session.
+func (s InterviewSession) Active() bool {
+	return s.Status == StatusInProgress
+}
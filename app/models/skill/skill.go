@@ -0,0 +1,36 @@
+package skill_model
+
+import (
+	"gorm.io/gorm"
+)
+
+// SkillEstimate is a candidate's skill in one competency as rated by a difficulty
+// engine. Ratings from different engines are not comparable, so each engine keeps its
+// own.
+type SkillEstimate struct {
+	gorm.Model
+	Email      string  `json:"email" gorm:"uniqueIndex:idx_skill;size:191"`
+	Engine     string  `json:"engine" gorm:"uniqueIndex:idx_skill;size:32"`
+	Competency string  `json:"competency" gorm:"uniqueIndex:idx_skill;size:191"`
+	Rating     float64 `json:"rating"`
+	// Observations is how many scored answers the rating is based on.
+	Observations int `json:"observations"`
+	// Difficulty is the question difficulty that currently keeps the candidate in their
+	// stretch zone.
+	Difficulty float64 `json:"difficulty" gorm:"-"`
+}
+
+// Selection is the question a difficulty engine picked and why.
+type Selection struct {
+	QuestionID       uint    `json:"question_id"`
+	Prompt           string  `json:"prompt"`
+	Competency       string  `json:"competency"`
+	Difficulty       int     `json:"difficulty"`
+	TargetDifficulty float64 `json:"target_difficulty"`
+	Rating           float64 `json:"rating"`
+	Observations     int     `json:"observations"`
+	// ExpectedScore is the engine's predicted score on the question, from 0 to 1.
+	ExpectedScore float64 `json:"expected_score"`
+	Engine        string  `json:"engine"`
+	Rationale     string  `json:"rationale"`
+}
@@ -0,0 +1,56 @@
+package submission_model
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	StatusAccepted     = "accepted"
+	StatusFailed       = "failed"
+	StatusCompileError = "compile_error"
+)
+
+const (
+	TestPassed       = "passed"
+	TestFailed       = "failed"
+	TestTimeout      = "timeout"
+	TestRuntimeError = "runtime_error"
+)
+
+// CodeSubmission is a program a candidate submitted for a coding question and how it
+// did on the question's test cases. A turn may have several; the latest is the one the
+// judge sees.
+type CodeSubmission struct {
+	gorm.Model
+	SessionID     uint         `json:"session_id" gorm:"index"`
+	TurnID        uint         `json:"turn_id" gorm:"index"`
+	TurnNumber    int          `json:"turn_number"`
+	QuestionID    uint         `json:"question_id"`
+	Language      string       `json:"language" gorm:"size:32"`
+	Code          string       `json:"code" gorm:"type:text"`
+	Status        string       `json:"status" gorm:"size:32"`
+	CompileOutput string       `json:"compile_output,omitempty" gorm:"type:text"`
+	Passed        int          `json:"passed"`
+	Total         int          `json:"total"`
+	Results       []TestResult `json:"results" gorm:"serializer:json;type:text"`
+}
+
+// TestResult is how a submission did on one test case. A hidden test case has only its
+// number and status.
+type TestResult struct {
+	Number    int    `json:"number"`
+	Hidden    bool   `json:"hidden"`
+	Status    string `json:"status"`
+	Input     string `json:"input,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"`
+	RuntimeMs int64  `json:"runtime_ms,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type InputSubmission struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
@@ -0,0 +1,50 @@
+package usage_model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	KindChat = "chat"
+	KindTts  = "tts"
+	KindStt  = "stt"
+)
+
+// UsageRecord is one call to an upstream AI provider. Failed attempts are recorded too,
+// so failover shows up as extra rows with Success false.
+type UsageRecord struct {
+	gorm.Model
+	Email            string  `json:"email" gorm:"index:idx_usage_email_created,priority:1"`
+	RequestID        string  `json:"request_id" gorm:"index"`
+	SessionID        uint    `json:"session_id,omitempty" gorm:"index"`
+	Kind             string  `json:"kind"`
+	Provider         string  `json:"provider"`
+	LlmModel         string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Characters       int     `json:"characters"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	LatencyMs        int64   `json:"latency_ms"`
+	Success          bool    `json:"success"`
+	Error            string  `json:"error,omitempty" gorm:"type:text"`
+	// CreatedAt is redeclared to share the composite index with Email.
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_usage_email_created,priority:2"`
+}
+
+// UsageSummary totals usage records per kind, provider and model.
+type UsageSummary struct {
+	Kind             string  `json:"kind"`
+	Provider         string  `json:"provider"`
+	LlmModel         string  `json:"model"`
+	Requests         int64   `json:"requests"`
+	Failures         int64   `json:"failures"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Characters       int64   `json:"characters"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
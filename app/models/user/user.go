@@ -22,6 +22,21 @@ type UserSettings struct {
 	SttModel      string `json:"stt_model" gorm:"default:whisper-1"`
 	TtsModel      string `json:"tts_model" gorm:"default:elevenlabs-multilingual-v1"`
 	AutoPlayAudio bool   `json:"auto_play_audio" gorm:"default:true"`
+	Persona       string `json:"persona" gorm:"default:swe-tutor"`
+	MaxFollowUps  int    `json:"max_follow_ups" gorm:"default:2"`
+	// TtsVoice is a voice ID of the TTS model's provider, empty for its default voice.
+	// SpeakingRate is a multiple of normal speed and Pitch a shift in semitones.
+	TtsVoice     string  `json:"tts_voice" gorm:"size:64"`
+	SpeakingRate float64 `json:"speaking_rate" gorm:"default:1"`
+	Pitch        float64 `json:"pitch" gorm:"default:0"`
+	AudioFormat  string  `json:"audio_format" gorm:"size:16;default:mp3"`
+}
+
+// InputUserSettings is the body of a settings update. MaxFollowUps is a pointer so that
+// clients which do not send it keep the stored value rather than turning follow-ups off.
+type InputUserSettings struct {
+	UserSettings
+	MaxFollowUps *int `json:"max_follow_ups"`
 }
 
 type InputUser struct {
@@ -1,19 +1,27 @@
 package service
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"os"
-	"regexp"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
 	ai_model "up-it-aps-api/app/models/ai"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	persona_model "up-it-aps-api/app/models/persona"
+	session_model "up-it-aps-api/app/models/session"
+	usage_model "up-it-aps-api/app/models/usage"
 	user_model "up-it-aps-api/app/models/user"
+	"up-it-aps-api/pkg/audiocache"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/middleware"
 
 	"github.com/form3tech-oss/jwt-go"
 	"golang.org/x/oauth2"
@@ -22,283 +30,353 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// Provider paths, relative to the base URLs in config.ProviderEndpoints.
 const (
 	ElevenLabsAmericanAccent   = "ErXwobaYiN019PkySvjV"
 	ElevenLabsAustralianAccent = "IKne3meq5aSn9XLyUdCD"
-	Role                       = "You are highly skilled software engineer for a big tech company. You're currently tutoring a candidate for a SWE (Software Engineer) role in a mock interview scenario. You are well versed in algorithms and data structures and can assist and provide feedback. Be short and concise with your responses. Never respond with more than 40 words."
-	// TODO: add APS role prompt back if needed
-	OpenAiCompletionsEndpoint     = "https://api.openai.com/v1/chat/completions"
-	OpenAiThreadsEndpoint         = "https://api.openai.com/v1/threads/runs"
-	OpenAiSingleThreadEndpoint    = "https://api.openai.com/v1/threads/%s/runs/%s/steps"
-	OpenAiVoiceGenerationEndpoint = "https://api.openai.com/v1/audio/speech"
-	OpenAiTranscriptionEndpoint   = "https://api.openai.com/v1/audio/transcriptions"
-	GooglerCustomGptId            = "asst_bzP4wf0kl1XWZcup65OZ27Gf"
-	MetaMateCustomGptId           = "asst_KeLCxkHbYlNHYKB4ccYyXQfd"
-	UnrealSpeechStreamEndpoint    = "https://api.v6.unrealspeech.com/stream"
-	ElevenLabsStreamEndpoint      = "https://api.elevenlabs.io/v1/text-to-speech/%s/stream"
-	VertexTranscriptionEndpoint   = "https://speech.googleapis.com/v1p1beta1/speech:recognize"
-	VertexTextGenerationEndpoint  = "https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s"
+	OpenAiCompletionsPath      = "/chat/completions"
+	OpenAiAssistantsBeta       = "assistants=v2"
+	OpenAiVoiceGenerationPath  = "/audio/speech"
+	OpenAiTranscriptionPath    = "/audio/transcriptions"
+	GooglerCustomGptId         = "asst_bzP4wf0kl1XWZcup65OZ27Gf"
+	MetaMateCustomGptId        = "asst_KeLCxkHbYlNHYKB4ccYyXQfd"
+	UnrealSpeechStreamPath     = "/stream"
+	ElevenLabsStreamPath       = "/text-to-speech/%s/stream"
+	VertexTextToSpeechPath     = "/text:synthesize"
+	VertexTranscriptionPath    = "/speech:recognize"
+	VertexTextGenerationPath   = "/models/%s:generateContent?key=%s"
+	VertexTextStreamPath       = "/models/%s:streamGenerateContent?alt=sse&key=%s"
 )
 
+var ErrNoCredits = errors.New("You have no more credits left")
+
 type AiService struct {
-	userService *UserService
+	userService         *UserService
+	conversationService *ConversationService
+	personaService      *PersonaService
+	sessionService      *SessionService
+	scoringService      *ScoringService
+	reportService       *ReportService
+	skillService        *SkillService
+	practiceService     *PracticeService
+	usageService        *UsageService
+	chatProviders       *ChatProviderRegistry
+	speechSynthesizers  *SpeechSynthesizerRegistry
+	audioCache          *audiocache.Cache
+	failover            config.FailoverConfig
+	ttsConcurrency      int
+	breakers            *breaker.Registry
+	endpoints           config.ProviderEndpoints
 }
 
 // NewAiService creates a new AI service instance
-func NewAiService(userService *UserService) *AiService {
-	return &AiService{
-		userService: userService,
-	}
+func NewAiService(userService *UserService, aiConfig config.AIConfig) *AiService {
+	endpoints := aiConfig.Endpoints.WithDefaults()
+	personaService := NewPersonaService()
+	questionService := NewQuestionService()
+	skillService := NewSkillService(NewEloEngine(), questionService)
+	s := &AiService{
+		userService:         userService,
+		conversationService: NewConversationService(),
+		personaService:      personaService,
+		sessionService:      NewSessionService(userService, personaService, questionService, skillService),
+		skillService:        skillService,
+		usageService:        NewUsageService(),
+		chatProviders:       NewDefaultChatProviderRegistry(endpoints, aiConfig.OpenAICompatible),
+		speechSynthesizers:  NewDefaultSpeechSynthesizerRegistry(endpoints),
+		audioCache:          newAudioCache(aiConfig.TtsCache),
+		failover:            aiConfig.Failover,
+		ttsConcurrency:      aiConfig.TtsConcurrency,
+		breakers:            newBreakerRegistry(aiConfig.Failover),
+		endpoints:           endpoints,
+	}
+	// the judge goes through CreateChatCompletion for failover and metering
+	s.practiceService = NewPracticeService(s.sessionService, questionService, skillService)
+	s.scoringService = NewScoringService(s, s.sessionService, questionService, skillService, s.practiceService, aiConfig.Judge)
+	s.reportService = NewReportService(s.sessionService, s.scoringService, questionService)
+	// sessions the server ends for running out of time get a report like any other
+	s.sessionService.OnSessionEnd(func(interview session_model.InterviewSession) {
+		if _, err := s.reportService.QueueReport(interview); err != nil {
+			log.Printf("queueing report for session %d failed: %v", interview.ID, err)
+		}
+	})
+	return s
 }
 
-func (s *AiService) AiCreateMessage(c *fiber.Ctx, ai *ai_model.MessageReceived) (err error) {
-	email := c.Query("email")
-	user := s.userService.GetUserByEmail(email)
-	if user.Credits <= 0 {
-		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
-			"message": "You have no more credits left",
-			"status":  "error",
-		})
-	}
+func (s *AiService) UserService() *UserService {
+	return s.userService
+}
 
-	if user.UserSettings.LlmModel == "chat-bison" || user.UserSettings.LlmModel == "gemini-pro" {
-		return VertexAiCreateMessage(c, ai, user.UserSettings.LlmModel, Role)
-	}
+func (s *AiService) Personas() *PersonaService {
+	return s.personaService
+}
 
-	if user.UserSettings.LlmModel == "googler" || user.UserSettings.LlmModel == "meta-mate" {
-		s.OpenAiCreateThreadForAssistant(c, ai, user.UserSettings.LlmModel)
-		return
-	}
-	return OpenAiCreateMessage(user, c, ai)
+func (s *AiService) Sessions() *SessionService {
+	return s.sessionService
 }
 
-func OpenAiCreateMessage(user user_model.User, c *fiber.Ctx, ai *ai_model.MessageReceived) (err error) {
-	apiKey := os.Getenv("OPEN_AI_API_KEY")
-	agent := fiber.Post(OpenAiCompletionsEndpoint)
-	auth := fmt.Sprint("Bearer ", apiKey)
-	agent.Set("Authorization", auth)
-	agent.Set("Content-Type", "application/json")
-
-	jsonBody := ai_model.OpenAiRequest{
-		Model: user.UserSettings.LlmModel,
-		Messages: []ai_model.MessageRequest{
-			{
-				Role:    "system",
-				Content: Role,
-			},
-			{
-				Role:    "user",
-				Content: ai.Message,
-			},
-		},
-	}
-	agent.JSON(jsonBody)
+func (s *AiService) Scoring() *ScoringService {
+	return s.scoringService
+}
 
-	statusCode, body, errs := agent.Bytes()
-	if len(errs) > 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"errs": errs,
+func (s *AiService) Reports() *ReportService {
+	return s.reportService
+}
+
+func (s *AiService) Skills() *SkillService {
+	return s.skillService
+}
+
+func (s *AiService) Practice() *PracticeService {
+	return s.practiceService
+}
+
+func (s *AiService) Usage() *UsageService {
+	return s.usageService
+}
+
+func (s *AiService) ChatProviders() *ChatProviderRegistry {
+	return s.chatProviders
+}
+
+func (s *AiService) SpeechSynthesizers() *SpeechSynthesizerRegistry {
+	return s.speechSynthesizers
+}
+
+// chatTurn is everything needed to answer one message in a conversation. session is
+// nil unless the message was sent as part of an interview session.
+type chatTurn struct {
+	conversation conversation_model.Conversation
+	persona      persona_model.Persona
+	session      *session_model.InterviewSession
+	message      string
+	request      ai_model.ChatRequest
+}
+
+func (s *AiService) AiCreateMessage(c *fiber.Ctx, ai *ai_model.MessageReceived) (err error) {
+	turn, err := s.prepareChatTurn(c.Query("email"), ai)
+	if err != nil {
+		return c.Status(chatErrorStatus(err)).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "error",
 		})
 	}
 
-	var chatGptResponse ai_model.OpenAiChatResponse
-	err = json.Unmarshal(body, &chatGptResponse)
+	ctx := WithUsageScope(c.UserContext(), c.Query("email"), middleware.GetRequestID(c))
+	ctx = WithUsageSession(ctx, turn.sessionID())
+	result, err := s.CreateChatCompletion(ctx, turn.request)
 	if err != nil {
+		return c.Status(chatErrorStatus(err)).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "error",
+		})
+	}
+
+	if err := s.saveChatTurn(turn, result.Text); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"err": err,
+			"message": err.Error(),
+			"status":  "error",
 		})
 	}
 
-	transformedData := TransformOpenAiData(chatGptResponse)
-	return c.Status(statusCode).JSON(fiber.Map{
-		"message": transformedData.MessageRetrieved,
-		"status":  "success",
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":         result.Text,
+		"conversation_id": turn.conversation.ID,
+		"session_id":      turn.sessionID(),
+		"persona":         turn.persona.Slug,
+		"persona_version": turn.persona.Version,
+		"preferred_voice": turn.persona.PreferredVoice,
+		"provider":        result.Provider,
+		"model":           result.Model,
+		"failed_over":     result.FailedOver,
+		"status":          "success",
 	})
 }
 
-func GetCustomGptAssistant(assistant string) string {
-	switch assistant {
-	/*These are custom Open AI GPTs with various helpful documentation for either of these companies,
-	only accessible via the original projects open ai api keys*/
-	case "googler":
-		return GooglerCustomGptId
-	case "meta-mate":
-		return MetaMateCustomGptId
-	default:
-		return GooglerCustomGptId
-	}
-}
-
-func (s *AiService) OpenAiCreateThreadForAssistant(c *fiber.Ctx, ai *ai_model.MessageReceived, assistant string) (err error) {
-	apiKey := os.Getenv("OPEN_AI_API_KEY")
-	agent := fiber.Post(OpenAiThreadsEndpoint)
-	auth := fmt.Sprint("Bearer ", apiKey)
-	agent.Set("Authorization", auth)
-	agent.Set("OpenAI-Beta", "assistants=v1")
-	agent.Set("Content-Type", "application/json")
-
-	jsonBody := ai_model.OpenAiThreadRequest{
-		AssistantID: GetCustomGptAssistant(assistant),
-		Thread: ai_model.OpenAiThread{Messages: []ai_model.MessageRequest{
-			{
-				Role:    "user",
-				Content: ai.Message,
-			},
-		},
-		},
+// AiStreamMessage answers like AiCreateMessage but forwards tokens to the client as
+// server-sent events: "delta" events with text fragments, then one "done" event with
+// usage and finish reason, or an "error" event if the provider fails mid-stream.
+func (s *AiService) AiStreamMessage(c *fiber.Ctx, ai *ai_model.MessageReceived) (err error) {
+	turn, err := s.prepareChatTurn(c.Query("email"), ai)
+	if err != nil {
+		return c.Status(chatErrorStatus(err)).JSON(fiber.Map{
+			"message": err.Error(),
+			"status":  "error",
+		})
 	}
-	agent.JSON(jsonBody)
 
-	_, body, _ := agent.Bytes()
+	email, requestID := c.Query("email"), middleware.GetRequestID(c)
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// the fiber context is recycled once the handler returns, so the stream gets its own
+		ctx, cancel := context.WithCancel(WithUsageSession(WithUsageScope(context.Background(), email, requestID), turn.sessionID()))
+		defer cancel()
 
-	var openAiThreadResponse ai_model.OpenAiThreadResponse
-	err = json.Unmarshal(body, &openAiThreadResponse)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": err,
+		result, err := s.StreamChatCompletion(ctx, turn.request, func(delta string) error {
+			return WriteSSE(w, "delta", fiber.Map{"text": delta})
 		})
-	}
-	if openAiThreadResponse.Id == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Thread ID is empty",
+		if err != nil {
+			_ = WriteSSE(w, "error", fiber.Map{
+				"message": err.Error(),
+				"status":  chatErrorStatus(err),
+			})
+			return
+		}
+
+		if err := s.saveChatTurn(turn, result.Text); err != nil {
+			log.Printf("Error saving streamed turn: %v", err)
+		}
+		_ = WriteSSE(w, "done", fiber.Map{
+			"conversation_id": turn.conversation.ID,
+			"session_id":      turn.sessionID(),
+			"persona":         turn.persona.Slug,
+			"persona_version": turn.persona.Version,
+			"preferred_voice": turn.persona.PreferredVoice,
+			"provider":        result.Provider,
+			"model":           result.Model,
+			"finish_reason":   result.FinishReason,
+			"usage":           result.Usage,
+			"failed_over":     result.FailedOver,
 		})
+	})
+	return nil
+}
+
+// prepareChatTurn checks credits, loads or creates the conversation and builds the
+// provider request from the conversation's persona, the history and the new message.
+func (s *AiService) prepareChatTurn(email string, ai *ai_model.MessageReceived) (*chatTurn, error) {
+	user := s.userService.GetUserByEmail(email)
+	if user.Credits <= 0 {
+		return nil, ErrNoCredits
 	}
 
-	var messageId string
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-Loop:
-	for i := 0; i < 200; i++ { //arbitrary number of times to try and get the message id
-		wg.Add(1)
-		time.Sleep(200 * time.Millisecond)
-		go func(i int) {
-			defer wg.Done()
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				singleThreadUrl := fmt.Sprintf(OpenAiSingleThreadEndpoint, openAiThreadResponse.ThreadId, openAiThreadResponse.Id)
-				singleThreadAgent := fiber.Get(singleThreadUrl)
-				singleThreadAgent.Set("Authorization", auth)
-				singleThreadAgent.Set("Content-Type", "application/json")
-				singleThreadAgent.Set("OpenAI-Beta", "assistants=v1")
-				_, singleThreadBody, _ := singleThreadAgent.Bytes()
-
-				var threadRunStepResponse ai_model.OpenAiThreadRunStepResponse
-				err = json.Unmarshal(singleThreadBody, &threadRunStepResponse)
-
-				if err != nil {
-					fmt.Println(err)
-				}
-
-				if len(threadRunStepResponse.Data) > 0 && threadRunStepResponse.Data[0].StepDetails.MessageCreation.MessageID != "" {
-					mu.Lock()
-					messageId = threadRunStepResponse.Data[0].StepDetails.MessageCreation.MessageID
-					mu.Unlock()
-					cancel()
-					return
-				}
-			}
-		}(i)
-		select {
-		case <-ctx.Done():
-			break Loop
-		default:
+	var interview *session_model.InterviewSession
+	if ai.SessionID != 0 {
+		active, err := s.sessionService.ActiveSession(ai.SessionID, email)
+		if err != nil {
+			return nil, err
 		}
+		interview = &active
 	}
-	var messageBody []byte
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		messageBody = OpenAiGetMessageFromThread(openAiThreadResponse.ThreadId, messageId)
-	}()
-	wg.Wait()
-	var stringifiedMessage = string(messageBody)
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": stringifiedMessage,
-		"status":  "success",
+
+	conversation, persona, err := s.resolveConversation(ai, email, user.UserSettings, interview)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := append(s.conversationService.History(conversation), ai_model.MessageRequest{
+		Role:    "user",
+		Content: ai.Message,
 	})
+	systemPrompt := persona.Prompt()
+	if interview != nil {
+		if err := s.sessionService.AdaptNextQuestion(interview); err != nil {
+			return nil, err
+		}
+		systemPrompt += s.sessionService.Instruction(*interview)
+	}
+	temperature := persona.Temperature
+	return &chatTurn{
+		conversation: conversation,
+		persona:      persona,
+		session:      interview,
+		message:      ai.Message,
+		request: ai_model.ChatRequest{
+			ConversationID: conversation.ID,
+			Model:          user.UserSettings.LlmModel,
+			SystemPrompt:   systemPrompt,
+			Temperature:    &temperature,
+			Messages:       messages,
+		},
+	}, nil
 }
 
-func OpenAiGetMessageFromThread(threadId string, messageId string) []byte {
-	url := fmt.Sprintf(OpenAiSingleThreadEndpoint, threadId, messageId)
-	apiKey := os.Getenv("OPEN_AI_API_KEY")
-	auth := "Bearer " + apiKey
-	agent := fiber.Get(url)
-	agent.Set("Authorization", auth)
-	agent.Set("Content-Type", "application/json")
-	agent.Set("OpenAI-Beta", "assistants=v1")
-	_, body, _ := agent.Bytes()
-
-	var openAiThreadMessageResponse ai_model.OpenAiThreadMessageResponse
-	err := json.Unmarshal(body, &openAiThreadMessageResponse)
+// resolveConversation loads the conversation the message belongs to, or starts a new one
+// when the client did not send an ID. A new conversation takes the persona from the
+// message, then from the user's settings, and keeps it for its whole life. A session has
+// exactly one conversation, started with the session's persona on its first message.
+func (s *AiService) resolveConversation(ai *ai_model.MessageReceived, email string, settings user_model.UserSettings, interview *session_model.InterviewSession) (conversation_model.Conversation, persona_model.Persona, error) {
+	conversationID := ai.ConversationID
+	if interview != nil {
+		conversationID = interview.ConversationID
+	}
+	if conversationID == 0 {
+		var persona persona_model.Persona
+		if interview != nil {
+			persona = s.personaService.ResolvePersona(interview.PersonaID, settings.Persona)
+		} else {
+			persona = s.personaService.ResolvePersona(0, ai.Persona, settings.Persona)
+		}
+		conversation, err := s.conversationService.CreateConversation(email, settings.LlmModel, persona.ID)
+		if err != nil || interview == nil {
+			return conversation, persona, err
+		}
+		interview.ConversationID = conversation.ID
+		return conversation, persona, s.sessionService.SetConversationID(interview.ID, conversation.ID)
+	}
+
+	conversation, err := s.conversationService.GetConversation(conversationID, email)
 	if err != nil {
-		fmt.Println(err)
+		return conversation_model.Conversation{}, persona_model.Persona{}, err
 	}
-	return []byte(openAiThreadMessageResponse.Content[0].Text.Value)
+	return conversation, s.personaService.ResolvePersona(conversation.PersonaID, settings.Persona), nil
 }
 
-func VertexAiCreateMessage(c *fiber.Ctx, ai *ai_model.MessageReceived, llmModel string, role string) (err error) {
-	jsonBody := ai_model.GoogleRequest{
-		Contents: []ai_model.GoogleRequestContent{
-			{
-				Parts: []ai_model.GoogleRequestPart{
-					{
-						Text: role + " " + ai.Message,
-					},
-				},
-			},
-		},
-		SafetySettings: []ai_model.GoogleRequestSafety{
-			{
-				Category:  "HARM_CATEGORY_DANGEROUS_CONTENT",
-				Threshold: "BLOCK_ONLY_HIGH",
-			},
-		},
-		GenerationConfig: ai_model.GoogleGenerationConfig{
-			Temperature:     1.0,
-			TopP:            0.8,
-			TopK:            10,
-			MaxOutputTokens: 125,
-		},
+// saveChatTurn stores the exchange in the conversation and, for a session, records the
+// message as the answer to the open question and the reply as the next question.
+func (s *AiService) saveChatTurn(turn *chatTurn, reply string) error {
+	if err := s.conversationService.AppendTurn(turn.conversation.ID, turn.persona.Version, turn.message, reply); err != nil {
+		return err
 	}
-	apiKey := os.Getenv("VERTEX_AI_API_KEY") //using the old gen ai maker method
-	url := fmt.Sprintf(VertexTextGenerationEndpoint, llmModel, apiKey)
-	agent := fiber.Post(url)
-	agent.Set("Content-Type", "application/json")
-	agent.JSON(jsonBody)
-	statusCode, body, errs := agent.Bytes()
-	if len(errs) > 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"errs": errs,
-		})
-	}
-	if statusCode == 400 {
-		return c.Status(fiber.StatusUnauthorized).JSON(body)
+	if turn.session == nil {
+		return nil
 	}
-	if statusCode == 401 {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Unauthorized",
-		})
+	return s.sessionService.RecordExchange(turn.session.ID, turn.message, reply)
+}
+
+func (t *chatTurn) sessionID() uint {
+	if t.session == nil {
+		return 0
 	}
+	return t.session.ID
+}
 
-	var googleResponse ai_model.GoogleResponse
-	err = json.Unmarshal(body, &googleResponse)
+// CreateChatCompletion runs req through the provider for req.Model, failing over along
+// the configured chat chain. The result names the model that actually answered.
+func (s *AiService) CreateChatCompletion(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	result, outcome, err := withFailover(s.breakers, s.chatCandidates(req.Model), func(model string) (*ai_model.ChatResult, error) {
+		provider, err := s.chatProviders.Resolve(model)
+		if err != nil {
+			return nil, err
+		}
+		attempt := req
+		attempt.Model = model
+		start := time.Now()
+		result, err := provider.CreateMessage(ctx, attempt)
+		s.usageService.Record(ctx, chatUsage(provider.Name(), model, result), start, err)
+		return result, err
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"err": err,
-		})
+		return nil, err
 	}
+	result.FailedOver = outcome.FailedOver
+	return result, nil
+}
 
-	transformedData := TransformGoogleData(googleResponse)
-
-	return c.Status(statusCode).JSON(fiber.Map{
-		"message": transformedData.MessageRetrieved,
-		"status":  "success",
-	})
+func GetCustomGptAssistant(assistant string) string {
+	switch assistant {
+	/*These are custom Open AI GPTs with various helpful documentation for either of these companies,
+	only accessible via the original projects open ai api keys*/
+	case "googler":
+		return GooglerCustomGptId
+	case "meta-mate":
+		return MetaMateCustomGptId
+	default:
+		return GooglerCustomGptId
+	}
 }
 
 func TransformGoogleData(responseReceived ai_model.GoogleResponse) ai_model.Response {
@@ -313,256 +391,284 @@ func TransformOpenAiData(responseReceived ai_model.OpenAiChatResponse) ai_model.
 	}
 }
 
-func (s *AiService) VertexAiGenerateAudio(message []byte) (output []byte) {
-	url := fmt.Sprintf("https://texttospeech.googleapis.com/v1/text:synthesize")
-	agent := fiber.Post(url)
-	apiKey := os.Getenv("GCLOUD_API_KEY")
-
-	agent.Set("Authorization", "Bearer "+apiKey)
-	agent.Set("Accept", "audio/mpeg")
-	agent.Set("Content-Type", "application/json; charset=utf-8")
-	agent.Set("x-goog-user-project", "up-it-aps")
-	vertexAudioRequest := ai_model.GoogleVertexAiRequest{
-		Input: ai_model.GoogleVertexAiAudioRequestInput{
-			Text: string(message),
-		},
-		Voice: ai_model.GoogleVertexAiAudioRequestVoice{
-			LanguageCode: "en-AU",
-			Name:         "en-AU-Neural2-B",
-		},
-		AudioConfig: ai_model.GoogleVertexAiAudioRequestAudioConfig{
-			AudioEncoding: "MP3",
-			SpeakingRate:  1.0,
-		},
+// GenerateAudio synthesises message with the user's TTS model and voice, failing over
+// along the configured chain when a provider errors or its breaker is open. Fallback
+// providers speak in their default voice, since voice IDs belong to one provider.
+// Audio already in the cache is served without calling the provider or charging credits.
+// Every provider is asked for AudioFormat, so the audio is in it whichever one answers.
+// New audio costs a credit, and ErrNoCredits is returned once the user has none left.
+func (s *AiService) GenerateAudio(ctx context.Context, model string, voice ai_model.VoiceOptions, message []byte, email string) ([]byte, FailoverOutcome, error) {
+	primary := ttsModelName(model)
+	voice.Format = s.AudioFormat(model, voice.Format)
+	if synthesizer, err := s.speechSynthesizers.Resolve(primary); err == nil {
+		if audio, ok := s.audioCache.Get(audioCacheKey(synthesizer, primary, voice, string(message))); ok {
+			return audio, FailoverOutcome{Model: primary}, nil
+		}
 	}
-
-	agent.JSON(vertexAudioRequest)
-	_, body, _ := agent.Bytes()
-	vertexResponse := ai_model.GoogleVertexAiAudioResponse{}
-	err := json.Unmarshal(body, &vertexResponse)
+	audio, outcome, err := withFailover(s.breakers, s.ttsCandidates(model), func(model string) ([]byte, error) {
+		options := voice
+		if model != primary {
+			options.VoiceID = ""
+		}
+		synthesizer, err := s.speechSynthesizers.Resolve(model)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		audio, err := synthesizer.Synthesize(ctx, string(message), options)
+		s.usageService.Record(ctx, usage_model.UsageRecord{
+			Kind:       usage_model.KindTts,
+			Provider:   synthesizer.Name(),
+			LlmModel:   model,
+			Characters: utf8.RuneCount(message),
+		}, start, err)
+		if err != nil {
+			return nil, err
+		}
+		s.audioCache.Put(audioCacheKey(synthesizer, model, options, string(message)), audio)
+		return audio, nil
+	})
 	if err != nil {
-		return nil
+		return nil, outcome, err
 	}
-	decodedBytes, err := base64.StdEncoding.DecodeString(vertexResponse.AudioContent)
-	if err != nil {
-		fmt.Println("Error decoding Base64 string:", err)
-		return
+	// charged outside the failover, so running out of credits is not a provider failure;
+	// Google voices have never been charged against credits
+	if outcome.Model != "vertex" {
+		if err := s.userService.DecreaseTokenUsage(email); err != nil {
+			return nil, outcome, err
+		}
 	}
-	reader := io.NopCloser(bytes.NewReader(decodedBytes))
-	byteArray, _ := io.ReadAll(reader)
-	output = byteArray
-
-	return output
+	return audio, outcome, nil
 }
 
-func (s *AiService) UnrealSpeechGenerateAudio(message []byte, email string) (output []byte) {
-	url := fmt.Sprintf(UnrealSpeechStreamEndpoint)
-	agent := fiber.Post(url)
-	apiKey := os.Getenv("UNREAL_SPEECH_API_KEY")
-
-	agent.Set("Authorization", "Bearer "+apiKey)
-	agent.Set("Accept", "audio/mpeg")
-	agent.Set("Content-Type", "application/json; charset=utf-8")
-	agent.Set("x-goog-user-project", "up-it-aps")
-	unrealSpeechAudioRequest := ai_model.UnrealSpeechRequest{
-		Text:    string(message),
-		VoiceId: "Liv",
-		Bitrate: "64k",
-		Speed:   "0",
-		Pitch:   "1",
-		Codec:   "libmp3lame",
-	}
-
-	agent.JSON(unrealSpeechAudioRequest)
-	_, body, _ := agent.Bytes()
-	s.userService.DecreaseTokenUsage(email)
-	reader := io.NopCloser(bytes.NewReader(body))
-	byteArray, _ := io.ReadAll(reader)
-	output = byteArray
-	return output
+// AudioFormat is the format audio from model comes in when asked for format: format if
+// model and every model it fails over to can produce it, and MP3 otherwise, so a
+// failover never changes the format mid-response.
+func (s *AiService) AudioFormat(model string, format string) string {
+	supported := false
+	for _, candidate := range s.ttsCandidates(model) {
+		synthesizer, err := s.speechSynthesizers.Resolve(candidate.model)
+		if err != nil {
+			continue
+		}
+		if catalogFormat(synthesizer.Catalog(), format) != format {
+			return AudioFormatMp3
+		}
+		supported = true
+	}
+	if !supported {
+		return AudioFormatMp3
+	}
+	return format
 }
 
-func (s *AiService) OpenAiGenerateAudio(message []byte, email string) (output []byte) {
-	url := fmt.Sprintf(OpenAiVoiceGenerationEndpoint)
-	agent := fiber.Post(url)
-	apiKey := os.Getenv("OPEN_AI_API_KEY")
-	agent.Set("Authorization", "Bearer "+apiKey)
-	agent.Set("Accept", "audio/mpeg")
-	agent.Set("Content-Type", "application/json")
-	messageReceived := string(message)
-
-	jsonBody := ai_model.OpenAiTtsRequest{
-		Model: "tts-1",
-		Input: messageReceived,
-		Voice: "alloy",
-	}
-	agent.JSON(jsonBody)
-	_, body, _ := agent.Bytes()
-	s.userService.DecreaseTokenUsage(email)
-	reader := io.NopCloser(bytes.NewReader(body))
-	byteArray, _ := io.ReadAll(reader)
-	output = byteArray
-	return output
+// ttsModelName maps a stored TtsModel onto a known model, anything else used OpenAI.
+func ttsModelName(model string) string {
+	switch model {
+	case "vertex", "unreal-speech", "elevenlabs-multilingual-v1":
+		return model
+	default:
+		return "tts-1"
+	}
 }
 
-func (s *AiService) ElevenLabsGenerateAudio(message []byte, email string) (output []byte) {
-	url := fmt.Sprintf(ElevenLabsStreamEndpoint, ElevenLabsAmericanAccent)
-	agent := fiber.Post(url)
-	apiKey := os.Getenv("ELEVEN_LABS_API_KEY")
-
-	agent.Set("xi-api-key", apiKey)
-	agent.Set("Accept", "audio/mpeg")
-	agent.Set("Content-Type", "application/json")
-	messageReceived := string(message)
-
-	jsonBody := ai_model.ElevenLabsRequest{
-		Text:                     messageReceived,
-		ModelID:                  "eleven_turbo_v2",
-		OptimizeStreamingLatency: 3,
-		VoiceSettings: ai_model.ElevenLabsVoiceSettings{
-			Stability:       0.95,
-			SimilarityBoost: 0.95,
-		},
+// Chunking splits a reply into the chunks it is spoken in with model, each short enough
+// for every provider model can fail over to.
+func (s *AiService) Chunking(input string, model string) (output [][]byte) {
+	options := SegmentOptions{MinChars: DefaultMinChunkChars, MaxChars: s.MaxChunkChars(model)}
+	// Unreal is faster if it's not chunked, so its chunks are as long as it takes
+	if ttsModelName(model) == "unreal-speech" {
+		options.MinChars = options.MaxChars
+	}
+	for _, segment := range SegmentSentences(input, options) {
+		output = append(output, []byte(segment))
 	}
-	agent.JSON(jsonBody)
-	_, body, _ := agent.Bytes()
-	s.userService.DecreaseTokenUsage(email)
-	reader := io.NopCloser(bytes.NewReader(body))
-	byteArray, _ := io.ReadAll(reader)
-	output = byteArray
 	return output
 }
 
-func (s *AiService) Chunking(input string) (output [][]byte) {
-	r := regexp.MustCompile(`[!?.,]`)
-	result := r.Split(input, -1)
-
-	for _, v := range result {
-		trimmed := strings.TrimSpace(v)
-		if trimmed != "" {
-			fmt.Println(trimmed)
-			output = append(output, []byte(trimmed))
+// MaxChunkChars is the longest chunk, in characters, that model and every model it fails
+// over to accept, or 0 if none of them has a limit.
+func (s *AiService) MaxChunkChars(model string) int {
+	limit := 0
+	for _, candidate := range s.ttsCandidates(model) {
+		synthesizer, err := s.speechSynthesizers.Resolve(candidate.model)
+		if err != nil {
+			continue
+		}
+		if max := synthesizer.Catalog().MaxChunkChars; max > 0 && (limit == 0 || max < limit) {
+			limit = max
 		}
 	}
-
-	return output
+	return limit
 }
 
-func (s *AiService) OpenAiCreateTranscription(c *fiber.Ctx) (err error) {
-	apiKey := os.Getenv("OPEN_AI_API_KEY")
-	fmt.Println("Running OpenAiCreateTranscription")
-	jsonData := c.Body()
-
-	var audio struct {
-		AudioData []byte `json:"audioData"`
-	}
+// Transcribe turns recorded audio into text with the user's STT model, failing over
+// along the configured chain.
+func (s *AiService) Transcribe(ctx context.Context, model string, audio []byte) (*ai_model.Transcription, error) {
+	return s.transcribe(ctx, model, audio, RecordedAudio)
+}
 
-	if err := json.Unmarshal([]byte(jsonData), &audio); err != nil {
-		fmt.Println("Error parsing JSON:", err)
-		return nil
+// transcribe is Transcribe for audio in encoding.
+func (s *AiService) transcribe(ctx context.Context, model string, audio []byte, encoding AudioEncoding) (*ai_model.Transcription, error) {
+	transcription, outcome, err := withFailover(s.breakers, s.sttCandidates(model), func(model string) (*ai_model.Transcription, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		var transcription *ai_model.Transcription
+		var err error
+		if model == "vertex" {
+			transcription, err = s.VertexAiCreateTranscription(audio, encoding)
+		} else {
+			transcription, err = s.OpenAiCreateTranscription(audio)
+		}
+		record := usage_model.UsageRecord{Kind: usage_model.KindStt, Provider: sttProviderName(model), LlmModel: model}
+		if transcription != nil {
+			record.AudioSeconds = transcription.AudioSeconds
+		}
+		s.usageService.Record(ctx, record, start, err)
+		return transcription, err
+	})
+	if err != nil {
+		return nil, err
 	}
+	transcription.FailedOver = outcome.FailedOver
+	return transcription, nil
+}
 
-	uint8Array := audio.AudioData
-	audioFile, err := os.Create("audio.wav")
-
-	if err != nil {
-		fmt.Println("Error creating audio file:", err)
-		return nil
+// sttModelName maps a stored SttModel onto a known model, anything else used Whisper.
+func sttModelName(model string) string {
+	if model == "vertex" {
+		return model
 	}
-	fmt.Println("Created audio file")
-	defer func(audioFile *os.File) {
-		err := audioFile.Close()
-		if err != nil {
-			fmt.Println("Error closing audio file:", err)
-		}
-	}(audioFile)
+	return "whisper-1"
+}
 
-	if _, err := audioFile.Write(uint8Array); err != nil {
-		fmt.Println("Error writing to audio file:", err)
-		return nil
+func sttProviderName(model string) string {
+	if model == "vertex" {
+		return "google"
 	}
+	return "openai"
+}
 
-	url := OpenAiTranscriptionEndpoint
+func (s *AiService) OpenAiCreateTranscription(audio []byte) (*ai_model.Transcription, error) {
+	apiKey := os.Getenv("OPEN_AI_API_KEY")
+	url := s.endpoints.OpenAI + OpenAiTranscriptionPath
 	agent := fiber.Post(url)
 	agent.Set("Authorization", "Bearer "+apiKey)
 	agent.Set("Content-Type", "multipart/form-data")
 
 	var args = fiber.AcquireArgs()
+	defer fiber.ReleaseArgs(args)
 	args.Add("model", "whisper-1")
 	args.Add("language", "en")
+	args.Add("response_format", "verbose_json")
 
 	var formFile = fiber.AcquireFormFile()
+	defer fiber.ReleaseFormFile(formFile)
 	formFile.Name = "audio.wav"
 	formFile.Fieldname = "file"
-	formFile.Content = uint8Array
+	formFile.Content = audio
 
 	agent.FileData(formFile).MultipartForm(args)
 
 	statusCode, body, errs := agent.Bytes()
 	if len(errs) > 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"errs": errs,
-		})
+		return nil, errors.Join(errs...)
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &ProviderError{Provider: "whisper-1", StatusCode: statusCode, Message: string(body)}
 	}
-	return c.Status(statusCode).Send(body)
+
+	var whisperResponse ai_model.OpenAiTranscriptionResponse
+	if err := json.Unmarshal(body, &whisperResponse); err != nil {
+		return nil, fmt.Errorf("decode whisper response: %w", err)
+	}
+	words := whisperWords(whisperResponse.Segments)
+	return &ai_model.Transcription{
+		Text:         whisperResponse.Text,
+		Provider:     "whisper-1",
+		AudioSeconds: whisperResponse.Duration,
+		Delivery:     AnalyseDelivery(words, ai_model.TimingSegments),
+		Words:        words,
+	}, nil
+}
+
+// AudioEncoding describes audio sent for transcription. Name is Google's name for it.
+type AudioEncoding struct {
+	Name       string
+	SampleRate int
 }
 
-func (s *AiService) VertexAiCreateTranscription(c *fiber.Ctx) (err error) {
-	url := fmt.Sprintf(VertexTranscriptionEndpoint)
+// RecordedAudio is how the frontend records answers sent to /speech-to-text.
+var RecordedAudio = AudioEncoding{Name: "MP3", SampleRate: 24000}
+
+func (s *AiService) VertexAiCreateTranscription(audio []byte, encoding AudioEncoding) (*ai_model.Transcription, error) {
+	url := s.endpoints.GoogleStt + VertexTranscriptionPath
 	agent := fiber.Post(url)
 	apiKey := os.Getenv("GCLOUD_API_KEY")
 	agent.Set("Authorization", "Bearer "+apiKey)
 	agent.Set("Content-Type", "application/json; charset=utf-8")
 	agent.Set("x-goog-user-project", "up-it-aps") //replace with your project id
 
-	retrievedJson := c.Body()
-	var audio struct {
-		AudioData []byte `json:"audioData"`
-	}
-
-	if err := json.Unmarshal([]byte(retrievedJson), &audio); err != nil {
-		fmt.Println("Error parsing JSON:", err)
-		return nil
-	}
-
-	encodedString := base64.StdEncoding.EncodeToString(audio.AudioData)
-	if err != nil {
-		fmt.Println("Error decoding Base64 string:", err)
-		return
-	}
-
 	jsonBody := ai_model.GoogleVertexAiSpeechToTextRequest{
 		Config: ai_model.GoogleVertexAiSpeechToTextRequestConfig{
 			LanguageCode:          "en-AU",
 			EnableWordTimeOffsets: true,
 			EnableWordConfidence:  true,
 			Model:                 "default",
-			Encoding:              "MP3",
-			SampleRateHertz:       24000,
+			Encoding:              encoding.Name,
+			SampleRateHertz:       encoding.SampleRate,
 			AudioChannelCount:     1,
 		},
 		Audio: ai_model.GoogleVertexAiSpeechToTextAudio{
-			Content: encodedString,
+			Content: base64.StdEncoding.EncodeToString(audio),
 		},
 	}
 	response := agent.JSON(jsonBody)
-	_, body, errs := response.Bytes()
+	statusCode, body, errs := response.Bytes()
 	if len(errs) > 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"errs": errs,
-		})
+		return nil, errors.Join(errs...)
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &ProviderError{Provider: "vertex", StatusCode: statusCode, Message: string(body)}
 	}
 
 	var vertexResponse ai_model.GoogleVertexAiSpeechToTextResponse
-	err = json.Unmarshal(body, &vertexResponse)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"err": err,
-		})
+	if err := json.Unmarshal(body, &vertexResponse); err != nil {
+		return nil, fmt.Errorf("decode vertex transcription response: %w", err)
 	}
-	return c.Status(200).JSON(fiber.Map{
-		"text": vertexResponse.VertexAiSpeechToTextResponseResults[0].Alternatives[0].Transcript,
-	})
+
+	transcripts := make([]string, 0, len(vertexResponse.VertexAiSpeechToTextResponseResults))
+	for _, result := range vertexResponse.VertexAiSpeechToTextResponseResults {
+		if len(result.Alternatives) > 0 {
+			transcripts = append(transcripts, strings.TrimSpace(result.Alternatives[0].Transcript))
+		}
+	}
+	words := googleWords(vertexResponse)
+	return &ai_model.Transcription{
+		Text:         strings.Join(transcripts, " "),
+		Provider:     "vertex",
+		AudioSeconds: vertexAudioSeconds(vertexResponse),
+		Delivery:     AnalyseDelivery(words, ai_model.TimingWords),
+		Words:        words,
+	}, nil
+}
+
+// vertexAudioSeconds prefers the billed time, which is what we pay for, and falls back
+// to the end of the last result. Both are durations like "3.500s".
+func vertexAudioSeconds(response ai_model.GoogleVertexAiSpeechToTextResponse) float64 {
+	if billed, err := time.ParseDuration(response.TotalBilledTime); err == nil {
+		return billed.Seconds()
+	}
+	results := response.VertexAiSpeechToTextResponseResults
+	if len(results) == 0 {
+		return 0
+	}
+	if end, err := time.ParseDuration(results[len(results)-1].ResultEndTime); err == nil {
+		return end.Seconds()
+	}
+	return 0
 }
 
 func validateToken(tokenString string) (*jwt.Token, error) {
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	RunStatusQueued         = "queued"
+	RunStatusInProgress     = "in_progress"
+	RunStatusRequiresAction = "requires_action"
+	RunStatusCancelling     = "cancelling"
+	RunStatusCancelled      = "cancelled"
+	RunStatusFailed         = "failed"
+	RunStatusCompleted      = "completed"
+	RunStatusIncomplete     = "incomplete"
+	RunStatusExpired        = "expired"
+)
+
+var ErrRunTimeout = errors.New("assistant run did not finish before the deadline")
+
+// AssistantRunError is returned when a run ends in any state other than completed.
+type AssistantRunError struct {
+	RunID   string
+	Status  string
+	Code    string
+	Message string
+}
+
+func (e *AssistantRunError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("assistant run %s %s: %s", e.RunID, e.Status, e.Message)
+	}
+	return fmt.Sprintf("assistant run %s %s", e.RunID, e.Status)
+}
+
+// AssistantsClient is a small client for the OpenAI Assistants API: threads, messages
+// and runs. Runs are polled with exponential backoff until they reach a terminal state
+// or RunTimeout passes.
+type AssistantsClient struct {
+	apiKey  string
+	baseUrl string
+
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	RunTimeout      time.Duration
+}
+
+func NewAssistantsClient(apiKey string, baseUrl string) *AssistantsClient {
+	return &AssistantsClient{
+		apiKey:          apiKey,
+		baseUrl:         baseUrl,
+		PollInterval:    250 * time.Millisecond,
+		MaxPollInterval: 2 * time.Second,
+		RunTimeout:      60 * time.Second,
+	}
+}
+
+func (c *AssistantsClient) CreateThread(ctx context.Context) (string, error) {
+	var thread ai_model.OpenAiThreadResponse
+	if err := c.do(ctx, fiber.MethodPost, "/threads", struct{}{}, &thread); err != nil {
+		return "", err
+	}
+	if thread.ID == "" {
+		return "", &ProviderError{Provider: "openai-assistants", Message: "Thread ID is empty"}
+	}
+	return thread.ID, nil
+}
+
+func (c *AssistantsClient) AddMessage(ctx context.Context, threadId string, content string) error {
+	return c.do(ctx, fiber.MethodPost, "/threads/"+threadId+"/messages", ai_model.OpenAiThreadMessageRequest{
+		Role:    "user",
+		Content: content,
+	}, nil)
+}
+
+func (c *AssistantsClient) CreateRun(ctx context.Context, threadId string, request ai_model.OpenAiRunRequest) (ai_model.OpenAiRun, error) {
+	var run ai_model.OpenAiRun
+	err := c.do(ctx, fiber.MethodPost, "/threads/"+threadId+"/runs", request, &run)
+	return run, err
+}
+
+func (c *AssistantsClient) GetRun(ctx context.Context, threadId string, runId string) (ai_model.OpenAiRun, error) {
+	var run ai_model.OpenAiRun
+	err := c.do(ctx, fiber.MethodGet, "/threads/"+threadId+"/runs/"+runId, nil, &run)
+	return run, err
+}
+
+func (c *AssistantsClient) CancelRun(ctx context.Context, threadId string, runId string) error {
+	return c.do(ctx, fiber.MethodPost, "/threads/"+threadId+"/runs/"+runId+"/cancel", struct{}{}, nil)
+}
+
+// WaitForRun polls the run until it completes. requires_action runs are cancelled since
+// our assistants define no tools we could answer, and a run still going at the deadline
+// is cancelled as well so it does not keep the thread locked.
+func (c *AssistantsClient) WaitForRun(ctx context.Context, run ai_model.OpenAiRun) (ai_model.OpenAiRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.RunTimeout)
+	defer cancel()
+
+	interval := c.PollInterval
+	for {
+		switch run.Status {
+		case RunStatusCompleted:
+			return run, nil
+		case RunStatusRequiresAction:
+			c.cancelInBackground(run)
+			return run, &AssistantRunError{RunID: run.ID, Status: run.Status, Message: "run requires tool outputs we cannot provide"}
+		case RunStatusFailed, RunStatusCancelled, RunStatusExpired, RunStatusIncomplete:
+			runErr := &AssistantRunError{RunID: run.ID, Status: run.Status}
+			if run.LastError != nil {
+				runErr.Code = run.LastError.Code
+				runErr.Message = run.LastError.Message
+			} else if run.Incomplete != nil {
+				runErr.Message = run.Incomplete.Reason
+			}
+			return run, runErr
+		}
+
+		select {
+		case <-ctx.Done():
+			c.cancelInBackground(run)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return run, ErrRunTimeout
+			}
+			return run, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = min(interval*3/2, c.MaxPollInterval)
+
+		polled, err := c.GetRun(ctx, run.ThreadID, run.ID)
+		if err != nil {
+			var providerErr *ProviderError
+			if errors.As(err, &providerErr) && providerErr.StatusCode >= fiber.StatusInternalServerError {
+				continue // transient, keep polling until the deadline
+			}
+			// the request can time out a moment before ctx reports its deadline
+			if deadline, _ := ctx.Deadline(); ctx.Err() != nil || !time.Now().Before(deadline) {
+				continue // let the select above report the deadline
+			}
+			return run, err
+		}
+		run = polled
+	}
+}
+
+// RunMessage returns the text of the assistant messages created by the run.
+func (c *AssistantsClient) RunMessage(ctx context.Context, threadId string, runId string) (string, error) {
+	var messages ai_model.OpenAiThreadMessageList
+	path := "/threads/" + threadId + "/messages?order=asc&run_id=" + runId
+	if err := c.do(ctx, fiber.MethodGet, path, nil, &messages); err != nil {
+		return "", err
+	}
+
+	var texts []string
+	for _, message := range messages.Data {
+		if message.Role != "assistant" {
+			continue
+		}
+		for _, content := range message.Content {
+			if content.Type == "text" && content.Text.Value != "" {
+				texts = append(texts, content.Text.Value)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return "", &ProviderError{Provider: "openai-assistants", Message: "run produced no assistant message"}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+func (c *AssistantsClient) cancelInBackground(run ai_model.OpenAiRun) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = c.CancelRun(ctx, run.ThreadID, run.ID)
+	}()
+}
+
+func (c *AssistantsClient) do(ctx context.Context, method string, path string, payload interface{}, out interface{}) error {
+	var agent *fiber.Agent
+	if method == fiber.MethodGet {
+		agent = fiber.Get(c.baseUrl + path)
+	} else {
+		agent = fiber.Post(c.baseUrl + path)
+	}
+	if err := prepareAgent(ctx, agent); err != nil {
+		return err
+	}
+	agent.Set("Authorization", "Bearer "+c.apiKey)
+	agent.Set("Content-Type", "application/json")
+	agent.Set("OpenAI-Beta", OpenAiAssistantsBeta)
+	if payload != nil {
+		agent.JSON(payload)
+	}
+
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if statusCode < fiber.StatusOK || statusCode >= fiber.StatusMultipleChoices {
+		return &ProviderError{Provider: "openai-assistants", StatusCode: statusCode, Message: string(body)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode assistants response: %w", err)
+	}
+	return nil
+}
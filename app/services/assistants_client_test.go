@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// fakeAssistants emulates the parts of the Assistants API we use. Each run walks through
+// statuses, one per poll, and ends in finalStatus.
+type fakeAssistants struct {
+	mu          sync.Mutex
+	finalStatus string
+	threads     map[string][]ai_model.OpenAiThreadMessageResponse
+	runs        map[string]*ai_model.OpenAiRun
+	cancelled   []string
+	// instructions holds the additional instructions of every run
+	instructions []string
+}
+
+func newFakeAssistants(finalStatus string) (*fakeAssistants, *httptest.Server) {
+	fake := &fakeAssistants{
+		finalStatus: finalStatus,
+		threads:     map[string][]ai_model.OpenAiThreadMessageResponse{},
+		runs:        map[string]*ai_model.OpenAiRun{},
+	}
+	return fake, httptest.NewServer(fake)
+}
+
+func (f *fakeAssistants) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("OpenAI-Beta") != OpenAiAssistantsBeta {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 1:
+		id := fmt.Sprintf("thread_%d", len(f.threads)+1)
+		f.threads[id] = nil
+		_ = json.NewEncoder(w).Encode(ai_model.OpenAiThreadResponse{ID: id})
+
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "messages":
+		var message ai_model.OpenAiThreadMessageRequest
+		_ = json.NewDecoder(r.Body).Decode(&message)
+		f.threads[parts[1]] = append(f.threads[parts[1]], ai_model.OpenAiThreadMessageResponse{
+			Role:    "user",
+			Content: []ai_model.OpenAiContentItem{{Type: "text", Text: ai_model.OpenAiTextContent{Value: message.Content}}},
+		})
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "runs":
+		var request ai_model.OpenAiRunRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.instructions = append(f.instructions, request.AdditionalInstructions)
+		run := &ai_model.OpenAiRun{ID: fmt.Sprintf("run_%d", len(f.runs)+1), ThreadID: parts[1], Status: RunStatusQueued}
+		f.runs[run.ID] = run
+		_ = json.NewEncoder(w).Encode(run)
+
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "runs":
+		run := f.runs[parts[3]]
+		switch run.Status {
+		case RunStatusQueued:
+			run.Status = RunStatusInProgress
+		case RunStatusInProgress:
+			run.Status = f.finalStatus
+			switch f.finalStatus {
+			case RunStatusCompleted:
+				userMessages := len(f.threads[run.ThreadID])
+				f.threads[run.ThreadID] = append(f.threads[run.ThreadID], ai_model.OpenAiThreadMessageResponse{
+					Role:  "assistant",
+					RunID: run.ID,
+					Content: []ai_model.OpenAiContentItem{
+						{Type: "text", Text: ai_model.OpenAiTextContent{Value: fmt.Sprintf("reply to %d messages", userMessages)}},
+					},
+				})
+				run.Usage = &ai_model.OpenAiUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+			case RunStatusFailed:
+				run.LastError = &ai_model.OpenAiRunError{Code: "server_error", Message: "something broke"}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(run)
+
+	case r.Method == http.MethodPost && len(parts) == 5 && parts[4] == "cancel":
+		f.cancelled = append(f.cancelled, parts[3])
+		f.runs[parts[3]].Status = RunStatusCancelling
+		_ = json.NewEncoder(w).Encode(f.runs[parts[3]])
+
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "messages":
+		var list ai_model.OpenAiThreadMessageList
+		for _, message := range f.threads[parts[1]] {
+			if message.RunID == r.URL.Query().Get("run_id") {
+				list.Data = append(list.Data, message)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeAssistants) cancelledRuns() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.cancelled...)
+}
+
+type memoryThreadStore map[uint]string
+
+func (m memoryThreadStore) AssistantThreadID(conversationID uint) string {
+	return m[conversationID]
+}
+
+func (m memoryThreadStore) SetAssistantThreadID(conversationID uint, threadID string) error {
+	m[conversationID] = threadID
+	return nil
+}
+
+func newTestAssistantsClient(server *httptest.Server) *AssistantsClient {
+	client := NewAssistantsClient("test-key", server.URL)
+	client.PollInterval = time.Millisecond
+	client.MaxPollInterval = 5 * time.Millisecond
+	return client
+}
+
+func TestOpenAiAssistantProvider_ReusesConversationThread(t *testing.T) {
+	fake, server := newFakeAssistants(RunStatusCompleted)
+	defer server.Close()
+
+	threads := memoryThreadStore{}
+	provider := NewOpenAiAssistantProvider(newTestAssistantsClient(server), threads)
+
+	first, err := provider.CreateMessage(context.Background(), ai_model.ChatRequest{
+		ConversationID: 7,
+		Model:          "googler",
+		SystemPrompt:   "You are a strict interviewer.",
+		Messages:       []ai_model.MessageRequest{{Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+	if first.Text != "reply to 1 messages" || first.Usage.TotalTokens != 15 {
+		t.Errorf("CreateMessage() = %+v", first)
+	}
+
+	second, err := provider.CreateMessage(context.Background(), ai_model.ChatRequest{
+		ConversationID: 7,
+		Model:          "googler",
+		SystemPrompt:   "You are a strict interviewer.",
+		Messages: []ai_model.MessageRequest{
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: first.Text},
+			{Role: "user", Content: "Ask me a question"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	// the second turn runs on the same thread and only adds the new user message
+	if second.Text != "reply to 3 messages" {
+		t.Errorf("CreateMessage() second turn = %q, want reply on the existing thread", second.Text)
+	}
+	if len(fake.threads) != 1 || threads[7] != "thread_1" {
+		t.Errorf("threads = %v, store = %v, want a single thread for the conversation", len(fake.threads), threads)
+	}
+	// the system prompt goes with every run, the thread never keeps it
+	if len(fake.instructions) != 2 || fake.instructions[0] != "You are a strict interviewer." || fake.instructions[1] != fake.instructions[0] {
+		t.Errorf("run instructions = %q, want the system prompt on both runs", fake.instructions)
+	}
+}
+
+func TestAssistantsClient_WaitForRunTerminalStates(t *testing.T) {
+	tests := []struct {
+		status     string
+		wantCancel bool
+	}{
+		{status: RunStatusFailed},
+		{status: RunStatusExpired},
+		{status: RunStatusCancelled},
+		{status: RunStatusRequiresAction, wantCancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			fake, server := newFakeAssistants(tt.status)
+			defer server.Close()
+			client := newTestAssistantsClient(server)
+
+			threadId, _ := client.CreateThread(context.Background())
+			run, err := client.CreateRun(context.Background(), threadId, ai_model.OpenAiRunRequest{AssistantID: GooglerCustomGptId})
+			if err != nil {
+				t.Fatalf("CreateRun() failed: %v", err)
+			}
+
+			_, err = client.WaitForRun(context.Background(), run)
+			var runErr *AssistantRunError
+			if !errors.As(err, &runErr) || runErr.Status != tt.status {
+				t.Fatalf("WaitForRun() error = %v, want AssistantRunError with status %s", err, tt.status)
+			}
+			if tt.status == RunStatusFailed && runErr.Message != "something broke" {
+				t.Errorf("WaitForRun() message = %q, want last_error message", runErr.Message)
+			}
+
+			if tt.wantCancel {
+				deadline := time.Now().Add(time.Second)
+				for len(fake.cancelledRuns()) == 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				if len(fake.cancelledRuns()) != 1 {
+					t.Errorf("cancelled runs = %v, want the run cancelled", fake.cancelledRuns())
+				}
+			}
+		})
+	}
+}
+
+func TestAssistantsClient_WaitForRunDeadline(t *testing.T) {
+	fake, server := newFakeAssistants(RunStatusInProgress)
+	defer server.Close()
+	client := newTestAssistantsClient(server)
+	client.RunTimeout = 30 * time.Millisecond
+
+	threadId, _ := client.CreateThread(context.Background())
+	run, _ := client.CreateRun(context.Background(), threadId, ai_model.OpenAiRunRequest{AssistantID: GooglerCustomGptId})
+
+	_, err := client.WaitForRun(context.Background(), run)
+	if !errors.Is(err, ErrRunTimeout) {
+		t.Fatalf("WaitForRun() error = %v, want ErrRunTimeout", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(fake.cancelledRuns()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(fake.cancelledRuns()) != 1 {
+		t.Errorf("cancelled runs = %v, want the timed out run cancelled", fake.cancelledRuns())
+	}
+}
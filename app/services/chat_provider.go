@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrNoChatProvider = errors.New("no chat provider registered for model")
+
+// ChatProvider is implemented by every LLM backend that can answer a chat request.
+type ChatProvider interface {
+	Name() string
+	CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error)
+}
+
+// ProviderError is returned when an upstream provider answers with a non-2xx status
+// or a body we cannot use.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: upstream returned %d: %s", e.Provider, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+}
+
+// ChatProviderRegistry maps model IDs (as stored in UserSettings.LlmModel) to providers.
+// Models without an explicit registration resolve to the fallback provider.
+type ChatProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]ChatProvider
+	fallback  ChatProvider
+}
+
+func NewChatProviderRegistry(fallback ChatProvider) *ChatProviderRegistry {
+	return &ChatProviderRegistry{
+		providers: make(map[string]ChatProvider),
+		fallback:  fallback,
+	}
+}
+
+// NewDefaultChatProviderRegistry wires up the providers we ship with. Unknown models go to
+// OpenAI chat completions, which is what the old if-chain did. Models served by a
+// configured OpenAI-compatible server are registered last, so they win over a public
+// model of the same name.
+func NewDefaultChatProviderRegistry(endpoints config.ProviderEndpoints, compatible config.OpenAICompatibleConfig) *ChatProviderRegistry {
+	openAi := NewOpenAiChatProvider(os.Getenv("OPEN_AI_API_KEY"), endpoints.OpenAI)
+	registry := NewChatProviderRegistry(openAi)
+	registry.Register(openAi, "gpt-3.5-turbo", "gpt-4", "gpt-4-turbo-preview")
+	registry.Register(NewGeminiChatProvider(os.Getenv("VERTEX_AI_API_KEY"), endpoints.Gemini), "chat-bison", "gemini-pro")
+	assistants := NewAssistantsClient(os.Getenv("OPEN_AI_API_KEY"), endpoints.OpenAI)
+	registry.Register(NewOpenAiAssistantProvider(assistants, NewConversationService()), "googler", "meta-mate")
+	if compatible.BaseURL != "" && len(compatible.Models) > 0 {
+		registry.Register(NewOpenAiCompatibleChatProvider(compatible.APIKey, compatible.BaseURL), compatible.Models...)
+	}
+	return registry
+}
+
+func (r *ChatProviderRegistry) Register(provider ChatProvider, models ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, model := range models {
+		r.providers[model] = provider
+	}
+}
+
+func (r *ChatProviderRegistry) Resolve(model string) (ChatProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if provider, ok := r.providers[model]; ok {
+		return provider, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoChatProvider, model)
+}
+
+// Models lists the explicitly registered model IDs in a stable order.
+func (r *ChatProviderRegistry) Models() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	models := make([]string, 0, len(r.providers))
+	for model := range r.providers {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// chatErrorStatus picks the status we send back to the client for a failed chat turn.
+func chatErrorStatus(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch providerErr.StatusCode {
+		case fiber.StatusBadRequest, fiber.StatusUnauthorized:
+			return fiber.StatusUnauthorized
+		case fiber.StatusTooManyRequests:
+			return fiber.StatusTooManyRequests
+		}
+	}
+	switch {
+	case errors.Is(err, ErrNoChatProvider):
+		return fiber.StatusBadRequest
+	case errors.Is(err, ErrNoCredits):
+		return fiber.StatusPaymentRequired
+	case errors.Is(err, ErrConversationNotFound), errors.Is(err, ErrSessionNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, ErrSessionNotActive):
+		return fiber.StatusConflict
+	case errors.Is(err, breaker.ErrOpen):
+		return fiber.StatusServiceUnavailable
+	}
+	return fiber.StatusInternalServerError
+}
+
+// prepareAgent makes a fiber agent honour the caller's context as far as it can:
+// it refuses to start on a cancelled context and turns a deadline into a timeout.
+func prepareAgent(ctx context.Context, agent *fiber.Agent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		agent.Timeout(time.Until(deadline))
+	}
+	return nil
+}
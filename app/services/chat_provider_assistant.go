@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// AssistantThreadStore remembers which Assistants thread belongs to a conversation.
+type AssistantThreadStore interface {
+	AssistantThreadID(conversationID uint) string
+	SetAssistantThreadID(conversationID uint, threadID string) error
+}
+
+// OpenAiAssistantProvider answers through one of our custom OpenAI assistants.
+// The model ID selects the assistant, see GetCustomGptAssistant. Every conversation keeps
+// its own thread, so only the newest user message is sent on each turn. The system prompt
+// is sent with every run, on top of the assistant's own instructions.
+type OpenAiAssistantProvider struct {
+	client  *AssistantsClient
+	threads AssistantThreadStore
+}
+
+func NewOpenAiAssistantProvider(client *AssistantsClient, threads AssistantThreadStore) *OpenAiAssistantProvider {
+	return &OpenAiAssistantProvider{client: client, threads: threads}
+}
+
+func (p *OpenAiAssistantProvider) Name() string {
+	return "openai-assistants"
+}
+
+func (p *OpenAiAssistantProvider) CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	threadId, pending, err := p.thread(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range pending {
+		if err := p.client.AddMessage(ctx, threadId, message.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	run, err := p.client.CreateRun(ctx, threadId, ai_model.OpenAiRunRequest{
+		AssistantID:            GetCustomGptAssistant(req.Model),
+		Temperature:            req.Temperature,
+		AdditionalInstructions: req.SystemPrompt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	run, err = p.client.WaitForRun(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := p.client.RunMessage(ctx, threadId, run.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ai_model.ChatResult{
+		Text:         text,
+		Provider:     p.Name(),
+		Model:        req.Model,
+		FinishReason: run.Status,
+	}
+	if run.Usage != nil {
+		result.Usage = ai_model.TokenUsage{
+			PromptTokens:     run.Usage.PromptTokens,
+			CompletionTokens: run.Usage.CompletionTokens,
+			TotalTokens:      run.Usage.TotalTokens,
+		}
+	}
+	return result, nil
+}
+
+// thread returns the thread to run on and the messages it is still missing. A known
+// conversation thread only needs the newest user message, a fresh thread gets every
+// user message we have (threads only accept user messages from us).
+func (p *OpenAiAssistantProvider) thread(ctx context.Context, req ai_model.ChatRequest) (string, []ai_model.MessageRequest, error) {
+	if req.ConversationID != 0 && p.threads != nil {
+		if threadId := p.threads.AssistantThreadID(req.ConversationID); threadId != "" {
+			return threadId, lastUserMessage(req.Messages), nil
+		}
+	}
+
+	threadId, err := p.client.CreateThread(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if req.ConversationID != 0 && p.threads != nil {
+		if err := p.threads.SetAssistantThreadID(req.ConversationID, threadId); err != nil {
+			return "", nil, err
+		}
+	}
+	return threadId, userMessages(req.Messages), nil
+}
+
+func userMessages(messages []ai_model.MessageRequest) []ai_model.MessageRequest {
+	filtered := make([]ai_model.MessageRequest, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "user" {
+			filtered = append(filtered, message)
+		}
+	}
+	return filtered
+}
+
+func lastUserMessage(messages []ai_model.MessageRequest) []ai_model.MessageRequest {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i : i+1]
+		}
+	}
+	return nil
+}
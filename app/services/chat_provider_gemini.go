@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GeminiChatProvider talks to the generative language generateContent endpoint
+// (using the old gen ai maker key).
+type GeminiChatProvider struct {
+	apiKey         string
+	endpoint       string
+	streamEndpoint string
+}
+
+func NewGeminiChatProvider(apiKey string, baseUrl string) *GeminiChatProvider {
+	return &GeminiChatProvider{
+		apiKey:         apiKey,
+		endpoint:       baseUrl + VertexTextGenerationPath,
+		streamEndpoint: baseUrl + VertexTextStreamPath,
+	}
+}
+
+func (p *GeminiChatProvider) Name() string {
+	return "gemini"
+}
+
+func (p *GeminiChatProvider) CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	url := fmt.Sprintf(p.endpoint, req.Model, p.apiKey)
+	agent := fiber.Post(url)
+	if err := prepareAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	agent.Set("Content-Type", "application/json")
+	agent.JSON(p.buildRequest(req))
+
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &ProviderError{Provider: p.Name(), StatusCode: statusCode, Message: string(body)}
+	}
+
+	var googleResponse ai_model.GoogleResponse
+	if err := json.Unmarshal(body, &googleResponse); err != nil {
+		return nil, fmt.Errorf("decode gemini response: %w", err)
+	}
+	if len(googleResponse.Candidates) == 0 || len(googleResponse.Candidates[0].Content.Parts) == 0 {
+		return nil, &ProviderError{Provider: p.Name(), Message: "response has no candidates"}
+	}
+
+	return &ai_model.ChatResult{
+		Text:         TransformGoogleData(googleResponse).MessageRetrieved,
+		Provider:     p.Name(),
+		Model:        req.Model,
+		FinishReason: googleResponse.Candidates[0].FinishReason,
+		Usage: ai_model.TokenUsage{
+			PromptTokens:     googleResponse.UsageMetadata.PromptTokenCount,
+			CompletionTokens: googleResponse.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      googleResponse.UsageMetadata.TotalTokenCount,
+		},
+	}, nil
+}
+
+func (p *GeminiChatProvider) StreamMessage(ctx context.Context, req ai_model.ChatRequest, onDelta func(delta string) error) (*ai_model.ChatResult, error) {
+	url := fmt.Sprintf(p.streamEndpoint, req.Model, p.apiKey)
+	response, err := postStream(ctx, p.Name(), url, nil, p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &ai_model.ChatResult{Provider: p.Name(), Model: req.Model}
+	var text strings.Builder
+	err = readSSE(response.Body, func(data []byte) error {
+		var chunk ai_model.GoogleResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("decode gemini stream chunk: %w", err)
+		}
+		// usageMetadata is cumulative, the last chunk has the totals
+		result.Usage = ai_model.TokenUsage{
+			PromptTokens:     chunk.UsageMetadata.PromptTokenCount,
+			CompletionTokens: chunk.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      chunk.UsageMetadata.TotalTokenCount,
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		candidate := chunk.Candidates[0]
+		if candidate.FinishReason != "" {
+			result.FinishReason = candidate.FinishReason
+		}
+		for _, part := range candidate.Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			text.WriteString(part.Text)
+			if err := onDelta(part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Text = text.String()
+	return result, nil
+}
+
+// buildRequest maps the conversation onto Gemini's multi-turn contents. Gemini only knows
+// the "user" and "model" roles, the system prompt goes into systemInstruction.
+func (p *GeminiChatProvider) buildRequest(req ai_model.ChatRequest) ai_model.GoogleRequest {
+	contents := make([]ai_model.GoogleRequestContent, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		role := "user"
+		if message.Role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, ai_model.GoogleRequestContent{
+			Role:  role,
+			Parts: []ai_model.GoogleRequestPart{{Text: message.Content}},
+		})
+	}
+
+	googleRequest := ai_model.GoogleRequest{
+		Contents: contents,
+		SafetySettings: []ai_model.GoogleRequestSafety{
+			{
+				Category:  "HARM_CATEGORY_DANGEROUS_CONTENT",
+				Threshold: "BLOCK_ONLY_HIGH",
+			},
+		},
+		GenerationConfig: ai_model.GoogleGenerationConfig{
+			Temperature:     1.0,
+			TopP:            0.8,
+			TopK:            10,
+			MaxOutputTokens: 125,
+		},
+	}
+	if req.Temperature != nil {
+		googleRequest.GenerationConfig.Temperature = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		googleRequest.GenerationConfig.MaxOutputTokens = int64(req.MaxTokens)
+	}
+	if req.JSONOutput {
+		googleRequest.GenerationConfig.ResponseMimeType = "application/json"
+	}
+	if req.SystemPrompt != "" {
+		googleRequest.SystemInstruction = &ai_model.GoogleRequestContent{
+			Parts: []ai_model.GoogleRequestPart{{Text: req.SystemPrompt}},
+		}
+	}
+	return googleRequest
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OpenAiChatProvider talks to the chat completions endpoint, either OpenAI's own or one
+// of a self-hosted server that implements the same API.
+type OpenAiChatProvider struct {
+	name     string
+	apiKey   string
+	endpoint string
+}
+
+func NewOpenAiChatProvider(apiKey string, baseUrl string) *OpenAiChatProvider {
+	return &OpenAiChatProvider{
+		name:     "openai",
+		apiKey:   apiKey,
+		endpoint: baseUrl + OpenAiCompletionsPath,
+	}
+}
+
+// NewOpenAiCompatibleChatProvider targets an OpenAI-compatible server such as llama.cpp
+// server, vLLM, LocalAI or Ollama. baseUrl includes the version prefix, for Ollama that
+// is http://localhost:11434/v1. The key may be empty for servers without auth.
+func NewOpenAiCompatibleChatProvider(apiKey string, baseUrl string) *OpenAiChatProvider {
+	return &OpenAiChatProvider{
+		name:     "openai-compatible",
+		apiKey:   apiKey,
+		endpoint: baseUrl + OpenAiCompletionsPath,
+	}
+}
+
+func (p *OpenAiChatProvider) Name() string {
+	return p.name
+}
+
+func (p *OpenAiChatProvider) headers() map[string]string {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	return headers
+}
+
+func (p *OpenAiChatProvider) CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	agent := fiber.Post(p.endpoint)
+	if err := prepareAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	for key, value := range p.headers() {
+		agent.Set(key, value)
+	}
+	agent.Set("Content-Type", "application/json")
+
+	agent.JSON(openAiRequest(req))
+
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &ProviderError{Provider: p.Name(), StatusCode: statusCode, Message: string(body)}
+	}
+
+	var chatGptResponse ai_model.OpenAiChatResponse
+	if err := json.Unmarshal(body, &chatGptResponse); err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", p.Name(), err)
+	}
+	if len(chatGptResponse.Choices) == 0 {
+		return nil, &ProviderError{Provider: p.Name(), Message: "response has no choices"}
+	}
+	if chatGptResponse.Model == "" {
+		// not every compatible server echoes the model
+		chatGptResponse.Model = req.Model
+	}
+
+	return &ai_model.ChatResult{
+		Text:         TransformOpenAiData(chatGptResponse).MessageRetrieved,
+		Provider:     p.Name(),
+		Model:        chatGptResponse.Model,
+		FinishReason: chatGptResponse.Choices[0].FinishReason,
+		Usage: ai_model.TokenUsage{
+			PromptTokens:     chatGptResponse.Usage.PromptTokens,
+			CompletionTokens: chatGptResponse.Usage.CompletionTokens,
+			TotalTokens:      chatGptResponse.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *OpenAiChatProvider) StreamMessage(ctx context.Context, req ai_model.ChatRequest, onDelta func(delta string) error) (*ai_model.ChatResult, error) {
+	request := openAiRequest(req)
+	request.Stream = true
+	request.StreamOptions = &ai_model.OpenAiStreamOptions{IncludeUsage: true}
+	response, err := postStream(ctx, p.Name(), p.endpoint, p.headers(), request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &ai_model.ChatResult{Provider: p.Name(), Model: req.Model}
+	var text strings.Builder
+	err = readSSE(response.Body, func(data []byte) error {
+		var chunk ai_model.OpenAiChatStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("decode %s stream chunk: %w", p.Name(), err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = ai_model.TokenUsage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				result.FinishReason = *choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			text.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Text = text.String()
+	return result, nil
+}
+
+func openAiRequest(req ai_model.ChatRequest) ai_model.OpenAiRequest {
+	request := ai_model.OpenAiRequest{
+		Model:       req.Model,
+		Messages:    openAiMessages(req),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	if req.JSONOutput {
+		request.ResponseFormat = &ai_model.OpenAiResponseFormat{Type: "json_object"}
+	}
+	return request
+}
+
+func openAiMessages(req ai_model.ChatRequest) []ai_model.MessageRequest {
+	messages := make([]ai_model.MessageRequest, 0, len(req.Messages)+1)
+	if req.SystemPrompt != "" {
+		messages = append(messages, ai_model.MessageRequest{Role: "system", Content: req.SystemPrompt})
+	}
+	return append(messages, req.Messages...)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/config"
+)
+
+type stubChatProvider struct {
+	name string
+}
+
+func (p *stubChatProvider) Name() string {
+	return p.name
+}
+
+func (p *stubChatProvider) CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	return &ai_model.ChatResult{Text: "hello from " + p.name, Provider: p.name, Model: req.Model}, nil
+}
+
+func TestChatProviderRegistry_Resolve(t *testing.T) {
+	fallback := &stubChatProvider{name: "fallback"}
+	gemini := &stubChatProvider{name: "gemini"}
+	registry := NewChatProviderRegistry(fallback)
+	registry.Register(gemini, "gemini-pro", "chat-bison")
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "gemini-pro", want: "gemini"},
+		{model: "chat-bison", want: "gemini"},
+		{model: "gpt-4", want: "fallback"},
+		{model: "", want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			provider, err := registry.Resolve(tt.model)
+			if err != nil {
+				t.Fatalf("Resolve() failed: %v", err)
+			}
+			if provider.Name() != tt.want {
+				t.Errorf("Resolve(%q) = %v, want %v", tt.model, provider.Name(), tt.want)
+			}
+		})
+	}
+
+	if models := registry.Models(); len(models) != 2 || models[0] != "chat-bison" {
+		t.Errorf("Models() = %v, want [chat-bison gemini-pro]", models)
+	}
+}
+
+func TestChatProviderRegistry_NoFallback(t *testing.T) {
+	registry := NewChatProviderRegistry(nil)
+	_, err := registry.Resolve("gpt-4")
+	if !errors.Is(err, ErrNoChatProvider) {
+		t.Errorf("Resolve() error = %v, want ErrNoChatProvider", err)
+	}
+}
+
+func TestOpenAiChatProvider_CreateMessage(t *testing.T) {
+	var received ai_model.OpenAiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		_ = json.NewEncoder(w).Encode(ai_model.OpenAiChatResponse{
+			Model: "gpt-4",
+			Choices: []ai_model.OpenAiChoice{
+				{FinishReason: "stop", Message: ai_model.MessageResponse{Role: "assistant", Content: "Tell me about a time you failed."}},
+			},
+			Usage: ai_model.OpenAiUsage{PromptTokens: 12, CompletionTokens: 8, TotalTokens: 20},
+		})
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiChatProvider("test-key", server.URL)
+
+	result, err := provider.CreateMessage(context.Background(), ai_model.ChatRequest{
+		Model:        "gpt-4",
+		SystemPrompt: "be brief",
+		Messages:     []ai_model.MessageRequest{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	if len(received.Messages) != 2 || received.Messages[0].Role != "system" {
+		t.Errorf("request messages = %+v, want system prompt first", received.Messages)
+	}
+	if result.Text != "Tell me about a time you failed." || result.FinishReason != "stop" {
+		t.Errorf("CreateMessage() = %+v", result)
+	}
+	if result.Usage.TotalTokens != 20 {
+		t.Errorf("CreateMessage() usage = %+v, want 20 total tokens", result.Usage)
+	}
+
+	provider.apiKey = "wrong-key"
+	_, err = provider.CreateMessage(context.Background(), ai_model.ChatRequest{Model: "gpt-4"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("CreateMessage() error = %v, want 401 ProviderError", err)
+	}
+}
+
+func TestGeminiChatProvider_BuildRequest(t *testing.T) {
+	provider := NewGeminiChatProvider("test-key", "")
+	request := provider.buildRequest(ai_model.ChatRequest{
+		Model:        "gemini-pro",
+		SystemPrompt: "You are an interviewer.",
+		Messages: []ai_model.MessageRequest{
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Tell me about yourself."},
+			{Role: "user", Content: "I am a developer."},
+		},
+	})
+
+	if request.SystemInstruction == nil || request.SystemInstruction.Parts[0].Text != "You are an interviewer." {
+		t.Errorf("SystemInstruction = %+v, want system prompt", request.SystemInstruction)
+	}
+
+	wantRoles := []string{"user", "model", "user"}
+	if len(request.Contents) != len(wantRoles) {
+		t.Fatalf("Contents has %d entries, want %d", len(request.Contents), len(wantRoles))
+	}
+	for i, role := range wantRoles {
+		if request.Contents[i].Role != role {
+			t.Errorf("Contents[%d].Role = %q, want %q", i, request.Contents[i].Role, role)
+		}
+	}
+	if request.Contents[0].Parts[0].Text != "Hi" {
+		t.Errorf("Contents[0] text = %q, want the message without the system prompt", request.Contents[0].Parts[0].Text)
+	}
+}
+
+func TestOpenAiCompatibleChatProvider_CreateMessage(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Path != "/v1/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// llama.cpp and friends do not always echo the model
+		_ = json.NewEncoder(w).Encode(ai_model.OpenAiChatResponse{
+			Choices: []ai_model.OpenAiChoice{
+				{FinishReason: "stop", Message: ai_model.MessageResponse{Role: "assistant", Content: "Why did you choose Go?"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiCompatibleChatProvider("", server.URL+"/v1")
+	result, err := provider.CreateMessage(context.Background(), ai_model.ChatRequest{
+		Model:    "llama3",
+		Messages: []ai_model.MessageRequest{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+	if authorization != "" {
+		t.Errorf("Authorization = %q, want no header without a key", authorization)
+	}
+	if result.Provider != "openai-compatible" || result.Model != "llama3" || result.Text != "Why did you choose Go?" {
+		t.Errorf("CreateMessage() = %+v", result)
+	}
+}
+
+func TestNewDefaultChatProviderRegistry_OpenAiCompatible(t *testing.T) {
+	registry := NewDefaultChatProviderRegistry(config.DefaultProviderEndpoints(), config.OpenAICompatibleConfig{
+		BaseURL: "http://localhost:11434/v1",
+		Models:  []string{"llama3", "gpt-4"},
+	})
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{model: "llama3", want: "openai-compatible"},
+		{model: "gpt-4", want: "openai-compatible"},
+		{model: "gpt-3.5-turbo", want: "openai"},
+		{model: "gemini-pro", want: "gemini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			provider, err := registry.Resolve(tt.model)
+			if err != nil {
+				t.Fatalf("Resolve() failed: %v", err)
+			}
+			if provider.Name() != tt.want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.model, provider.Name(), tt.want)
+			}
+		})
+	}
+}
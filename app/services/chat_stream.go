@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// StreamingChatProvider is implemented by providers that can forward tokens as they are
+// generated. onDelta is called for every text fragment, the returned result carries the
+// full text, usage and finish reason once the upstream stream is done.
+type StreamingChatProvider interface {
+	ChatProvider
+	StreamMessage(ctx context.Context, req ai_model.ChatRequest, onDelta func(delta string) error) (*ai_model.ChatResult, error)
+}
+
+// streamClient has no timeout on purpose, streams are bounded by the request context.
+var streamClient = &http.Client{}
+
+// StreamChatCompletion streams req through its provider, failing over like
+// CreateChatCompletion as long as no token has reached the client yet. Providers without
+// streaming support are called normally and their reply is emitted as a single delta.
+func (s *AiService) StreamChatCompletion(ctx context.Context, req ai_model.ChatRequest, onDelta func(delta string) error) (*ai_model.ChatResult, error) {
+	result, outcome, err := withFailover(s.breakers, s.chatCandidates(req.Model), func(model string) (*ai_model.ChatResult, error) {
+		provider, err := s.chatProviders.Resolve(model)
+		if err != nil {
+			return nil, err
+		}
+		attempt := req
+		attempt.Model = model
+
+		emitted, clientFailed := false, false
+		emit := func(delta string) error {
+			emitted = true
+			if err := onDelta(delta); err != nil {
+				clientFailed = true
+				return err
+			}
+			return nil
+		}
+
+		var result *ai_model.ChatResult
+		start := time.Now()
+		if streaming, ok := provider.(StreamingChatProvider); ok {
+			result, err = streaming.StreamMessage(ctx, attempt, emit)
+		} else if result, err = provider.CreateMessage(ctx, attempt); err == nil {
+			err = emit(result.Text)
+		}
+		s.usageService.Record(ctx, chatUsage(provider.Name(), model, result), start, err)
+		if err != nil && emitted {
+			return nil, &abortFailover{err: err, client: clientFailed}
+		}
+		return result, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.FailedOver = outcome.FailedOver
+	return result, nil
+}
+
+// postStream sends a JSON body and returns the response for the caller to read as a stream.
+// Non-2xx responses are turned into a ProviderError.
+func postStream(ctx context.Context, provider string, url string, headers map[string]string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := streamClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(response.Body)
+		return nil, &ProviderError{Provider: provider, StatusCode: response.StatusCode, Message: string(message)}
+	}
+	return response, nil
+}
+
+// readSSE calls onData with the payload of every "data:" line of an event stream.
+// It stops at the OpenAI "[DONE]" sentinel or at EOF.
+func readSSE(body io.Reader, onData func(data []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if bytes.Equal(data, []byte("[DONE]")) {
+			return nil
+		}
+		if err := onData(data); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// WriteSSE writes one server-sent event and flushes it to the client.
+func WriteSSE(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// WriteSSEComment writes a server-sent event comment, which clients ignore, and flushes
+// it, to find out whether the client is still there.
+func WriteSSEComment(w *bufio.Writer, comment string) error {
+	if _, err := fmt.Fprintf(w, ": %s\n\n", comment); err != nil {
+		return err
+	}
+	return w.Flush()
+}
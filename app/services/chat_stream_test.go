@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := "event: message\ndata: {\"a\":1}\n\n: keep-alive\n\ndata: {\"a\":2}\n\ndata: [DONE]\n\ndata: {\"a\":3}\n\n"
+
+	var payloads []string
+	err := readSSE(strings.NewReader(stream), func(data []byte) error {
+		payloads = append(payloads, string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readSSE() failed: %v", err)
+	}
+	if len(payloads) != 2 || payloads[0] != `{"a":1}` || payloads[1] != `{"a":2}` {
+		t.Errorf("readSSE() payloads = %v, want the two events before [DONE]", payloads)
+	}
+}
+
+func TestOpenAiChatProvider_StreamMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, token := range []string{"Tell", " me", " more."} {
+			fmt.Fprintf(w, "data: {\"model\":\"gpt-4\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", token)
+		}
+		fmt.Fprint(w, "data: {\"model\":\"gpt-4\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"model\":\"gpt-4\",\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":3,\"total_tokens\":12}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewOpenAiChatProvider("test-key", server.URL)
+
+	var deltas []string
+	result, err := provider.StreamMessage(context.Background(), ai_model.ChatRequest{Model: "gpt-4"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMessage() failed: %v", err)
+	}
+
+	if len(deltas) != 3 {
+		t.Errorf("StreamMessage() emitted %d deltas, want 3", len(deltas))
+	}
+	if result.Text != "Tell me more." || result.FinishReason != "stop" || result.Usage.TotalTokens != 12 {
+		t.Errorf("StreamMessage() result = %+v", result)
+	}
+}
+
+func TestGeminiChatProvider_StreamMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "gemini-pro:streamGenerateContent") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Good \"}]}}],\"usageMetadata\":{\"promptTokenCount\":5,\"candidatesTokenCount\":1,\"totalTokenCount\":6}}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"answer.\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":5,\"candidatesTokenCount\":2,\"totalTokenCount\":7}}\n\n")
+	}))
+	defer server.Close()
+
+	provider := NewGeminiChatProvider("test-key", server.URL)
+
+	var text strings.Builder
+	result, err := provider.StreamMessage(context.Background(), ai_model.ChatRequest{Model: "gemini-pro"}, func(delta string) error {
+		text.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMessage() failed: %v", err)
+	}
+
+	if text.String() != "Good answer." || result.Text != "Good answer." {
+		t.Errorf("StreamMessage() text = %q, result = %q", text.String(), result.Text)
+	}
+	if result.FinishReason != "STOP" || result.Usage.TotalTokens != 7 {
+		t.Errorf("StreamMessage() result = %+v", result)
+	}
+}
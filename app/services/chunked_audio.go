@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/breaker"
+)
+
+// DefaultTtsConcurrency is how many chunks of one reply are synthesised at once when the
+// config does not say.
+const DefaultTtsConcurrency = 3
+
+// ChunkedAudioFormat is the format of chunked audio. Each chunk is a whole file, and
+// MP3 files played back to back are one stream, where WAV and Ogg files are not.
+const ChunkedAudioFormat = AudioFormatMp3
+
+// ChunkFailure is a chunk of a reply that could not be synthesised and was left out.
+// Index counts from 0.
+type ChunkFailure struct {
+	Index int
+	Err   error
+}
+
+// chunkAudio is one synthesised chunk and the provider that spoke it.
+type chunkAudio struct {
+	audio   []byte
+	outcome FailoverOutcome
+}
+
+// GenerateChunkedAudio synthesises the chunks of a reply, several at a time, and passes
+// each chunk's audio to emit in order as soon as it and every chunk before it are done,
+// so the first audio goes out as soon as the first chunk is ready. Chunks that fail are
+// left out and returned. An emit error, such as the client having gone away, or ctx
+// ending stops the pipeline and is returned: chunks not started yet are never sent to a
+// provider and audio still being synthesised is dropped. The audio is always in
+// ChunkedAudioFormat.
+func (s *AiService) GenerateChunkedAudio(ctx context.Context, model string, voice ai_model.VoiceOptions, chunks [][]byte, email string, emit func(index int, audio []byte, outcome FailoverOutcome) error) ([]ChunkFailure, error) {
+	voice.Format = ChunkedAudioFormat
+	concurrency := s.ttsConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultTtsConcurrency
+	}
+	return synthesizeInOrder(ctx, len(chunks), concurrency, func(ctx context.Context, index int) (chunkAudio, error) {
+		audio, outcome, err := s.GenerateAudio(ctx, model, voice, chunks[index], email)
+		return chunkAudio{audio: audio, outcome: outcome}, err
+	}, func(index int, result chunkAudio) error {
+		return emit(index, result.audio, result.outcome)
+	})
+}
+
+// synthesizeInOrder runs synthesize for indexes 0 to count-1, at most limit at a time,
+// and hands each result to emit in index order. A failed index is skipped and reported,
+// unless every provider's breaker is open or the user is out of credits, in which case
+// the rest would fail too and the error is returned.
+func synthesizeInOrder[T any](ctx context.Context, count int, limit int, synthesize func(ctx context.Context, index int) (T, error), emit func(index int, result T) error) ([]ChunkFailure, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	// buffered, so workers never block on a consumer that has given up
+	results := make([]chan result, count)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	slots := make(chan struct{}, limit)
+	go func() {
+		for i := 0; i < count; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(index int) {
+				value, err := synthesize(ctx, index)
+				<-slots
+				results[index] <- result{value: value, err: err}
+			}(i)
+		}
+	}()
+
+	var failures []ChunkFailure
+	for i := 0; i < count; i++ {
+		var r result
+		select {
+		case r = <-results[i]:
+		case <-ctx.Done():
+			return failures, ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return failures, err
+		}
+		if r.err != nil {
+			if errors.Is(r.err, breaker.ErrOpen) || errors.Is(r.err, ErrNoCredits) {
+				return failures, r.err
+			}
+			failures = append(failures, ChunkFailure{Index: i, Err: r.err})
+			continue
+		}
+		if err := emit(i, r.value); err != nil {
+			return failures, err
+		}
+	}
+	return failures, nil
+}
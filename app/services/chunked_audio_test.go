@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestSynthesizeInOrder(t *testing.T) {
+	var running, peak int32
+	synthesize := func(ctx context.Context, index int) (int, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		// the first chunk is the slowest, so later ones finish before it
+		delay := 5 * time.Millisecond
+		if index == 0 {
+			delay = 40 * time.Millisecond
+		}
+		time.Sleep(delay)
+		if index == 2 {
+			return 0, errors.New("provider rejected the chunk")
+		}
+		return index * 10, nil
+	}
+	var emitted []int
+	failures, err := synthesizeInOrder(context.Background(), 6, 3, synthesize, func(index int, result int) error {
+		emitted = append(emitted, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("synthesizeInOrder() failed: %v", err)
+	}
+	if fmt.Sprint(emitted) != "[0 10 30 40 50]" {
+		t.Errorf("emitted %v, want every chunk but the failed one, in order", emitted)
+	}
+	if len(failures) != 1 || failures[0].Index != 2 {
+		t.Errorf("failures = %+v, want chunk 2", failures)
+	}
+	if peak < 2 || peak > 3 {
+		t.Errorf("peak concurrency = %d, want up to 3 chunks at once", peak)
+	}
+}
+
+func TestSynthesizeInOrder_Stops(t *testing.T) {
+	t.Run("client gone", func(t *testing.T) {
+		var started int32
+		gone := errors.New("client disconnected")
+		_, err := synthesizeInOrder(context.Background(), 20, 2, func(ctx context.Context, index int) (int, error) {
+			atomic.AddInt32(&started, 1)
+			time.Sleep(5 * time.Millisecond)
+			return index, nil
+		}, func(index int, result int) error {
+			if index == 1 {
+				return gone
+			}
+			return nil
+		})
+		if !errors.Is(err, gone) {
+			t.Errorf("synthesizeInOrder() error = %v, want the emit error", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := atomic.LoadInt32(&started); n > 5 {
+			t.Errorf("%d chunks were started, want the rest cancelled", n)
+		}
+	})
+
+	t.Run("every breaker open", func(t *testing.T) {
+		failures, err := synthesizeInOrder(context.Background(), 4, 1, func(ctx context.Context, index int) (int, error) {
+			if index == 1 {
+				return 0, fmt.Errorf("tts:tts-1: %w", breaker.ErrOpen)
+			}
+			return index, nil
+		}, func(index int, result int) error {
+			return nil
+		})
+		if !errors.Is(err, breaker.ErrOpen) || len(failures) != 0 {
+			t.Errorf("synthesizeInOrder() = %+v, %v, want it to stop on the open breaker", failures, err)
+		}
+	})
+}
+
+func TestAiService_GenerateChunkedAudio(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	fake.SetLatency(fakeproviders.RouteOpenAiSpeech, 20*time.Millisecond)
+	chunks := [][]byte{[]byte("Tell me"), []byte("about a time"), []byte("you led a team")}
+
+	var audio [][]byte
+	start := time.Now()
+	failures, err := s.GenerateChunkedAudio(context.Background(), "tts-1", ai_model.VoiceOptions{Format: AudioFormatWav}, chunks, "test@example.com", func(index int, chunk []byte, outcome FailoverOutcome) error {
+		audio = append(audio, chunk)
+		return nil
+	})
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("GenerateChunkedAudio() = %+v, %v", failures, err)
+	}
+	for i, chunk := range chunks {
+		if i >= len(audio) || !bytes.Equal(audio[i], fakeproviders.FakeAudio(string(chunk))) {
+			t.Fatalf("audio = %q, want each chunk spoken in order", audio)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 55*time.Millisecond {
+		t.Errorf("three chunks took %v, want them synthesised in parallel", elapsed)
+	}
+	// WAV files cannot be played back to back, so chunks are always MP3
+	if request := string(fake.LastRequest(fakeproviders.RouteOpenAiSpeech)); !strings.Contains(request, `"response_format":"mp3"`) {
+		t.Errorf("request = %s, want mp3 asked for", request)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	ai_model "up-it-aps-api/app/models/ai"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+// MaxConversationHistory caps how many stored messages are replayed to the model per turn.
+const MaxConversationHistory = 50
+
+var ErrConversationNotFound = errors.New("conversation not found")
+
+type ConversationService struct {
+}
+
+func NewConversationService() *ConversationService {
+	return &ConversationService{}
+}
+
+func (s *ConversationService) CreateConversation(email string, llmModel string, personaID uint) (conversation_model.Conversation, error) {
+	var db = database.DBConn
+	conversation := conversation_model.Conversation{Email: email, LlmModel: llmModel, PersonaID: personaID}
+	result := db.Create(&conversation)
+	if result.Error != nil {
+		return conversation_model.Conversation{}, result.Error
+	}
+	return conversation, nil
+}
+
+// GetConversation returns the conversation with its messages in order. Conversations
+// belonging to a different user are reported as not found.
+func (s *ConversationService) GetConversation(id uint, email string) (conversation_model.Conversation, error) {
+	var db = database.DBConn
+	var conversation conversation_model.Conversation
+	result := db.Preload("Messages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("id = ? AND email = ?", id, email).First(&conversation)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return conversation_model.Conversation{}, ErrConversationNotFound
+	}
+	if result.Error != nil {
+		return conversation_model.Conversation{}, result.Error
+	}
+	return conversation, nil
+}
+
+func (s *ConversationService) GetConversationsByEmail(email string) []conversation_model.Conversation {
+	var db = database.DBConn
+	var conversations []conversation_model.Conversation
+	db.Where("email = ?", email).Order("id DESC").Find(&conversations)
+	return conversations
+}
+
+func (s *ConversationService) AssistantThreadID(conversationID uint) string {
+	var db = database.DBConn
+	var conversation conversation_model.Conversation
+	db.Select("assistant_thread_id").Where("id = ?", conversationID).First(&conversation)
+	return conversation.AssistantThreadID
+}
+
+func (s *ConversationService) SetAssistantThreadID(conversationID uint, threadID string) error {
+	var db = database.DBConn
+	return db.Model(&conversation_model.Conversation{}).Where("id = ?", conversationID).Update("assistant_thread_id", threadID).Error
+}
+
+// AppendTurn stores a user message and the reply it produced in one transaction, so a
+// failed provider call never leaves half a turn behind. The reply records the persona
+// version that produced it.
+func (s *ConversationService) AppendTurn(conversationID uint, personaVersion uint, userMessage string, assistantMessage string) error {
+	var db = database.DBConn
+	return db.Transaction(func(tx *gorm.DB) error {
+		messages := []conversation_model.ConversationMessage{
+			{ConversationID: conversationID, Role: conversation_model.RoleUser, Content: userMessage},
+			{ConversationID: conversationID, Role: conversation_model.RoleAssistant, Content: assistantMessage, PersonaVersion: personaVersion},
+		}
+		return tx.Create(&messages).Error
+	})
+}
+
+// History converts stored messages into chat messages, keeping only the most recent
+// MaxConversationHistory entries.
+func (s *ConversationService) History(conversation conversation_model.Conversation) []ai_model.MessageRequest {
+	messages := conversation.Messages
+	if len(messages) > MaxConversationHistory {
+		messages = messages[len(messages)-MaxConversationHistory:]
+	}
+	history := make([]ai_model.MessageRequest, 0, len(messages))
+	for _, message := range messages {
+		history = append(history, ai_model.MessageRequest{Role: message.Role, Content: message.Content})
+	}
+	return history
+}
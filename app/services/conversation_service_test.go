@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	"up-it-aps-api/platform/database"
+)
+
+func TestConversationService_AppendTurnAndHistory(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewConversationService()
+
+	conversation, err := service.CreateConversation("test@example.com", "gpt-4", 1)
+	if err != nil {
+		t.Fatalf("CreateConversation() failed: %v", err)
+	}
+
+	if err := service.AppendTurn(conversation.ID, 1, "I led the migration.", "What did you personally do?"); err != nil {
+		t.Fatalf("AppendTurn() failed: %v", err)
+	}
+	if err := service.AppendTurn(conversation.ID, 2, "I wrote the rollout plan.", "How did you measure success?"); err != nil {
+		t.Fatalf("AppendTurn() failed: %v", err)
+	}
+
+	loaded, err := service.GetConversation(conversation.ID, "test@example.com")
+	if err != nil {
+		t.Fatalf("GetConversation() failed: %v", err)
+	}
+
+	if loaded.PersonaID != 1 {
+		t.Errorf("PersonaID = %d, want 1", loaded.PersonaID)
+	}
+	if loaded.Messages[1].PersonaVersion != 1 || loaded.Messages[3].PersonaVersion != 2 {
+		t.Errorf("assistant persona versions = %d, %d, want 1, 2", loaded.Messages[1].PersonaVersion, loaded.Messages[3].PersonaVersion)
+	}
+
+	history := service.History(loaded)
+	if len(history) != 4 {
+		t.Fatalf("History() returned %d messages, want 4", len(history))
+	}
+	if history[0].Role != conversation_model.RoleUser || history[0].Content != "I led the migration." {
+		t.Errorf("History()[0] = %+v, want first user message", history[0])
+	}
+	if history[3].Role != conversation_model.RoleAssistant || history[3].Content != "How did you measure success?" {
+		t.Errorf("History()[3] = %+v, want last assistant message", history[3])
+	}
+
+	// Another user must not see the conversation
+	if _, err := service.GetConversation(conversation.ID, "other@example.com"); err != ErrConversationNotFound {
+		t.Errorf("GetConversation() for other user error = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestConversationService_HistoryWindow(t *testing.T) {
+	service := NewConversationService()
+
+	conversation := conversation_model.Conversation{}
+	for i := 0; i < MaxConversationHistory+10; i++ {
+		conversation.Messages = append(conversation.Messages, conversation_model.ConversationMessage{
+			Role:    conversation_model.RoleUser,
+			Content: fmt.Sprintf("message %d", i),
+		})
+	}
+
+	history := service.History(conversation)
+	if len(history) != MaxConversationHistory {
+		t.Fatalf("History() returned %d messages, want %d", len(history), MaxConversationHistory)
+	}
+	if history[0].Content != "message 10" {
+		t.Errorf("History()[0] = %q, want oldest messages dropped", history[0].Content)
+	}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// Thresholds for judging how an answer was delivered.
+const (
+	// LongPauseSeconds is the silence between two words that counts as a long pause.
+	LongPauseSeconds = 2.0
+	// LowConfidenceWord is the provider confidence below which a word was probably
+	// mumbled or mispronounced.
+	LowConfidenceWord = 0.6
+	// SlowPace and FastPace bound a steady speaking pace, in words per minute.
+	SlowPace = 110
+	FastPace = 170
+)
+
+// fillerPhrases and hedgePhrases are matched on whole words, longest phrase first, so
+// "i'm not sure" counts once rather than also as "not sure".
+var (
+	fillerPhrases = []string{"um", "umm", "uh", "er", "erm", "ah", "hmm", "like", "you know", "i mean", "basically", "literally"}
+	hedgePhrases  = []string{
+		"i think", "i guess", "i suppose", "i believe", "i feel like", "i'm not sure", "not sure",
+		"maybe", "perhaps", "probably", "possibly", "sort of", "kind of", "might", "hopefully",
+	}
+)
+
+// likeVerbs come before "like" when it is a verb or a comparison rather than a filler,
+// as in "I'd like to" or "it looked like".
+var likeVerbs = map[string]bool{
+	"i": true, "you": true, "we": true, "they": true, "would": true, "i'd": true, "you'd": true, "we'd": true,
+	"they'd": true, "don't": true, "didn't": true, "really": true, "look": true, "looks": true, "looked": true,
+	"feel": true, "feels": true, "felt": true, "sound": true, "sounds": true, "seem": true, "seems": true,
+	"more": true, "much": true,
+}
+
+// AnalyseDelivery works out how the timed words were spoken. timing says whether each
+// word or only each segment was timed; low-confidence words are only picked out when
+// each word was. It returns nil when there are no words.
+func AnalyseDelivery(words []ai_model.TimedWord, timing string) *ai_model.Delivery {
+	if len(words) == 0 {
+		return nil
+	}
+	delivery := &ai_model.Delivery{
+		Timing:          timing,
+		Words:           len(words),
+		SpeakingSeconds: roundSeconds(words[len(words)-1].End - words[0].Start),
+	}
+	minutes := (words[len(words)-1].End - words[0].Start) / 60
+	if minutes > 0 {
+		delivery.WordsPerMinute = math.Round(float64(len(words)) / minutes)
+		switch {
+		case delivery.WordsPerMinute < SlowPace:
+			delivery.Pace = ai_model.PaceSlow
+		case delivery.WordsPerMinute > FastPace:
+			delivery.Pace = ai_model.PaceFast
+		default:
+			delivery.Pace = ai_model.PaceSteady
+		}
+	}
+
+	for i, word := range words {
+		if i > 0 {
+			if gap := word.Start - words[i-1].End; gap >= LongPauseSeconds {
+				delivery.Pauses = append(delivery.Pauses, ai_model.Pause{At: roundSeconds(words[i-1].End), Seconds: roundSeconds(gap), After: words[i-1].Word})
+				delivery.PauseSeconds += roundSeconds(gap)
+			}
+		}
+		if timing == ai_model.TimingWords && word.Confidence > 0 && word.Confidence < LowConfidenceWord {
+			delivery.LowConfidence = append(delivery.LowConfidence, word)
+		}
+	}
+	delivery.PauseSeconds = roundSeconds(delivery.PauseSeconds)
+
+	tokens := make([]string, len(words))
+	for i, word := range words {
+		tokens[i] = spokenToken(word.Word)
+	}
+	delivery.Fillers, delivery.Hedges = countPhrases(tokens)
+	for _, filler := range delivery.Fillers {
+		delivery.FillerCount += filler.Count
+	}
+	for _, hedge := range delivery.Hedges {
+		delivery.HedgeCount += hedge.Count
+	}
+	if minutes > 0 {
+		delivery.FillersPerMinute = math.Round(float64(delivery.FillerCount)/minutes*10) / 10
+	}
+	return delivery
+}
+
+// spokenToken lower-cases a word and strips the punctuation around it, keeping
+// apostrophes so "I'm" stays one word.
+func spokenToken(word string) string {
+	word = strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+	return strings.TrimFunc(word, func(r rune) bool {
+		return r != '\'' && !('a' <= r && r <= 'z') && !('0' <= r && r <= '9')
+	})
+}
+
+// countPhrases counts the filler and hedging phrases in tokens, most frequent first.
+func countPhrases(tokens []string) (fillers []ai_model.PhraseCount, hedges []ai_model.PhraseCount) {
+	type phrase struct {
+		words  []string
+		filler bool
+	}
+	var phrases []phrase
+	for _, text := range fillerPhrases {
+		phrases = append(phrases, phrase{words: strings.Fields(text), filler: true})
+	}
+	for _, text := range hedgePhrases {
+		phrases = append(phrases, phrase{words: strings.Fields(text)})
+	}
+	sort.SliceStable(phrases, func(i, j int) bool { return len(phrases[i].words) > len(phrases[j].words) })
+
+	fillerCounts, hedgeCounts := map[string]int{}, map[string]int{}
+	for i := 0; i < len(tokens); {
+		matched := 0
+		for _, p := range phrases {
+			if !hasPhrase(tokens[i:], p.words) {
+				continue
+			}
+			if p.filler && p.words[0] == "like" && i > 0 && likeVerbs[tokens[i-1]] {
+				continue
+			}
+			text := strings.Join(p.words, " ")
+			if p.filler {
+				fillerCounts[text]++
+			} else {
+				hedgeCounts[text]++
+			}
+			matched = len(p.words)
+			break
+		}
+		i += max(matched, 1)
+	}
+	return phraseCounts(fillerCounts), phraseCounts(hedgeCounts)
+}
+
+func hasPhrase(tokens []string, words []string) bool {
+	if len(tokens) < len(words) {
+		return false
+	}
+	for i, word := range words {
+		if tokens[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+func phraseCounts(counts map[string]int) []ai_model.PhraseCount {
+	var phrases []ai_model.PhraseCount
+	for text, count := range counts {
+		phrases = append(phrases, ai_model.PhraseCount{Phrase: text, Count: count})
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if phrases[i].Count != phrases[j].Count {
+			return phrases[i].Count > phrases[j].Count
+		}
+		return phrases[i].Phrase < phrases[j].Phrase
+	})
+	return phrases
+}
+
+// googleWords reads the word offsets of the best alternative of each result.
+func googleWords(response ai_model.GoogleVertexAiSpeechToTextResponse) []ai_model.TimedWord {
+	var words []ai_model.TimedWord
+	for _, result := range response.VertexAiSpeechToTextResponseResults {
+		if len(result.Alternatives) == 0 {
+			continue
+		}
+		for _, word := range result.Alternatives[0].Words {
+			start, err := time.ParseDuration(word.StartTime)
+			if err != nil {
+				continue
+			}
+			end, err := time.ParseDuration(word.EndTime)
+			if err != nil {
+				end = start
+			}
+			words = append(words, ai_model.TimedWord{Word: word.Word, Start: start.Seconds(), End: end.Seconds(), Confidence: word.Confidence})
+		}
+	}
+	return words
+}
+
+// whisperWords spreads the words of each verbose_json segment evenly over the segment,
+// since Whisper only times segments. Each word gets the segment's confidence, the
+// probability its average token log probability stands for.
+func whisperWords(segments []ai_model.OpenAiTranscriptionSegment) []ai_model.TimedWord {
+	var words []ai_model.TimedWord
+	for _, segment := range segments {
+		fields := strings.Fields(segment.Text)
+		if len(fields) == 0 {
+			continue
+		}
+		step := (segment.End - segment.Start) / float64(len(fields))
+		confidence := math.Exp(math.Min(segment.AvgLogprob, 0))
+		for i, field := range fields {
+			start := segment.Start + float64(i)*step
+			words = append(words, ai_model.TimedWord{Word: field, Start: start, End: start + step, Confidence: confidence})
+		}
+	}
+	return words
+}
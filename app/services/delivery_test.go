@@ -0,0 +1,98 @@
+package service
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	ai_model "up-it-aps-api/app/models/ai"
+	session_model "up-it-aps-api/app/models/session"
+)
+
+// spoken times the words of text at 300ms each from start.
+func spoken(start float64, text string) []ai_model.TimedWord {
+	var words []ai_model.TimedWord
+	for i, word := range strings.Fields(text) {
+		at := start + float64(i)*0.3
+		words = append(words, ai_model.TimedWord{Word: word, Start: at, End: at + 0.3, Confidence: 0.9})
+	}
+	return words
+}
+
+func TestAnalyseDelivery(t *testing.T) {
+	words := spoken(0, "So um I think we basically, like, rebuilt it.")
+	words = append(words, spoken(5.2, "I'd like to say it sort of worked, you know.")...)
+	words[7].Confidence = 0.4
+
+	got := AnalyseDelivery(words, ai_model.TimingWords)
+	want := &ai_model.Delivery{
+		Timing:          ai_model.TimingWords,
+		Words:           19,
+		SpeakingSeconds: 8.2,
+		WordsPerMinute:  139,
+		Pace:            ai_model.PaceSteady,
+		Pauses:          []ai_model.Pause{{At: 2.7, Seconds: 2.5, After: "it."}},
+		PauseSeconds:    2.5,
+		// "I'd like to" is not a filler
+		Fillers:          []ai_model.PhraseCount{{Phrase: "basically", Count: 1}, {Phrase: "like", Count: 1}, {Phrase: "um", Count: 1}, {Phrase: "you know", Count: 1}},
+		FillerCount:      4,
+		FillersPerMinute: 29.3,
+		Hedges:           []ai_model.PhraseCount{{Phrase: "i think", Count: 1}, {Phrase: "sort of", Count: 1}},
+		HedgeCount:       2,
+		LowConfidence:    []ai_model.TimedWord{words[7]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AnalyseDelivery() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	rushed := AnalyseDelivery(spoken(0, strings.Repeat("I'm not sure maybe ", 4)), ai_model.TimingWords)
+	// 16 words in 4.8 seconds, and "i'm not sure" is not counted again as "not sure"
+	if rushed.Pace != ai_model.PaceFast || rushed.HedgeCount != 8 || len(rushed.Hedges) != 2 {
+		t.Errorf("AnalyseDelivery() = %+v, want a fast pace and 8 hedges", rushed)
+	}
+	if AnalyseDelivery(nil, ai_model.TimingWords) != nil {
+		t.Error("AnalyseDelivery() of no words is not nil")
+	}
+}
+
+func TestWhisperWords(t *testing.T) {
+	words := whisperWords([]ai_model.OpenAiTranscriptionSegment{
+		{Start: 0, End: 1, Text: " We shipped it."},
+		{Start: 3.5, End: 4.5, Text: " Um, eventually.", AvgLogprob: -1},
+	})
+	if len(words) != 5 || words[1].Start != 1.0/3 || words[4].Start != 4 || words[4].End != 4.5 {
+		t.Fatalf("whisperWords() = %+v, want the words spread over their segment", words)
+	}
+	if words[0].Confidence != 1 || words[3].Confidence != math.Exp(-1) {
+		t.Errorf("whisperWords() confidence = %v, %v", words[0].Confidence, words[3].Confidence)
+	}
+	// the unsure segment does not say which of its words was unclear
+	if delivery := AnalyseDelivery(words, ai_model.TimingSegments); len(delivery.Pauses) != 1 || delivery.Pauses[0].Seconds != 2.5 || delivery.FillerCount != 1 || len(delivery.LowConfidence) != 0 {
+		t.Errorf("AnalyseDelivery() = %+v, want the pause between segments and no low-confidence words", delivery)
+	}
+}
+
+func TestSessionService_RecordSpokenAnswer(t *testing.T) {
+	service := newTestSessionService(t)
+	email := "test@example.com"
+	interview, err := service.StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "PM"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := service.RecordExchange(interview.ID, "I am ready.", "Tell me about a launch that slipped."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	words := spoken(0, "Um, we sort of shipped it late.")
+	transcription := &ai_model.Transcription{Text: "Um, we sort of shipped it late.", Delivery: AnalyseDelivery(words, ai_model.TimingWords)}
+	if _, err := service.RecordSpokenAnswer(interview.ID, transcription); err != nil {
+		t.Fatalf("RecordSpokenAnswer() failed: %v", err)
+	}
+
+	turn, err := service.GetTurn(interview.ID, 1)
+	if err != nil {
+		t.Fatalf("GetTurn() failed: %v", err)
+	}
+	if turn.Answer != transcription.Text || !reflect.DeepEqual(turn.Delivery, transcription.Delivery) {
+		t.Errorf("turn = %q with delivery %+v, want the answer and its delivery", turn.Answer, turn.Delivery)
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/config"
+)
+
+// FailoverOutcome records which model actually answered and which ones were skipped
+// or failed before it.
+type FailoverOutcome struct {
+	Model      string   `json:"model"`
+	FailedOver []string `json:"failed_over,omitempty"`
+}
+
+// failoverCandidate is one entry of a failover chain. Candidates sharing a breaker key
+// share a breaker, so two models on the same provider trip together.
+type failoverCandidate struct {
+	model      string
+	breakerKey string
+}
+
+// abortFailover wraps an error that must not be retried on the next candidate, e.g. a
+// stream that already sent tokens to the client. client is set when the client failed
+// rather than the provider, e.g. the connection the stream was written to closed.
+type abortFailover struct {
+	err    error
+	client bool
+}
+
+func (e *abortFailover) Error() string {
+	return e.err.Error()
+}
+
+func (e *abortFailover) Unwrap() error {
+	return e.err
+}
+
+func newBreakerRegistry(policy config.FailoverConfig) *breaker.Registry {
+	return breaker.NewRegistry(breaker.Settings{
+		FailureThreshold: policy.BreakerFailureThreshold,
+		OpenTimeout:      policy.BreakerOpenTimeout,
+		HalfOpenProbes:   policy.BreakerHalfOpenProbes,
+	})
+}
+
+// failoverChain puts the user's own choice first, followed by the configured fallbacks.
+func failoverChain(primary string, fallbacks []string) []string {
+	chain := make([]string, 0, len(fallbacks)+1)
+	if primary != "" {
+		chain = append(chain, primary)
+	}
+	for _, model := range fallbacks {
+		if model != primary {
+			chain = append(chain, model)
+		}
+	}
+	return chain
+}
+
+// withFailover tries each candidate in order, skipping those whose breaker is open.
+// Client cancellations and write errors are neither counted as failures nor retried, and
+// errors caused by the request rather than the provider fail over without being counted.
+func withFailover[T any](breakers *breaker.Registry, candidates []failoverCandidate, call func(model string) (T, error)) (T, FailoverOutcome, error) {
+	var zero T
+	var outcome FailoverOutcome
+	lastErr := fmt.Errorf("%w: no candidates", breaker.ErrOpen)
+
+	for _, candidate := range candidates {
+		b := breakers.Get(candidate.breakerKey)
+		if err := b.Allow(); err != nil {
+			outcome.FailedOver = append(outcome.FailedOver, candidate.model)
+			lastErr = fmt.Errorf("%s: %w", candidate.breakerKey, err)
+			continue
+		}
+
+		result, err := call(candidate.model)
+		if err == nil {
+			b.Success()
+			outcome.Model = candidate.model
+			return result, outcome, nil
+		}
+		var abort *abortFailover
+		aborted := errors.As(err, &abort)
+		if aborted {
+			err = abort.err
+		}
+		switch {
+		case errors.Is(err, context.Canceled) || aborted && abort.client:
+			b.Release()
+			return zero, outcome, err
+		case providerFault(err):
+			b.Failure(err)
+		default:
+			b.Release()
+		}
+		if aborted {
+			return zero, outcome, err
+		}
+		outcome.FailedOver = append(outcome.FailedOver, candidate.model)
+		lastErr = err
+	}
+	return zero, outcome, lastErr
+}
+
+// providerFault reports whether err says the provider is unhealthy. Other 4xx responses
+// come from the request itself, such as one user's oversized prompt, and must not open
+// the breaker for everyone.
+func providerFault(err error) bool {
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode < 400 || providerErr.StatusCode >= 500 {
+		return true
+	}
+	switch providerErr.StatusCode {
+	case 401, 403, 408, 429:
+		return true
+	}
+	return false
+}
+
+// Breakers exposes the provider circuit breakers for the admin endpoint.
+func (s *AiService) Breakers() *breaker.Registry {
+	return s.breakers
+}
+
+func (s *AiService) chatCandidates(model string) []failoverCandidate {
+	models := failoverChain(model, s.failover.Chat)
+	candidates := make([]failoverCandidate, 0, len(models))
+	for _, model := range models {
+		provider, err := s.chatProviders.Resolve(model)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, failoverCandidate{model: model, breakerKey: "chat:" + provider.Name()})
+	}
+	return candidates
+}
+
+func (s *AiService) ttsCandidates(model string) []failoverCandidate {
+	models := failoverChain(ttsModelName(model), s.failover.Tts)
+	candidates := make([]failoverCandidate, 0, len(models))
+	for _, model := range models {
+		candidates = append(candidates, failoverCandidate{model: model, breakerKey: "tts:" + model})
+	}
+	return candidates
+}
+
+func (s *AiService) sttCandidates(model string) []failoverCandidate {
+	models := failoverChain(sttModelName(model), s.failover.Stt)
+	candidates := make([]failoverCandidate, 0, len(models))
+	for _, model := range models {
+		candidates = append(candidates, failoverCandidate{model: model, breakerKey: "stt:" + model})
+	}
+	return candidates
+}
+
+// AvailableTtsModel returns the first TTS model in the chain whose breaker is not open.
+// Audio is streamed after the headers are sent, so this is what we report up front.
+func (s *AiService) AvailableTtsModel(model string) string {
+	candidates := s.ttsCandidates(model)
+	for _, candidate := range candidates {
+		if s.breakers.Get(candidate.breakerKey).State() != breaker.Open {
+			return candidate.model
+		}
+	}
+	return ttsModelName(model)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/breaker"
+	"up-it-aps-api/pkg/config"
+)
+
+type failingChatProvider struct {
+	name  string
+	calls int
+	// status is the upstream status code, 500 when zero.
+	status int
+}
+
+func (p *failingChatProvider) Name() string {
+	return p.name
+}
+
+func (p *failingChatProvider) CreateMessage(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error) {
+	p.calls++
+	status := p.status
+	if status == 0 {
+		status = 500
+	}
+	return nil, &ProviderError{Provider: p.name, StatusCode: status, Message: "upstream down"}
+}
+
+func newFailoverTestService(primary ChatProvider, secondary ChatProvider) *AiService {
+	policy := config.FailoverConfig{
+		Chat:                    []string{"gpt-4", "gemini-pro"},
+		BreakerFailureThreshold: 2,
+		BreakerOpenTimeout:      time.Minute,
+	}
+	registry := NewChatProviderRegistry(nil)
+	registry.Register(primary, "gpt-4")
+	registry.Register(secondary, "gemini-pro")
+	return &AiService{
+		chatProviders: registry,
+		failover:      policy,
+		breakers:      newBreakerRegistry(policy),
+	}
+}
+
+func TestAiService_CreateChatCompletionFailsOver(t *testing.T) {
+	openAi := &failingChatProvider{name: "openai"}
+	s := newFailoverTestService(openAi, &stubChatProvider{name: "gemini"})
+
+	for i := 0; i < 3; i++ {
+		result, err := s.CreateChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gpt-4"})
+		if err != nil {
+			t.Fatalf("CreateChatCompletion() failed: %v", err)
+		}
+		if result.Provider != "gemini" || result.Model != "gemini-pro" {
+			t.Errorf("CreateChatCompletion() answered by %s/%s, want gemini/gemini-pro", result.Provider, result.Model)
+		}
+		if len(result.FailedOver) != 1 || result.FailedOver[0] != "gpt-4" {
+			t.Errorf("CreateChatCompletion() FailedOver = %v, want [gpt-4]", result.FailedOver)
+		}
+	}
+
+	// after two consecutive failures the openai breaker is open and no longer called
+	if openAi.calls != 2 {
+		t.Errorf("openai provider called %d times, want 2", openAi.calls)
+	}
+	if state := s.Breakers().Get("chat:openai").State(); state != breaker.Open {
+		t.Errorf("chat:openai breaker state = %v, want open", state)
+	}
+}
+
+func TestAiService_CreateChatCompletionAllProvidersDown(t *testing.T) {
+	s := newFailoverTestService(&failingChatProvider{name: "openai"}, &failingChatProvider{name: "gemini"})
+
+	_, err := s.CreateChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gemini-pro"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Provider != "openai" {
+		t.Errorf("CreateChatCompletion() error = %v, want last provider error from openai", err)
+	}
+}
+
+func TestAiService_StreamDoesNotFailOverAfterTokens(t *testing.T) {
+	s := newFailoverTestService(&stubChatProvider{name: "openai"}, &stubChatProvider{name: "gemini"})
+
+	clientGone := errors.New("client went away")
+	_, err := s.StreamChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gpt-4"}, func(delta string) error {
+		return clientGone
+	})
+	if !errors.Is(err, clientGone) {
+		t.Errorf("StreamChatCompletion() error = %v, want the write error without failover", err)
+	}
+}
+
+func TestAiService_StreamWriteErrorsKeepBreakerClosed(t *testing.T) {
+	s := newFailoverTestService(&stubChatProvider{name: "openai"}, &stubChatProvider{name: "gemini"})
+
+	// clients closing their tabs mid-stream say nothing about the provider
+	for i := 0; i < 3; i++ {
+		s.StreamChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gpt-4"}, func(delta string) error {
+			return errors.New("broken pipe")
+		})
+	}
+	if snapshot := s.Breakers().Get("chat:openai").Snapshot(); snapshot.State != breaker.Closed.String() || snapshot.ConsecutiveFailures != 0 {
+		t.Errorf("chat:openai breaker = %+v, want closed with no failures", snapshot)
+	}
+}
+
+func TestAiService_RequestErrorsKeepBreakerClosed(t *testing.T) {
+	openAi := &failingChatProvider{name: "openai", status: 400}
+	s := newFailoverTestService(openAi, &stubChatProvider{name: "gemini"})
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.CreateChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gpt-4"}); err != nil {
+			t.Fatalf("CreateChatCompletion() failed: %v", err)
+		}
+	}
+	if openAi.calls != 3 || s.Breakers().Get("chat:openai").State() != breaker.Closed {
+		t.Errorf("openai called %d times with breaker %v, want a 400 to leave it closed", openAi.calls, s.Breakers().Get("chat:openai").State())
+	}
+
+	openAi.status = 429
+	for i := 0; i < 2; i++ {
+		s.CreateChatCompletion(context.Background(), ai_model.ChatRequest{Model: "gpt-4"})
+	}
+	if state := s.Breakers().Get("chat:openai").State(); state != breaker.Open {
+		t.Errorf("chat:openai breaker after rate limiting = %v, want open", state)
+	}
+}
+
+func TestFailoverChain(t *testing.T) {
+	got := failoverChain("tts-1", []string{"elevenlabs-multilingual-v1", "tts-1", "vertex"})
+	want := []string{"tts-1", "elevenlabs-multilingual-v1", "vertex"}
+	if len(got) != len(want) {
+		t.Fatalf("failoverChain() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("failoverChain()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
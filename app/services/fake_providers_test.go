@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	user_model "up-it-aps-api/app/models/user"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/fakeproviders"
+	"up-it-aps-api/platform/database"
+)
+
+// newFakeProviderService wires an AiService and a test database to a fake provider server. The breaker
+// threshold is high so injected errors never open a breaker between subtests.
+func newFakeProviderService(t *testing.T) (*AiService, *fakeproviders.Server) {
+	t.Helper()
+	db := setupTestDB(t)
+	database.DBConn = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	})
+
+	fake := fakeproviders.NewServer()
+	t.Cleanup(fake.Close)
+	s := NewAiService(NewUserService(), config.AIConfig{
+		Endpoints: fake.Endpoints(),
+		Failover:  config.FailoverConfig{BreakerFailureThreshold: 100, BreakerOpenTimeout: time.Minute},
+	})
+	if _, err := s.userService.CreateUser(&user_model.InputUser{Email: "test@example.com"}); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	return s, fake
+}
+
+func TestAiService_ChatAgainstFakeProviders(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	fake.Script(fakeproviders.RouteGeminiGenerate, fakeproviders.Response{Text: "Describe a time you disagreed with your manager."})
+
+	tests := []struct {
+		model    string
+		provider string
+		want     string
+	}{
+		{model: "gpt-4", provider: "openai", want: fakeproviders.DefaultReply},
+		{model: "gemini-pro", provider: "gemini", want: "Describe a time you disagreed with your manager."},
+		{model: "googler", provider: "openai-assistants", want: fakeproviders.DefaultReply},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			result, err := s.CreateChatCompletion(context.Background(), ai_model.ChatRequest{
+				Model:        tt.model,
+				SystemPrompt: "be brief",
+				Messages:     []ai_model.MessageRequest{{Role: "user", Content: "Hi, I am ready."}},
+			})
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() failed: %v", err)
+			}
+			if result.Provider != tt.provider || result.Text != tt.want {
+				t.Errorf("CreateChatCompletion() = %s %q, want %s %q", result.Provider, result.Text, tt.provider, tt.want)
+			}
+		})
+	}
+}
+
+func TestAiService_StreamAgainstFakeProviders(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+
+	for _, model := range []string{"gpt-4", "gemini-pro"} {
+		t.Run(model, func(t *testing.T) {
+			var deltas int
+			result, err := s.StreamChatCompletion(context.Background(), ai_model.ChatRequest{
+				Model:    model,
+				Messages: []ai_model.MessageRequest{{Role: "user", Content: "Hi"}},
+			}, func(delta string) error {
+				deltas++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("StreamChatCompletion() failed: %v", err)
+			}
+			if result.Text != fakeproviders.DefaultReply || deltas < 2 {
+				t.Errorf("StreamChatCompletion() = %q in %d deltas", result.Text, deltas)
+			}
+			if result.Usage.TotalTokens == 0 {
+				t.Errorf("StreamChatCompletion() usage = %+v, want token counts", result.Usage)
+			}
+		})
+	}
+}
+
+func TestAiService_AudioAgainstFakeProviders(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+
+	for _, model := range []string{"vertex", "unreal-speech", "elevenlabs-multilingual-v1", "tts-1"} {
+		t.Run(model, func(t *testing.T) {
+			audio, outcome, err := s.GenerateAudio(context.Background(), model, ai_model.VoiceOptions{}, []byte("Hello"), "test@example.com")
+			if err != nil {
+				t.Fatalf("GenerateAudio() failed: %v", err)
+			}
+			if outcome.Model != model || !bytes.Equal(audio, fakeproviders.FakeAudio("Hello")) {
+				t.Errorf("GenerateAudio() = %q from %s", audio, outcome.Model)
+			}
+		})
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		s.failover.Tts = []string{"tts-1"}
+		fake.Fail(fakeproviders.RouteElevenLabs, http.StatusInternalServerError, 1)
+		_, outcome, err := s.GenerateAudio(context.Background(), "elevenlabs-multilingual-v1", ai_model.VoiceOptions{}, []byte("Hello"), "test@example.com")
+		if err != nil {
+			t.Fatalf("GenerateAudio() failed: %v", err)
+		}
+		if outcome.Model != "tts-1" || len(outcome.FailedOver) != 1 {
+			t.Errorf("GenerateAudio() outcome = %+v, want failover to tts-1", outcome)
+		}
+	})
+
+	t.Run("no credits", func(t *testing.T) {
+		database.DBConn.Model(&user_model.User{}).Where("email = ?", "test@example.com").Update("credits", 0)
+		if _, _, err := s.GenerateAudio(context.Background(), "tts-1", ai_model.VoiceOptions{}, []byte("Hello"), "test@example.com"); !errors.Is(err, ErrNoCredits) {
+			t.Errorf("GenerateAudio() without credits error = %v, want ErrNoCredits", err)
+		}
+	})
+}
+
+func TestAiService_TranscribeAgainstFakeProviders(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	audio := make([]byte, 64000)
+
+	tests := []struct {
+		model       string
+		wantSeconds float64
+		wantTiming  string
+	}{
+		{model: "whisper-1", wantSeconds: 2, wantTiming: ai_model.TimingSegments},
+		{model: "vertex", wantSeconds: 6, wantTiming: ai_model.TimingWords},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			transcription, err := s.Transcribe(context.Background(), tt.model, audio)
+			if err != nil {
+				t.Fatalf("Transcribe() failed: %v", err)
+			}
+			if transcription.Text != fakeproviders.DefaultTranscript || transcription.AudioSeconds != tt.wantSeconds {
+				t.Errorf("Transcribe() = %q, %vs", transcription.Text, transcription.AudioSeconds)
+			}
+			// the fakes time 14 words at 400ms each
+			if delivery := transcription.Delivery; delivery == nil || delivery.Timing != tt.wantTiming || delivery.Words != 14 || delivery.WordsPerMinute != 150 {
+				t.Errorf("Transcribe() delivery = %+v, want 14 words at 150 wpm timed by %s", delivery, tt.wantTiming)
+			}
+		})
+	}
+}
+
+func TestAiService_OpenAiCompatibleAgainstFakeProviders(t *testing.T) {
+	fake := fakeproviders.NewServer()
+	defer fake.Close()
+	s := NewAiService(NewUserService(), config.AIConfig{
+		Endpoints: fake.Endpoints(),
+		// the fake OpenAI routes stand in for a self-hosted server
+		OpenAICompatible: config.OpenAICompatibleConfig{BaseURL: fake.Endpoints().OpenAI, Models: []string{"llama3"}},
+	})
+
+	request := ai_model.ChatRequest{Model: "llama3", Messages: []ai_model.MessageRequest{{Role: "user", Content: "Hi"}}}
+	result, err := s.CreateChatCompletion(context.Background(), request)
+	if err != nil {
+		t.Fatalf("CreateChatCompletion() failed: %v", err)
+	}
+	if result.Provider != "openai-compatible" || result.Model != "llama3" {
+		t.Errorf("CreateChatCompletion() answered by %s/%s", result.Provider, result.Model)
+	}
+
+	streamed, err := s.StreamChatCompletion(context.Background(), request, func(delta string) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamChatCompletion() failed: %v", err)
+	}
+	if streamed.Provider != "openai-compatible" || streamed.Text != fakeproviders.DefaultReply {
+		t.Errorf("StreamChatCompletion() = %+v", streamed)
+	}
+}
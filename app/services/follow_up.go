@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+)
+
+var (
+	ErrFollowUpOutput  = errors.New("generator did not return valid follow-up questions")
+	ErrFollowUpLimit   = errors.New("no follow-ups are left for this question")
+	ErrFollowUpTooLate = errors.New("the interview has moved on from this turn")
+)
+
+// answerGap is something the candidate's answer fell short on, for a follow-up to probe.
+type answerGap struct {
+	Key    string
+	Detail string
+}
+
+// GenerateFollowUps has the judge model write probing questions about the gaps in the
+// answer of the latest turn of an in-progress session: the rubric criteria its latest
+// score fell short on and any STAR flags. Up to the session's MaxFollowUps are allowed per
+// question, counting those already asked; the new ones replace any still waiting and are
+// asked before the interviewer moves on.
+func (s *ScoringService) GenerateFollowUps(ctx context.Context, sessionID uint, email string, turnNumber int) ([]session_model.FollowUp, error) {
+	interview, turn, err := s.answeredTurn(sessionID, email, turnNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !interview.Active() {
+		return nil, fmt.Errorf("%w: it is %s", ErrSessionNotActive, interview.Status)
+	}
+	// the session's copy of the turn comes with its STAR analysis
+	if turn = interview.Turns[len(interview.Turns)-1]; turn.Number != turnNumber {
+		return nil, ErrFollowUpTooLate
+	}
+	root := rootTurn(interview.Turns, turn)
+	var asked []session_model.FollowUp
+	for _, followUp := range root.FollowUps {
+		if followUp.Asked() {
+			asked = append(asked, followUp)
+		}
+	}
+	allowed := interview.MaxFollowUps - len(asked)
+	if allowed <= 0 {
+		return nil, fmt.Errorf("%w: %d of %d asked", ErrFollowUpLimit, len(asked), interview.MaxFollowUps)
+	}
+
+	scores, err := s.GetTurnScores(interview.ID, email, turn.Number)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, ErrTurnNotScoredYet
+	}
+	gaps := answerGaps(scores[0], turn.Star)
+
+	followUps := []session_model.FollowUp{}
+	if len(gaps) > 0 {
+		var parsed []session_model.FollowUp
+		_, attempts, problems, err := s.askJudge(ctx, followUpRequest(s.judge.Model, interview, root, turn, gaps, allowed), func(text string) []string {
+			var problems []string
+			parsed, problems = parseFollowUps(text, gaps, allowed)
+			return problems
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(problems) > 0 {
+			return nil, fmt.Errorf("%w after %d attempts: %s", ErrFollowUpOutput, attempts, strings.Join(problems, "; "))
+		}
+		followUps = parsed
+	}
+
+	root.FollowUps = append(asked, followUps...)
+	var db = database.DBConn
+	if err := db.Model(&root).Select("follow_ups").Updates(&root).Error; err != nil {
+		return nil, err
+	}
+	return followUps, nil
+}
+
+// answerGaps lists the criteria score fell short on, the biggest weighted shortfall
+// first, then the STAR components star flagged.
+func answerGaps(score scoring_model.TurnScore, star *session_model.StarAnalysis) []answerGap {
+	criteria := make([]scoring_model.CriterionScore, len(score.Criteria))
+	copy(criteria, score.Criteria)
+	shortfall := func(i int) float64 {
+		if criteria[i].MaxScore <= 0 {
+			return 0
+		}
+		return criteria[i].Weight * float64(criteria[i].MaxScore-criteria[i].Score) / float64(criteria[i].MaxScore)
+	}
+	sort.SliceStable(criteria, func(i, j int) bool {
+		return shortfall(i) > shortfall(j)
+	})
+
+	var gaps []answerGap
+	for i, criterion := range criteria {
+		if shortfall(i) <= 0 {
+			continue
+		}
+		gaps = append(gaps, answerGap{
+			Key:    criterion.Criterion,
+			Detail: fmt.Sprintf("scored %d of %d: %s", criterion.Score, criterion.MaxScore, criterion.Justification),
+		})
+	}
+	if star != nil {
+		for _, flag := range star.Flags {
+			gaps = append(gaps, answerGap{Key: flag.Part, Detail: flag.Message})
+		}
+	}
+	return gaps
+}
+
+// followUpOutput is the JSON the generator is asked to reply with.
+type followUpOutput struct {
+	FollowUps []struct {
+		Gap      string `json:"gap"`
+		Question string `json:"question"`
+	} `json:"follow_ups"`
+}
+
+func followUpRequest(model string, interview session_model.InterviewSession, root session_model.SessionTurn, turn session_model.SessionTurn, gaps []answerGap, allowed int) ai_model.ChatRequest {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "You are an experienced interview panel member. Write at most %d short follow-up questions that probe the gaps listed below in the candidate's answer, ", allowed)
+	prompt.WriteString("one gap per question, most important gap first. Refer to what the candidate actually said, for example: \"You said 'we' - what did you personally do?\". ")
+	prompt.WriteString("Do not ask about anything the answer already covers, and write fewer questions if fewer gaps are worth probing.\n\n")
+	prompt.WriteString("Reply with only a JSON object of this shape, using the gap keys below:\n")
+	prompt.WriteString(`{"follow_ups": [{"gap": "<key>", "question": "<text>"}]}`)
+
+	var answer strings.Builder
+	fmt.Fprintf(&answer, "Interview type: %s\nTarget role: %s\nQuestion: %s\n", interview.Type, interview.TargetRole, root.Question)
+	if turn.Number != root.Number {
+		fmt.Fprintf(&answer, "Follow-up question: %s\n", turn.Question)
+	}
+	fmt.Fprintf(&answer, "Candidate's answer: %s\n\nGaps:\n", turn.Answer)
+	for _, gap := range gaps {
+		fmt.Fprintf(&answer, "- %s: %s\n", gap.Key, gap.Detail)
+	}
+
+	temperature := float32(0)
+	return ai_model.ChatRequest{
+		Model:        model,
+		SystemPrompt: prompt.String(),
+		Temperature:  &temperature,
+		MaxTokens:    JudgeMaxTokens,
+		JSONOutput:   true,
+		Messages:     []ai_model.MessageRequest{{Role: "user", Content: answer.String()}},
+	}
+}
+
+// parseFollowUps extracts the generator's JSON from text and checks there are at most
+// allowed questions, each about one of gaps. It returns what was wrong with it, if
+// anything.
+func parseFollowUps(text string, gaps []answerGap, allowed int) ([]session_model.FollowUp, []string) {
+	var output followUpOutput
+	if err := json.Unmarshal([]byte(extractJSONObject(text)), &output); err != nil {
+		return nil, []string{fmt.Sprintf("the reply is not a valid JSON object (%v)", err)}
+	}
+
+	var problems []string
+	if len(output.FollowUps) > allowed {
+		problems = append(problems, fmt.Sprintf("there are %d follow-ups, at most %d are allowed", len(output.FollowUps), allowed))
+	}
+	known := make(map[string]bool)
+	for _, gap := range gaps {
+		known[gap.Key] = true
+	}
+	seen := make(map[string]bool)
+	followUps := []session_model.FollowUp{}
+	for i, given := range output.FollowUps {
+		question := strings.TrimSpace(given.Question)
+		switch {
+		case question == "":
+			problems = append(problems, fmt.Sprintf("follow-up %d has no question", i+1))
+		case seen[strings.ToLower(question)]:
+			problems = append(problems, fmt.Sprintf("follow-up %d repeats an earlier question", i+1))
+		case !known[given.Gap]:
+			problems = append(problems, fmt.Sprintf("follow-up %d is about %q, which is not one of the gaps", i+1, given.Gap))
+		}
+		seen[strings.ToLower(question)] = true
+		followUps = append(followUps, session_model.FollowUp{Question: question, Gap: given.Gap})
+	}
+	return followUps, problems
+}
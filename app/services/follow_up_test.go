@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	question_model "up-it-aps-api/app/models/question"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestAnswerGaps(t *testing.T) {
+	score := scoring_model.TurnScore{Criteria: []scoring_model.CriterionScore{
+		{Criterion: "structure", Score: 3, MaxScore: 4, Weight: 1},
+		{Criterion: "ownership", Score: 2, MaxScore: 4, Weight: 1.5, Justification: "Says 'we' throughout."},
+		{Criterion: "impact", Score: 4, MaxScore: 4, Weight: 1},
+	}}
+	star := &session_model.StarAnalysis{Flags: []session_model.StarFlag{{Part: session_model.StarResult, Issue: session_model.StarIssueWeak, Message: "The result has nothing measurable in it."}}}
+
+	var keys []string
+	for _, gap := range answerGaps(score, star) {
+		keys = append(keys, gap.Key)
+	}
+	if strings.Join(keys, ",") != "ownership,structure,result" {
+		t.Errorf("answerGaps() keys = %v, want the biggest shortfall first, no full marks and the STAR flag last", keys)
+	}
+	if gaps := answerGaps(scoring_model.TurnScore{}, nil); len(gaps) != 0 {
+		t.Errorf("answerGaps() with nothing short = %+v, want none", gaps)
+	}
+}
+
+func TestParseFollowUps(t *testing.T) {
+	gaps := []answerGap{{Key: "ownership"}, {Key: "impact"}}
+	tests := []struct {
+		name     string
+		text     string
+		count    int
+		problems []string
+	}{
+		{
+			name:  "valid in a code fence",
+			text:  "```json\n{\"follow_ups\": [{\"gap\": \"ownership\", \"question\": \"You said 'we' - what did you personally do?\"}]}\n```",
+			count: 1,
+		},
+		{
+			name: "none worth asking",
+			text: `{"follow_ups": []}`,
+		},
+		{
+			name:     "not json",
+			text:     "What did you personally do?",
+			problems: []string{"the reply is not a valid JSON object"},
+		},
+		{
+			name:  "too many, empty, repeated and unknown gap",
+			text:  `{"follow_ups": [{"gap": "ownership", "question": "What did you do?"}, {"gap": "impact", "question": " "}, {"gap": "impact", "question": "what did you do?"}, {"gap": "clarity", "question": "Can you be clearer?"}]}`,
+			count: 4,
+			problems: []string{
+				"there are 4 follow-ups, at most 2 are allowed",
+				"follow-up 2 has no question",
+				"follow-up 3 repeats an earlier question",
+				`follow-up 4 is about "clarity"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			followUps, problems := parseFollowUps(tt.text, gaps, 2)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("parseFollowUps() problems = %q, want %q", problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+				}
+			}
+			if len(followUps) != tt.count {
+				t.Errorf("parseFollowUps() = %+v, want %d follow-ups", followUps, tt.count)
+			}
+		})
+	}
+}
+
+func TestScoringService_FollowUpsInSessionFlow(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	for _, input := range []question_model.InputQuestion{
+		{Prompt: "Tell me about a time you led change.", Competency: "leadership", Difficulty: 2},
+		{Prompt: "Tell me about a time you resolved a conflict.", Competency: "leadership", Difficulty: 2},
+	} {
+		input := input
+		if _, err := NewQuestionService().CreateQuestion(&input); err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+	}
+
+	email := "test@example.com"
+	tooMany := MaxFollowUpsLimit + 1
+	if _, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", MaxFollowUps: &tooMany}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("StartSession() with %d follow-ups error = %v, want ErrInvalidSession", tooMany, err)
+	}
+	one := 1
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:          session_model.TypeBehavioral,
+		TargetRole:    "APS EL1",
+		Questions:     &question_model.QuestionFilter{Competency: "leadership"},
+		QuestionCount: 2,
+		MaxFollowUps:  &one,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Tell me about a time you led change."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "We moved our team to a new case system and it went well."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	if _, err := s.Scoring().GenerateFollowUps(context.Background(), interview.ID, email, 1); !errors.Is(err, ErrTurnNotScoredYet) {
+		t.Errorf("GenerateFollowUps() before scoring error = %v, want ErrTurnNotScoredYet", err)
+	}
+
+	score := func(turn int) {
+		t.Helper()
+		fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: `{"scores": [
+			{"criterion": "structure", "score": 3, "justification": "Clear enough."},
+			{"criterion": "ownership", "score": 1, "justification": "Only says what 'we' did."},
+			{"criterion": "impact", "score": 2, "justification": "Went well is not measured."}
+		]}`})
+		if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, turn, ""); err != nil {
+			t.Fatalf("ScoreTurn() failed: %v", err)
+		}
+	}
+	score(1)
+	fake.Script(fakeproviders.RouteOpenAiChat,
+		fakeproviders.Response{Text: `{"follow_ups": [{"gap": "ownership", "question": "You said 'we' - what did you personally do?"}, {"gap": "impact", "question": "How did you measure that it went well?"}]}`},
+		fakeproviders.Response{Text: `{"follow_ups": [{"gap": "ownership", "question": "You said 'we' - what did you personally do?"}]}`},
+	)
+	followUps, err := s.Scoring().GenerateFollowUps(context.Background(), interview.ID, email, 1)
+	if err != nil {
+		t.Fatalf("GenerateFollowUps() failed: %v", err)
+	}
+	if len(followUps) != 1 || followUps[0].Gap != "ownership" || followUps[0].Asked() {
+		t.Errorf("GenerateFollowUps() = %+v, want one pending ownership follow-up", followUps)
+	}
+	last := string(fake.LastRequest(fakeproviders.RouteOpenAiChat))
+	for _, want := range []string{"ownership: scored 1 of 4", "at most 1 are allowed"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("follow-up request does not contain %q: %s", want, last)
+		}
+	}
+
+	interview, _ = s.Sessions().GetSession(interview.ID, email)
+	if instruction := s.Sessions().Instruction(interview); !strings.Contains(instruction, "what did you personally do?") {
+		t.Errorf("Instruction() = %q, want the follow-up before the next question", instruction)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "", "You said 'we' - what did you personally do?"); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "I ran the training myself."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	score(2)
+	if _, err := s.Scoring().GenerateFollowUps(context.Background(), interview.ID, email, 2); !errors.Is(err, ErrFollowUpLimit) {
+		t.Errorf("GenerateFollowUps() past the limit error = %v, want ErrFollowUpLimit", err)
+	}
+
+	interview, _ = s.Sessions().GetSession(interview.ID, email)
+	if next, ok := s.Sessions().NextQuestion(interview); !ok || next.ID != interview.QuestionIDs[1] {
+		t.Errorf("NextQuestion() after the follow-up = %+v, want the second planned question", next)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "", "Tell me about a time you resolved a conflict."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	interview, _ = s.Sessions().GetSession(interview.ID, email)
+	turns := interview.Turns
+	if len(turns) != 3 || turns[0].FollowUps[0].Turn != 2 || turns[1].FollowUpOf != 1 || turns[1].QuestionID != 0 || turns[2].QuestionID != interview.QuestionIDs[1] {
+		t.Errorf("turns = %+v, want the follow-up between the two planned questions", turns)
+	}
+	if _, err := s.Scoring().GenerateFollowUps(context.Background(), interview.ID, email, 1); !errors.Is(err, ErrFollowUpTooLate) {
+		t.Errorf("GenerateFollowUps() on an earlier turn error = %v, want ErrFollowUpTooLate", err)
+	}
+}
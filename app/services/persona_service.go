@@ -0,0 +1,284 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	persona_model "up-it-aps-api/app/models/persona"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPersonaSlug is used when neither the conversation nor the user picked a persona.
+const DefaultPersonaSlug = "swe-tutor"
+
+var (
+	ErrPersonaNotFound  = errors.New("persona not found")
+	ErrPersonaSlugTaken = errors.New("persona slug already exists")
+	ErrDefaultPersona   = errors.New("the default persona cannot be deleted")
+	ErrInvalidPersona   = errors.New("invalid persona")
+)
+
+var personaSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// DefaultPersonas are seeded on startup when missing. The SWE tutor carries the prompt
+// that used to be the hard-coded Role constant.
+var DefaultPersonas = []persona_model.Persona{
+	{
+		Slug:           DefaultPersonaSlug,
+		Name:           "SWE tutor",
+		Description:    "A senior engineer coaching you through a software engineering mock interview.",
+		SystemPrompt:   "You are highly skilled software engineer for a big tech company. You're currently tutoring a candidate for a SWE (Software Engineer) role in a mock interview scenario. You are well versed in algorithms and data structures and can assist and provide feedback. Be short and concise with your responses.",
+		WordLimit:      40,
+		Temperature:    1.0,
+		PreferredVoice: ElevenLabsAmericanAccent,
+		InterviewStyle: persona_model.StyleTutor,
+	},
+	{
+		Slug:           "aps-el1-panel-chair",
+		Name:           "APS EL1 panel chair",
+		Description:    "Chairs an Australian Public Service selection panel for an Executive Level 1 role.",
+		SystemPrompt:   "You are the chair of an Australian Public Service selection panel interviewing a candidate for an Executive Level 1 (EL1) role. Ask one behavioural question at a time, drawn from the Integrated Leadership System capabilities: shapes strategic thinking, achieves results, cultivates productive working relationships, exemplifies personal drive and integrity, and communicates with influence. Expect answers in the STAR format and probe for the candidate's own actions and measurable outcomes. Stay formal, neutral and courteous, and do not give feedback until the candidate asks for it.",
+		WordLimit:      60,
+		Temperature:    0.7,
+		PreferredVoice: ElevenLabsAustralianAccent,
+		InterviewStyle: persona_model.StylePanel,
+	},
+	{
+		Slug:           "faang-swe-interviewer",
+		Name:           "FAANG SWE interviewer",
+		Description:    "Runs a technical coding and system design loop the way large tech companies do.",
+		SystemPrompt:   "You are a software engineer at a large tech company running a technical interview. Present one coding or system design problem at a time, let the candidate drive, and ask about complexity, edge cases and trade-offs. Give hints only when the candidate is stuck, and never write the full solution for them.",
+		WordLimit:      50,
+		Temperature:    0.7,
+		PreferredVoice: ElevenLabsAmericanAccent,
+		InterviewStyle: persona_model.StyleTechnical,
+	},
+	{
+		Slug:           "friendly-hr-screener",
+		Name:           "Friendly HR screener",
+		Description:    "A warm first-round phone screen about motivation, experience and logistics.",
+		SystemPrompt:   "You are a friendly recruiter running a first-round screening call. Ask about the candidate's background, motivation for the role, salary expectations and availability, one question at a time. Keep a warm, encouraging tone and acknowledge their answers briefly before moving on.",
+		WordLimit:      45,
+		Temperature:    1.0,
+		PreferredVoice: ElevenLabsAustralianAccent,
+		InterviewStyle: persona_model.StyleConversational,
+	},
+}
+
+type PersonaService struct {
+}
+
+func NewPersonaService() *PersonaService {
+	return &PersonaService{}
+}
+
+// SeedDefaults creates the DefaultPersonas that do not exist yet. Existing personas are
+// left alone so admin edits survive a restart.
+func (s *PersonaService) SeedDefaults() error {
+	for _, persona := range DefaultPersonas {
+		_, err := s.GetPersonaBySlug(persona.Slug)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrPersonaNotFound) {
+			return err
+		}
+		if _, err := s.create(persona); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PersonaService) GetPersonas() []persona_model.Persona {
+	var db = database.DBConn
+	var personas []persona_model.Persona
+	db.Order("name ASC").Find(&personas)
+	return personas
+}
+
+func (s *PersonaService) GetPersona(id uint) (persona_model.Persona, error) {
+	return s.find(database.DBConn.Where("id = ?", id))
+}
+
+func (s *PersonaService) GetPersonaBySlug(slug string) (persona_model.Persona, error) {
+	return s.find(database.DBConn.Where("slug = ?", slug))
+}
+
+func (s *PersonaService) find(query *gorm.DB) (persona_model.Persona, error) {
+	var persona persona_model.Persona
+	result := query.First(&persona)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return persona_model.Persona{}, ErrPersonaNotFound
+	}
+	if result.Error != nil {
+		return persona_model.Persona{}, result.Error
+	}
+	return persona, nil
+}
+
+// GetPersonaVersions lists every stored version of a persona, newest first. Deleted
+// personas keep their history so old transcripts can still be explained.
+func (s *PersonaService) GetPersonaVersions(id uint) ([]persona_model.PersonaVersion, error) {
+	var db = database.DBConn
+	var versions []persona_model.PersonaVersion
+	result := db.Where("persona_id = ?", id).Order("version DESC").Find(&versions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(versions) == 0 {
+		return nil, ErrPersonaNotFound
+	}
+	return versions, nil
+}
+
+func (s *PersonaService) GetPersonaVersion(id uint, version uint) (persona_model.PersonaVersion, error) {
+	var db = database.DBConn
+	var personaVersion persona_model.PersonaVersion
+	result := db.Where("persona_id = ? AND version = ?", id, version).First(&personaVersion)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return persona_model.PersonaVersion{}, ErrPersonaNotFound
+	}
+	if result.Error != nil {
+		return persona_model.PersonaVersion{}, result.Error
+	}
+	return personaVersion, nil
+}
+
+func (s *PersonaService) CreatePersona(input *persona_model.InputPersona) (persona_model.Persona, error) {
+	if err := validatePersona(input); err != nil {
+		return persona_model.Persona{}, err
+	}
+	if _, err := s.GetPersonaBySlug(input.Slug); err == nil {
+		return persona_model.Persona{}, ErrPersonaSlugTaken
+	}
+	return s.create(persona_model.Persona{
+		Slug:           input.Slug,
+		Name:           input.Name,
+		Description:    input.Description,
+		SystemPrompt:   input.SystemPrompt,
+		WordLimit:      input.WordLimit,
+		Temperature:    input.Temperature,
+		PreferredVoice: input.PreferredVoice,
+		InterviewStyle: input.InterviewStyle,
+	})
+}
+
+func (s *PersonaService) create(persona persona_model.Persona) (persona_model.Persona, error) {
+	var db = database.DBConn
+	persona.Version = 1
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&persona).Error; err != nil {
+			return err
+		}
+		snapshot := persona.Snapshot()
+		return tx.Create(&snapshot).Error
+	})
+	if err != nil {
+		return persona_model.Persona{}, err
+	}
+	return persona, nil
+}
+
+// UpdatePersona applies input to the persona. Changes to the prompt, word limit,
+// temperature, voice or style create a new version; name and description edits do not.
+func (s *PersonaService) UpdatePersona(id uint, input *persona_model.InputPersona) (persona_model.Persona, error) {
+	if err := validatePersona(input); err != nil {
+		return persona_model.Persona{}, err
+	}
+	persona, err := s.GetPersona(id)
+	if err != nil {
+		return persona_model.Persona{}, err
+	}
+	if input.Slug != persona.Slug {
+		if _, err := s.GetPersonaBySlug(input.Slug); err == nil {
+			return persona_model.Persona{}, ErrPersonaSlugTaken
+		}
+	}
+
+	versioned := persona.SystemPrompt != input.SystemPrompt ||
+		persona.WordLimit != input.WordLimit ||
+		persona.Temperature != input.Temperature ||
+		persona.PreferredVoice != input.PreferredVoice ||
+		persona.InterviewStyle != input.InterviewStyle
+
+	persona.Slug = input.Slug
+	persona.Name = input.Name
+	persona.Description = input.Description
+	persona.SystemPrompt = input.SystemPrompt
+	persona.WordLimit = input.WordLimit
+	persona.Temperature = input.Temperature
+	persona.PreferredVoice = input.PreferredVoice
+	persona.InterviewStyle = input.InterviewStyle
+	if versioned {
+		persona.Version++
+	}
+
+	var db = database.DBConn
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&persona).Error; err != nil {
+			return err
+		}
+		if !versioned {
+			return nil
+		}
+		snapshot := persona.Snapshot()
+		return tx.Create(&snapshot).Error
+	})
+	if err != nil {
+		return persona_model.Persona{}, err
+	}
+	return persona, nil
+}
+
+// DeletePersona soft deletes the persona. Its versions are kept.
+func (s *PersonaService) DeletePersona(id uint) error {
+	persona, err := s.GetPersona(id)
+	if err != nil {
+		return err
+	}
+	if persona.Slug == DefaultPersonaSlug {
+		return ErrDefaultPersona
+	}
+	var db = database.DBConn
+	return db.Delete(&persona).Error
+}
+
+// ResolvePersona returns the persona for a conversation. A conversation keeps the
+// persona it started with, even if that persona was deleted since; otherwise the first
+// known slug wins, falling back to the default persona.
+func (s *PersonaService) ResolvePersona(personaID uint, slugs ...string) persona_model.Persona {
+	if personaID != 0 {
+		if persona, err := s.find(database.DBConn.Unscoped().Where("id = ?", personaID)); err == nil {
+			return persona
+		}
+	}
+	for _, slug := range append(slugs, DefaultPersonaSlug) {
+		if slug == "" {
+			continue
+		}
+		if persona, err := s.GetPersonaBySlug(slug); err == nil {
+			return persona
+		}
+	}
+	// not seeded yet, answer with the built-in default rather than no prompt at all
+	return DefaultPersonas[0]
+}
+
+func validatePersona(input *persona_model.InputPersona) error {
+	switch {
+	case !personaSlugPattern.MatchString(input.Slug):
+		return fmt.Errorf("%w: slug must be lowercase letters, digits and dashes", ErrInvalidPersona)
+	case input.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPersona)
+	case input.SystemPrompt == "":
+		return fmt.Errorf("%w: system_prompt is required", ErrInvalidPersona)
+	case input.WordLimit < 0:
+		return fmt.Errorf("%w: word_limit cannot be negative", ErrInvalidPersona)
+	case input.Temperature < 0 || input.Temperature > 2:
+		return fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidPersona)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	persona_model "up-it-aps-api/app/models/persona"
+	"up-it-aps-api/platform/database"
+)
+
+func TestPersonaService_SeedDefaults(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewPersonaService()
+	if err := service.SeedDefaults(); err != nil {
+		t.Fatalf("SeedDefaults() failed: %v", err)
+	}
+	// seeding twice must not duplicate or reset anything
+	if err := service.SeedDefaults(); err != nil {
+		t.Fatalf("second SeedDefaults() failed: %v", err)
+	}
+
+	personas := service.GetPersonas()
+	if len(personas) != len(DefaultPersonas) {
+		t.Fatalf("GetPersonas() returned %d personas, want %d", len(personas), len(DefaultPersonas))
+	}
+
+	tutor, err := service.GetPersonaBySlug(DefaultPersonaSlug)
+	if err != nil {
+		t.Fatalf("GetPersonaBySlug() failed: %v", err)
+	}
+	want := "You are highly skilled software engineer for a big tech company. You're currently tutoring a candidate for a SWE (Software Engineer) role in a mock interview scenario. You are well versed in algorithms and data structures and can assist and provide feedback. Be short and concise with your responses. Never respond with more than 40 words."
+	if tutor.Prompt() != want {
+		t.Errorf("Prompt() = %q, want the former Role prompt", tutor.Prompt())
+	}
+}
+
+func TestPersonaService_Versioning(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewPersonaService()
+	input := &persona_model.InputPersona{
+		Slug:         "bank-panel",
+		Name:         "Bank panel",
+		SystemPrompt: "You interview graduates for a bank.",
+		WordLimit:    50,
+		Temperature:  0.5,
+	}
+	persona, err := service.CreatePersona(input)
+	if err != nil {
+		t.Fatalf("CreatePersona() failed: %v", err)
+	}
+	if persona.Version != 1 {
+		t.Errorf("Version = %d, want 1", persona.Version)
+	}
+	if _, err := service.CreatePersona(input); !errors.Is(err, ErrPersonaSlugTaken) {
+		t.Errorf("CreatePersona() with taken slug error = %v, want ErrPersonaSlugTaken", err)
+	}
+
+	// Renaming does not change what the model sees, so no new version
+	input.Name = "Retail bank panel"
+	persona, err = service.UpdatePersona(persona.ID, input)
+	if err != nil {
+		t.Fatalf("UpdatePersona() failed: %v", err)
+	}
+	if persona.Version != 1 {
+		t.Errorf("Version after rename = %d, want 1", persona.Version)
+	}
+
+	input.SystemPrompt = "You interview graduates for a retail bank."
+	persona, err = service.UpdatePersona(persona.ID, input)
+	if err != nil {
+		t.Fatalf("UpdatePersona() failed: %v", err)
+	}
+	if persona.Version != 2 {
+		t.Errorf("Version after prompt change = %d, want 2", persona.Version)
+	}
+
+	versions, err := service.GetPersonaVersions(persona.ID)
+	if err != nil {
+		t.Fatalf("GetPersonaVersions() failed: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 {
+		t.Fatalf("GetPersonaVersions() = %+v, want versions 2 and 1", versions)
+	}
+	first, err := service.GetPersonaVersion(persona.ID, 1)
+	if err != nil {
+		t.Fatalf("GetPersonaVersion() failed: %v", err)
+	}
+	if first.SystemPrompt != "You interview graduates for a bank." {
+		t.Errorf("version 1 prompt = %q", first.SystemPrompt)
+	}
+
+	// Deleted personas still answer for the conversations that used them
+	if err := service.DeletePersona(persona.ID); err != nil {
+		t.Fatalf("DeletePersona() failed: %v", err)
+	}
+	if _, err := service.GetPersona(persona.ID); !errors.Is(err, ErrPersonaNotFound) {
+		t.Errorf("GetPersona() after delete error = %v, want ErrPersonaNotFound", err)
+	}
+	if resolved := service.ResolvePersona(persona.ID); resolved.Slug != "bank-panel" {
+		t.Errorf("ResolvePersona() after delete = %q, want bank-panel", resolved.Slug)
+	}
+	if _, err := service.GetPersonaVersions(persona.ID); err != nil {
+		t.Errorf("GetPersonaVersions() after delete failed: %v", err)
+	}
+}
+
+func TestPersonaService_ResolvePersona(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewPersonaService()
+	if resolved := service.ResolvePersona(0, "aps-el1-panel-chair"); resolved.Slug != DefaultPersonaSlug {
+		t.Errorf("ResolvePersona() before seeding = %q, want built-in %q", resolved.Slug, DefaultPersonaSlug)
+	}
+
+	if err := service.SeedDefaults(); err != nil {
+		t.Fatalf("SeedDefaults() failed: %v", err)
+	}
+	tests := []struct {
+		name  string
+		slugs []string
+		want  string
+	}{
+		{name: "first slug wins", slugs: []string{"aps-el1-panel-chair", "friendly-hr-screener"}, want: "aps-el1-panel-chair"},
+		{name: "unknown slug is skipped", slugs: []string{"nope", "friendly-hr-screener"}, want: "friendly-hr-screener"},
+		{name: "empty slug is skipped", slugs: []string{"", "faang-swe-interviewer"}, want: "faang-swe-interviewer"},
+		{name: "falls back to default", slugs: nil, want: DefaultPersonaSlug},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.ResolvePersona(0, tt.slugs...); got.Slug != tt.want {
+				t.Errorf("ResolvePersona() = %q, want %q", got.Slug, tt.want)
+			}
+		})
+	}
+
+	tutor, _ := service.GetPersonaBySlug(DefaultPersonaSlug)
+	if err := service.DeletePersona(tutor.ID); !errors.Is(err, ErrDefaultPersona) {
+		t.Errorf("DeletePersona() on default error = %v, want ErrDefaultPersona", err)
+	}
+}
+
+func TestValidatePersona(t *testing.T) {
+	valid := persona_model.InputPersona{Slug: "hr", Name: "HR", SystemPrompt: "Screen the candidate.", Temperature: 1}
+	tests := []struct {
+		name   string
+		mutate func(p *persona_model.InputPersona)
+		valid  bool
+	}{
+		{name: "valid", mutate: func(p *persona_model.InputPersona) {}, valid: true},
+		{name: "uppercase slug", mutate: func(p *persona_model.InputPersona) { p.Slug = "HR" }},
+		{name: "missing name", mutate: func(p *persona_model.InputPersona) { p.Name = "" }},
+		{name: "missing prompt", mutate: func(p *persona_model.InputPersona) { p.SystemPrompt = "" }},
+		{name: "negative word limit", mutate: func(p *persona_model.InputPersona) { p.WordLimit = -1 }},
+		{name: "temperature too high", mutate: func(p *persona_model.InputPersona) { p.Temperature = 2.5 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid
+			tt.mutate(&input)
+			err := validatePersona(&input)
+			if tt.valid && err != nil {
+				t.Errorf("validatePersona() error = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidPersona) {
+				t.Errorf("validatePersona() error = %v, want ErrInvalidPersona", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+	practice_model "up-it-aps-api/app/models/practice"
+	question_model "up-it-aps-api/app/models/question"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// InitialEase is the SM-2 ease factor of an item before its first review.
+	InitialEase = 2.5
+	// MinEase keeps items the candidate keeps struggling with from coming back daily
+	// forever once they improve.
+	MinEase = 1.3
+	// PassingQuality is the lowest review quality, from 0 to 5, that counts as a good
+	// answer; anything below starts the item's repetitions again.
+	PassingQuality = 3
+)
+
+var ErrNothingDue = errors.New("nothing is due for practice")
+
+// PracticeService schedules bank questions and competencies for practice with SM-2, so
+// topics a candidate did badly on come back soon and the ones they do well on less and
+// less often.
+type PracticeService struct {
+	sessionService  *SessionService
+	questionService *QuestionService
+	skillService    *SkillService
+}
+
+func NewPracticeService(sessionService *SessionService, questionService *QuestionService, skillService *SkillService) *PracticeService {
+	return &PracticeService{
+		sessionService:  sessionService,
+		questionService: questionService,
+		skillService:    skillService,
+	}
+}
+
+// reviewQuality turns an overall score percentage into an SM-2 quality from 0 to 5, so
+// 50% or more is a passing review.
+func reviewQuality(score float64) int {
+	return int(math.Round(math.Max(0, math.Min(100, score)) / 20))
+}
+
+// review applies one SM-2 review with score, from 0 to 100, taken at to the item.
+func review(item *practice_model.ReviewItem, score float64, at time.Time) {
+	quality := reviewQuality(score)
+	if item.EaseFactor == 0 {
+		item.EaseFactor = InitialEase
+	}
+	if quality < PassingQuality {
+		item.Repetitions, item.IntervalDays = 0, 1
+		item.Lapses++
+	} else {
+		switch item.Repetitions {
+		case 0:
+			item.IntervalDays = 1
+		case 1:
+			item.IntervalDays = 6
+		default:
+			item.IntervalDays = int(math.Round(float64(item.IntervalDays) * item.EaseFactor))
+		}
+		item.Repetitions++
+	}
+	miss := float64(5 - quality)
+	item.EaseFactor = math.Max(MinEase, item.EaseFactor+0.1-miss*(0.08+miss*0.02))
+	item.Reviews++
+	item.LastQuality, item.LastScore, item.LastReviewedAt = quality, math.Round(score*10)/10, &at
+	item.DueAt = at.AddDate(0, 0, item.IntervalDays)
+}
+
+// scoredAnswer is a bank question answer and its latest overall score.
+type scoredAnswer struct {
+	SessionID  uint
+	QuestionID uint
+	Competency string
+	At         time.Time
+	Score      float64
+}
+
+// scoredAnswers returns the user's scored answers to questionIDs, or to any bank
+// question if questionIDs is nil, oldest first. A re-scored answer counts once, with its
+// latest score. Answers to questions since deleted are left out.
+func scoredAnswers(email string, questionIDs []uint) ([]scoredAnswer, error) {
+	var db = database.DBConn
+	var sessionIDs []uint
+	if err := db.Model(&session_model.InterviewSession{}).Where("email = ?", email).Pluck("id", &sessionIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	query := db.Select("id", "session_id", "question_id", "answered_at").
+		Where("session_id IN ? AND question_id <> 0 AND answered_at IS NOT NULL", sessionIDs)
+	if questionIDs != nil {
+		query = query.Where("question_id IN ?", questionIDs)
+	}
+	var turns []session_model.SessionTurn
+	if err := query.Order("answered_at ASC, id ASC").Find(&turns).Error; err != nil {
+		return nil, err
+	}
+	if len(turns) == 0 {
+		return nil, nil
+	}
+
+	turnIDs := make([]uint, len(turns))
+	asked := make(map[uint]bool)
+	for i, turn := range turns {
+		turnIDs[i], asked[turn.QuestionID] = turn.ID, true
+	}
+	var scores []scoring_model.TurnScore
+	if err := db.Select("id", "turn_id", "overall").Where("turn_id IN ?", turnIDs).Order("id ASC").Find(&scores).Error; err != nil {
+		return nil, err
+	}
+	latest := make(map[uint]float64)
+	for _, score := range scores {
+		latest[score.TurnID] = score.Overall
+	}
+	var ids []uint
+	for id := range asked {
+		ids = append(ids, id)
+	}
+	var questions []question_model.Question
+	if err := db.Select("id", "competency").Where("id IN ?", ids).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	competencies := make(map[uint]string)
+	for _, question := range questions {
+		competencies[question.ID] = question.Competency
+	}
+
+	var answers []scoredAnswer
+	for _, turn := range turns {
+		score, scored := latest[turn.ID]
+		competency, exists := competencies[turn.QuestionID]
+		if !scored || !exists {
+			continue
+		}
+		answers = append(answers, scoredAnswer{SessionID: turn.SessionID, QuestionID: turn.QuestionID, Competency: competency, At: *turn.AnsweredAt, Score: score})
+	}
+	return answers, nil
+}
+
+// Recompute replays the user's scored answers in the question's competency, or to the
+// question alone if it has none, and stores the resulting schedules. Replaying rather
+// than stepping the stored schedule keeps re-scored answers from counting twice.
+func (s *PracticeService) Recompute(email string, question question_model.Question) error {
+	ids := []uint{question.ID}
+	if question.Competency != "" {
+		var db = database.DBConn
+		if err := db.Model(&question_model.Question{}).Where("competency = ?", question.Competency).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+	}
+	answers, err := scoredAnswers(email, ids)
+	if err != nil {
+		return err
+	}
+	return database.DBConn.Transaction(func(tx *gorm.DB) error {
+		return saveSchedule(tx, email, schedule(answers))
+	})
+}
+
+// Rebuild replaces all of the user's schedules with ones replayed from every scored
+// answer, for answers scored before practice scheduling existed.
+func (s *PracticeService) Rebuild(email string) ([]practice_model.ReviewItem, error) {
+	answers, err := scoredAnswers(email, nil)
+	if err != nil {
+		return nil, err
+	}
+	var db = database.DBConn
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("email = ?", email).Delete(&practice_model.ReviewItem{}).Error; err != nil {
+			return err
+		}
+		return saveSchedule(tx, email, schedule(answers))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(email)
+}
+
+// schedule replays answers, oldest first, into review items. Each answer reviews its
+// question; each session's answers in a competency review the competency once, with
+// their mean score, as of the last of them.
+func schedule(answers []scoredAnswer) []*practice_model.ReviewItem {
+	var items []*practice_model.ReviewItem
+	questions := make(map[uint]*practice_model.ReviewItem)
+	for _, answer := range answers {
+		item, ok := questions[answer.QuestionID]
+		if !ok {
+			item = &practice_model.ReviewItem{Kind: practice_model.KindQuestion, QuestionID: answer.QuestionID}
+			questions[answer.QuestionID] = item
+			items = append(items, item)
+		}
+		item.Competency = answer.Competency
+		review(item, answer.Score, answer.At)
+	}
+
+	type sessionReview struct {
+		competency string
+		at         time.Time
+		total      float64
+		count      int
+	}
+	type sessionCompetency struct {
+		sessionID  uint
+		competency string
+	}
+	var reviews []*sessionReview
+	bySession := make(map[sessionCompetency]*sessionReview)
+	for _, answer := range answers {
+		if answer.Competency == "" {
+			continue
+		}
+		key := sessionCompetency{answer.SessionID, answer.Competency}
+		r, ok := bySession[key]
+		if !ok {
+			r = &sessionReview{competency: answer.Competency}
+			bySession[key] = r
+			reviews = append(reviews, r)
+		}
+		r.at, r.total, r.count = answer.At, r.total+answer.Score, r.count+1
+	}
+	sort.SliceStable(reviews, func(i, j int) bool {
+		return reviews[i].at.Before(reviews[j].at)
+	})
+	competencies := make(map[string]*practice_model.ReviewItem)
+	for _, r := range reviews {
+		item, ok := competencies[r.competency]
+		if !ok {
+			item = &practice_model.ReviewItem{Kind: practice_model.KindCompetency, Competency: r.competency}
+			competencies[r.competency] = item
+			items = append(items, item)
+		}
+		review(item, r.total/float64(r.count), r.at)
+	}
+	return items
+}
+
+// saveSchedule stores the items over the user's existing ones.
+func saveSchedule(tx *gorm.DB, email string, items []*practice_model.ReviewItem) error {
+	for _, item := range items {
+		item.Email = email
+		query := tx.Where("email = ? AND kind = ?", email, item.Kind)
+		if item.Kind == practice_model.KindQuestion {
+			query = query.Where("question_id = ?", item.QuestionID)
+		} else {
+			query = query.Where("question_id = 0 AND competency = ?", item.Competency)
+		}
+		var stored []practice_model.ReviewItem
+		if err := query.Limit(1).Find(&stored).Error; err != nil {
+			return err
+		}
+		if len(stored) > 0 {
+			item.ID, item.CreatedAt = stored[0].ID, stored[0].CreatedAt
+		}
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSchedule returns all of the user's review items, soonest due first.
+func (s *PracticeService) GetSchedule(email string) ([]practice_model.ReviewItem, error) {
+	var db = database.DBConn
+	var items []practice_model.ReviewItem
+	result := db.Where("email = ?", email).Order("due_at ASC, id ASC").Find(&items)
+	return items, result.Error
+}
+
+// GetDue returns the user's practice queue: the items due by now, longest overdue
+// first and, among those due together, the hardest for the candidate first. Questions
+// since deleted from the bank are left out.
+func (s *PracticeService) GetDue(email string, now time.Time) ([]practice_model.ReviewItem, error) {
+	var db = database.DBConn
+	var items []practice_model.ReviewItem
+	if err := db.Where("email = ? AND due_at <= ?", email, now).Order("due_at ASC, ease_factor ASC, id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	due := []practice_model.ReviewItem{}
+	for _, item := range items {
+		if item.Kind == practice_model.KindQuestion {
+			question, err := s.questionService.GetQuestion(item.QuestionID)
+			if errors.Is(err, ErrQuestionNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			item.Prompt = question.Prompt
+		}
+		item.OverdueDays = roundTenth(now.Sub(item.DueAt).Hours() / 24)
+		due = append(due, item)
+	}
+	return due, nil
+}
+
+// StartPracticeSession starts a session that asks the questions due in the user's
+// practice queue, in queue order. A due question is asked again; a due competency gets
+// the question in it that best suits the candidate's skill. input.Questions narrows the
+// questions that may be asked and input.QuestionCount caps them.
+func (s *PracticeService) StartPracticeSession(email string, input *session_model.InputSession) (session_model.InterviewSession, error) {
+	if err := validateSession(input); err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	due, err := s.GetDue(email, time.Now())
+	if err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	count := input.QuestionCount
+	if count <= 0 {
+		count = DefaultSessionQuestions
+	}
+	var filter question_model.QuestionFilter
+	var allowed map[uint]bool
+	if input.Questions != nil {
+		filter = *input.Questions
+		questions, err := s.questionService.GetQuestions(filter)
+		if err != nil {
+			return session_model.InterviewSession{}, err
+		}
+		allowed = make(map[uint]bool)
+		for _, question := range questions {
+			allowed[question.ID] = true
+		}
+	}
+
+	var planned []uint
+	picked := make(map[uint]bool)
+	for _, item := range due {
+		if len(planned) == count {
+			break
+		}
+		questionID := item.QuestionID
+		if item.Kind == practice_model.KindCompetency {
+			if filter.Competency != "" && filter.Competency != item.Competency {
+				continue
+			}
+			competencyFilter := filter
+			competencyFilter.Competency = item.Competency
+			selection, err := s.skillService.SelectQuestion(email, competencyFilter, planned)
+			if errors.Is(err, ErrNoQuestions) {
+				continue
+			}
+			if err != nil {
+				return session_model.InterviewSession{}, err
+			}
+			questionID = selection.QuestionID
+		}
+		if picked[questionID] || (allowed != nil && !allowed[questionID]) {
+			continue
+		}
+		planned, picked[questionID] = append(planned, questionID), true
+	}
+	if len(planned) == 0 {
+		return session_model.InterviewSession{}, ErrNothingDue
+	}
+	return s.sessionService.startSession(email, input, planned)
+}
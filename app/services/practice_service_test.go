@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+	practice_model "up-it-aps-api/app/models/practice"
+	question_model "up-it-aps-api/app/models/question"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+	"up-it-aps-api/platform/database"
+)
+
+func TestReview(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		score    float64
+		quality  int
+		interval int
+		ease     float64
+		lapses   int
+	}{
+		{score: 90, quality: 5, interval: 1, ease: 2.6},
+		{score: 95, quality: 5, interval: 6, ease: 2.7},
+		{score: 100, quality: 5, interval: 16, ease: 2.8},
+		{score: 30, quality: 2, interval: 1, ease: 2.48, lapses: 1},
+		{score: 80, quality: 4, interval: 1, ease: 2.48, lapses: 1},
+		{score: 70, quality: 4, interval: 6, ease: 2.48, lapses: 1},
+	}
+	var item practice_model.ReviewItem
+	at := start
+	for i, tt := range tests {
+		review(&item, tt.score, at)
+		if item.LastQuality != tt.quality || item.IntervalDays != tt.interval || math.Abs(item.EaseFactor-tt.ease) > 1e-9 || item.Lapses != tt.lapses {
+			t.Fatalf("review %d of %v = quality %d, interval %d, ease %v, lapses %d; want %d, %d, %v, %d",
+				i+1, tt.score, item.LastQuality, item.IntervalDays, item.EaseFactor, item.Lapses, tt.quality, tt.interval, tt.ease, tt.lapses)
+		}
+		if !item.DueAt.Equal(at.AddDate(0, 0, tt.interval)) {
+			t.Errorf("review %d due %v, want %d days after it", i+1, item.DueAt, tt.interval)
+		}
+		at = item.DueAt
+	}
+
+	var poor practice_model.ReviewItem
+	for i := 0; i < 10; i++ {
+		review(&poor, 0, start)
+	}
+	if poor.EaseFactor != MinEase || poor.Repetitions != 0 || poor.Reviews != 10 {
+		t.Errorf("after ten failed reviews = %+v, want the minimum ease", poor)
+	}
+}
+
+func TestPracticeService_ScheduleAndPractice(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	questions := NewQuestionService()
+	var ids []uint
+	for _, input := range []question_model.InputQuestion{
+		{Prompt: "Tell me about leading a small change.", Competency: "leadership", Difficulty: 2},
+		{Prompt: "Tell me about leading a restructure.", Competency: "leadership", Difficulty: 4},
+		{Prompt: "Tell me about explaining a policy.", Competency: "communication", Difficulty: 2},
+	} {
+		input := input
+		question, err := questions.CreateQuestion(&input)
+		if err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+		ids = append(ids, question.ID)
+	}
+	top := `{"scores": [{"criterion": "structure", "score": 4, "justification": "x"}, {"criterion": "ownership", "score": 4, "justification": "x"}, {"criterion": "impact", "score": 4, "justification": "x"}]}`
+	poor := `{"scores": [{"criterion": "structure", "score": 1, "justification": "x"}, {"criterion": "ownership", "score": 1, "justification": "x"}, {"criterion": "impact", "score": 1, "justification": "x"}]}`
+
+	email := "test@example.com"
+	// answer asks the one question matching filter and has the answer scored once per
+	// judgement
+	answer := func(filter question_model.QuestionFilter, judgements ...string) {
+		t.Helper()
+		interview, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", Questions: &filter, QuestionCount: 1})
+		if err != nil {
+			t.Fatalf("StartSession() failed: %v", err)
+		}
+		if err := s.Sessions().RecordExchange(interview.ID, "", "Next question."); err != nil {
+			t.Fatalf("RecordExchange() failed: %v", err)
+		}
+		if _, err := s.Sessions().RecordAnswer(interview.ID, "My answer."); err != nil {
+			t.Fatalf("RecordAnswer() failed: %v", err)
+		}
+		for _, judgement := range judgements {
+			fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: judgement})
+			if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); err != nil {
+				t.Fatalf("ScoreTurn() failed: %v", err)
+			}
+		}
+	}
+	communication := question_model.QuestionFilter{Competency: "communication"}
+	answer(communication, top)
+	answer(communication, top)
+	// re-scoring replaces the first score rather than adding a review
+	answer(question_model.QuestionFilter{Competency: "leadership", MaxDifficulty: 2}, top, poor)
+
+	schedule, err := s.Practice().GetSchedule(email)
+	if err != nil || len(schedule) != 4 {
+		t.Fatalf("GetSchedule() = %+v, %v, want two questions and two competencies", schedule, err)
+	}
+	items := make(map[string]practice_model.ReviewItem)
+	for _, item := range schedule {
+		items[item.Kind+":"+item.Competency] = item
+	}
+	if leadership := items["question:leadership"]; leadership.QuestionID != ids[0] || leadership.Reviews != 1 || leadership.Lapses != 1 || leadership.IntervalDays != 1 {
+		t.Errorf("leadership question = %+v, want one failed review", leadership)
+	}
+	if item := items["competency:communication"]; item.QuestionID != 0 || item.Reviews != 2 || item.IntervalDays != 6 {
+		t.Errorf("communication = %+v, want two good reviews and a 6 day interval", item)
+	}
+	if due, _ := s.Practice().GetDue(email, time.Now()); len(due) != 0 {
+		t.Errorf("GetDue() straight away = %+v, want nothing", due)
+	}
+
+	// three days on, only leadership is due again
+	if err := database.DBConn.Model(&session_model.SessionTurn{}).Where("answered_at IS NOT NULL").
+		Update("answered_at", time.Now().AddDate(0, 0, -3)).Error; err != nil {
+		t.Fatalf("moving answers back failed: %v", err)
+	}
+	if _, err := s.Practice().Rebuild(email); err != nil {
+		t.Fatalf("Rebuild() failed: %v", err)
+	}
+	due, err := s.Practice().GetDue(email, time.Now())
+	if err != nil || len(due) != 2 || due[0].Competency != "leadership" || due[1].Competency != "leadership" {
+		t.Fatalf("GetDue() = %+v, %v, want the leadership question and competency", due, err)
+	}
+	if due[0].Prompt != "Tell me about leading a small change." || math.Abs(due[0].OverdueDays-2) > 0.1 {
+		t.Errorf("GetDue() first = %+v, want the failed question two days overdue", due[0])
+	}
+
+	if _, err := s.Practice().StartPracticeSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", Questions: &communication}); !errors.Is(err, ErrNothingDue) {
+		t.Errorf("StartPracticeSession() for communication error = %v, want ErrNothingDue", err)
+	}
+	interview, err := s.Practice().StartPracticeSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", QuestionCount: 3})
+	if err != nil {
+		t.Fatalf("StartPracticeSession() failed: %v", err)
+	}
+	if !interview.Practice || len(interview.QuestionIDs) != 2 || interview.QuestionIDs[0] != ids[0] || interview.QuestionIDs[1] != ids[1] {
+		t.Errorf("StartPracticeSession() planned %v, want the failed question then another in its competency", interview.QuestionIDs)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	question_model "up-it-aps-api/app/models/question"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrQuestionFormat = errors.New("unsupported question format")
+
+// questionCSVHeader is the column order of exported CSV. Imports accept the columns in
+// any order, and only prompt is required. Test cases are a JSON array in one column.
+var questionCSVHeader = []string{"prompt", "competency", "difficulty", "role_family", "tags", "expected_answer", "source", "type", "test_cases"}
+
+// questionCSVTagSeparator joins tags inside the single CSV tags column.
+const questionCSVTagSeparator = ";"
+
+// questionRow is one decoded import record with the problems found while decoding it.
+type questionRow struct {
+	number   int
+	input    question_model.InputQuestion
+	problems []question_model.ImportError
+}
+
+// QuestionContentType is the Content-Type of an export in format.
+func QuestionContentType(format string) string {
+	switch format {
+	case question_model.FormatYAML:
+		return "application/yaml"
+	case question_model.FormatCSV:
+		return "text/csv"
+	default:
+		return "application/json"
+	}
+}
+
+func decodeQuestions(format string, data []byte) ([]questionRow, error) {
+	switch format {
+	case question_model.FormatJSON:
+		var inputs []question_model.InputQuestion
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			return nil, fmt.Errorf("%w: invalid JSON: %v", ErrInvalidQuestion, err)
+		}
+		return questionRows(inputs), nil
+	case question_model.FormatYAML:
+		var inputs []question_model.InputQuestion
+		if err := yaml.Unmarshal(data, &inputs); err != nil {
+			return nil, fmt.Errorf("%w: invalid YAML: %v", ErrInvalidQuestion, err)
+		}
+		return questionRows(inputs), nil
+	case question_model.FormatCSV:
+		return decodeQuestionsCSV(data)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrQuestionFormat, format)
+}
+
+func questionRows(inputs []question_model.InputQuestion) []questionRow {
+	rows := make([]questionRow, 0, len(inputs))
+	for i, input := range inputs {
+		rows = append(rows, questionRow{number: i + 1, input: input})
+	}
+	return rows
+}
+
+func decodeQuestionsCSV(data []byte) ([]questionRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV header: %v", ErrInvalidQuestion, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["prompt"]; !ok {
+		return nil, fmt.Errorf("%w: CSV header has no prompt column", ErrInvalidQuestion)
+	}
+
+	var rows []questionRow
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := questionRow{number: number}
+		if err != nil {
+			// a malformed line leaves the reader usable, so report it and carry on
+			row.problems = append(row.problems, question_model.ImportError{Message: err.Error()})
+			rows = append(rows, row)
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		row.input = question_model.InputQuestion{
+			Prompt:         field("prompt"),
+			Competency:     field("competency"),
+			RoleFamily:     field("role_family"),
+			ExpectedAnswer: field("expected_answer"),
+			Source:         field("source"),
+			Type:           field("type"),
+		}
+		if tags := field("tags"); tags != "" {
+			row.input.Tags = strings.Split(tags, questionCSVTagSeparator)
+		}
+		if difficulty := strings.TrimSpace(field("difficulty")); difficulty != "" {
+			value, err := strconv.Atoi(difficulty)
+			if err != nil {
+				row.problems = append(row.problems, question_model.ImportError{Field: "difficulty", Message: fmt.Sprintf("difficulty %q is not a number", difficulty)})
+			}
+			row.input.Difficulty = value
+		}
+		if tests := strings.TrimSpace(field("test_cases")); tests != "" {
+			if err := json.Unmarshal([]byte(tests), &row.input.TestCases); err != nil {
+				row.problems = append(row.problems, question_model.ImportError{Field: "test_cases", Message: fmt.Sprintf("test cases are not a JSON array: %v", err)})
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func encodeQuestions(format string, inputs []question_model.InputQuestion) ([]byte, error) {
+	switch format {
+	case question_model.FormatJSON:
+		return json.MarshalIndent(inputs, "", "  ")
+	case question_model.FormatYAML:
+		return yaml.Marshal(inputs)
+	case question_model.FormatCSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		if err := writer.Write(questionCSVHeader); err != nil {
+			return nil, err
+		}
+		for _, input := range inputs {
+			tests := ""
+			if len(input.TestCases) > 0 {
+				data, err := json.Marshal(input.TestCases)
+				if err != nil {
+					return nil, err
+				}
+				tests = string(data)
+			}
+			record := []string{
+				input.Prompt,
+				input.Competency,
+				strconv.Itoa(input.Difficulty),
+				input.RoleFamily,
+				strings.Join(input.Tags, questionCSVTagSeparator),
+				input.ExpectedAnswer,
+				input.Source,
+				input.Type,
+				tests,
+			}
+			if err := writer.Write(record); err != nil {
+				return nil, err
+			}
+		}
+		writer.Flush()
+		return buf.Bytes(), writer.Error()
+	}
+	return nil, fmt.Errorf("%w: %q", ErrQuestionFormat, format)
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	question_model "up-it-aps-api/app/models/question"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrQuestionNotFound = errors.New("question not found")
+	ErrInvalidQuestion  = errors.New("invalid question")
+	ErrNoQuestions      = errors.New("no questions match the filter")
+)
+
+type QuestionService struct {
+}
+
+func NewQuestionService() *QuestionService {
+	return &QuestionService{}
+}
+
+// GetQuestions returns the questions matching filter in the order they were added.
+func (s *QuestionService) GetQuestions(filter question_model.QuestionFilter) ([]question_model.Question, error) {
+	var db = database.DBConn
+	var questions []question_model.Question
+	result := applyQuestionFilter(db, filter).Order("id ASC").Find(&questions)
+	return questions, result.Error
+}
+
+func (s *QuestionService) GetQuestion(id uint) (question_model.Question, error) {
+	var db = database.DBConn
+	var question question_model.Question
+	result := db.Where("id = ?", id).First(&question)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return question_model.Question{}, ErrQuestionNotFound
+	}
+	if result.Error != nil {
+		return question_model.Question{}, result.Error
+	}
+	return question, nil
+}
+
+func (s *QuestionService) CreateQuestion(input *question_model.InputQuestion) (question_model.Question, error) {
+	normalizeQuestion(input)
+	if err := validateQuestion(input); err != nil {
+		return question_model.Question{}, err
+	}
+	question := newQuestion(*input)
+	var db = database.DBConn
+	if err := db.Create(&question).Error; err != nil {
+		return question_model.Question{}, err
+	}
+	return question, nil
+}
+
+func (s *QuestionService) UpdateQuestion(id uint, input *question_model.InputQuestion) (question_model.Question, error) {
+	normalizeQuestion(input)
+	if err := validateQuestion(input); err != nil {
+		return question_model.Question{}, err
+	}
+	question, err := s.GetQuestion(id)
+	if err != nil {
+		return question_model.Question{}, err
+	}
+	updated := newQuestion(*input)
+	updated.Model = question.Model
+	var db = database.DBConn
+	if err := db.Save(&updated).Error; err != nil {
+		return question_model.Question{}, err
+	}
+	return updated, nil
+}
+
+func (s *QuestionService) DeleteQuestion(id uint) error {
+	question, err := s.GetQuestion(id)
+	if err != nil {
+		return err
+	}
+	var db = database.DBConn
+	return db.Delete(&question).Error
+}
+
+// DrawQuestions picks up to count questions at random from those matching filter.
+func (s *QuestionService) DrawQuestions(filter question_model.QuestionFilter, count int) ([]question_model.Question, error) {
+	questions, err := s.GetQuestions(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, ErrNoQuestions
+	}
+	rand.Shuffle(len(questions), func(i, j int) {
+		questions[i], questions[j] = questions[j], questions[i]
+	})
+	if count > 0 && count < len(questions) {
+		questions = questions[:count]
+	}
+	return questions, nil
+}
+
+// ImportQuestions decodes data in format and stores every valid record. Invalid records
+// and prompts that are already in the bank are reported rather than failing the whole
+// import. A dry run only validates.
+func (s *QuestionService) ImportQuestions(format string, data []byte, dryRun bool) (question_model.ImportReport, error) {
+	rows, err := decodeQuestions(format, data)
+	if err != nil {
+		return question_model.ImportReport{}, err
+	}
+	report := question_model.ImportReport{Format: format, DryRun: dryRun, Total: len(rows), Errors: []question_model.ImportError{}}
+
+	existing, err := s.existingPrompts(rows)
+	if err != nil {
+		return question_model.ImportReport{}, err
+	}
+	var questions []question_model.Question
+	for _, row := range rows {
+		normalizeQuestion(&row.input)
+		problems := row.problems
+		for _, problem := range questionProblems(&row.input) {
+			// a field that could not be decoded is only reported once
+			if !hasProblem(row.problems, problem.Field) {
+				problems = append(problems, problem)
+			}
+		}
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				problem.Row = row.number
+				report.Errors = append(report.Errors, problem)
+			}
+			continue
+		}
+		if existing[row.input.Prompt] {
+			report.Skipped++
+			report.Errors = append(report.Errors, question_model.ImportError{Row: row.number, Field: "prompt", Message: "question already exists"})
+			continue
+		}
+		existing[row.input.Prompt] = true
+		questions = append(questions, newQuestion(row.input))
+	}
+
+	if !dryRun && len(questions) > 0 {
+		var db = database.DBConn
+		if err := db.Create(&questions).Error; err != nil {
+			return question_model.ImportReport{}, err
+		}
+	}
+	report.Imported = len(questions)
+	return report, nil
+}
+
+// ExportQuestions encodes the questions matching filter in format, ready to import.
+func (s *QuestionService) ExportQuestions(format string, filter question_model.QuestionFilter) ([]byte, error) {
+	questions, err := s.GetQuestions(filter)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]question_model.InputQuestion, 0, len(questions))
+	for _, question := range questions {
+		inputs = append(inputs, question.Input())
+	}
+	return encodeQuestions(format, inputs)
+}
+
+// existingPrompts returns which of the rows' prompts are already in the bank.
+func (s *QuestionService) existingPrompts(rows []questionRow) (map[string]bool, error) {
+	prompts := make([]string, 0, len(rows))
+	for _, row := range rows {
+		prompts = append(prompts, strings.TrimSpace(row.input.Prompt))
+	}
+	existing := make(map[string]bool)
+	if len(prompts) == 0 {
+		return existing, nil
+	}
+	var db = database.DBConn
+	var stored []string
+	if err := db.Model(&question_model.Question{}).Where("prompt IN ?", prompts).Pluck("prompt", &stored).Error; err != nil {
+		return nil, err
+	}
+	for _, prompt := range stored {
+		existing[prompt] = true
+	}
+	return existing, nil
+}
+
+func applyQuestionFilter(query *gorm.DB, filter question_model.QuestionFilter) *gorm.DB {
+	for _, tag := range filter.Tags {
+		if tag = normalizeTag(tag); tag != "" {
+			// tags are stored as a JSON array, so match the quoted element
+			query = query.Where("tags LIKE ?", `%"`+tag+`"%`)
+		}
+	}
+	if filter.Competency != "" {
+		query = query.Where("competency = ?", filter.Competency)
+	}
+	if filter.RoleFamily != "" {
+		query = query.Where("role_family = ?", filter.RoleFamily)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.MinDifficulty > 0 {
+		query = query.Where("difficulty >= ?", filter.MinDifficulty)
+	}
+	if filter.MaxDifficulty > 0 {
+		query = query.Where("difficulty <= ?", filter.MaxDifficulty)
+	}
+	return query
+}
+
+func newQuestion(input question_model.InputQuestion) question_model.Question {
+	return question_model.Question{
+		Type:           input.Type,
+		Prompt:         input.Prompt,
+		Tags:           input.Tags,
+		Competency:     input.Competency,
+		Difficulty:     input.Difficulty,
+		RoleFamily:     input.RoleFamily,
+		ExpectedAnswer: input.ExpectedAnswer,
+		Source:         input.Source,
+		TestCases:      input.TestCases,
+	}
+}
+
+// normalizeQuestion trims every field and lower-cases and de-duplicates the tags. Test
+// cases are left alone, as whitespace may be part of the input.
+func normalizeQuestion(input *question_model.InputQuestion) {
+	input.Type = strings.ToLower(strings.TrimSpace(input.Type))
+	if input.Type == "" {
+		input.Type = question_model.TypeOpen
+	}
+	input.Prompt = strings.TrimSpace(input.Prompt)
+	input.Competency = strings.TrimSpace(input.Competency)
+	input.RoleFamily = strings.TrimSpace(input.RoleFamily)
+	input.ExpectedAnswer = strings.TrimSpace(input.ExpectedAnswer)
+	input.Source = strings.TrimSpace(input.Source)
+	tags := make([]string, 0, len(input.Tags))
+	seen := make(map[string]bool)
+	for _, tag := range input.Tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	input.Tags = tags
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// questionProblems lists everything wrong with a normalised question.
+func questionProblems(input *question_model.InputQuestion) []question_model.ImportError {
+	var problems []question_model.ImportError
+	if input.Prompt == "" {
+		problems = append(problems, question_model.ImportError{Field: "prompt", Message: "prompt is required"})
+	}
+	if input.Competency == "" {
+		problems = append(problems, question_model.ImportError{Field: "competency", Message: "competency is required"})
+	}
+	if input.Difficulty < question_model.MinDifficulty || input.Difficulty > question_model.MaxDifficulty {
+		problems = append(problems, question_model.ImportError{
+			Field:   "difficulty",
+			Message: fmt.Sprintf("difficulty must be between %d and %d", question_model.MinDifficulty, question_model.MaxDifficulty),
+		})
+	}
+	for _, tag := range input.Tags {
+		if strings.ContainsAny(tag, `"%`) {
+			problems = append(problems, question_model.ImportError{Field: "tags", Message: fmt.Sprintf("tag %q cannot contain quotes or %%", tag)})
+		}
+	}
+	switch input.Type {
+	case question_model.TypeOpen:
+		if len(input.TestCases) > 0 {
+			problems = append(problems, question_model.ImportError{Field: "test_cases", Message: "only coding questions have test cases"})
+		}
+	case question_model.TypeCoding:
+		if len(input.TestCases) == 0 {
+			problems = append(problems, question_model.ImportError{Field: "test_cases", Message: "a coding question needs at least one test case"})
+		}
+		for i, test := range input.TestCases {
+			if strings.TrimSpace(test.ExpectedOutput) == "" {
+				problems = append(problems, question_model.ImportError{Field: "test_cases", Message: fmt.Sprintf("test case %d has no expected output", i+1)})
+			}
+		}
+	default:
+		problems = append(problems, question_model.ImportError{
+			Field:   "type",
+			Message: fmt.Sprintf("type must be %q or %q", question_model.TypeOpen, question_model.TypeCoding),
+		})
+	}
+	return problems
+}
+
+func hasProblem(problems []question_model.ImportError, field string) bool {
+	for _, problem := range problems {
+		if problem.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func validateQuestion(input *question_model.InputQuestion) error {
+	if problems := questionProblems(input); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidQuestion, problems[0].Message)
+	}
+	return nil
+}
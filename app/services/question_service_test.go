@@ -0,0 +1,248 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	question_model "up-it-aps-api/app/models/question"
+	"up-it-aps-api/platform/database"
+)
+
+func newTestQuestionService(t *testing.T) *QuestionService {
+	t.Helper()
+	db := setupTestDB(t)
+	database.DBConn = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	})
+	return NewQuestionService()
+}
+
+func seedQuestions(t *testing.T, service *QuestionService) {
+	t.Helper()
+	inputs := []question_model.InputQuestion{
+		{Prompt: "Tell me about a time you led a team through change.", Tags: []string{"Leadership", "change "}, Competency: "leadership", Difficulty: 3, RoleFamily: "aps"},
+		{Prompt: "Design a URL shortener.", Tags: []string{"system-design"}, Competency: "architecture", Difficulty: 4, RoleFamily: "swe"},
+		{Prompt: "Reverse a linked list.", Tags: []string{"coding", "lists"}, Competency: "problem solving", Difficulty: 2, RoleFamily: "swe", Type: question_model.TypeCoding, TestCases: []question_model.TestCase{
+			{Input: "1 2 3\n", ExpectedOutput: "3 2 1\n"},
+			{Input: "7\n", ExpectedOutput: "7\n", Hidden: true},
+		}},
+	}
+	for i := range inputs {
+		if _, err := service.CreateQuestion(&inputs[i]); err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+	}
+}
+
+func TestQuestionService_CRUDAndFilter(t *testing.T) {
+	service := newTestQuestionService(t)
+	seedQuestions(t, service)
+
+	tests := []struct {
+		name   string
+		filter question_model.QuestionFilter
+		want   int
+	}{
+		{name: "all", want: 3},
+		{name: "role family", filter: question_model.QuestionFilter{RoleFamily: "swe"}, want: 2},
+		{name: "normalised tag", filter: question_model.QuestionFilter{Tags: []string{"LEADERSHIP"}}, want: 1},
+		{name: "every tag must match", filter: question_model.QuestionFilter{Tags: []string{"coding", "leadership"}}, want: 0},
+		{name: "tag is not a substring match", filter: question_model.QuestionFilter{Tags: []string{"list"}}, want: 0},
+		{name: "difficulty range", filter: question_model.QuestionFilter{MinDifficulty: 3, MaxDifficulty: 4}, want: 2},
+		{name: "coding", filter: question_model.QuestionFilter{Type: question_model.TypeCoding}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions, err := service.GetQuestions(tt.filter)
+			if err != nil {
+				t.Fatalf("GetQuestions() failed: %v", err)
+			}
+			if len(questions) != tt.want {
+				t.Errorf("GetQuestions() returned %d questions, want %d", len(questions), tt.want)
+			}
+		})
+	}
+
+	updated, err := service.UpdateQuestion(1, &question_model.InputQuestion{Prompt: "Tell me about leading change.", Competency: "leadership", Difficulty: 5})
+	if err != nil {
+		t.Fatalf("UpdateQuestion() failed: %v", err)
+	}
+	if updated.ID != 1 || updated.Difficulty != 5 || len(updated.Tags) != 0 {
+		t.Errorf("UpdateQuestion() = %+v", updated)
+	}
+	if _, err := service.UpdateQuestion(1, &question_model.InputQuestion{Prompt: "x", Competency: "y", Difficulty: 9}); !errors.Is(err, ErrInvalidQuestion) {
+		t.Errorf("UpdateQuestion() with difficulty 9 error = %v, want ErrInvalidQuestion", err)
+	}
+	for _, input := range []question_model.InputQuestion{
+		{Prompt: "x", Competency: "y", Difficulty: 1, Type: question_model.TypeCoding},
+		{Prompt: "x", Competency: "y", Difficulty: 1, Type: question_model.TypeCoding, TestCases: []question_model.TestCase{{Input: "1"}}},
+		{Prompt: "x", Competency: "y", Difficulty: 1, TestCases: []question_model.TestCase{{Input: "1", ExpectedOutput: "1"}}},
+		{Prompt: "x", Competency: "y", Difficulty: 1, Type: "essay"},
+	} {
+		input := input
+		if _, err := service.CreateQuestion(&input); !errors.Is(err, ErrInvalidQuestion) {
+			t.Errorf("CreateQuestion(%+v) error = %v, want ErrInvalidQuestion", input, err)
+		}
+	}
+	coding, _ := service.GetQuestion(3)
+	if visible := coding.WithoutHiddenTests(); len(visible.TestCases) != 1 || len(coding.TestCases) != 2 {
+		t.Errorf("WithoutHiddenTests() = %+v, want only the visible test of %+v", visible.TestCases, coding.TestCases)
+	}
+
+	if err := service.DeleteQuestion(2); err != nil {
+		t.Fatalf("DeleteQuestion() failed: %v", err)
+	}
+	if _, err := service.GetQuestion(2); !errors.Is(err, ErrQuestionNotFound) {
+		t.Errorf("GetQuestion() after delete error = %v, want ErrQuestionNotFound", err)
+	}
+
+	drawn, err := service.DrawQuestions(question_model.QuestionFilter{}, 1)
+	if err != nil || len(drawn) != 1 {
+		t.Errorf("DrawQuestions(1) = %d questions, %v, want 1", len(drawn), err)
+	}
+	if _, err := service.DrawQuestions(question_model.QuestionFilter{RoleFamily: "sales"}, 1); !errors.Is(err, ErrNoQuestions) {
+		t.Errorf("DrawQuestions() with no match error = %v, want ErrNoQuestions", err)
+	}
+}
+
+func TestQuestionService_Import(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		data     string
+		imported int
+		skipped  int
+		errors   []question_model.ImportError
+	}{
+		{
+			name:   "json",
+			format: question_model.FormatJSON,
+			data: `[
+				{"prompt": "Why this role?", "competency": "motivation", "difficulty": 1, "tags": ["screening"]},
+				{"prompt": "", "competency": "motivation", "difficulty": 7},
+				{"prompt": "Why this role?", "competency": "motivation", "difficulty": 1}
+			]`,
+			imported: 1,
+			skipped:  1,
+			errors: []question_model.ImportError{
+				{Row: 2, Field: "prompt", Message: "prompt is required"},
+				{Row: 2, Field: "difficulty", Message: "difficulty must be between 1 and 5"},
+				{Row: 3, Field: "prompt", Message: "question already exists"},
+			},
+		},
+		{
+			name:   "yaml",
+			format: question_model.FormatYAML,
+			data: `- prompt: Walk me through a production incident you handled.
+  competency: ownership
+  difficulty: 3
+  role_family: swe
+  tags: [incident, on-call]
+  expected_answer: |
+    - detection and triage
+    - mitigation before root cause
+    - blameless follow-up
+- prompt: Estimate the number of piano tuners in Sydney.
+  difficulty: 2
+`,
+			imported: 1,
+			errors:   []question_model.ImportError{{Row: 2, Field: "competency", Message: "competency is required"}},
+		},
+		{
+			name:   "csv",
+			format: question_model.FormatCSV,
+			data: "Prompt,Difficulty,Competency,Tags\n" +
+				"\"Describe a conflict, and how you resolved it.\",2,teamwork,conflict;behavioural\n" +
+				"What is a mutex?,two,concurrency,\n",
+			imported: 1,
+			errors:   []question_model.ImportError{{Row: 2, Field: "difficulty", Message: `difficulty "two" is not a number`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestQuestionService(t)
+			report, err := service.ImportQuestions(tt.format, []byte(tt.data), false)
+			if err != nil {
+				t.Fatalf("ImportQuestions() failed: %v", err)
+			}
+			if report.Imported != tt.imported || report.Skipped != tt.skipped {
+				t.Errorf("ImportQuestions() imported %d skipped %d, want %d and %d", report.Imported, report.Skipped, tt.imported, tt.skipped)
+			}
+			if len(report.Errors) != len(tt.errors) {
+				t.Fatalf("ImportQuestions() errors = %+v, want %+v", report.Errors, tt.errors)
+			}
+			for i, want := range tt.errors {
+				if report.Errors[i] != want {
+					t.Errorf("error %d = %+v, want %+v", i, report.Errors[i], want)
+				}
+			}
+			stored, _ := service.GetQuestions(question_model.QuestionFilter{})
+			if len(stored) != tt.imported {
+				t.Errorf("bank holds %d questions, want %d", len(stored), tt.imported)
+			}
+		})
+	}
+}
+
+func TestQuestionService_ImportDryRunAndBadInput(t *testing.T) {
+	service := newTestQuestionService(t)
+
+	report, err := service.ImportQuestions(question_model.FormatJSON, []byte(`[{"prompt": "Why?", "competency": "motivation", "difficulty": 1}]`), true)
+	if err != nil {
+		t.Fatalf("ImportQuestions() failed: %v", err)
+	}
+	if !report.DryRun || report.Imported != 1 {
+		t.Errorf("dry run report = %+v, want 1 importable question", report)
+	}
+	if stored, _ := service.GetQuestions(question_model.QuestionFilter{}); len(stored) != 0 {
+		t.Errorf("dry run stored %d questions, want 0", len(stored))
+	}
+
+	if _, err := service.ImportQuestions(question_model.FormatJSON, []byte(`{"prompt": "not a list"}`), false); !errors.Is(err, ErrInvalidQuestion) {
+		t.Errorf("ImportQuestions() with malformed JSON error = %v, want ErrInvalidQuestion", err)
+	}
+	if _, err := service.ImportQuestions(question_model.FormatCSV, []byte("question,difficulty\nWhy?,1\n"), false); !errors.Is(err, ErrInvalidQuestion) {
+		t.Errorf("ImportQuestions() without a prompt column error = %v, want ErrInvalidQuestion", err)
+	}
+	if _, err := service.ImportQuestions("xml", nil, false); !errors.Is(err, ErrQuestionFormat) {
+		t.Errorf("ImportQuestions() with xml error = %v, want ErrQuestionFormat", err)
+	}
+}
+
+func TestQuestionService_ExportRoundTrip(t *testing.T) {
+	for _, format := range []string{question_model.FormatJSON, question_model.FormatYAML, question_model.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			service := newTestQuestionService(t)
+			seedQuestions(t, service)
+			before, _ := service.GetQuestions(question_model.QuestionFilter{RoleFamily: "swe"})
+
+			data, err := service.ExportQuestions(format, question_model.QuestionFilter{RoleFamily: "swe"})
+			if err != nil {
+				t.Fatalf("ExportQuestions() failed: %v", err)
+			}
+			if format == question_model.FormatCSV && !strings.HasPrefix(string(data), strings.Join(questionCSVHeader, ",")) {
+				t.Errorf("CSV export does not start with the header: %q", data)
+			}
+
+			fresh := newTestQuestionService(t)
+			report, err := fresh.ImportQuestions(format, data, false)
+			if err != nil {
+				t.Fatalf("ImportQuestions() failed: %v", err)
+			}
+			if report.Imported != len(before) || len(report.Errors) != 0 {
+				t.Fatalf("re-import report = %+v, want %d clean imports", report, len(before))
+			}
+			after, _ := fresh.GetQuestions(question_model.QuestionFilter{})
+			for i := range before {
+				if before[i].Prompt != after[i].Prompt || strings.Join(before[i].Tags, ",") != strings.Join(after[i].Tags, ",") || before[i].Difficulty != after[i].Difficulty ||
+					before[i].Type != after[i].Type || len(before[i].TestCases) != len(after[i].TestCases) {
+					t.Errorf("question %d = %+v, want %+v", i, after[i].Input(), before[i].Input())
+				}
+			}
+		})
+	}
+}
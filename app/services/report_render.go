@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	report_model "up-it-aps-api/app/models/report"
+
+	"github.com/go-pdf/fpdf"
+)
+
+//go:embed templates/report.md.tmpl templates/report.html.tmpl
+var reportTemplates embed.FS
+
+var reportFuncs = map[string]interface{}{
+	"percent": func(score *float64) string {
+		if score == nil {
+			return "not scored"
+		}
+		return strconv.FormatFloat(*score, 'f', -1, 64) + "%"
+	},
+	"date": func(at *time.Time) string {
+		if at == nil {
+			return "not started"
+		}
+		return at.Format("2 January 2006")
+	},
+	"humanize": func(value string) string {
+		return strings.ReplaceAll(value, "_", " ")
+	},
+	// quote makes every line of text part of a Markdown block quote
+	"quote": func(text string) string {
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	},
+}
+
+var (
+	reportMarkdownTemplate = template.Must(template.New("report.md.tmpl").Funcs(reportFuncs).ParseFS(reportTemplates, "templates/report.md.tmpl"))
+	reportHTMLTemplate     = htmltemplate.Must(htmltemplate.New("report.html.tmpl").Funcs(reportFuncs).ParseFS(reportTemplates, "templates/report.html.tmpl"))
+)
+
+func renderReportMarkdown(data report_model.ReportData) (string, error) {
+	var out bytes.Buffer
+	if err := reportMarkdownTemplate.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderReportHTML(data report_model.ReportData) (string, error) {
+	var out bytes.Buffer
+	if err := reportHTMLTemplate.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// renderReportPDF lays out the rendered Markdown report as a PDF, so the template stays
+// the one place the report's content is decided. Only the Markdown the template uses is
+// understood: headings, bullets, block quotes, bold and italic lines.
+func renderReportPDF(markdown string) ([]byte, error) {
+	const margin, lineHeight = 20.0, 5.5
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin)
+	pdf.AddPage()
+	// the core fonts are cp1252, so translate the UTF-8 text into it
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	write := func(style string, size float64, indent float64, text string) {
+		pdf.SetFont("Helvetica", style, size)
+		pdf.SetLeftMargin(margin + indent)
+		pdf.SetX(margin + indent)
+		pdf.MultiCell(0, lineHeight*size/11, tr(text), "", "L", false)
+		pdf.SetLeftMargin(margin)
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.ReplaceAll(strings.TrimRight(line, " "), "**", "")
+		switch {
+		case line == "":
+			pdf.Ln(2)
+		case strings.HasPrefix(line, "### "):
+			pdf.Ln(2)
+			write("B", 11, 0, strings.TrimPrefix(line, "### "))
+		case strings.HasPrefix(line, "## "):
+			pdf.Ln(4)
+			write("B", 14, 0, strings.TrimPrefix(line, "## "))
+		case strings.HasPrefix(line, "# "):
+			write("B", 18, 0, strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "- "):
+			write("", 10, 4, "• "+strings.TrimPrefix(line, "- "))
+		case strings.HasPrefix(line, ">"):
+			write("I", 10, 6, strings.TrimSpace(strings.TrimPrefix(line, ">")))
+		case len(line) > 1 && strings.HasPrefix(line, "_") && strings.HasSuffix(line, "_"):
+			write("I", 10, 0, strings.Trim(line, "_"))
+		default:
+			write("", 10, 0, line)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	question_model "up-it-aps-api/app/models/question"
+	report_model "up-it-aps-api/app/models/report"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReportNotFound  = errors.New("report not found")
+	ErrReportNotReady  = errors.New("report is still being generated")
+	ErrReportFailed    = errors.New("report could not be generated")
+	ErrReportFormat    = errors.New("unsupported report format")
+	ErrSessionNotEnded = errors.New("session has not been completed")
+)
+
+// A competency averaging at least ReportStrengthScore percent is reported as a
+// strength, one below ReportImprovementScore as an area to improve.
+const (
+	ReportStrengthScore    = 75.0
+	ReportImprovementScore = 60.0
+	// ReportPracticeQuestions is how many unasked bank questions are suggested per
+	// weak competency.
+	ReportPracticeQuestions = 3
+)
+
+type ReportService struct {
+	sessionService  *SessionService
+	scoringService  *ScoringService
+	questionService *QuestionService
+	pending         sync.WaitGroup
+}
+
+func NewReportService(sessionService *SessionService, scoringService *ScoringService, questionService *QuestionService) *ReportService {
+	return &ReportService{
+		sessionService:  sessionService,
+		scoringService:  scoringService,
+		questionService: questionService,
+	}
+}
+
+// QueueReport marks the report of a completed session as pending and generates it in
+// the background, so ending a session does not wait for it. Queuing it again, after
+// more answers have been scored, regenerates it.
+func (s *ReportService) QueueReport(interview session_model.InterviewSession) (report_model.SessionReport, error) {
+	if interview.Status != session_model.StatusCompleted {
+		return report_model.SessionReport{}, ErrSessionNotEnded
+	}
+	var db = database.DBConn
+	var report report_model.SessionReport
+	err := db.Where(report_model.SessionReport{SessionID: interview.ID}).
+		Assign(map[string]interface{}{"email": interview.Email, "status": report_model.StatusPending, "error": ""}).
+		FirstOrCreate(&report).Error
+	if err != nil {
+		return report_model.SessionReport{}, err
+	}
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		s.generate(interview.ID, interview.Email)
+	}()
+	return report, nil
+}
+
+// RegenerateReport queues the report of one of the user's sessions again.
+func (s *ReportService) RegenerateReport(sessionID uint, email string) (report_model.SessionReport, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return report_model.SessionReport{}, err
+	}
+	return s.QueueReport(interview)
+}
+
+// Wait blocks until every queued report has been generated.
+func (s *ReportService) Wait() {
+	s.pending.Wait()
+}
+
+// GetReport returns the report of one of the user's sessions, whatever its status.
+func (s *ReportService) GetReport(sessionID uint, email string) (report_model.SessionReport, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return report_model.SessionReport{}, err
+	}
+	var db = database.DBConn
+	var report report_model.SessionReport
+	result := db.Where("session_id = ?", interview.ID).First(&report)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return report_model.SessionReport{}, ErrReportNotFound
+	}
+	if result.Error != nil {
+		return report_model.SessionReport{}, result.Error
+	}
+	return report, nil
+}
+
+// ReportContent returns a ready report in format with its content type.
+func ReportContent(report report_model.SessionReport, format string) ([]byte, string, error) {
+	switch report.Status {
+	case report_model.StatusPending:
+		return nil, "", ErrReportNotReady
+	case report_model.StatusFailed:
+		return nil, "", fmt.Errorf("%w: %s", ErrReportFailed, report.Error)
+	}
+	switch format {
+	case report_model.FormatMarkdown:
+		return []byte(report.Markdown), "text/markdown; charset=utf-8", nil
+	case report_model.FormatHTML:
+		return []byte(report.HTML), "text/html; charset=utf-8", nil
+	case report_model.FormatPDF:
+		return report.PDF, "application/pdf", nil
+	}
+	return nil, "", fmt.Errorf("%w %q, use one of %s", ErrReportFormat, format, strings.Join(report_model.Formats, ", "))
+}
+
+// generate renders the report in every format and stores it, or records why it failed.
+func (s *ReportService) generate(sessionID uint, email string) {
+	var db = database.DBConn
+	updates, err := s.render(sessionID, email)
+	if err != nil {
+		log.Printf("report for session %d failed: %v", sessionID, err)
+		updates = map[string]interface{}{"status": report_model.StatusFailed, "error": err.Error()}
+	}
+	if err := db.Model(&report_model.SessionReport{}).Where("session_id = ?", sessionID).Updates(updates).Error; err != nil {
+		log.Printf("storing report for session %d failed: %v", sessionID, err)
+	}
+}
+
+func (s *ReportService) render(sessionID uint, email string) (map[string]interface{}, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.reportData(interview)
+	if err != nil {
+		return nil, err
+	}
+	markdown, err := renderReportMarkdown(data)
+	if err != nil {
+		return nil, err
+	}
+	html, err := renderReportHTML(data)
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := renderReportPDF(markdown)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"status":       report_model.StatusReady,
+		"error":        "",
+		"generated_at": time.Now(),
+		"markdown":     markdown,
+		"html":         html,
+		"pdf":          pdf,
+	}, nil
+}
+
+// competencyTally collects one rubric criterion's scores across the session, keeping
+// the best and worst answer so the report can quote their justifications.
+type competencyTally struct {
+	competency  report_model.ReportCompetency
+	description string
+	total       float64
+	best, worst float64
+	bestDetail  string
+	worstDetail string
+}
+
+// reportData gathers the answered turns with their latest score and STAR analysis and
+// derives the competency scores, strengths, areas to improve and next practice.
+func (s *ReportService) reportData(interview session_model.InterviewSession) (report_model.ReportData, error) {
+	data := report_model.ReportData{
+		SessionID:  interview.ID,
+		Type:       interview.Type,
+		TargetRole: interview.TargetRole,
+		Persona:    interview.Persona,
+		StartedAt:  interview.StartedAt,
+		EndedAt:    interview.EndedAt,
+	}
+	if interview.StartedAt != nil && interview.EndedAt != nil {
+		seconds := interview.EndedAt.Sub(*interview.StartedAt).Seconds() - interview.PausedSeconds
+		data.Minutes = int(math.Round(math.Max(seconds, 0) / 60))
+	}
+	data.TimeLimits = timeLimits(interview)
+
+	rubrics := make(map[string]scoring_model.Rubric)
+	tallies := make(map[string]*competencyTally)
+	var order []string
+	asked := make(map[uint]bool)
+	var weakBankCompetencies []string
+	flagCounts := make(map[session_model.StarFlag]int)
+	var flagOrder []session_model.StarFlag
+	var starTipsGiven []string
+	var overall float64
+	scored := 0
+	timedTurns, overTime := 0, 0
+
+	for _, turn := range interview.Turns {
+		asked[turn.QuestionID] = true
+		if turn.LimitSeconds > 0 && turn.AnsweredAt != nil {
+			timedTurns++
+			if turn.TimedOut || turn.OvertimeSeconds > 0 {
+				overTime++
+			}
+		}
+		if strings.TrimSpace(turn.Answer) == "" {
+			continue
+		}
+		answer := report_model.ReportAnswer{Number: turn.Number, Question: turn.Question, Answer: turn.Answer, Timing: turnTiming(turn)}
+		if turn.QuestionID != 0 {
+			if question, err := s.questionService.GetQuestion(turn.QuestionID); err == nil {
+				answer.Competency = question.Competency
+			}
+		}
+
+		scores, err := s.scoringService.GetTurnScores(interview.ID, interview.Email, turn.Number)
+		if err != nil {
+			return report_model.ReportData{}, err
+		}
+		if len(scores) > 0 {
+			latest := scores[0]
+			answer.Score, answer.Summary = &latest.Overall, latest.Summary
+			overall += latest.Overall
+			scored++
+			if latest.Overall < ReportImprovementScore && answer.Competency != "" && !containsString(weakBankCompetencies, answer.Competency) {
+				weakBankCompetencies = append(weakBankCompetencies, answer.Competency)
+			}
+			rubric, ok := rubrics[latest.RubricSlug]
+			if !ok {
+				rubric, _ = s.scoringService.GetRubricBySlug(latest.RubricSlug)
+				rubrics[latest.RubricSlug] = rubric
+			}
+			for _, given := range latest.Criteria {
+				tally, ok := tallies[given.Criterion]
+				if !ok {
+					tally = &competencyTally{competency: report_model.ReportCompetency{Key: given.Criterion, Name: given.Criterion}, best: -1, worst: 101}
+					if criterion, found := rubricCriterion(rubric, given.Criterion); found {
+						tally.competency.Name, tally.description = criterion.Name, criterion.Description
+					}
+					tallies[given.Criterion] = tally
+					order = append(order, given.Criterion)
+				}
+				percent := 0.0
+				if given.MaxScore > 0 {
+					percent = float64(given.Score) / float64(given.MaxScore) * 100
+				}
+				tally.total += percent
+				tally.competency.Answers++
+				detail := fmt.Sprintf("Question %d: %s", turn.Number, given.Justification)
+				if percent > tally.best {
+					tally.best, tally.bestDetail = percent, detail
+				}
+				if percent < tally.worst {
+					tally.worst, tally.worstDetail = percent, detail
+				}
+			}
+		}
+
+		if turn.Star != nil {
+			for i, flag := range turn.Star.Flags {
+				answer.Flags = append(answer.Flags, flag.Message)
+				if flagCounts[flag] == 0 {
+					flagOrder = append(flagOrder, flag)
+				}
+				flagCounts[flag]++
+				if i < len(turn.Star.Tips) && !containsString(starTipsGiven, turn.Star.Tips[i]) {
+					starTipsGiven = append(starTipsGiven, turn.Star.Tips[i])
+				}
+			}
+		}
+		data.Answers = append(data.Answers, answer)
+	}
+
+	if scored > 0 {
+		mean := math.Round(overall/float64(scored)*10) / 10
+		data.Overall = &mean
+	}
+	var weakest []*competencyTally
+	for _, key := range order {
+		tally := tallies[key]
+		tally.competency.Score = math.Round(tally.total/float64(tally.competency.Answers)*10) / 10
+		data.Competencies = append(data.Competencies, tally.competency)
+		switch {
+		case tally.competency.Score >= ReportStrengthScore:
+			data.Strengths = append(data.Strengths, report_model.ReportPoint{Title: tally.competency.Name, Detail: tally.bestDetail})
+		case tally.competency.Score < ReportImprovementScore:
+			weakest = append(weakest, tally)
+		}
+	}
+	sort.SliceStable(weakest, func(i, j int) bool {
+		return weakest[i].competency.Score < weakest[j].competency.Score
+	})
+	for _, tally := range weakest {
+		data.Improvements = append(data.Improvements, report_model.ReportPoint{Title: tally.competency.Name, Detail: tally.worstDetail})
+		if tally.description != "" {
+			data.NextPractice = append(data.NextPractice, fmt.Sprintf("Work on %s: %s", strings.ToLower(tally.competency.Name), tally.description))
+		}
+	}
+
+	for _, flag := range flagOrder {
+		data.Improvements = append(data.Improvements, report_model.ReportPoint{
+			Title:  "STAR " + flag.Part,
+			Detail: fmt.Sprintf("%s (%d of %d answers)", strings.TrimSuffix(flag.Message, "."), flagCounts[flag], len(data.Answers)),
+		})
+	}
+	data.NextPractice = append(data.NextPractice, starTipsGiven...)
+
+	if overTime > 0 {
+		data.Improvements = append(data.Improvements, report_model.ReportPoint{
+			Title:  "Time management",
+			Detail: fmt.Sprintf("%d of %d timed questions went over time or were cut off", overTime, timedTurns),
+		})
+		data.NextPractice = append(data.NextPractice, fmt.Sprintf("Practise answering within %s per question.", formatSeconds(interview.QuestionSeconds)))
+	}
+
+	for _, competency := range weakBankCompetencies {
+		questions, err := s.questionService.GetQuestions(question_model.QuestionFilter{Competency: competency})
+		if err != nil {
+			return report_model.ReportData{}, err
+		}
+		suggested := 0
+		for _, question := range questions {
+			if asked[question.ID] || suggested == ReportPracticeQuestions {
+				continue
+			}
+			data.NextPractice = append(data.NextPractice, fmt.Sprintf("Practise %s: %s", competency, question.Prompt))
+			suggested++
+		}
+	}
+	if scored == 0 && len(data.Answers) > 0 {
+		data.NextPractice = append(data.NextPractice, "Score your answers to get practice suggestions for your weakest competencies.")
+	}
+	return data, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// timeLimits describes the budgets of a timed session.
+func timeLimits(interview session_model.InterviewSession) string {
+	var limits []string
+	if interview.QuestionSeconds > 0 {
+		limits = append(limits, formatSeconds(interview.QuestionSeconds)+" per question")
+	}
+	if interview.TotalSeconds > 0 {
+		limits = append(limits, formatSeconds(interview.TotalSeconds)+" in total")
+	}
+	return strings.Join(limits, ", ")
+}
+
+// turnTiming describes how long a timed turn's answer took against its limit.
+func turnTiming(turn session_model.SessionTurn) string {
+	if turn.LimitSeconds == 0 {
+		return ""
+	}
+	timing := fmt.Sprintf("%.0f of %d seconds", turn.DurationSeconds, turn.LimitSeconds)
+	switch {
+	case turn.TimedOut:
+		timing += ", cut off when time ran out"
+	case turn.OvertimeSeconds > 0:
+		timing += fmt.Sprintf(", %.0f over", turn.OvertimeSeconds)
+	}
+	return timing
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	question_model "up-it-aps-api/app/models/question"
+	report_model "up-it-aps-api/app/models/report"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestReportService_GeneratesEveryFormatWhenSessionEnds(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	questions := NewQuestionService()
+	seedQuestions(t, questions)
+	if _, err := questions.CreateQuestion(&question_model.InputQuestion{Prompt: "Tell me about a time you changed a team's direction.", Competency: "leadership", Difficulty: 3}); err != nil {
+		t.Fatalf("CreateQuestion() failed: %v", err)
+	}
+
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:          session_model.TypeBehavioral,
+		TargetRole:    "APS EL1",
+		Questions:     &question_model.QuestionFilter{RoleFamily: "aps"},
+		QuestionCount: 1,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if _, err := s.Reports().QueueReport(interview); !errors.Is(err, ErrSessionNotEnded) {
+		t.Errorf("QueueReport() on an active session error = %v, want ErrSessionNotEnded", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Tell me about a time you led a team through change."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "We moved to a new case system. <b>We</b> got through it."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: `{"scores": [
+		{"criterion": "structure", "score": 4, "justification": "Easy to follow."},
+		{"criterion": "ownership", "score": 1, "justification": "Only says what the team did."},
+		{"criterion": "impact", "score": 2, "justification": "No measured result."}
+	], "summary": "Say what you did."}`})
+	if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); err != nil {
+		t.Fatalf("ScoreTurn() failed: %v", err)
+	}
+
+	ended, err := s.Sessions().EndSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("EndSession() failed: %v", err)
+	}
+	queued, err := s.Reports().QueueReport(ended)
+	if err != nil {
+		t.Fatalf("QueueReport() failed: %v", err)
+	}
+	if queued.Status != report_model.StatusPending {
+		t.Errorf("QueueReport() status = %q, want pending", queued.Status)
+	}
+	s.Reports().Wait()
+
+	report, err := s.Reports().GetReport(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetReport() failed: %v", err)
+	}
+	if report.Status != report_model.StatusReady || report.GeneratedAt == nil {
+		t.Fatalf("GetReport() = status %q, error %q, want ready", report.Status, report.Error)
+	}
+
+	markdown, contentType, err := ReportContent(report, report_model.FormatMarkdown)
+	if err != nil || !strings.HasPrefix(contentType, "text/markdown") {
+		t.Fatalf("ReportContent(md) = %q, %v", contentType, err)
+	}
+	for _, want := range []string{
+		"# Interview report: APS EL1",
+		"**Overall score:** 53.6%",
+		"- **Structure:** 100% over 1 answer",
+		"## Strengths\n\n- **Structure:** Question 1: Easy to follow.",
+		"## Areas to improve\n\n- **Ownership:** Question 1: Only says what the team did.\n- **Impact:**",
+		"Practise leadership: Tell me about a time you changed a team's direction.",
+		"### 1. Tell me about a time you led a team through change.\n\n_Competency: leadership_",
+		"> We moved to a new case system.",
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("markdown report does not contain %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(string(markdown), "Practise leadership: Tell me about a time you led a team") {
+		t.Errorf("markdown report suggests a question that was already asked:\n%s", markdown)
+	}
+
+	html, _, err := ReportContent(report, report_model.FormatHTML)
+	if err != nil || !bytes.Contains(html, []byte("&lt;b&gt;We&lt;/b&gt;")) {
+		t.Errorf("html report does not escape the answer (%v):\n%s", err, html)
+	}
+	pdf, contentType, err := ReportContent(report, report_model.FormatPDF)
+	if err != nil || contentType != "application/pdf" || !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Errorf("ReportContent(pdf) = %d bytes of %q, %v", len(pdf), contentType, err)
+	}
+	if _, _, err := ReportContent(report, "docx"); !errors.Is(err, ErrReportFormat) {
+		t.Errorf("ReportContent(docx) error = %v, want ErrReportFormat", err)
+	}
+	if _, err := s.Reports().GetReport(interview.ID, "other@example.com"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("GetReport() for another user error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestReportContent_NotReady(t *testing.T) {
+	tests := []struct {
+		status string
+		err    error
+	}{
+		{status: report_model.StatusPending, err: ErrReportNotReady},
+		{status: report_model.StatusFailed, err: ErrReportFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			_, _, err := ReportContent(report_model.SessionReport{Status: tt.status}, report_model.FormatMarkdown)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ReportContent() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
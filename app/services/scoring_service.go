@@ -0,0 +1,553 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+	question_model "up-it-aps-api/app/models/question"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+// JudgeMaxTokens leaves the judge room for a justification per criterion.
+const JudgeMaxTokens = 1024
+
+var (
+	ErrRubricNotFound   = errors.New("rubric not found")
+	ErrRubricSlugTaken  = errors.New("rubric slug is already taken")
+	ErrInvalidRubric    = errors.New("invalid rubric")
+	ErrTurnNotAnswered  = errors.New("turn has no answer to score")
+	ErrJudgeOutput      = errors.New("judge did not return a valid score")
+	ErrTurnNotScoredYet = errors.New("turn has not been scored")
+)
+
+// fourLevels builds the usual 1-4 scale from its descriptors, lowest first.
+func fourLevels(descriptors ...string) []scoring_model.Level {
+	levels := make([]scoring_model.Level, len(descriptors))
+	for i, descriptor := range descriptors {
+		levels[i] = scoring_model.Level{Score: i + 1, Descriptor: descriptor}
+	}
+	return levels
+}
+
+// DefaultRubrics are seeded on startup, one per session type.
+var DefaultRubrics = []scoring_model.Rubric{
+	{
+		Slug:        "behavioral-core",
+		Name:        "Behavioral core",
+		SessionType: session_model.TypeBehavioral,
+		Criteria: []scoring_model.Criterion{
+			{Key: "structure", Name: "Structure", Description: "The answer sets up the situation, the candidate's task, the actions taken and the result.", Weight: 1, Levels: fourLevels(
+				"Rambling or hypothetical, no clear situation or outcome.",
+				"Some context but actions or result are missing.",
+				"Clear situation, actions and result with minor gaps.",
+				"Concise, complete and easy to follow from situation to result.")},
+			{Key: "ownership", Name: "Ownership", Description: "The candidate's own contribution is clear, not just the team's.", Weight: 1.5, Levels: fourLevels(
+				"Only describes what the team or others did.",
+				"Own role is vague or overstated.",
+				"Own actions are clear and specific.",
+				"Own decisions, trade-offs and influence on others are explicit.")},
+			{Key: "impact", Name: "Impact", Description: "The result is concrete and, where possible, measured.", Weight: 1, Levels: fourLevels(
+				"No result given.",
+				"Result is generic or unmeasured.",
+				"Concrete result with some evidence.",
+				"Measured result plus reflection on what was learned.")},
+		},
+	},
+	{
+		Slug:        "technical-core",
+		Name:        "Technical core",
+		SessionType: session_model.TypeTechnical,
+		Criteria: []scoring_model.Criterion{
+			{Key: "correctness", Name: "Correctness", Description: "The approach solves the problem and handles edge cases.", Weight: 2, Levels: fourLevels(
+				"Incorrect or does not address the problem.",
+				"Partly correct, misses important cases.",
+				"Correct with minor gaps in edge cases.",
+				"Correct, with edge cases identified and handled.")},
+			{Key: "complexity", Name: "Complexity analysis", Description: "Time and space costs are stated and justified.", Weight: 1, Levels: fourLevels(
+				"No analysis.",
+				"Analysis is wrong or unjustified.",
+				"Correct analysis of the main approach.",
+				"Correct analysis with alternatives compared.")},
+			{Key: "communication", Name: "Communication", Description: "The reasoning is explained clearly as it is developed.", Weight: 1, Levels: fourLevels(
+				"Hard to follow.",
+				"Understandable but disorganised.",
+				"Clear explanation of the approach.",
+				"Clear, structured and checks assumptions with the interviewer.")},
+		},
+	},
+	{
+		Slug:        "system-design-core",
+		Name:        "System design core",
+		SessionType: session_model.TypeSystemDesign,
+		Criteria: []scoring_model.Criterion{
+			{Key: "requirements", Name: "Requirements", Description: "Functional and non-functional requirements and scale are clarified first.", Weight: 1, Levels: fourLevels(
+				"Jumps to a design without requirements.",
+				"Some requirements, no scale estimates.",
+				"Clear requirements with rough scale.",
+				"Requirements, scale and priorities agreed before designing.")},
+			{Key: "architecture", Name: "Architecture", Description: "Components, data model and data flow fit the requirements.", Weight: 2, Levels: fourLevels(
+				"Missing or unworkable design.",
+				"Workable design with major gaps.",
+				"Sound design covering the main flows.",
+				"Sound design with a justified data model and clear interfaces.")},
+			{Key: "tradeoffs", Name: "Trade-offs", Description: "Bottlenecks, failure modes and alternatives are discussed.", Weight: 1.5, Levels: fourLevels(
+				"No trade-offs discussed.",
+				"Mentions trade-offs without reasoning.",
+				"Reasons about the main bottlenecks and failures.",
+				"Compares alternatives and explains what would change at higher scale.")},
+		},
+	},
+}
+
+// chatCompleter is the part of AiService the judge needs, so failover, metering and
+// every provider come with it.
+type chatCompleter interface {
+	CreateChatCompletion(ctx context.Context, req ai_model.ChatRequest) (*ai_model.ChatResult, error)
+}
+
+type ScoringService struct {
+	chat            chatCompleter
+	sessionService  *SessionService
+	questionService *QuestionService
+	skillService    *SkillService
+	practiceService *PracticeService
+	judge           config.JudgeConfig
+}
+
+func NewScoringService(chat chatCompleter, sessionService *SessionService, questionService *QuestionService, skillService *SkillService, practiceService *PracticeService, judge config.JudgeConfig) *ScoringService {
+	if judge.Model == "" {
+		judge.Model = "gpt-4"
+	}
+	if judge.MaxAttempts <= 0 {
+		judge.MaxAttempts = 3
+	}
+	return &ScoringService{
+		chat:            chat,
+		sessionService:  sessionService,
+		questionService: questionService,
+		skillService:    skillService,
+		practiceService: practiceService,
+		judge:           judge,
+	}
+}
+
+// SeedDefaultRubrics creates the DefaultRubrics that do not exist yet. Existing rubrics
+// are left alone so admin edits survive a restart.
+func SeedDefaultRubrics() error {
+	var db = database.DBConn
+	s := &ScoringService{}
+	for _, rubric := range DefaultRubrics {
+		_, err := s.GetRubricBySlug(rubric.Slug)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrRubricNotFound) {
+			return err
+		}
+		if err := db.Create(&rubric).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScoringService) GetRubrics() []scoring_model.Rubric {
+	var db = database.DBConn
+	var rubrics []scoring_model.Rubric
+	db.Order("slug ASC").Find(&rubrics)
+	return rubrics
+}
+
+func (s *ScoringService) GetRubric(id uint) (scoring_model.Rubric, error) {
+	return s.findRubric(database.DBConn.Where("id = ?", id))
+}
+
+func (s *ScoringService) GetRubricBySlug(slug string) (scoring_model.Rubric, error) {
+	return s.findRubric(database.DBConn.Where("slug = ?", slug))
+}
+
+func (s *ScoringService) findRubric(query *gorm.DB) (scoring_model.Rubric, error) {
+	var rubric scoring_model.Rubric
+	result := query.First(&rubric)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return scoring_model.Rubric{}, ErrRubricNotFound
+	}
+	if result.Error != nil {
+		return scoring_model.Rubric{}, result.Error
+	}
+	return rubric, nil
+}
+
+func (s *ScoringService) CreateRubric(input *scoring_model.InputRubric) (scoring_model.Rubric, error) {
+	if err := validateRubric(input); err != nil {
+		return scoring_model.Rubric{}, err
+	}
+	if _, err := s.GetRubricBySlug(input.Slug); err == nil {
+		return scoring_model.Rubric{}, ErrRubricSlugTaken
+	}
+	rubric := scoring_model.Rubric{Slug: input.Slug, Name: input.Name, SessionType: input.SessionType, Criteria: input.Criteria}
+	var db = database.DBConn
+	if err := db.Create(&rubric).Error; err != nil {
+		return scoring_model.Rubric{}, err
+	}
+	return rubric, nil
+}
+
+// UpdateRubric replaces the rubric's name, type and criteria. Scores already given keep
+// the weights and maxima they were computed with.
+func (s *ScoringService) UpdateRubric(id uint, input *scoring_model.InputRubric) (scoring_model.Rubric, error) {
+	rubric, err := s.GetRubric(id)
+	if err != nil {
+		return scoring_model.Rubric{}, err
+	}
+	input.Slug = rubric.Slug
+	if err := validateRubric(input); err != nil {
+		return scoring_model.Rubric{}, err
+	}
+	rubric.Name, rubric.SessionType, rubric.Criteria = input.Name, input.SessionType, input.Criteria
+	var db = database.DBConn
+	if err := db.Save(&rubric).Error; err != nil {
+		return scoring_model.Rubric{}, err
+	}
+	return rubric, nil
+}
+
+// ResolveRubric returns the rubric named by slug, or else the first rubric for the
+// session type.
+func (s *ScoringService) ResolveRubric(slug string, sessionType string) (scoring_model.Rubric, error) {
+	if slug != "" {
+		return s.GetRubricBySlug(slug)
+	}
+	return s.findRubric(database.DBConn.Where("session_type = ?", sessionType).Order("id ASC"))
+}
+
+// ScoreTurn asks the judge model to score the answer of one session turn against a
+// rubric and stores the result. Malformed output is sent back to the judge with what was
+// wrong with it, up to the configured number of attempts. The first score of a turn
+// drawn from the question bank also updates the candidate's skill estimate, and every
+// score of one reschedules its question and competency for practice.
+func (s *ScoringService) ScoreTurn(ctx context.Context, sessionID uint, email string, turnNumber int, rubricSlug string) (scoring_model.TurnScore, error) {
+	interview, turn, err := s.answeredTurn(sessionID, email, turnNumber)
+	if err != nil {
+		return scoring_model.TurnScore{}, err
+	}
+	rubric, err := s.ResolveRubric(rubricSlug, interview.Type)
+	if err != nil {
+		return scoring_model.TurnScore{}, err
+	}
+
+	var question question_model.Question
+	if turn.QuestionID != 0 {
+		if question, err = s.questionService.GetQuestion(turn.QuestionID); err != nil && !errors.Is(err, ErrQuestionNotFound) {
+			return scoring_model.TurnScore{}, err
+		}
+	}
+	var submission string
+	if question.Type == question_model.TypeCoding {
+		if submission, err = submissionEvidence(turn.ID); err != nil {
+			return scoring_model.TurnScore{}, err
+		}
+	}
+	request := judgeRequest(s.judge.Model, rubric, interview, turn, question.ExpectedAnswer, submission)
+
+	var judgement judgeOutput
+	result, attempts, problems, err := s.askJudge(ctx, request, func(text string) []string {
+		var problems []string
+		judgement, problems = parseJudgement(text, rubric)
+		return problems
+	})
+	if err != nil {
+		return scoring_model.TurnScore{}, err
+	}
+	if len(problems) > 0 {
+		return scoring_model.TurnScore{}, fmt.Errorf("%w after %d attempts: %s", ErrJudgeOutput, attempts, strings.Join(problems, "; "))
+	}
+	score := turnScore(rubric, judgement)
+	score.SessionID, score.TurnNumber, score.TurnID = interview.ID, turn.Number, turn.ID
+	score.Provider, score.JudgeModel, score.Attempts = result.Provider, result.Model, attempts
+	var db = database.DBConn
+	if err := db.Create(&score).Error; err != nil {
+		return scoring_model.TurnScore{}, err
+	}
+	// re-scoring a turn must not count the same answer twice, so only the score that
+	// marks the turn observed updates the skill estimate, even when two race
+	if question.ID != 0 {
+		result := db.Model(&session_model.SessionTurn{}).Where("id = ? AND skill_observed = ?", turn.ID, false).Update("skill_observed", true)
+		if result.Error != nil {
+			log.Printf("Error marking turn %d observed: %v", turn.ID, result.Error)
+		} else if result.RowsAffected == 1 {
+			if _, err := s.skillService.Observe(interview.Email, question, score.Overall/100); err != nil {
+				log.Printf("Error updating skill estimate: %v", err)
+			}
+		}
+	}
+	if question.ID != 0 {
+		if err := s.practiceService.Recompute(interview.Email, question); err != nil {
+			log.Printf("Error updating practice schedule: %v", err)
+		}
+	}
+	return score, nil
+}
+
+// answeredTurn loads a turn of the user's session and checks it has an answer.
+func (s *ScoringService) answeredTurn(sessionID uint, email string, turnNumber int) (session_model.InterviewSession, session_model.SessionTurn, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return session_model.InterviewSession{}, session_model.SessionTurn{}, err
+	}
+	turn, err := s.sessionService.GetTurn(interview.ID, turnNumber)
+	if err != nil {
+		return session_model.InterviewSession{}, session_model.SessionTurn{}, err
+	}
+	if strings.TrimSpace(turn.Answer) == "" {
+		return session_model.InterviewSession{}, session_model.SessionTurn{}, ErrTurnNotAnswered
+	}
+	return interview, turn, nil
+}
+
+// askJudge sends request to the judge model until check finds nothing wrong with the
+// reply. Each rejected reply is sent back with what was wrong with it, up to the
+// configured number of attempts; if none is accepted the last problems are returned.
+func (s *ScoringService) askJudge(ctx context.Context, request ai_model.ChatRequest, check func(text string) []string) (*ai_model.ChatResult, int, []string, error) {
+	var problems []string
+	for attempt := 1; attempt <= s.judge.MaxAttempts; attempt++ {
+		result, err := s.chat.CreateChatCompletion(ctx, request)
+		if err != nil {
+			return nil, attempt, nil, err
+		}
+		if problems = check(result.Text); len(problems) == 0 {
+			return result, attempt, nil, nil
+		}
+		request.Messages = append(request.Messages,
+			ai_model.MessageRequest{Role: "assistant", Content: result.Text},
+			ai_model.MessageRequest{Role: "user", Content: repairPrompt(problems)},
+		)
+	}
+	return nil, s.judge.MaxAttempts, problems, nil
+}
+
+// GetTurnScores returns every judgement of the turn, newest first.
+func (s *ScoringService) GetTurnScores(sessionID uint, email string, turnNumber int) ([]scoring_model.TurnScore, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return nil, err
+	}
+	var db = database.DBConn
+	var scores []scoring_model.TurnScore
+	result := db.Preload("Criteria", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("session_id = ? AND turn_number = ?", interview.ID, turnNumber).Order("id DESC").Find(&scores)
+	return scores, result.Error
+}
+
+// judgeOutput is the JSON the judge is asked to reply with.
+type judgeOutput struct {
+	Scores []struct {
+		Criterion     string `json:"criterion"`
+		Score         *int   `json:"score"`
+		Justification string `json:"justification"`
+	} `json:"scores"`
+	Summary string `json:"summary"`
+}
+
+// judgeRequest asks the judge to score the turn. submission describes the code the
+// candidate ran against a coding question's tests, if any.
+func judgeRequest(model string, rubric scoring_model.Rubric, interview session_model.InterviewSession, turn session_model.SessionTurn, outline string, submission string) ai_model.ChatRequest {
+	var prompt strings.Builder
+	prompt.WriteString("You are an impartial interview assessor. Score the candidate's answer against every criterion of the rubric below, using only the listed scores. ")
+	prompt.WriteString("Base each justification on what the candidate actually said, in one or two sentences.\n\nRubric:\n")
+	for _, criterion := range rubric.Criteria {
+		fmt.Fprintf(&prompt, "- %s (%s, weight %g): %s\n", criterion.Key, criterion.Name, criterion.Weight, criterion.Description)
+		for _, level := range criterion.Levels {
+			fmt.Fprintf(&prompt, "  %d: %s\n", level.Score, level.Descriptor)
+		}
+	}
+	prompt.WriteString("\nReply with only a JSON object of this shape, with one entry per criterion key:\n")
+	prompt.WriteString(`{"scores": [{"criterion": "<key>", "score": <integer>, "justification": "<text>"}], "summary": "<one paragraph of feedback>"}`)
+
+	var answer strings.Builder
+	fmt.Fprintf(&answer, "Interview type: %s\nTarget role: %s\nQuestion: %s\n", interview.Type, interview.TargetRole, turn.Question)
+	if outline != "" {
+		fmt.Fprintf(&answer, "Expected answer outline:\n%s\n", outline)
+	}
+	if turn.LimitSeconds > 0 {
+		fmt.Fprintf(&answer, "Time limit: %d seconds. The candidate took %.0f seconds", turn.LimitSeconds, turn.DurationSeconds)
+		switch {
+		case turn.TimedOut:
+			answer.WriteString(" and was cut off when time ran out")
+		case turn.OvertimeSeconds > 0:
+			fmt.Fprintf(&answer, ", %.0f seconds over", turn.OvertimeSeconds)
+		}
+		answer.WriteString("; where a criterion covers concision or time management, take this into account.\n")
+	}
+	fmt.Fprintf(&answer, "Candidate's answer: %s", turn.Answer)
+	if submission != "" {
+		fmt.Fprintf(&answer, "\n\n%s", submission)
+	}
+
+	temperature := float32(0)
+	return ai_model.ChatRequest{
+		Model:        model,
+		SystemPrompt: prompt.String(),
+		Temperature:  &temperature,
+		MaxTokens:    JudgeMaxTokens,
+		JSONOutput:   true,
+		Messages:     []ai_model.MessageRequest{{Role: "user", Content: answer.String()}},
+	}
+}
+
+func repairPrompt(problems []string) string {
+	return "Your reply could not be used: " + strings.Join(problems, "; ") + ". Reply again with only the corrected JSON object."
+}
+
+// parseJudgement extracts the judge's JSON from text and checks it against the rubric.
+// It returns what was wrong with it, if anything.
+func parseJudgement(text string, rubric scoring_model.Rubric) (judgeOutput, []string) {
+	var judgement judgeOutput
+	if err := json.Unmarshal([]byte(extractJSONObject(text)), &judgement); err != nil {
+		return judgeOutput{}, []string{fmt.Sprintf("the reply is not a valid JSON object (%v)", err)}
+	}
+
+	var problems []string
+	seen := make(map[string]int)
+	for _, score := range judgement.Scores {
+		seen[score.Criterion]++
+	}
+	reported := make(map[string]bool)
+	for _, score := range judgement.Scores {
+		key := score.Criterion
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+		if _, ok := rubricCriterion(rubric, key); !ok {
+			problems = append(problems, fmt.Sprintf("%q is not a rubric criterion", key))
+		} else if seen[key] > 1 {
+			problems = append(problems, fmt.Sprintf("criterion %q is scored %d times", key, seen[key]))
+		}
+	}
+	for _, criterion := range rubric.Criteria {
+		if seen[criterion.Key] == 0 {
+			problems = append(problems, fmt.Sprintf("criterion %q is missing", criterion.Key))
+		}
+	}
+	for _, score := range judgement.Scores {
+		criterion, ok := rubricCriterion(rubric, score.Criterion)
+		if !ok {
+			continue
+		}
+		switch {
+		case score.Score == nil:
+			problems = append(problems, fmt.Sprintf("criterion %q has no score", score.Criterion))
+		case !criterion.HasLevel(*score.Score):
+			problems = append(problems, fmt.Sprintf("criterion %q score %d is not one of its levels (%s)", score.Criterion, *score.Score, levelScores(criterion)))
+		}
+		if strings.TrimSpace(score.Justification) == "" {
+			problems = append(problems, fmt.Sprintf("criterion %q has no justification", score.Criterion))
+		}
+	}
+	return judgement, problems
+}
+
+// levelScores lists the scores of the criterion's levels, such as "1, 2, 3, 4".
+func levelScores(criterion scoring_model.Criterion) string {
+	scores := make([]string, len(criterion.Levels))
+	for i, level := range criterion.Levels {
+		scores[i] = strconv.Itoa(level.Score)
+	}
+	return strings.Join(scores, ", ")
+}
+
+// extractJSONObject strips code fences and any prose around the outermost JSON object.
+func extractJSONObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return strings.TrimSpace(text)
+	}
+	return text[start : end+1]
+}
+
+func rubricCriterion(rubric scoring_model.Rubric, key string) (scoring_model.Criterion, bool) {
+	for _, criterion := range rubric.Criteria {
+		if criterion.Key == key {
+			return criterion, true
+		}
+	}
+	return scoring_model.Criterion{}, false
+}
+
+// turnScore turns a validated judgement into a TurnScore in rubric order. Overall is the
+// weighted mean of score / max score, as a percentage.
+func turnScore(rubric scoring_model.Rubric, judgement judgeOutput) scoring_model.TurnScore {
+	score := scoring_model.TurnScore{RubricID: rubric.ID, RubricSlug: rubric.Slug, Summary: strings.TrimSpace(judgement.Summary)}
+	var weighted, weights float64
+	for _, criterion := range rubric.Criteria {
+		for _, given := range judgement.Scores {
+			if given.Criterion != criterion.Key {
+				continue
+			}
+			score.Criteria = append(score.Criteria, scoring_model.CriterionScore{
+				Criterion:     criterion.Key,
+				Score:         *given.Score,
+				MaxScore:      criterion.MaxScore(),
+				Weight:        criterion.Weight,
+				Justification: strings.TrimSpace(given.Justification),
+			})
+			if criterion.MaxScore() > 0 {
+				weighted += criterion.Weight * float64(*given.Score) / float64(criterion.MaxScore())
+			}
+			weights += criterion.Weight
+		}
+	}
+	if weights > 0 {
+		score.Overall = math.Round(weighted/weights*1000) / 10
+	}
+	return score
+}
+
+func validateRubric(input *scoring_model.InputRubric) error {
+	switch {
+	case !personaSlugPattern.MatchString(input.Slug):
+		return fmt.Errorf("%w: slug must be lowercase letters, digits and dashes", ErrInvalidRubric)
+	case input.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidRubric)
+	case len(input.Criteria) == 0:
+		return fmt.Errorf("%w: at least one criterion is required", ErrInvalidRubric)
+	}
+	keys := make(map[string]bool)
+	for _, criterion := range input.Criteria {
+		switch {
+		case criterion.Key == "":
+			return fmt.Errorf("%w: every criterion needs a key", ErrInvalidRubric)
+		case keys[criterion.Key]:
+			return fmt.Errorf("%w: criterion %q is listed twice", ErrInvalidRubric, criterion.Key)
+		case criterion.Weight <= 0:
+			return fmt.Errorf("%w: criterion %q needs a positive weight", ErrInvalidRubric, criterion.Key)
+		case len(criterion.Levels) < 2:
+			return fmt.Errorf("%w: criterion %q needs at least two levels", ErrInvalidRubric, criterion.Key)
+		case criterion.MaxScore() <= 0:
+			return fmt.Errorf("%w: criterion %q needs a positive top score", ErrInvalidRubric, criterion.Key)
+		}
+		keys[criterion.Key] = true
+		scores := make(map[int]bool)
+		for _, level := range criterion.Levels {
+			if scores[level.Score] || level.Descriptor == "" {
+				return fmt.Errorf("%w: criterion %q levels need distinct scores and descriptors", ErrInvalidRubric, criterion.Key)
+			}
+			scores[level.Score] = true
+		}
+	}
+	return nil
+}
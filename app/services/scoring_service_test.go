@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+var testRubric = scoring_model.Rubric{
+	Slug: "test",
+	Criteria: []scoring_model.Criterion{
+		{Key: "structure", Weight: 1, Levels: fourLevels("a", "b", "c", "d")},
+		{Key: "impact", Weight: 3, Levels: fourLevels("a", "b", "c", "d")},
+	},
+}
+
+func TestParseJudgement(t *testing.T) {
+	// a rubric whose impact levels skip scores
+	gappedRubric := scoring_model.Rubric{
+		Slug: "gapped",
+		Criteria: []scoring_model.Criterion{
+			testRubric.Criteria[0],
+			{Key: "impact", Weight: 1, Levels: []scoring_model.Level{{Score: 0, Descriptor: "none"}, {Score: 3, Descriptor: "some"}, {Score: 5, Descriptor: "measured"}}},
+		},
+	}
+	tests := []struct {
+		name     string
+		text     string
+		rubric   scoring_model.Rubric
+		problems []string
+	}{
+		{
+			name: "valid in a code fence",
+			text: "```json\n{\"scores\": [{\"criterion\": \"structure\", \"score\": 3, \"justification\": \"Clear STAR.\"}, {\"criterion\": \"impact\", \"score\": 2, \"justification\": \"No numbers.\"}], \"summary\": \"Good.\"}\n```",
+		},
+		{
+			name:     "not json",
+			text:     "I would give this a 3 out of 4.",
+			problems: []string{"the reply is not a valid JSON object"},
+		},
+		{
+			name: "missing, unknown and out of range",
+			text: `{"scores": [{"criterion": "structure", "score": 5, "justification": "x"}, {"criterion": "clarity", "score": 2, "justification": "y"}]}`,
+			problems: []string{
+				`"clarity" is not a rubric criterion`,
+				`criterion "impact" is missing`,
+				`criterion "structure" score 5 is not one of its levels (1, 2, 3, 4)`,
+			},
+		},
+		{
+			name:     "score between levels",
+			text:     `{"scores": [{"criterion": "structure", "score": 2, "justification": "x"}, {"criterion": "impact", "score": 2, "justification": "y"}]}`,
+			rubric:   gappedRubric,
+			problems: []string{`criterion "impact" score 2 is not one of its levels (0, 3, 5)`},
+		},
+		{
+			name: "duplicate, no score and no justification",
+			text: `{"scores": [{"criterion": "structure", "score": 2, "justification": "x"}, {"criterion": "structure", "score": 3, "justification": "y"}, {"criterion": "impact", "justification": " "}]}`,
+			problems: []string{
+				`criterion "structure" is scored 2 times`,
+				`criterion "impact" has no score`,
+				`criterion "impact" has no justification`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rubric := testRubric
+			if tt.rubric.Slug != "" {
+				rubric = tt.rubric
+			}
+			_, problems := parseJudgement(tt.text, rubric)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("parseJudgement() problems = %q, want %q", problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnScore_WeightedOverall(t *testing.T) {
+	judgement, problems := parseJudgement(`{"scores": [{"criterion": "impact", "score": 2, "justification": "x"}, {"criterion": "structure", "score": 4, "justification": "y"}], "summary": " ok "}`, testRubric)
+	if len(problems) > 0 {
+		t.Fatalf("parseJudgement() problems = %q", problems)
+	}
+	score := turnScore(testRubric, judgement)
+	// (1 * 4/4 + 3 * 2/4) / 4 = 62.5%
+	if score.Overall != 62.5 {
+		t.Errorf("Overall = %v, want 62.5", score.Overall)
+	}
+	if len(score.Criteria) != 2 || score.Criteria[0].Criterion != "structure" || score.Criteria[1].MaxScore != 4 {
+		t.Errorf("Criteria = %+v, want rubric order with max scores", score.Criteria)
+	}
+	if score.Summary != "ok" {
+		t.Errorf("Summary = %q, want %q", score.Summary, "ok")
+	}
+}
+
+func TestScoringService_ScoreTurnAgainstFakeJudge(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Tell me about a time you led change."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); !errors.Is(err, ErrTurnNotAnswered) {
+		t.Errorf("ScoreTurn() on an open question error = %v, want ErrTurnNotAnswered", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "I moved my team to a new case system and cut backlog by 30%."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+
+	valid := `{"scores": [
+		{"criterion": "structure", "score": 3, "justification": "Situation and result are clear."},
+		{"criterion": "ownership", "score": 2, "justification": "Says 'my team' more than 'I'."},
+		{"criterion": "impact", "score": 4, "justification": "Backlog cut by 30%."}
+	], "summary": "Solid example, make your own role clearer."}`
+	fake.Script(fakeproviders.RouteOpenAiChat,
+		fakeproviders.Response{Text: "Here is my assessment: structure 3, ownership 2."},
+		fakeproviders.Response{Text: valid},
+	)
+
+	score, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, "")
+	if err != nil {
+		t.Fatalf("ScoreTurn() failed: %v", err)
+	}
+	if score.Attempts != 2 || score.RubricSlug != "behavioral-core" || len(score.Criteria) != 3 {
+		t.Errorf("ScoreTurn() = %d attempts, rubric %q, %d criteria", score.Attempts, score.RubricSlug, len(score.Criteria))
+	}
+	last := string(fake.LastRequest(fakeproviders.RouteOpenAiChat))
+	for _, want := range []string{`"response_format":{"type":"json_object"}`, "cut backlog by 30%", "Your reply could not be used"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("repair request does not contain %q: %s", want, last)
+		}
+	}
+
+	scores, err := s.Scoring().GetTurnScores(interview.ID, email, 1)
+	if err != nil {
+		t.Fatalf("GetTurnScores() failed: %v", err)
+	}
+	if len(scores) != 1 || len(scores[0].Criteria) != 3 || scores[0].Criteria[2].Justification != "Backlog cut by 30%." {
+		t.Errorf("GetTurnScores() = %+v", scores)
+	}
+
+	fake.Script(fakeproviders.RouteOpenAiChat,
+		fakeproviders.Response{Text: "nope"},
+		fakeproviders.Response{Text: "still nope"},
+		fakeproviders.Response{Text: "{}"},
+	)
+	if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); !errors.Is(err, ErrJudgeOutput) {
+		t.Errorf("ScoreTurn() with malformed output every time error = %v, want ErrJudgeOutput", err)
+	}
+	if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, "no-such-rubric"); !errors.Is(err, ErrRubricNotFound) {
+		t.Errorf("ScoreTurn() with an unknown rubric error = %v, want ErrRubricNotFound", err)
+	}
+}
+
+func TestValidateRubric(t *testing.T) {
+	criterion := scoring_model.Criterion{Key: "impact", Weight: 1, Levels: fourLevels("a", "b", "c", "d")}
+	tests := []struct {
+		name  string
+		input scoring_model.InputRubric
+		valid bool
+	}{
+		{name: "valid", input: scoring_model.InputRubric{Slug: "ok", Name: "Ok", Criteria: []scoring_model.Criterion{criterion}}, valid: true},
+		{name: "no criteria", input: scoring_model.InputRubric{Slug: "ok", Name: "Ok"}},
+		{name: "duplicate key", input: scoring_model.InputRubric{Slug: "ok", Name: "Ok", Criteria: []scoring_model.Criterion{criterion, criterion}}},
+		{name: "zero weight", input: scoring_model.InputRubric{Slug: "ok", Name: "Ok", Criteria: []scoring_model.Criterion{{Key: "x", Levels: criterion.Levels}}}},
+		{name: "one level", input: scoring_model.InputRubric{Slug: "ok", Name: "Ok", Criteria: []scoring_model.Criterion{{Key: "x", Weight: 1, Levels: fourLevels("a")}}}},
+		{name: "bad slug", input: scoring_model.InputRubric{Slug: "Not OK", Name: "Ok", Criteria: []scoring_model.Criterion{criterion}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRubric(&tt.input)
+			if tt.valid && err != nil {
+				t.Errorf("validateRubric() error = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidRubric) {
+				t.Errorf("validateRubric() error = %v, want ErrInvalidRubric", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMinChunkChars is the shortest chunk worth its own TTS request. Shorter sentences
+// are merged with a neighbour, so "Yes." is not spoken on its own.
+const DefaultMinChunkChars = 20
+
+// SegmentOptions bound the size of the chunks SegmentSentences returns, in characters.
+// MaxChars of 0 means no limit.
+type SegmentOptions struct {
+	MinChars int
+	MaxChars int
+}
+
+// abbreviations never end a sentence, whatever follows them.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"e.g": true, "i.e": true, "eg": true, "ie": true, "cf": true, "vs": true, "approx": true,
+	"dept": true, "est": true, "fig": true,
+}
+
+// SegmentSentences splits text into chunks to be spoken one at a time. Chunks end at the
+// end of a sentence or line and keep their punctuation, so the voice keeps its intonation.
+// Full stops in abbreviations, decimals, URLs and names like Node.js do not end a
+// sentence, nor does anything inside code or quotes. Sentences longer than MaxChars are
+// split at a clause and then at a word, and ones shorter than MinChars are merged with a
+// neighbour.
+func SegmentSentences(text string, options SegmentOptions) []string {
+	var segments []string
+	for _, sentence := range splitSentences(text) {
+		segments = append(segments, splitLong(sentence, options.MaxChars)...)
+	}
+	return mergeFragments(segments, options.MinChars, options.MaxChars)
+}
+
+// splitSentences splits text at sentence ends and line breaks.
+func splitSentences(text string) []string {
+	r := []rune(text)
+	var sentences []string
+	emit := func(from int, to int) {
+		if sentence := strings.TrimSpace(string(r[from:to])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	start := 0
+	fenced, inCode, quoted := false, false, false
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '`':
+			if strings.HasPrefix(string(r[i:]), "```") {
+				fenced = !fenced
+				i += 2
+			} else if !fenced {
+				inCode = !inCode
+			}
+			continue
+		case fenced:
+			continue
+		case c == '\n':
+			// an unclosed quote or backtick does not run on past the line
+			inCode, quoted = false, false
+			emit(start, i)
+			start = i + 1
+			continue
+		case inCode:
+			continue
+		case c == '"' || c == '“' || c == '”':
+			quoted = opensQuote(r, i, quoted)
+			continue
+		case !isTerminal(c):
+			continue
+		}
+
+		end := i + 1
+		for end < len(r) && isTerminal(r[end]) {
+			end++
+		}
+		for end < len(r) && isCloser(r[end]) {
+			if r[end] == '"' || r[end] == '”' {
+				quoted = false
+			}
+			end++
+		}
+		next := end
+		for next < len(r) && r[next] != '\n' && unicode.IsSpace(r[next]) {
+			next++
+		}
+		// 3.14, Node.js and URLs carry on without a space
+		if end < len(r) && !unicode.IsSpace(r[end]) || quoted || continuesSentence(r, start, i, end, next) {
+			i = end - 1
+			continue
+		}
+		emit(start, end)
+		start = end
+		i = end - 1
+	}
+	emit(start, len(r))
+	return sentences
+}
+
+// continuesSentence says whether the sentence goes on after the terminal punctuation
+// r[at:end], with the next word starting at next.
+func continuesSentence(r []rune, start int, at int, end int, next int) bool {
+	if next == len(r) || r[next] == '\n' {
+		return false
+	}
+	// "etc. and", "approx. ten", "Really?" she asked
+	if unicode.IsLower(r[next]) {
+		return true
+	}
+	if r[at] != '.' || end-at > 1 && isTerminal(r[at+1]) {
+		return false
+	}
+	word := at
+	for word > start && !unicode.IsSpace(r[word-1]) && !isOpener(r[word-1]) {
+		word--
+	}
+	before := strings.ToLower(string(r[word:at]))
+	if abbreviations[before] {
+		return true
+	}
+	// initials, as in J. Smith or U.S. Army, but not "than I. We"
+	letters := strings.ReplaceAll(before, ".", "")
+	count := utf8.RuneCountInString(letters)
+	if letters == "" || count > 3 || strings.Count(before, ".") != count-1 || before == "i" {
+		return false
+	}
+	return unicode.IsUpper(r[word]) && allLetters(letters)
+}
+
+// opensQuote returns whether a quote is open after the quote mark at r[i].
+func opensQuote(r []rune, i int, quoted bool) bool {
+	switch r[i] {
+	case '“':
+		return true
+	case '”':
+		return false
+	}
+	// a straight quote after a space opens, anything else closes
+	return !quoted && (i == 0 || unicode.IsSpace(r[i-1]) || isOpener(r[i-1]))
+}
+
+// splitLong splits a sentence longer than max characters, at the last clause break that
+// fits, then at the last space, then wherever it has to.
+func splitLong(sentence string, max int) []string {
+	var parts []string
+	r := []rune(sentence)
+	for max > 0 && len(r) > max {
+		cut := -1
+		for i := max - 1; i > 0 && cut < 0; i-- {
+			if strings.ContainsRune(",;:—–", r[i]) && unicode.IsSpace(r[i+1]) {
+				cut = i + 1
+			}
+		}
+		for i := max; i > 0 && cut < 0; i-- {
+			if unicode.IsSpace(r[i]) {
+				cut = i
+			}
+		}
+		if cut < 0 {
+			cut = max
+		}
+		if part := strings.TrimSpace(string(r[:cut])); part != "" {
+			parts = append(parts, part)
+		}
+		r = []rune(strings.TrimSpace(string(r[cut:])))
+	}
+	if len(r) > 0 {
+		parts = append(parts, string(r))
+	}
+	return parts
+}
+
+// mergeFragments joins each segment shorter than min characters to its neighbour, as
+// long as the result is no longer than max.
+func mergeFragments(segments []string, min int, max int) []string {
+	var merged []string
+	for _, segment := range segments {
+		if n := len(merged); n > 0 {
+			last, length := utf8.RuneCountInString(merged[n-1]), utf8.RuneCountInString(segment)
+			if (last < min || length < min) && (max <= 0 || last+1+length <= max) {
+				merged[n-1] += " " + segment
+				continue
+			}
+		}
+		merged = append(merged, segment)
+	}
+	return merged
+}
+
+func isTerminal(c rune) bool {
+	return c == '.' || c == '!' || c == '?' || c == '…'
+}
+
+func isCloser(c rune) bool {
+	return strings.ContainsRune("\"'”’)]»", c)
+}
+
+func isOpener(c rune) bool {
+	return strings.ContainsRune("\"'“‘([«", c)
+}
+
+func allLetters(s string) bool {
+	for _, c := range s {
+		if !unicode.IsLetter(c) {
+			return false
+		}
+	}
+	return true
+}
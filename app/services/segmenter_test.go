@@ -0,0 +1,109 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSegmentSentences(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		options SegmentOptions
+		want    []string
+	}{
+		{
+			name: "keeps punctuation",
+			text: "Tell me about a time you led a team. What was the outcome? Great, thanks!",
+			want: []string{"Tell me about a time you led a team.", "What was the outcome?", "Great, thanks!"},
+		},
+		{
+			name: "abbreviations",
+			text: "Use a framework, e.g. STAR, to answer. Dr. Smith vs. Mr. Jones was close. We moved to the U.S. Army base.",
+			want: []string{"Use a framework, e.g. STAR, to answer.", "Dr. Smith vs. Mr. Jones was close.", "We moved to the U.S. Army base."},
+		},
+		{
+			name: "lower case carries on",
+			text: "We cut costs, staff, etc. and still delivered. It worked.",
+			want: []string{"We cut costs, staff, etc. and still delivered.", "It worked."},
+		},
+		{
+			name: "decimals, names and URLs",
+			text: "Pi is 3.14 and the budget grew 2.5 times. I built it in Node.js. See https://example.com/a.b?c=1 for more.",
+			want: []string{"Pi is 3.14 and the budget grew 2.5 times.", "I built it in Node.js.", "See https://example.com/a.b?c=1 for more."},
+		},
+		{
+			name: "code",
+			text: "Sorting is O(n log n). Call `os.Exit(1). Then return.` to stop. ```\nx := 1. Done.\n``` That is all.",
+			want: []string{"Sorting is O(n log n).", "Call `os.Exit(1). Then return.` to stop.", "```\nx := 1. Done.\n``` That is all."},
+		},
+		{
+			name: "quotes",
+			text: `She said "Stop. Go home." Then she left. "Really?" he asked. It's “fine. Honestly.” Right.`,
+			want: []string{`She said "Stop. Go home."`, `Then she left.`, `"Really?" he asked.`, `It's “fine. Honestly.”`, `Right.`},
+		},
+		{
+			name: "ellipses and lines",
+			text: "Well... maybe. Wait… What?! No\n- one\n- two",
+			want: []string{"Well... maybe.", "Wait…", "What?!", "No", "- one", "- two"},
+		},
+		{
+			name:    "merges fragments",
+			text:    "Yes. I led the migration myself. It took us six months. Ok.",
+			options: SegmentOptions{MinChars: DefaultMinChunkChars},
+			want:    []string{"Yes. I led the migration myself.", "It took us six months. Ok."},
+		},
+		{
+			name:    "splits long sentences",
+			text:    "First we mapped the systems, then we planned the cutover; finally we moved everything over one weekend.",
+			options: SegmentOptions{MaxChars: 40},
+			want:    []string{"First we mapped the systems,", "then we planned the cutover;", "finally we moved everything over one", "weekend."},
+		},
+		{
+			name:    "merging stays under the limit",
+			text:    "One. Two. Three. Four.",
+			options: SegmentOptions{MinChars: 12, MaxChars: 12},
+			want:    []string{"One. Two.", "Three. Four."},
+		},
+		{
+			name: "empty",
+			text: "  \n ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SegmentSentences(tt.text, tt.options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SegmentSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAiService_Chunking(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	s.failover.Tts = []string{"unreal-speech"}
+	if limit := s.MaxChunkChars("tts-1"); limit != 1000 {
+		t.Errorf("MaxChunkChars() = %d, want the smallest limit in the failover chain", limit)
+	}
+	s.failover.Tts = []string{"tts-1"}
+
+	reply := strings.Repeat("That is a good example of leading a team. ", 60)
+	for _, model := range []string{"tts-1", "unreal-speech"} {
+		chunks := s.Chunking(reply, model)
+		max := s.MaxChunkChars(model)
+		for _, chunk := range chunks {
+			if n := utf8.RuneCount(chunk); n > max {
+				t.Errorf("%s chunk of %d characters, want at most %d", model, n, max)
+			}
+		}
+		if model == "tts-1" && len(chunks) != 60 {
+			t.Errorf("tts-1 chunks = %d, want a sentence each", len(chunks))
+		}
+		if model == "unreal-speech" && len(chunks) != 3 {
+			t.Errorf("unreal-speech chunks = %d, want as few as its limit allows", len(chunks))
+		}
+	}
+}
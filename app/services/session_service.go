@@ -0,0 +1,538 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	question_model "up-it-aps-api/app/models/question"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+// DefaultSessionQuestions is how many bank questions a session draws when it does not
+// say.
+const DefaultSessionQuestions = 5
+
+// MaxFollowUpsLimit caps the follow-ups per question a session or user can ask for.
+const MaxFollowUpsLimit = 5
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionNotActive    = errors.New("session is not in progress")
+	ErrInvalidSession      = errors.New("invalid session")
+	ErrSessionTransition   = errors.New("session cannot move to that status")
+	ErrSessionTurnNotFound = errors.New("session turn not found")
+)
+
+type SessionService struct {
+	userService     *UserService
+	personaService  *PersonaService
+	questionService *QuestionService
+	skillService    *SkillService
+	onEnd           func(session_model.InterviewSession)
+}
+
+func NewSessionService(userService *UserService, personaService *PersonaService, questionService *QuestionService, skillService *SkillService) *SessionService {
+	return &SessionService{
+		userService:     userService,
+		personaService:  personaService,
+		questionService: questionService,
+		skillService:    skillService,
+	}
+}
+
+// StartSession creates a session for email. It starts straight away unless it is
+// scheduled for later. The persona comes from the input, then from the user's settings.
+func (s *SessionService) StartSession(email string, input *session_model.InputSession) (session_model.InterviewSession, error) {
+	return s.startSession(email, input, nil)
+}
+
+// startSession creates the session. Sessions planned elsewhere, such as practice
+// sessions, pass their questions as planned instead of drawing them from input.Questions.
+func (s *SessionService) startSession(email string, input *session_model.InputSession, planned []uint) (session_model.InterviewSession, error) {
+	if err := validateSession(input); err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	settings := s.userService.GetUserSettingsByEmail(email)
+	persona := s.personaService.ResolvePersona(0, input.Persona, settings.Persona)
+
+	interview := session_model.InterviewSession{
+		Email:        email,
+		Type:         input.Type,
+		TargetRole:   input.TargetRole,
+		PersonaID:    persona.ID,
+		Persona:      persona.Slug,
+		MaxFollowUps: min(max(settings.MaxFollowUps, 0), MaxFollowUpsLimit),
+	}
+	if input.MaxFollowUps != nil {
+		interview.MaxFollowUps = *input.MaxFollowUps
+	}
+	if input.QuestionSeconds > 0 || input.TotalSeconds > 0 {
+		interview.QuestionSeconds, interview.TotalSeconds = input.QuestionSeconds, input.TotalSeconds
+		interview.WarningSeconds, interview.TimeUp = input.WarningSeconds, input.TimeUp
+		if interview.WarningSeconds == nil {
+			interview.WarningSeconds = DefaultWarningSeconds
+		}
+		if interview.TimeUp == "" {
+			interview.TimeUp = session_model.TimeUpAdvance
+		}
+	}
+	if planned != nil {
+		interview.QuestionIDs, interview.Practice = planned, true
+	} else if input.Questions != nil {
+		count := input.QuestionCount
+		if count <= 0 {
+			count = DefaultSessionQuestions
+		}
+		if input.Adaptive {
+			// only the first question is picked now, the rest as the session goes
+			interview.Adaptive, interview.QuestionCount, interview.QuestionFilter = true, count, input.Questions
+			err := s.selectAdaptiveQuestion(&interview)
+			if errors.Is(err, ErrNoQuestions) {
+				return session_model.InterviewSession{}, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+			}
+			if err != nil {
+				return session_model.InterviewSession{}, err
+			}
+		} else {
+			questions, err := s.questionService.DrawQuestions(*input.Questions, count)
+			if errors.Is(err, ErrNoQuestions) {
+				return session_model.InterviewSession{}, fmt.Errorf("%w: %v", ErrInvalidSession, err)
+			}
+			if err != nil {
+				return session_model.InterviewSession{}, err
+			}
+			for _, question := range questions {
+				interview.QuestionIDs = append(interview.QuestionIDs, question.ID)
+			}
+		}
+	}
+	now := time.Now()
+	if input.ScheduledAt != nil && input.ScheduledAt.After(now) {
+		interview.Status = session_model.StatusScheduled
+		interview.ScheduledAt = input.ScheduledAt
+	} else {
+		interview.Status = session_model.StatusInProgress
+		interview.StartedAt = &now
+	}
+
+	var db = database.DBConn
+	if err := db.Create(&interview).Error; err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	return interview, nil
+}
+
+// GetSessions lists the user's sessions, newest first, optionally filtered by status.
+func (s *SessionService) GetSessions(email string, status string) []session_model.InterviewSession {
+	var db = database.DBConn
+	var sessions []session_model.InterviewSession
+	query := db.Where("email = ?", email)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("id DESC").Find(&sessions)
+	return sessions
+}
+
+// GetSession returns the session with its turns in order. Sessions belonging to a
+// different user are reported as not found.
+func (s *SessionService) GetSession(id uint, email string) (session_model.InterviewSession, error) {
+	var db = database.DBConn
+	var interview session_model.InterviewSession
+	result := db.Preload("Turns", func(db *gorm.DB) *gorm.DB {
+		return db.Order("number ASC")
+	}).Preload("Turns.Star").Where("id = ? AND email = ?", id, email).First(&interview)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return session_model.InterviewSession{}, ErrSessionNotFound
+	}
+	if result.Error != nil {
+		return session_model.InterviewSession{}, result.Error
+	}
+	return interview, nil
+}
+
+// GetTurn returns turn number of the session.
+func (s *SessionService) GetTurn(sessionID uint, number int) (session_model.SessionTurn, error) {
+	var db = database.DBConn
+	var turn session_model.SessionTurn
+	result := db.Where("session_id = ? AND number = ?", sessionID, number).First(&turn)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return session_model.SessionTurn{}, ErrSessionTurnNotFound
+	}
+	if result.Error != nil {
+		return session_model.SessionTurn{}, result.Error
+	}
+	return turn, nil
+}
+
+// ActiveSession returns the session if calls can be attached to it right now. Its time
+// limits are enforced first, so a session that has run out of time is not active.
+func (s *SessionService) ActiveSession(id uint, email string) (session_model.InterviewSession, error) {
+	interview, err := s.GetSession(id, email)
+	if err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	if err := s.enforceTimeLimits(&interview, time.Now()); err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	if !interview.Active() {
+		return session_model.InterviewSession{}, fmt.Errorf("%w: it is %s", ErrSessionNotActive, interview.Status)
+	}
+	return interview, nil
+}
+
+// StartScheduledSession starts a scheduled session ahead of or at its scheduled time.
+func (s *SessionService) StartScheduledSession(id uint, email string) (session_model.InterviewSession, error) {
+	return s.transition(id, email, []string{session_model.StatusScheduled}, func(interview *session_model.InterviewSession, now time.Time) {
+		interview.Status = session_model.StatusInProgress
+		interview.StartedAt = &now
+	})
+}
+
+func (s *SessionService) PauseSession(id uint, email string) (session_model.InterviewSession, error) {
+	return s.transition(id, email, []string{session_model.StatusInProgress}, func(interview *session_model.InterviewSession, now time.Time) {
+		interview.Status = session_model.StatusPaused
+		interview.PausedAt = &now
+	})
+}
+
+func (s *SessionService) ResumeSession(id uint, email string) (session_model.InterviewSession, error) {
+	return s.transition(id, email, []string{session_model.StatusPaused}, func(interview *session_model.InterviewSession, now time.Time) {
+		unpause(interview, now)
+		interview.Status = session_model.StatusInProgress
+	})
+}
+
+// EndSession completes a started session.
+func (s *SessionService) EndSession(id uint, email string) (session_model.InterviewSession, error) {
+	return s.transition(id, email, []string{session_model.StatusInProgress, session_model.StatusPaused}, func(interview *session_model.InterviewSession, now time.Time) {
+		unpause(interview, now)
+		interview.Status = session_model.StatusCompleted
+		interview.EndedAt = &now
+	})
+}
+
+// AbandonSession gives up on a session that has not been completed.
+func (s *SessionService) AbandonSession(id uint, email string) (session_model.InterviewSession, error) {
+	return s.transition(id, email, []string{session_model.StatusScheduled, session_model.StatusInProgress, session_model.StatusPaused}, func(interview *session_model.InterviewSession, now time.Time) {
+		unpause(interview, now)
+		interview.Status = session_model.StatusAbandoned
+		interview.EndedAt = &now
+	})
+}
+
+// transition applies change to the session if its current status is one of from. Two
+// requests can race, so the update only applies while the status is still one of from
+// and the loser gets ErrSessionTransition.
+func (s *SessionService) transition(id uint, email string, from []string, change func(*session_model.InterviewSession, time.Time)) (session_model.InterviewSession, error) {
+	interview, err := s.GetSession(id, email)
+	if err != nil {
+		return session_model.InterviewSession{}, err
+	}
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || interview.Status == status
+	}
+	if !allowed {
+		return session_model.InterviewSession{}, fmt.Errorf("%w: it is %s", ErrSessionTransition, interview.Status)
+	}
+
+	change(&interview, time.Now())
+	var db = database.DBConn
+	result := db.Model(&interview).Where("status IN ?", from).
+		Select("status", "started_at", "paused_at", "ended_at", "paused_seconds").Updates(&interview)
+	if result.Error != nil {
+		return session_model.InterviewSession{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return session_model.InterviewSession{}, fmt.Errorf("%w: it changed meanwhile", ErrSessionTransition)
+	}
+	return interview, nil
+}
+
+// unpause adds the time spent paused to the session's total, if it is paused.
+func unpause(interview *session_model.InterviewSession, now time.Time) {
+	if interview.PausedAt == nil {
+		return
+	}
+	interview.PausedSeconds += now.Sub(*interview.PausedAt).Seconds()
+	interview.PausedAt = nil
+}
+
+// NextQuestion returns the bank question the interviewer should ask next, if the session
+// drew questions and has not asked them all. Turns must be loaded.
+func (s *SessionService) NextQuestion(interview session_model.InterviewSession) (question_model.Question, bool) {
+	next := questionTurns(interview.Turns)
+	if next >= len(interview.QuestionIDs) {
+		return question_model.Question{}, false
+	}
+	question, err := s.questionService.GetQuestion(interview.QuestionIDs[next])
+	if err != nil {
+		return question_model.Question{}, false
+	}
+	return question, true
+}
+
+// pendingFollowUp returns the next follow-up waiting to be asked about the question of
+// the latest turn, and the number of the turn that asked that question. Turns must be
+// loaded.
+func pendingFollowUp(interview session_model.InterviewSession) (session_model.FollowUp, int, bool) {
+	if len(interview.Turns) == 0 {
+		return session_model.FollowUp{}, 0, false
+	}
+	root := rootTurn(interview.Turns, interview.Turns[len(interview.Turns)-1])
+	for _, followUp := range root.FollowUps {
+		if !followUp.Asked() {
+			return followUp, root.Number, true
+		}
+	}
+	return session_model.FollowUp{}, 0, false
+}
+
+// rootTurn returns the turn that asked the question turn follows up on, or turn itself.
+func rootTurn(turns []session_model.SessionTurn, turn session_model.SessionTurn) session_model.SessionTurn {
+	if turn.FollowUpOf == 0 {
+		return turn
+	}
+	for _, candidate := range turns {
+		if candidate.Number == turn.FollowUpOf {
+			return candidate
+		}
+	}
+	return turn
+}
+
+// questionTurns counts the turns that asked a new question rather than a follow-up.
+func questionTurns(turns []session_model.SessionTurn) int {
+	count := 0
+	for _, turn := range turns {
+		if turn.FollowUpOf == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// AdaptNextQuestion picks the next question of an adaptive session once the interview
+// has caught up with its plan. It runs before every interviewer turn, so each pick uses
+// the skill estimates as they are then, and waits while follow-ups are pending. When the
+// bank runs out, the session ends with the questions asked so far.
+func (s *SessionService) AdaptNextQuestion(interview *session_model.InterviewSession) error {
+	if !interview.Adaptive || interview.QuestionFilter == nil ||
+		questionTurns(interview.Turns) < len(interview.QuestionIDs) || len(interview.QuestionIDs) >= interview.QuestionCount {
+		return nil
+	}
+	if _, _, pending := pendingFollowUp(*interview); pending {
+		return nil
+	}
+	err := s.selectAdaptiveQuestion(interview)
+	if errors.Is(err, ErrNoQuestions) {
+		interview.QuestionCount = len(interview.QuestionIDs)
+	} else if err != nil {
+		return err
+	}
+	var db = database.DBConn
+	return db.Model(interview).Select("question_ids", "selections", "question_count").Updates(interview).Error
+}
+
+// selectAdaptiveQuestion adds the question that suits the candidate best to the plan.
+func (s *SessionService) selectAdaptiveQuestion(interview *session_model.InterviewSession) error {
+	selection, err := s.skillService.SelectQuestion(interview.Email, *interview.QuestionFilter, interview.QuestionIDs)
+	if err != nil {
+		return err
+	}
+	interview.QuestionIDs = append(interview.QuestionIDs, selection.QuestionID)
+	interview.Selections = append(interview.Selections, selection)
+	return nil
+}
+
+// Instruction is appended to the persona prompt so the interviewer follows the session's
+// question plan, asking any pending follow-up before moving on. Sessions without drawn
+// questions otherwise leave the persona in charge.
+func (s *SessionService) Instruction(interview session_model.InterviewSession) string {
+	if interview.TotalSeconds > 0 && sessionElapsed(interview, time.Now()) >= float64(interview.TotalSeconds) {
+		return " The interview is out of time. Thank the candidate and close the interview."
+	}
+	if followUp, _, ok := pendingFollowUp(interview); ok {
+		return fmt.Sprintf(" Before moving on, the next question you ask must be this follow-up: %q", followUp.Question)
+	}
+	if len(interview.QuestionIDs) == 0 {
+		return ""
+	}
+	if question, ok := s.NextQuestion(interview); ok {
+		return fmt.Sprintf(" The next question you ask must be: %q", question.Prompt)
+	}
+	if questionTurns(interview.Turns) >= len(interview.QuestionIDs) {
+		return " You have asked all of your questions. Thank the candidate and close the interview."
+	}
+	return ""
+}
+
+func (s *SessionService) SetConversationID(id uint, conversationID uint) error {
+	var db = database.DBConn
+	return db.Model(&session_model.InterviewSession{}).Where("id = ?", id).Update("conversation_id", conversationID).Error
+}
+
+// RecordExchange stores one chat exchange: the candidate's message answers the open
+// question, if there is one, and the interviewer's reply opens the next turn. The reply
+// asks the pending follow-up, if there was one, and otherwise the bank question the
+// session planned for it.
+func (s *SessionService) RecordExchange(sessionID uint, answer string, question string) error {
+	var db = database.DBConn
+	return db.Transaction(func(tx *gorm.DB) error {
+		var interview session_model.InterviewSession
+		err := tx.Select("id", "question_ids", "question_seconds", "paused_seconds").Preload("Turns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("number ASC")
+		}).Where("id = ?", sessionID).First(&interview).Error
+		if err != nil {
+			return err
+		}
+		var last session_model.SessionTurn
+		if len(interview.Turns) > 0 {
+			last = interview.Turns[len(interview.Turns)-1]
+		}
+		now := time.Now()
+		if last.ID != 0 && last.AnsweredAt == nil && answer != "" {
+			if err := answerTurn(tx, &last, answer, now); err != nil {
+				return err
+			}
+		}
+		turn := session_model.SessionTurn{
+			SessionID:          sessionID,
+			Number:             last.Number + 1,
+			Question:           question,
+			AskedAt:            now,
+			LimitSeconds:       interview.QuestionSeconds,
+			PausedSecondsAsked: interview.PausedSeconds,
+		}
+		if _, rootNumber, ok := pendingFollowUp(interview); ok {
+			turn.FollowUpOf = rootNumber
+			if err := markFollowUpAsked(tx, interview.Turns, rootNumber, turn.Number); err != nil {
+				return err
+			}
+		} else if next := questionTurns(interview.Turns); next < len(interview.QuestionIDs) {
+			turn.QuestionID = interview.QuestionIDs[next]
+		}
+		return tx.Create(&turn).Error
+	})
+}
+
+// markFollowUpAsked records that turn number asked the first pending follow-up of the
+// turn numbered root.
+func markFollowUpAsked(tx *gorm.DB, turns []session_model.SessionTurn, root int, number int) error {
+	for _, turn := range turns {
+		if turn.Number != root {
+			continue
+		}
+		for i := range turn.FollowUps {
+			if !turn.FollowUps[i].Asked() {
+				turn.FollowUps[i].Turn = number
+				break
+			}
+		}
+		return tx.Model(&turn).Select("follow_ups").Updates(&turn).Error
+	}
+	return nil
+}
+
+// RecordAnswer stores a transcribed answer on the open question. It returns the turn,
+// or a zero turn if no question is waiting for an answer.
+func (s *SessionService) RecordAnswer(sessionID uint, answer string) (session_model.SessionTurn, error) {
+	return s.recordAnswer(sessionID, answer, nil)
+}
+
+// RecordSpokenAnswer is RecordAnswer for a transcription, also keeping how the answer
+// was delivered.
+func (s *SessionService) RecordSpokenAnswer(sessionID uint, transcription *ai_model.Transcription) (session_model.SessionTurn, error) {
+	return s.recordAnswer(sessionID, transcription.Text, transcription.Delivery)
+}
+
+func (s *SessionService) recordAnswer(sessionID uint, answer string, delivery *ai_model.Delivery) (session_model.SessionTurn, error) {
+	var db = database.DBConn
+	var turn session_model.SessionTurn
+	err := db.Transaction(func(tx *gorm.DB) error {
+		last, err := lastTurn(tx, sessionID)
+		if err != nil || last.ID == 0 || last.AnsweredAt != nil {
+			return err
+		}
+		if err := answerTurn(tx, &last, answer, time.Now()); err != nil {
+			return err
+		}
+		if delivery != nil {
+			last.Delivery = delivery
+			if err := tx.Model(&last).Select("delivery").Updates(&last).Error; err != nil {
+				return err
+			}
+		}
+		turn = last
+		return nil
+	})
+	return turn, err
+}
+
+// lastTurn returns the session's latest turn, or a zero turn if it has none.
+func lastTurn(tx *gorm.DB, sessionID uint) (session_model.SessionTurn, error) {
+	var turns []session_model.SessionTurn
+	if err := tx.Where("session_id = ?", sessionID).Order("number DESC").Limit(1).Find(&turns).Error; err != nil {
+		return session_model.SessionTurn{}, err
+	}
+	if len(turns) == 0 {
+		return session_model.SessionTurn{}, nil
+	}
+	return turns[0], nil
+}
+
+// answerTurn stores the answer on the turn and, in a timed session, how long the
+// candidate took and how far over time that was.
+func answerTurn(tx *gorm.DB, turn *session_model.SessionTurn, answer string, now time.Time) error {
+	turn.Answer, turn.AnsweredAt = answer, &now
+	updates := map[string]interface{}{"answer": answer, "answered_at": now}
+	if turn.LimitSeconds > 0 {
+		var interview session_model.InterviewSession
+		if err := tx.Select("id", "paused_seconds", "paused_at").Where("id = ?", turn.SessionID).First(&interview).Error; err != nil {
+			return err
+		}
+		turn.DurationSeconds = roundSeconds(turnElapsed(interview, *turn, now))
+		turn.OvertimeSeconds = roundSeconds(math.Max(turn.DurationSeconds-float64(turn.LimitSeconds), 0))
+		updates["duration_seconds"], updates["overtime_seconds"] = turn.DurationSeconds, turn.OvertimeSeconds
+	}
+	return tx.Model(turn).Updates(updates).Error
+}
+
+func validateSession(input *session_model.InputSession) error {
+	switch input.Type {
+	case session_model.TypeBehavioral, session_model.TypeTechnical, session_model.TypeSystemDesign:
+	default:
+		return fmt.Errorf("%w: type must be %s, %s or %s", ErrInvalidSession,
+			session_model.TypeBehavioral, session_model.TypeTechnical, session_model.TypeSystemDesign)
+	}
+	if input.TargetRole == "" {
+		return fmt.Errorf("%w: target_role is required", ErrInvalidSession)
+	}
+	if input.Adaptive && input.Questions == nil {
+		return fmt.Errorf("%w: adaptive sessions need a questions filter", ErrInvalidSession)
+	}
+	if input.MaxFollowUps != nil && (*input.MaxFollowUps < 0 || *input.MaxFollowUps > MaxFollowUpsLimit) {
+		return fmt.Errorf("%w: max_follow_ups must be between 0 and %d", ErrInvalidSession, MaxFollowUpsLimit)
+	}
+	if input.QuestionSeconds < 0 || input.QuestionSeconds > MaxTimedSeconds || input.TotalSeconds < 0 || input.TotalSeconds > MaxTimedSeconds {
+		return fmt.Errorf("%w: question_seconds and total_seconds must be between 0 and %d", ErrInvalidSession, MaxTimedSeconds)
+	}
+	for _, seconds := range input.WarningSeconds {
+		if seconds <= 0 {
+			return fmt.Errorf("%w: warning_seconds must be positive", ErrInvalidSession)
+		}
+	}
+	switch input.TimeUp {
+	case "", session_model.TimeUpAdvance, session_model.TimeUpClose, session_model.TimeUpOvertime:
+	default:
+		return fmt.Errorf("%w: time_up must be %s, %s or %s", ErrInvalidSession,
+			session_model.TimeUpAdvance, session_model.TimeUpClose, session_model.TimeUpOvertime)
+	}
+	return nil
+}
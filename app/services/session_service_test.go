@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	question_model "up-it-aps-api/app/models/question"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+func newTestSessionService(t *testing.T) *SessionService {
+	t.Helper()
+	db := setupTestDB(t)
+	database.DBConn = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	})
+	personaService := NewPersonaService()
+	if err := personaService.SeedDefaults(); err != nil {
+		t.Fatalf("SeedDefaults() failed: %v", err)
+	}
+	questionService := NewQuestionService()
+	return NewSessionService(NewUserService(), personaService, questionService, NewSkillService(NewEloEngine(), questionService))
+}
+
+func TestSessionService_Lifecycle(t *testing.T) {
+	service := newTestSessionService(t)
+	email := "test@example.com"
+
+	interview, err := service.StartSession(email, &session_model.InputSession{
+		Type:       session_model.TypeBehavioral,
+		TargetRole: "APS EL1",
+		Persona:    "aps-el1-panel-chair",
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if interview.Status != session_model.StatusInProgress || interview.StartedAt == nil {
+		t.Errorf("StartSession() = %s started %v, want in_progress with a start time", interview.Status, interview.StartedAt)
+	}
+	if interview.Persona != "aps-el1-panel-chair" || interview.PersonaID == 0 {
+		t.Errorf("StartSession() persona = %q (%d), want aps-el1-panel-chair", interview.Persona, interview.PersonaID)
+	}
+
+	steps := []struct {
+		name   string
+		change func(uint, string) (session_model.InterviewSession, error)
+		want   string
+		err    error
+	}{
+		{name: "resume while running", change: service.ResumeSession, err: ErrSessionTransition},
+		{name: "pause", change: service.PauseSession, want: session_model.StatusPaused},
+		{name: "pause twice", change: service.PauseSession, err: ErrSessionTransition},
+		{name: "resume", change: service.ResumeSession, want: session_model.StatusInProgress},
+		{name: "pause again", change: service.PauseSession, want: session_model.StatusPaused},
+		{name: "end while paused", change: service.EndSession, want: session_model.StatusCompleted},
+		{name: "abandon after end", change: service.AbandonSession, err: ErrSessionTransition},
+	}
+	for _, step := range steps {
+		got, err := step.change(interview.ID, email)
+		if step.err != nil {
+			if !errors.Is(err, step.err) {
+				t.Errorf("%s: error = %v, want %v", step.name, err, step.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: failed: %v", step.name, err)
+		}
+		if got.Status != step.want {
+			t.Errorf("%s: status = %s, want %s", step.name, got.Status, step.want)
+		}
+	}
+
+	ended, err := service.GetSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetSession() failed: %v", err)
+	}
+	if ended.EndedAt == nil || ended.PausedAt != nil {
+		t.Errorf("ended session = ended %v paused %v, want ended and not paused", ended.EndedAt, ended.PausedAt)
+	}
+	if _, err := service.ActiveSession(interview.ID, email); !errors.Is(err, ErrSessionNotActive) {
+		t.Errorf("ActiveSession() on a completed session error = %v, want ErrSessionNotActive", err)
+	}
+	if _, err := service.PauseSession(interview.ID, "other@example.com"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("PauseSession() for other user error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSessionService_EndSessionOnce(t *testing.T) {
+	service := newTestSessionService(t)
+	email := "test@example.com"
+
+	interview, err := service.StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	// another request abandons the session between EndSession reading and updating it
+	raced := false
+	database.DBConn.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "interview_sessions" {
+			return
+		}
+		raced = true
+		tx.Statement.ConnPool.ExecContext(tx.Statement.Context, "UPDATE interview_sessions SET status = ? WHERE id = ?", session_model.StatusAbandoned, interview.ID)
+	})
+	if _, err := service.EndSession(interview.ID, email); !errors.Is(err, ErrSessionTransition) {
+		t.Errorf("EndSession() after the session was abandoned error = %v, want ErrSessionTransition", err)
+	}
+	if got, _ := service.GetSession(interview.ID, email); got.Status != session_model.StatusAbandoned || got.EndedAt != nil {
+		t.Errorf("session = %s ended %v, want it left abandoned", got.Status, got.EndedAt)
+	}
+}
+
+func TestSessionService_ScheduledSession(t *testing.T) {
+	service := newTestSessionService(t)
+	email := "test@example.com"
+
+	scheduledAt := time.Now().Add(24 * time.Hour)
+	interview, err := service.StartSession(email, &session_model.InputSession{
+		Type:        session_model.TypeSystemDesign,
+		TargetRole:  "Staff engineer",
+		ScheduledAt: &scheduledAt,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if interview.Status != session_model.StatusScheduled || interview.StartedAt != nil {
+		t.Errorf("StartSession() = %s, want scheduled and not started", interview.Status)
+	}
+	if interview.Persona != DefaultPersonaSlug {
+		t.Errorf("StartSession() persona = %q, want %q", interview.Persona, DefaultPersonaSlug)
+	}
+	if _, err := service.PauseSession(interview.ID, email); !errors.Is(err, ErrSessionTransition) {
+		t.Errorf("PauseSession() on a scheduled session error = %v, want ErrSessionTransition", err)
+	}
+	started, err := service.StartScheduledSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("StartScheduledSession() failed: %v", err)
+	}
+	if started.Status != session_model.StatusInProgress || started.StartedAt == nil {
+		t.Errorf("StartScheduledSession() = %s, want in_progress", started.Status)
+	}
+
+	if got := service.GetSessions(email, session_model.StatusInProgress); len(got) != 1 {
+		t.Errorf("GetSessions(in_progress) returned %d sessions, want 1", len(got))
+	}
+	if got := service.GetSessions(email, session_model.StatusScheduled); len(got) != 0 {
+		t.Errorf("GetSessions(scheduled) returned %d sessions, want 0", len(got))
+	}
+}
+
+func TestSessionService_RecordTurns(t *testing.T) {
+	service := newTestSessionService(t)
+	email := "test@example.com"
+
+	interview, err := service.StartSession(email, &session_model.InputSession{Type: session_model.TypeTechnical, TargetRole: "Backend engineer"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+
+	// no question has been asked yet, so there is nothing to answer
+	if turn, err := service.RecordAnswer(interview.ID, "hello?"); err != nil || turn.Number != 0 {
+		t.Errorf("RecordAnswer() before any question = %d, %v, want 0, nil", turn.Number, err)
+	}
+	if err := service.RecordExchange(interview.ID, "I am ready.", "How would you design a rate limiter?"); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	turn, err := service.RecordAnswer(interview.ID, "A token bucket per API key.")
+	if err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	if turn.Number != 1 || turn.AnsweredAt == nil {
+		t.Errorf("RecordAnswer() = turn %d answered %v, want turn 1 answered", turn.Number, turn.AnsweredAt)
+	}
+	if err := service.RecordExchange(interview.ID, "A token bucket per API key, stored in Redis.", "How do you handle bursts?"); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+
+	loaded, err := service.GetSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetSession() failed: %v", err)
+	}
+	if len(loaded.Turns) != 2 {
+		t.Fatalf("session has %d turns, want 2", len(loaded.Turns))
+	}
+	// the transcript already answered turn 1, so the chat message does not overwrite it
+	if loaded.Turns[0].Question != "How would you design a rate limiter?" || loaded.Turns[0].Answer != "A token bucket per API key." {
+		t.Errorf("turn 1 = %+v", loaded.Turns[0])
+	}
+	if loaded.Turns[1].Number != 2 || loaded.Turns[1].Answer != "" {
+		t.Errorf("turn 2 = %+v, want an open question", loaded.Turns[1])
+	}
+	if _, err := service.GetTurn(interview.ID, 3); !errors.Is(err, ErrSessionTurnNotFound) {
+		t.Errorf("GetTurn(3) error = %v, want ErrSessionTurnNotFound", err)
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	tests := []struct {
+		name  string
+		input session_model.InputSession
+		valid bool
+	}{
+		{name: "valid", input: session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "PM"}, valid: true},
+		{name: "unknown type", input: session_model.InputSession{Type: "pairing", TargetRole: "PM"}},
+		{name: "missing role", input: session_model.InputSession{Type: session_model.TypeTechnical}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSession(&tt.input)
+			if tt.valid && err != nil {
+				t.Errorf("validateSession() error = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSession) {
+				t.Errorf("validateSession() error = %v, want ErrInvalidSession", err)
+			}
+		})
+	}
+}
+
+func TestSessionService_DrawsQuestionsFromTheBank(t *testing.T) {
+	service := newTestSessionService(t)
+	seedQuestions(t, service.questionService)
+	email := "test@example.com"
+
+	if _, err := service.StartSession(email, &session_model.InputSession{
+		Type:       session_model.TypeTechnical,
+		TargetRole: "Backend engineer",
+		Questions:  &question_model.QuestionFilter{RoleFamily: "sales"},
+	}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("StartSession() with no matching questions error = %v, want ErrInvalidSession", err)
+	}
+
+	interview, err := service.StartSession(email, &session_model.InputSession{
+		Type:          session_model.TypeTechnical,
+		TargetRole:    "Backend engineer",
+		Questions:     &question_model.QuestionFilter{RoleFamily: "swe"},
+		QuestionCount: 5,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if len(interview.QuestionIDs) != 2 {
+		t.Fatalf("session drew %d questions, want the 2 swe questions", len(interview.QuestionIDs))
+	}
+
+	first, err := service.questionService.GetQuestion(interview.QuestionIDs[0])
+	if err != nil {
+		t.Fatalf("GetQuestion() failed: %v", err)
+	}
+	if got := service.Instruction(interview); !strings.Contains(got, first.Prompt) {
+		t.Errorf("Instruction() = %q, want it to ask %q", got, first.Prompt)
+	}
+
+	for _, answer := range []string{"Ready.", "My answer.", "My second answer."} {
+		if err := service.RecordExchange(interview.ID, answer, "question"); err != nil {
+			t.Fatalf("RecordExchange() failed: %v", err)
+		}
+	}
+	loaded, err := service.GetSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetSession() failed: %v", err)
+	}
+	if loaded.Turns[0].QuestionID != interview.QuestionIDs[0] || loaded.Turns[1].QuestionID != interview.QuestionIDs[1] || loaded.Turns[2].QuestionID != 0 {
+		t.Errorf("turn question IDs = %d, %d, %d, want %v then 0", loaded.Turns[0].QuestionID, loaded.Turns[1].QuestionID, loaded.Turns[2].QuestionID, interview.QuestionIDs)
+	}
+	if got := service.Instruction(loaded); !strings.Contains(got, "close the interview") {
+		t.Errorf("Instruction() after every question = %q, want it to close the interview", got)
+	}
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+// DefaultWarningSeconds are the seconds left at which a timed session warns the
+// candidate when it does not set its own.
+var DefaultWarningSeconds = []int{60, 15}
+
+// MaxTimedSeconds caps the question and total budgets of a timed session.
+const MaxTimedSeconds = 4 * 60 * 60
+
+// TimeLimitSweepInterval is how often WatchTimeLimits enforces the budgets of every
+// timed session, so time runs out even when no client is watching.
+const TimeLimitSweepInterval = 2 * time.Second
+
+// TimerPing is the event WatchTimer sends on a check that has nothing else to send.
+const TimerPing = "ping"
+
+// OnSessionEnd registers a function to call when the server ends a session because it
+// ran out of time.
+func (s *SessionService) OnSessionEnd(onEnd func(session_model.InterviewSession)) {
+	s.onEnd = onEnd
+}
+
+// GetTimer enforces the session's time limits and returns where it stands against them.
+func (s *SessionService) GetTimer(id uint, email string) (session_model.Timer, error) {
+	interview, err := s.GetSession(id, email)
+	if err != nil {
+		return session_model.Timer{}, err
+	}
+	now := time.Now()
+	if err := s.enforceTimeLimits(&interview, now); err != nil {
+		return session_model.Timer{}, err
+	}
+	return sessionTimer(interview, now), nil
+}
+
+// WatchTimer sends the session's timer as a "timer" event, then checks it every
+// interval: each warning threshold reached is sent once as a "warning", each turn or
+// session the server closed for running out of time as a "time_up", and the new timer
+// as a "timer" whenever the turn on the clock changes, and otherwise a TimerPing with no
+// data, so a client that has gone is noticed while the clock stands still. It ends with
+// an "end" event once the session is over, or when ctx is done or send fails.
+func (s *SessionService) WatchTimer(ctx context.Context, id uint, email string, interval time.Duration, send func(event string, data interface{}) error) error {
+	timer, err := s.GetTimer(id, email)
+	if err != nil {
+		return err
+	}
+	if err := send("timer", timer); err != nil {
+		return err
+	}
+	warned := make(map[session_model.TimerWarning]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, warning := range timer.Warnings {
+			if !warned[warning] {
+				warned[warning] = true
+				if err := send("warning", warning); err != nil {
+					return err
+				}
+			}
+		}
+		if timer.Status != session_model.StatusInProgress && timer.Status != session_model.StatusPaused {
+			return send("end", timer)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		previous := timer
+		if timer, err = s.GetTimer(id, email); err != nil {
+			return err
+		}
+		timeUps := s.timeUps(previous, timer)
+		for _, timeUp := range timeUps {
+			if err := send("time_up", timeUp); err != nil {
+				return err
+			}
+		}
+		if countdownTurn(previous.Question) != countdownTurn(timer.Question) || previous.Status != timer.Status {
+			if err := send("timer", timer); err != nil {
+				return err
+			}
+		} else if len(timeUps) == 0 {
+			if err := send(TimerPing, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// timeUps lists what the server closed for running out of time between two timers.
+func (s *SessionService) timeUps(previous session_model.Timer, current session_model.Timer) []session_model.TimerWarning {
+	var timeUps []session_model.TimerWarning
+	if number := countdownTurn(previous.Question); number != 0 && number != countdownTurn(current.Question) {
+		if turn, err := s.GetTurn(current.SessionID, number); err == nil && turn.TimedOut {
+			timeUp := session_model.TimerWarning{
+				Scope:   session_model.ScopeQuestion,
+				Turn:    number,
+				Message: fmt.Sprintf("Time is up for question %d.", number),
+			}
+			if current.TimeUp == session_model.TimeUpAdvance {
+				if next, err := s.GetTurn(current.SessionID, number+1); err == nil {
+					timeUp.Question = next.Question
+				}
+			}
+			timeUps = append(timeUps, timeUp)
+		}
+	}
+	if previous.Status != session_model.StatusCompleted && current.Status == session_model.StatusCompleted &&
+		current.Session != nil && current.Session.RemainingSeconds <= 0 {
+		timeUps = append(timeUps, session_model.TimerWarning{Scope: session_model.ScopeSession, Message: "The interview is out of time."})
+	}
+	return timeUps
+}
+
+func countdownTurn(countdown *session_model.Countdown) int {
+	if countdown == nil {
+		return 0
+	}
+	return countdown.Turn
+}
+
+// WatchTimeLimits enforces the time limits of every timed session in progress each
+// interval until ctx is done.
+func (s *SessionService) WatchTimeLimits(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.EnforceTimeLimits(now); err != nil {
+				log.Printf("Error enforcing session time limits: %v", err)
+			}
+		}
+	}
+}
+
+// EnforceTimeLimits applies the time limits of every timed session in progress as of
+// now. A session that fails is logged and the rest are still enforced.
+func (s *SessionService) EnforceTimeLimits(now time.Time) error {
+	var db = database.DBConn
+	var sessions []session_model.InterviewSession
+	err := db.Preload("Turns", func(db *gorm.DB) *gorm.DB {
+		return db.Order("number ASC")
+	}).Where("status = ? AND (question_seconds > 0 OR total_seconds > 0)", session_model.StatusInProgress).Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := s.enforceTimeLimits(&sessions[i], now); err != nil {
+			log.Printf("Error enforcing the time limits of session %d: %v", sessions[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// enforceTimeLimits closes what has run out of time in a session in progress: the whole
+// session when its total budget is spent, otherwise the turn on the clock when its own
+// is. A session that allows overtime is never cut off. Turns must be loaded; the session
+// is updated in place.
+func (s *SessionService) enforceTimeLimits(interview *session_model.InterviewSession, now time.Time) error {
+	if interview.Status != session_model.StatusInProgress || !interview.Timed() || interview.TimeUp == session_model.TimeUpOvertime {
+		return nil
+	}
+	var db = database.DBConn
+	open := openTurn(*interview)
+
+	if interview.TotalSeconds > 0 {
+		if over := sessionElapsed(*interview, now) - float64(interview.TotalSeconds); over >= 0 {
+			end := now.Add(-time.Duration(over * float64(time.Second)))
+			ended := false
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if open != nil {
+					if _, err := closeTurn(tx, *interview, open, end); err != nil {
+						return err
+					}
+				}
+				interview.Status, interview.EndedAt = session_model.StatusCompleted, &end
+				// the sweep and a request can race, so only the one that ends it reports it
+				result := tx.Model(interview).Where("status = ?", session_model.StatusInProgress).
+					Select("status", "ended_at").Updates(interview)
+				ended = result.RowsAffected == 1
+				return result.Error
+			})
+			if err != nil {
+				return err
+			}
+			if ended && s.onEnd != nil {
+				s.onEnd(*interview)
+			}
+			return nil
+		}
+	}
+
+	if open == nil || open.LimitSeconds == 0 {
+		return nil
+	}
+	over := turnElapsed(*interview, *open, now) - float64(open.LimitSeconds)
+	if over < 0 {
+		return nil
+	}
+	closed, err := closeTurn(db, *interview, open, now.Add(-time.Duration(over*float64(time.Second))))
+	if err != nil || !closed || interview.TimeUp != session_model.TimeUpAdvance {
+		return err
+	}
+	// the next question is asked now rather than at the deadline, so a session nobody
+	// watched does not run through its questions in one go. Before the candidate's first
+	// message there is no conversation to ask it in, so the next chat turn asks it.
+	if interview.ConversationID == 0 {
+		return nil
+	}
+	if err := s.AdaptNextQuestion(interview); err != nil {
+		return err
+	}
+	question := ""
+	if followUp, _, ok := pendingFollowUp(*interview); ok {
+		question = followUp.Question
+	} else if next, ok := s.NextQuestion(*interview); ok {
+		question = next.Prompt
+	}
+	if question == "" {
+		return nil
+	}
+	if err := s.RecordExchange(interview.ID, "", question); err != nil {
+		return err
+	}
+	if err := s.askInConversation(*interview, question); err != nil {
+		return err
+	}
+	var turns []session_model.SessionTurn
+	if err := db.Where("session_id = ?", interview.ID).Order("number ASC").Find(&turns).Error; err != nil {
+		return err
+	}
+	interview.Turns = turns
+	return nil
+}
+
+// askInConversation adds a question the server asked to the session's conversation as
+// an interviewer message, so the candidate sees it and the model knows it was asked.
+func (s *SessionService) askInConversation(interview session_model.InterviewSession, question string) error {
+	var db = database.DBConn
+	var conversation conversation_model.Conversation
+	if err := db.Select("id", "persona_id").Where("id = ?", interview.ConversationID).First(&conversation).Error; err != nil {
+		return err
+	}
+	persona := s.personaService.ResolvePersona(conversation.PersonaID)
+	return db.Create(&conversation_model.ConversationMessage{
+		ConversationID: conversation.ID,
+		Role:           conversation_model.RoleAssistant,
+		Content:        question,
+		PersonaVersion: persona.Version,
+	}).Error
+}
+
+// closeTurn ends an unanswered turn at the moment its time ran out. It reports false if
+// the turn was answered or closed in the meantime, as the sweep and a request can race.
+func closeTurn(tx *gorm.DB, interview session_model.InterviewSession, turn *session_model.SessionTurn, at time.Time) (bool, error) {
+	turn.AnsweredAt, turn.TimedOut = &at, true
+	turn.DurationSeconds = roundSeconds(turnElapsed(interview, *turn, at))
+	if turn.LimitSeconds > 0 {
+		turn.OvertimeSeconds = roundSeconds(math.Max(turn.DurationSeconds-float64(turn.LimitSeconds), 0))
+	}
+	result := tx.Model(turn).Where("answered_at IS NULL").
+		Select("answered_at", "timed_out", "duration_seconds", "overtime_seconds").Updates(turn)
+	return result.RowsAffected == 1, result.Error
+}
+
+// openTurn returns the latest turn if it is still waiting for an answer.
+func openTurn(interview session_model.InterviewSession) *session_model.SessionTurn {
+	if len(interview.Turns) == 0 {
+		return nil
+	}
+	turn := &interview.Turns[len(interview.Turns)-1]
+	if turn.AnsweredAt != nil {
+		return nil
+	}
+	return turn
+}
+
+// sessionElapsed is how long the session has run as of now, not counting pauses.
+func sessionElapsed(interview session_model.InterviewSession, now time.Time) float64 {
+	if interview.StartedAt == nil {
+		return 0
+	}
+	if interview.EndedAt != nil && interview.EndedAt.Before(now) {
+		now = *interview.EndedAt
+	}
+	return math.Max(now.Sub(*interview.StartedAt).Seconds()-interview.PausedSecondsAt(now), 0)
+}
+
+// turnElapsed is how long the turn has been waiting for an answer as of now, not
+// counting pauses.
+func turnElapsed(interview session_model.InterviewSession, turn session_model.SessionTurn, now time.Time) float64 {
+	paused := interview.PausedSecondsAt(now) - turn.PausedSecondsAsked
+	return math.Max(now.Sub(turn.AskedAt).Seconds()-paused, 0)
+}
+
+// sessionTimer works out where the session stands against its budgets as of now.
+func sessionTimer(interview session_model.InterviewSession, now time.Time) session_model.Timer {
+	timer := session_model.Timer{
+		SessionID: interview.ID,
+		Status:    interview.Status,
+		TimeUp:    interview.TimeUp,
+		Warnings:  []session_model.TimerWarning{},
+	}
+	if !interview.Timed() || interview.StartedAt == nil {
+		return timer
+	}
+	if interview.TotalSeconds > 0 {
+		elapsed := sessionElapsed(interview, now)
+		timer.Session = &session_model.Countdown{
+			LimitSeconds:     interview.TotalSeconds,
+			ElapsedSeconds:   roundSeconds(elapsed),
+			RemainingSeconds: remainingSeconds(float64(interview.TotalSeconds) - elapsed),
+		}
+	}
+	running := interview.Status == session_model.StatusInProgress || interview.Status == session_model.StatusPaused
+	if open := openTurn(interview); running && open != nil && open.LimitSeconds > 0 {
+		elapsed := turnElapsed(interview, *open, now)
+		timer.Question = &session_model.Countdown{
+			Turn:             open.Number,
+			Question:         open.Question,
+			LimitSeconds:     open.LimitSeconds,
+			ElapsedSeconds:   roundSeconds(elapsed),
+			RemainingSeconds: remainingSeconds(float64(open.LimitSeconds) - elapsed),
+		}
+	}
+	if !running {
+		return timer
+	}
+	if warning, ok := timerWarning(session_model.ScopeQuestion, timer.Question, interview.WarningSeconds); ok {
+		timer.Warnings = append(timer.Warnings, warning)
+	}
+	if warning, ok := timerWarning(session_model.ScopeSession, timer.Session, interview.WarningSeconds); ok {
+		timer.Warnings = append(timer.Warnings, warning)
+	}
+	return timer
+}
+
+// timerWarning returns the warning for the smallest threshold the countdown has reached.
+// Thresholds as long as the budget itself are ignored.
+func timerWarning(scope string, countdown *session_model.Countdown, thresholds []int) (session_model.TimerWarning, bool) {
+	if countdown == nil {
+		return session_model.TimerWarning{}, false
+	}
+	subject := "the interview"
+	if scope == session_model.ScopeQuestion {
+		subject = fmt.Sprintf("question %d", countdown.Turn)
+	}
+	warning := session_model.TimerWarning{Scope: scope, Turn: countdown.Turn}
+	if countdown.RemainingSeconds <= 0 {
+		warning.Message = fmt.Sprintf("Time is up for %s.", subject)
+		return warning, true
+	}
+	for _, threshold := range thresholds {
+		if threshold < countdown.LimitSeconds && countdown.RemainingSeconds <= float64(threshold) &&
+			(warning.SecondsLeft == 0 || threshold < warning.SecondsLeft) {
+			warning.SecondsLeft = threshold
+		}
+	}
+	if warning.SecondsLeft == 0 {
+		return session_model.TimerWarning{}, false
+	}
+	warning.Message = fmt.Sprintf("%s left for %s.", formatSeconds(warning.SecondsLeft), subject)
+	return warning, true
+}
+
+func formatSeconds(seconds int) string {
+	switch {
+	case seconds == 60:
+		return "1 minute"
+	case seconds > 60 && seconds%60 == 0:
+		return fmt.Sprintf("%d minutes", seconds/60)
+	case seconds == 1:
+		return "1 second"
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+func roundSeconds(seconds float64) float64 {
+	return math.Round(seconds*10) / 10
+}
+
+// remainingSeconds rounds up, so time is not shown as up before it is enforced.
+func remainingSeconds(seconds float64) float64 {
+	return math.Ceil(seconds*10) / 10
+}
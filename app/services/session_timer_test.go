@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+	question_model "up-it-aps-api/app/models/question"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+)
+
+func TestTimerWarning(t *testing.T) {
+	thresholds := []int{60, 15, 120}
+	tests := []struct {
+		name      string
+		countdown *session_model.Countdown
+		want      string
+	}{
+		{name: "untimed"},
+		{name: "plenty left", countdown: &session_model.Countdown{Turn: 2, LimitSeconds: 90, RemainingSeconds: 61}},
+		{name: "first threshold", countdown: &session_model.Countdown{Turn: 2, LimitSeconds: 90, RemainingSeconds: 59.5}, want: "1 minute left for question 2."},
+		{name: "smallest threshold reached", countdown: &session_model.Countdown{Turn: 2, LimitSeconds: 90, RemainingSeconds: 3}, want: "15 seconds left for question 2."},
+		{name: "time is up", countdown: &session_model.Countdown{Turn: 2, LimitSeconds: 90, RemainingSeconds: -4}, want: "Time is up for question 2."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, ok := timerWarning(session_model.ScopeQuestion, tt.countdown, thresholds)
+			if ok != (tt.want != "") || warning.Message != tt.want {
+				t.Errorf("timerWarning() = %+v, %v, want %q", warning, ok, tt.want)
+			}
+		})
+	}
+	if warning, _ := timerWarning(session_model.ScopeSession, &session_model.Countdown{LimitSeconds: 1800, RemainingSeconds: 100}, thresholds); warning.Message != "2 minutes left for the interview." {
+		t.Errorf("timerWarning() for the session = %+v", warning)
+	}
+}
+
+// rewind moves every timestamp of the session and its turns back by d, as if it had
+// been running that much longer.
+func rewind(t *testing.T, sessionID uint, d time.Duration) {
+	t.Helper()
+	db := database.DBConn
+	var interview session_model.InterviewSession
+	db.Preload("Turns").First(&interview, sessionID)
+	started := interview.StartedAt.Add(-d)
+	if err := db.Model(&interview).Update("started_at", started).Error; err != nil {
+		t.Fatalf("rewinding session failed: %v", err)
+	}
+	for _, turn := range interview.Turns {
+		if err := db.Model(&turn).Update("asked_at", turn.AskedAt.Add(-d)).Error; err != nil {
+			t.Fatalf("rewinding turn failed: %v", err)
+		}
+	}
+}
+
+func TestSessionService_TimedSession(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	for _, prompt := range []string{"Tell me about a time you led change.", "Tell me about a time you resolved a conflict."} {
+		if _, err := NewQuestionService().CreateQuestion(&question_model.InputQuestion{Prompt: prompt, Competency: "leadership", Difficulty: 2}); err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+	}
+	var ended []session_model.InterviewSession
+	s.Sessions().OnSessionEnd(func(interview session_model.InterviewSession) {
+		ended = append(ended, interview)
+	})
+
+	email := "test@example.com"
+	if _, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", QuestionSeconds: 60, TimeUp: "pause"}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("StartSession() with time_up pause error = %v, want ErrInvalidSession", err)
+	}
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:            session_model.TypeBehavioral,
+		TargetRole:      "APS EL1",
+		Questions:       &question_model.QuestionFilter{Competency: "leadership"},
+		QuestionCount:   2,
+		QuestionSeconds: 60,
+		TotalSeconds:    300,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if interview.TimeUp != session_model.TimeUpAdvance || len(interview.WarningSeconds) != len(DefaultWarningSeconds) {
+		t.Errorf("StartSession() = %+v, want the default time_up and warnings", interview)
+	}
+	first, _ := s.Sessions().NextQuestion(interview)
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", first.Prompt); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	conversation, err := NewConversationService().CreateConversation(email, "gpt-4", 0)
+	if err != nil {
+		t.Fatalf("CreateConversation() failed: %v", err)
+	}
+	if err := s.Sessions().SetConversationID(interview.ID, conversation.ID); err != nil {
+		t.Fatalf("SetConversationID() failed: %v", err)
+	}
+
+	rewind(t, interview.ID, 50*time.Second)
+	timer, err := s.Sessions().GetTimer(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetTimer() failed: %v", err)
+	}
+	if timer.Question == nil || timer.Question.Turn != 1 || math.Abs(timer.Question.RemainingSeconds-10) > 1 || timer.Session == nil {
+		t.Fatalf("GetTimer() = %+v, want about 10 seconds left on turn 1", timer)
+	}
+	if len(timer.Warnings) != 1 || timer.Warnings[0].SecondsLeft != 15 {
+		t.Errorf("GetTimer() warnings = %+v, want the 15 second question warning", timer.Warnings)
+	}
+
+	// the question runs out and the next one is asked
+	if err := s.Sessions().EnforceTimeLimits(time.Now().Add(15 * time.Second)); err != nil {
+		t.Fatalf("EnforceTimeLimits() failed: %v", err)
+	}
+	interview, _ = s.Sessions().GetSession(interview.ID, email)
+	if len(interview.Turns) != 2 {
+		t.Fatalf("turns = %+v, want the second question asked", interview.Turns)
+	}
+	closed, next := interview.Turns[0], interview.Turns[1]
+	if !closed.TimedOut || closed.AnsweredAt == nil || math.Abs(closed.DurationSeconds-60) > 1 || closed.OvertimeSeconds != 0 {
+		t.Errorf("closed turn = %+v, want it cut off at 60 seconds", closed)
+	}
+	if next.QuestionID != interview.QuestionIDs[1] || next.LimitSeconds != 60 {
+		t.Errorf("next turn = %+v, want the second planned question with 60 seconds", next)
+	}
+	after, _ := s.Sessions().GetTimer(interview.ID, email)
+	if timeUps := s.Sessions().timeUps(timer, after); len(timeUps) != 1 || timeUps[0].Question != next.Question || after.Question.Question != next.Question {
+		t.Errorf("timeUps() = %+v with timer %+v, want both to give the next question", timeUps, after.Question)
+	}
+	conversation, _ = NewConversationService().GetConversation(conversation.ID, email)
+	if messages := conversation.Messages; len(messages) != 1 || messages[0].Role != "assistant" || messages[0].Content != next.Question {
+		t.Errorf("conversation = %+v, want the next question asked in it", messages)
+	}
+	if turn, _ := s.Sessions().RecordAnswer(interview.ID, "We held a workshop."); turn.Number != 2 {
+		t.Errorf("RecordAnswer() after the time-out = turn %d, want the answer on turn 2", turn.Number)
+	}
+
+	// the whole interview runs out; a stale copy of the session does not end it twice
+	rewind(t, interview.ID, 300*time.Second)
+	var stale session_model.InterviewSession
+	database.DBConn.Preload("Turns").First(&stale, interview.ID)
+	if _, err := s.Sessions().ActiveSession(interview.ID, email); !errors.Is(err, ErrSessionNotActive) {
+		t.Errorf("ActiveSession() out of time error = %v, want ErrSessionNotActive", err)
+	}
+	interview, _ = s.Sessions().GetSession(interview.ID, email)
+	if interview.Status != session_model.StatusCompleted || len(ended) != 1 || ended[0].ID != interview.ID {
+		t.Errorf("session = %s, ended %d, want it completed and reported", interview.Status, len(ended))
+	}
+	if elapsed := interview.EndedAt.Sub(*interview.StartedAt).Seconds(); math.Abs(elapsed-300) > 1 {
+		t.Errorf("session ran %.0f seconds, want it ended at its 300 second budget", elapsed)
+	}
+	if err := s.Sessions().enforceTimeLimits(&stale, time.Now()); err != nil || len(ended) != 1 {
+		t.Errorf("enforceTimeLimits() on a stale session = %v, ended %d, want it reported once", err, len(ended))
+	}
+}
+
+func TestSessionService_TimedSessionOvertime(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:            session_model.TypeTechnical,
+		TargetRole:      "APS6 developer",
+		QuestionSeconds: 30,
+		WarningSeconds:  []int{10},
+		TimeUp:          session_model.TimeUpOvertime,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "", "How would you find a cycle in a linked list?"); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	rewind(t, interview.ID, 45*time.Second)
+	// ten of those seconds were spent paused
+	if err := database.DBConn.Model(&session_model.InterviewSession{}).Where("id = ?", interview.ID).Update("paused_seconds", 10).Error; err != nil {
+		t.Fatalf("updating paused seconds failed: %v", err)
+	}
+	if err := s.Sessions().EnforceTimeLimits(time.Now()); err != nil {
+		t.Fatalf("EnforceTimeLimits() failed: %v", err)
+	}
+	timer, _ := s.Sessions().GetTimer(interview.ID, email)
+	if len(timer.Warnings) != 1 || timer.Warnings[0].SecondsLeft != 0 || timer.Question == nil || timer.Question.RemainingSeconds > -4 {
+		t.Errorf("GetTimer() = %+v, want turn 1 about 5 seconds into overtime", timer)
+	}
+
+	turn, err := s.Sessions().RecordAnswer(interview.ID, "Use a fast and a slow pointer.")
+	if err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	if turn.TimedOut || math.Abs(turn.DurationSeconds-35) > 1 || math.Abs(turn.OvertimeSeconds-5) > 1 {
+		t.Errorf("RecordAnswer() = %+v, want 35 seconds taken, 5 over", turn)
+	}
+	rubric := scoring_model.Rubric{Criteria: []scoring_model.Criterion{{Key: "correctness"}}}
+	request := judgeRequest("gpt-4", rubric, interview, turn, "", "")
+	if content := request.Messages[0].Content; !strings.Contains(content, "Time limit: 30 seconds. The candidate took 35 seconds, 5 seconds over") {
+		t.Errorf("judge request does not give the timing: %s", content)
+	}
+}
+
+func TestSessionService_WatchTimer(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:            session_model.TypeTechnical,
+		TargetRole:      "APS6 developer",
+		QuestionSeconds: 60,
+		TimeUp:          session_model.TimeUpClose,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "", "What is a hash map?"); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	rewind(t, interview.ID, 59800*time.Millisecond)
+
+	var events []string
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+	pings := 0
+	err = s.Sessions().WatchTimer(ctx, interview.ID, email, 20*time.Millisecond, func(event string, data interface{}) error {
+		if event == TimerPing {
+			pings++
+			return nil
+		}
+		if warning, ok := data.(session_model.TimerWarning); ok {
+			event += ":" + warning.Message
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WatchTimer() failed: %v", err)
+	}
+	want := []string{"timer", "warning:15 seconds left for question 1.", "time_up:Time is up for question 1.", "timer"}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Errorf("WatchTimer() events = %q, want %q", events, want)
+	}
+	if pings == 0 {
+		t.Errorf("WatchTimer() sent no pings while the clock stood still")
+	}
+	if turn, _ := s.Sessions().GetTurn(interview.ID, 1); !turn.TimedOut {
+		t.Errorf("turn = %+v, want it closed", turn)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math"
+	question_model "up-it-aps-api/app/models/question"
+)
+
+// SkillEngine estimates a candidate's skill from scored answers and says which question
+// difficulty suits it. Ratings are only meaningful to the engine that produced them.
+type SkillEngine interface {
+	Name() string
+	// InitialRating is the rating of a competency with no scored answers yet.
+	InitialRating() float64
+	// Expected is the score, from 0 to 1, a candidate with rating is predicted to get on
+	// a question of difficulty.
+	Expected(rating float64, difficulty int) float64
+	// Update returns the rating after a score from 0 to 1 on a question of difficulty.
+	// observations is how many answers the current rating is based on.
+	Update(rating float64, observations int, difficulty int, score float64) float64
+	// TargetDifficulty is the difficulty, between the bank's minimum and maximum, that
+	// keeps a candidate with rating in their stretch zone.
+	TargetDifficulty(rating float64) float64
+	// StretchScore is the expected score, from 0 to 1, that TargetDifficulty aims for.
+	StretchScore() float64
+}
+
+// Elo engine defaults. Difficulties are placed on the rating scale EloDifficultyStep
+// apart, starting at EloBaseRating for the easiest; a new candidate starts between
+// difficulty 2 and 3. The K-factor starts at EloMaxK and shrinks towards EloMinK as
+// evidence builds up. StretchSuccess is the expected score the next question aims for:
+// hard enough to stretch the candidate but likely to be answered well.
+const (
+	EloBaseRating     = 1000.0
+	EloDifficultyStep = 200.0
+	EloInitialRating  = 1300.0
+	EloMaxK           = 64.0
+	EloMinK           = 16.0
+	StretchSuccess    = 0.6
+)
+
+// EloEngine treats every answer as a match between the candidate and the question, each
+// difficulty having a fixed rating.
+type EloEngine struct {
+	stretch float64
+}
+
+func NewEloEngine() *EloEngine {
+	return &EloEngine{stretch: StretchSuccess}
+}
+
+func (e *EloEngine) Name() string {
+	return "elo"
+}
+
+func (e *EloEngine) InitialRating() float64 {
+	return EloInitialRating
+}
+
+func (e *EloEngine) Expected(rating float64, difficulty int) float64 {
+	return 1 / (1 + math.Pow(10, (difficultyRating(float64(difficulty))-rating)/400))
+}
+
+func (e *EloEngine) Update(rating float64, observations int, difficulty int, score float64) float64 {
+	k := math.Max(EloMinK, EloMaxK/math.Sqrt(float64(observations+1)))
+	return rating + k*(score-e.Expected(rating, difficulty))
+}
+
+func (e *EloEngine) TargetDifficulty(rating float64) float64 {
+	// solve Expected(rating, d) = stretch for d
+	target := rating + 400*math.Log10(1/e.stretch-1)
+	difficulty := 1 + (target-EloBaseRating)/EloDifficultyStep
+	return math.Max(question_model.MinDifficulty, math.Min(question_model.MaxDifficulty, difficulty))
+}
+
+func (e *EloEngine) StretchScore() float64 {
+	return e.stretch
+}
+
+func difficultyRating(difficulty float64) float64 {
+	return EloBaseRating + (difficulty-1)*EloDifficultyStep
+}
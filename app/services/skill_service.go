@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	question_model "up-it-aps-api/app/models/question"
+	skill_model "up-it-aps-api/app/models/skill"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+type SkillService struct {
+	engine          SkillEngine
+	questionService *QuestionService
+}
+
+func NewSkillService(engine SkillEngine, questionService *QuestionService) *SkillService {
+	return &SkillService{engine: engine, questionService: questionService}
+}
+
+func (s *SkillService) Engine() SkillEngine {
+	return s.engine
+}
+
+// GetEstimates returns the user's estimates from the current engine by competency, with
+// the difficulty that currently suits each.
+func (s *SkillService) GetEstimates(email string) ([]skill_model.SkillEstimate, error) {
+	var db = database.DBConn
+	var estimates []skill_model.SkillEstimate
+	result := db.Where("email = ? AND engine = ?", email, s.engine.Name()).Order("competency ASC").Find(&estimates)
+	for i := range estimates {
+		estimates[i].Difficulty = roundTenth(s.engine.TargetDifficulty(estimates[i].Rating))
+	}
+	return estimates, result.Error
+}
+
+// estimate returns the user's stored estimate for competency, or a new one at the
+// engine's initial rating.
+func (s *SkillService) estimate(db *gorm.DB, email string, competency string) (skill_model.SkillEstimate, error) {
+	var estimate skill_model.SkillEstimate
+	result := db.Where("email = ? AND engine = ? AND competency = ?", email, s.engine.Name(), competency).First(&estimate)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return skill_model.SkillEstimate{Email: email, Engine: s.engine.Name(), Competency: competency, Rating: s.engine.InitialRating()}, nil
+	}
+	return estimate, result.Error
+}
+
+// Observe updates the user's estimate for the question's competency with a score from
+// 0 to 1. Questions without a competency carry no skill signal and are ignored.
+func (s *SkillService) Observe(email string, question question_model.Question, score float64) (skill_model.SkillEstimate, error) {
+	if question.Competency == "" {
+		return skill_model.SkillEstimate{}, nil
+	}
+	var db = database.DBConn
+	var estimate skill_model.SkillEstimate
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if estimate, err = s.estimate(tx, email, question.Competency); err != nil {
+			return err
+		}
+		estimate.Rating = s.engine.Update(estimate.Rating, estimate.Observations, question.Difficulty, math.Max(0, math.Min(1, score)))
+		estimate.Observations++
+		return tx.Save(&estimate).Error
+	})
+	if err != nil {
+		return skill_model.SkillEstimate{}, err
+	}
+	estimate.Difficulty = roundTenth(s.engine.TargetDifficulty(estimate.Rating))
+	return estimate, nil
+}
+
+// SelectQuestion picks the next question for the user from those matching filter,
+// leaving out exclude. The topic is a competency the user has not been scored on yet or
+// else their weakest one; the question is the one whose difficulty is closest to the
+// engine's stretch target for it. The rationale explains both choices.
+func (s *SkillService) SelectQuestion(email string, filter question_model.QuestionFilter, exclude []uint) (skill_model.Selection, error) {
+	questions, err := s.questionService.GetQuestions(filter)
+	if err != nil {
+		return skill_model.Selection{}, err
+	}
+	excluded := make(map[uint]bool)
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+	byCompetency := make(map[string][]question_model.Question)
+	var competencies []string
+	for _, question := range questions {
+		if excluded[question.ID] || question.Competency == "" {
+			continue
+		}
+		if len(byCompetency[question.Competency]) == 0 {
+			competencies = append(competencies, question.Competency)
+		}
+		byCompetency[question.Competency] = append(byCompetency[question.Competency], question)
+	}
+	if len(competencies) == 0 {
+		return skill_model.Selection{}, ErrNoQuestions
+	}
+
+	var db = database.DBConn
+	estimates := make(map[string]skill_model.SkillEstimate)
+	for _, competency := range competencies {
+		if estimates[competency], err = s.estimate(db, email, competency); err != nil {
+			return skill_model.Selection{}, err
+		}
+	}
+	// unpractised competencies first, then the weakest; names break ties
+	sort.Slice(competencies, func(i, j int) bool {
+		a, b := estimates[competencies[i]], estimates[competencies[j]]
+		if (a.Observations == 0) != (b.Observations == 0) {
+			return a.Observations == 0
+		}
+		if a.Rating != b.Rating {
+			return a.Rating < b.Rating
+		}
+		return competencies[i] < competencies[j]
+	})
+	competency := competencies[0]
+	estimate := estimates[competency]
+	target := s.engine.TargetDifficulty(estimate.Rating)
+
+	candidates := byCompetency[competency]
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di := math.Abs(float64(candidates[i].Difficulty) - target)
+		dj := math.Abs(float64(candidates[j].Difficulty) - target)
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i].Difficulty < candidates[j].Difficulty
+	})
+	question := candidates[0]
+
+	selection := skill_model.Selection{
+		QuestionID:       question.ID,
+		Prompt:           question.Prompt,
+		Competency:       competency,
+		Difficulty:       question.Difficulty,
+		TargetDifficulty: roundTenth(target),
+		Rating:           math.Round(estimate.Rating),
+		Observations:     estimate.Observations,
+		ExpectedScore:    math.Round(s.engine.Expected(estimate.Rating, question.Difficulty)*100) / 100,
+		Engine:           s.engine.Name(),
+	}
+	selection.Rationale = selectionRationale(selection, len(competencies), s.engine.StretchScore())
+	return selection, nil
+}
+
+// selectionRationale explains the pick; stretch is the expected score the engine aims for.
+func selectionRationale(selection skill_model.Selection, competencies int, stretch float64) string {
+	var topic string
+	switch {
+	case selection.Observations == 0:
+		topic = fmt.Sprintf("You have no scored answers in %s yet, so it is practised first from a starting rating of %.0f.", selection.Competency, selection.Rating)
+	case competencies == 1:
+		topic = fmt.Sprintf("Only %s has questions left; you are rated %.0f in it after %d scored %s.", selection.Competency, selection.Rating, selection.Observations, plural(selection.Observations, "answer", "answers"))
+	default:
+		topic = fmt.Sprintf("Of the %d competencies with questions left, your weakest is %s, rated %.0f after %d scored %s.", competencies, selection.Competency, selection.Rating, selection.Observations, plural(selection.Observations, "answer", "answers"))
+	}
+	return fmt.Sprintf("%s Difficulty %.1f keeps you in your stretch zone, where you are expected to score about %.0f%%; the closest question is difficulty %d, where you are expected to score %.0f%%.",
+		topic, selection.TargetDifficulty, stretch*100, selection.Difficulty, selection.ExpectedScore*100)
+}
+
+func plural(count int, one string, many string) string {
+	if count == 1 {
+		return one
+	}
+	return many
+}
+
+func roundTenth(value float64) float64 {
+	return math.Round(value*10) / 10
+}
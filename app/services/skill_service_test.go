@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	question_model "up-it-aps-api/app/models/question"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+func TestEloEngine(t *testing.T) {
+	engine := NewEloEngine()
+	if got := engine.Expected(difficultyRating(3), 3); got != 0.5 {
+		t.Errorf("Expected() at an equal rating = %v, want 0.5", got)
+	}
+	tests := []struct {
+		name   string
+		rating float64
+		target float64
+	}{
+		{name: "new candidate", rating: EloInitialRating, target: 2.1},
+		{name: "expert", rating: 2400, target: 5},
+		{name: "novice", rating: 600, target: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roundTenth(engine.TargetDifficulty(tt.rating)); got != tt.target {
+				t.Errorf("TargetDifficulty(%v) = %v, want %v", tt.rating, got, tt.target)
+			}
+		})
+	}
+
+	up := engine.Update(EloInitialRating, 0, 3, 1)
+	down := engine.Update(EloInitialRating, 0, 3, 0)
+	if up <= EloInitialRating || down >= EloInitialRating {
+		t.Errorf("Update() = %v after a full score and %v after none, want above and below %v", up, down, EloInitialRating)
+	}
+	late := engine.Update(EloInitialRating, 50, 3, 1)
+	if late-EloInitialRating >= up-EloInitialRating {
+		t.Errorf("Update() moves %v after 50 answers, want less than the first answer's %v", late-EloInitialRating, up-EloInitialRating)
+	}
+	// the stretch target is where the engine expects the chosen success rate
+	rating := 1500.0
+	target := difficultyRating(engine.TargetDifficulty(rating))
+	if expected := 1 / (1 + math.Pow(10, (target-rating)/400)); math.Abs(expected-StretchSuccess) > 1e-9 {
+		t.Errorf("expected score at the target difficulty = %v, want %v", expected, StretchSuccess)
+	}
+}
+
+func newTestSkillService(t *testing.T) *SkillService {
+	t.Helper()
+	newTestSessionService(t)
+	questions := NewQuestionService()
+	for _, input := range []question_model.InputQuestion{
+		{Prompt: "Easy leadership question.", Competency: "leadership", Difficulty: 1, RoleFamily: "aps"},
+		{Prompt: "Medium leadership question.", Competency: "leadership", Difficulty: 2, RoleFamily: "aps"},
+		{Prompt: "Hard leadership question.", Competency: "leadership", Difficulty: 5, RoleFamily: "aps"},
+		{Prompt: "Medium communication question.", Competency: "communication", Difficulty: 2, RoleFamily: "aps"},
+		{Prompt: "Hard communication question.", Competency: "communication", Difficulty: 4, RoleFamily: "aps"},
+	} {
+		input := input
+		if _, err := questions.CreateQuestion(&input); err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+	}
+	return NewSkillService(NewEloEngine(), questions)
+}
+
+func TestSkillService_SelectQuestion(t *testing.T) {
+	s := newTestSkillService(t)
+	email := "test@example.com"
+	filter := question_model.QuestionFilter{RoleFamily: "aps"}
+
+	selection, err := s.SelectQuestion(email, filter, nil)
+	if err != nil {
+		t.Fatalf("SelectQuestion() failed: %v", err)
+	}
+	if selection.Competency != "communication" || selection.Difficulty != 2 || !strings.Contains(selection.Rationale, "no scored answers in communication") {
+		t.Errorf("SelectQuestion() with no estimates = %+v, want the unpractised competency first", selection)
+	}
+
+	leadership, _ := s.questionService.GetQuestions(question_model.QuestionFilter{Competency: "leadership", MinDifficulty: 2, MaxDifficulty: 2})
+	communication, _ := s.questionService.GetQuestions(question_model.QuestionFilter{Competency: "communication", MinDifficulty: 2, MaxDifficulty: 2})
+	if _, err := s.Observe(email, communication[0], 1); err != nil {
+		t.Fatalf("Observe() failed: %v", err)
+	}
+	estimate, err := s.Observe(email, leadership[0], 0.2)
+	if err != nil {
+		t.Fatalf("Observe() failed: %v", err)
+	}
+	if estimate.Observations != 1 || estimate.Rating >= EloInitialRating || estimate.Difficulty >= roundTenth(NewEloEngine().TargetDifficulty(EloInitialRating)) {
+		t.Errorf("Observe() after a poor answer = %+v, want a lower rating and target", estimate)
+	}
+
+	selection, err = s.SelectQuestion(email, filter, nil)
+	if err != nil {
+		t.Fatalf("SelectQuestion() failed: %v", err)
+	}
+	if selection.Competency != "leadership" || selection.Difficulty != 2 || !strings.Contains(selection.Rationale, "your weakest is leadership") {
+		t.Errorf("SelectQuestion() = %+v, want the medium leadership question", selection)
+	}
+	if selection.ExpectedScore <= 0 || selection.ExpectedScore >= 1 || selection.Engine != "elo" {
+		t.Errorf("SelectQuestion() = %+v, want an expected score from the elo engine", selection)
+	}
+
+	selection, err = s.SelectQuestion(email, question_model.QuestionFilter{Competency: "leadership"}, []uint{selection.QuestionID})
+	if err != nil || selection.Difficulty != 1 || !strings.Contains(selection.Rationale, "Only leadership has questions left") {
+		t.Errorf("SelectQuestion() excluding the medium question = %+v, %v", selection, err)
+	}
+	if _, err := s.SelectQuestion(email, question_model.QuestionFilter{RoleFamily: "swe"}, nil); !errors.Is(err, ErrNoQuestions) {
+		t.Errorf("SelectQuestion() with no matches error = %v, want ErrNoQuestions", err)
+	}
+
+	estimates, err := s.GetEstimates(email)
+	if err != nil || len(estimates) != 2 || estimates[0].Competency != "communication" || estimates[0].Rating <= EloInitialRating {
+		t.Errorf("GetEstimates() = %+v, %v", estimates, err)
+	}
+	if others, _ := s.GetEstimates("other@example.com"); len(others) != 0 {
+		t.Errorf("GetEstimates() for another user = %+v, want none", others)
+	}
+
+	// the rationale quotes the engine's own stretch target
+	s.engine = &EloEngine{stretch: 0.75}
+	selection, err = s.SelectQuestion(email, filter, nil)
+	if err != nil || !strings.Contains(selection.Rationale, "expected to score about 75%") {
+		t.Errorf("SelectQuestion() with a 75%% stretch target = %q, %v", selection.Rationale, err)
+	}
+}
+
+func TestAdaptiveSession_PicksQuestionsFromScores(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	questions := NewQuestionService()
+	for _, input := range []question_model.InputQuestion{
+		{Prompt: "Tell me about leading a small change.", Competency: "leadership", Difficulty: 2},
+		{Prompt: "Tell me about leading a restructure.", Competency: "leadership", Difficulty: 3},
+		{Prompt: "Tell me about an easy leadership moment.", Competency: "leadership", Difficulty: 1},
+	} {
+		input := input
+		if _, err := questions.CreateQuestion(&input); err != nil {
+			t.Fatalf("CreateQuestion() failed: %v", err)
+		}
+	}
+
+	email := "test@example.com"
+	if _, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1", Adaptive: true}); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("StartSession() adaptive without a filter error = %v, want ErrInvalidSession", err)
+	}
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:          session_model.TypeBehavioral,
+		TargetRole:    "APS EL1",
+		Questions:     &question_model.QuestionFilter{Competency: "leadership"},
+		QuestionCount: 2,
+		Adaptive:      true,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if len(interview.QuestionIDs) != 1 || len(interview.Selections) != 1 || interview.Selections[0].Difficulty != 2 {
+		t.Fatalf("StartSession() planned %v with %+v, want only the first question, of difficulty 2", interview.QuestionIDs, interview.Selections)
+	}
+
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Tell me about leading a small change."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "I led it and it went perfectly."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	top := `{"scores": [{"criterion": "structure", "score": 4, "justification": "x"}, {"criterion": "ownership", "score": 4, "justification": "x"}, {"criterion": "impact", "score": 4, "justification": "x"}]}`
+	fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: top}, fakeproviders.Response{Text: top}, fakeproviders.Response{Text: top})
+	// another request scores the turn while the first is about to store its score, so
+	// both saw no earlier score; the answer still counts once
+	raced := false
+	database.DBConn.Callback().Create().Before("gorm:begin_transaction").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "turn_scores" {
+			return
+		}
+		raced = true
+		if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); err != nil {
+			t.Errorf("racing ScoreTurn() failed: %v", err)
+		}
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); err != nil {
+			t.Fatalf("ScoreTurn() failed: %v", err)
+		}
+	}
+	estimates, err := s.Skills().GetEstimates(email)
+	if err != nil || len(estimates) != 1 || estimates[0].Observations != 1 {
+		t.Fatalf("GetEstimates() after scoring a turn three times = %+v, %v, want one observation", estimates, err)
+	}
+
+	interview, err = s.Sessions().GetSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetSession() failed: %v", err)
+	}
+	if err := s.Sessions().AdaptNextQuestion(&interview); err != nil {
+		t.Fatalf("AdaptNextQuestion() failed: %v", err)
+	}
+	if len(interview.QuestionIDs) != 2 || interview.Selections[1].Difficulty != 3 {
+		t.Errorf("AdaptNextQuestion() planned %+v, want the harder question after a top score", interview.Selections)
+	}
+	if instruction := s.Sessions().Instruction(interview); !strings.Contains(instruction, "leading a restructure") {
+		t.Errorf("Instruction() = %q, want the adapted question", instruction)
+	}
+	if err := s.Sessions().AdaptNextQuestion(&interview); err != nil || len(interview.QuestionIDs) != 2 {
+		t.Errorf("AdaptNextQuestion() before the question is asked planned %v, %v", interview.QuestionIDs, err)
+	}
+	stored, _ := s.Sessions().GetSession(interview.ID, email)
+	if len(stored.QuestionIDs) != 2 || len(stored.Selections) != 2 {
+		t.Errorf("stored plan = %v, want the adapted question saved", stored.QuestionIDs)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	ai_model "up-it-aps-api/app/models/ai"
+	user_model "up-it-aps-api/app/models/user"
+	"up-it-aps-api/pkg/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrNoSpeechSynthesizer = errors.New("no speech synthesizer registered for model")
+
+// Output formats a user can ask for. Providers that cannot produce one fall back to MP3.
+const (
+	AudioFormatMp3  = "mp3"
+	AudioFormatOpus = "opus"
+	AudioFormatWav  = "wav"
+)
+
+var AudioFormats = []string{AudioFormatMp3, AudioFormatOpus, AudioFormatWav}
+
+const (
+	MinSpeakingRate = 0.5
+	MaxSpeakingRate = 2.0
+	// MaxPitch is the largest pitch shift, in semitones, either way.
+	MaxPitch = 12.0
+)
+
+// SpeechSynthesizer is implemented by every TTS backend.
+type SpeechSynthesizer interface {
+	Name() string
+	Synthesize(ctx context.Context, text string, options ai_model.VoiceOptions) ([]byte, error)
+	// Catalog lists the provider's voices and formats. Its Model is left to the registry.
+	Catalog() ai_model.VoiceCatalog
+}
+
+// SpeechSynthesizerRegistry maps TTS model IDs (as stored in UserSettings.TtsModel) to
+// synthesizers. Models without an explicit registration resolve to the fallback.
+type SpeechSynthesizerRegistry struct {
+	mu           sync.RWMutex
+	synthesizers map[string]SpeechSynthesizer
+	fallback     SpeechSynthesizer
+}
+
+func NewSpeechSynthesizerRegistry(fallback SpeechSynthesizer) *SpeechSynthesizerRegistry {
+	return &SpeechSynthesizerRegistry{
+		synthesizers: make(map[string]SpeechSynthesizer),
+		fallback:     fallback,
+	}
+}
+
+// NewDefaultSpeechSynthesizerRegistry wires up the TTS providers we ship with. Unknown
+// models go to OpenAI, as they always have.
+func NewDefaultSpeechSynthesizerRegistry(endpoints config.ProviderEndpoints) *SpeechSynthesizerRegistry {
+	openAi := NewOpenAiSpeechSynthesizer(os.Getenv("OPEN_AI_API_KEY"), endpoints.OpenAI)
+	registry := NewSpeechSynthesizerRegistry(openAi)
+	registry.Register(openAi, "tts-1")
+	registry.Register(NewElevenLabsSpeechSynthesizer(os.Getenv("ELEVEN_LABS_API_KEY"), endpoints.ElevenLabs), "elevenlabs-multilingual-v1")
+	registry.Register(NewGoogleSpeechSynthesizer(os.Getenv("GCLOUD_API_KEY"), endpoints.GoogleTts), "vertex")
+	registry.Register(NewUnrealSpeechSynthesizer(os.Getenv("UNREAL_SPEECH_API_KEY"), endpoints.UnrealSpeech), "unreal-speech")
+	return registry
+}
+
+func (r *SpeechSynthesizerRegistry) Register(synthesizer SpeechSynthesizer, models ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, model := range models {
+		r.synthesizers[model] = synthesizer
+	}
+}
+
+func (r *SpeechSynthesizerRegistry) Resolve(model string) (SpeechSynthesizer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if synthesizer, ok := r.synthesizers[model]; ok {
+		return synthesizer, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoSpeechSynthesizer, model)
+}
+
+// Catalogs lists the voices of every registered model, in model order.
+func (r *SpeechSynthesizerRegistry) Catalogs() []ai_model.VoiceCatalog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	models := make([]string, 0, len(r.synthesizers))
+	for model := range r.synthesizers {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	catalogs := make([]ai_model.VoiceCatalog, 0, len(models))
+	for _, model := range models {
+		catalog := r.synthesizers[model].Catalog()
+		catalog.Model = model
+		catalogs = append(catalogs, catalog)
+	}
+	return catalogs
+}
+
+// VoiceOptions turns the user's voice settings into synthesizer options.
+func VoiceOptions(settings user_model.UserSettings) ai_model.VoiceOptions {
+	return ai_model.VoiceOptions{
+		VoiceID:      settings.TtsVoice,
+		SpeakingRate: settings.SpeakingRate,
+		Pitch:        settings.Pitch,
+		Format:       settings.AudioFormat,
+	}
+}
+
+// catalogVoice returns the voice to use from catalog: id if the provider knows it, and
+// otherwise the default, so a voice picked for another provider is never sent.
+// isCustom says whether an unlisted id is one the provider accepts anyway.
+func catalogVoice(catalog ai_model.VoiceCatalog, id string, isCustom func(string) bool) ai_model.Voice {
+	var fallback ai_model.Voice
+	for _, voice := range catalog.Voices {
+		if voice.ID == id {
+			return voice
+		}
+		if voice.ID == catalog.DefaultVoice {
+			fallback = voice
+		}
+	}
+	if id != "" && isCustom != nil && isCustom(id) {
+		return ai_model.Voice{ID: id}
+	}
+	return fallback
+}
+
+// catalogFormat returns format if the provider can produce it, and MP3 otherwise.
+func catalogFormat(catalog ai_model.VoiceCatalog, format string) string {
+	for _, supported := range catalog.Formats {
+		if supported == format {
+			return format
+		}
+	}
+	return AudioFormatMp3
+}
+
+// AudioContentType is the MIME type of audio in format.
+func AudioContentType(format string) string {
+	switch format {
+	case AudioFormatOpus:
+		return "audio/ogg"
+	case AudioFormatWav:
+		return "audio/wav"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// speakingRate returns the rate, 1 when unset, clamped to the provider's range.
+func speakingRate(rate float64, low float64, high float64) float64 {
+	if rate == 0 {
+		rate = 1
+	}
+	return math.Max(low, math.Min(high, rate))
+}
+
+// audioResponse sends a prepared TTS request and turns the result into audio bytes or an error.
+func audioResponse(provider string, agent *fiber.Agent) ([]byte, error) {
+	statusCode, body, errs := agent.Bytes()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if statusCode != fiber.StatusOK {
+		return nil, &ProviderError{Provider: provider, StatusCode: statusCode, Message: string(body)}
+	}
+	if len(body) == 0 {
+		return nil, &ProviderError{Provider: provider, Message: "empty audio response"}
+	}
+	return body, nil
+}
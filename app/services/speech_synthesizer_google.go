@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var googleVoiceCatalog = ai_model.VoiceCatalog{
+	Provider:     "google",
+	DefaultVoice: "en-AU-Neural2-B",
+	Formats:      []string{AudioFormatMp3, AudioFormatOpus, AudioFormatWav},
+	Pitch:        true,
+	CustomVoices: true,
+	// the limit is 5000 bytes, which leaves room for accented text
+	MaxChunkChars: 2500,
+	Voices: []ai_model.Voice{
+		{ID: "en-AU-Neural2-A", Name: "Australian A", Accent: "en-AU", Gender: "female"},
+		{ID: "en-AU-Neural2-B", Name: "Australian B", Accent: "en-AU", Gender: "male"},
+		{ID: "en-AU-Neural2-C", Name: "Australian C", Accent: "en-AU", Gender: "female"},
+		{ID: "en-AU-Neural2-D", Name: "Australian D", Accent: "en-AU", Gender: "male"},
+		{ID: "en-GB-Neural2-A", Name: "British A", Accent: "en-GB", Gender: "female"},
+		{ID: "en-GB-Neural2-B", Name: "British B", Accent: "en-GB", Gender: "male"},
+		{ID: "en-US-Neural2-C", Name: "American C", Accent: "en-US", Gender: "female"},
+		{ID: "en-US-Neural2-D", Name: "American D", Accent: "en-US", Gender: "male"},
+	},
+}
+
+// googleVoiceName matches Google voice names such as en-IN-Wavenet-A, which start with
+// their language code.
+var googleVoiceName = regexp.MustCompile(`^([a-z]{2,3}-[A-Z]{2})-[A-Za-z0-9]+-[A-Z]$`)
+
+var googleAudioEncodings = map[string]string{
+	AudioFormatMp3:  "MP3",
+	AudioFormatOpus: "OGG_OPUS",
+	AudioFormatWav:  "LINEAR16",
+}
+
+// GoogleSpeechSynthesizer talks to Google Cloud Text-to-Speech.
+type GoogleSpeechSynthesizer struct {
+	apiKey   string
+	endpoint string
+}
+
+func NewGoogleSpeechSynthesizer(apiKey string, baseUrl string) *GoogleSpeechSynthesizer {
+	return &GoogleSpeechSynthesizer{apiKey: apiKey, endpoint: baseUrl + VertexTextToSpeechPath}
+}
+
+func (p *GoogleSpeechSynthesizer) Name() string {
+	return "google"
+}
+
+func (p *GoogleSpeechSynthesizer) Catalog() ai_model.VoiceCatalog {
+	return googleVoiceCatalog
+}
+
+func (p *GoogleSpeechSynthesizer) Synthesize(ctx context.Context, text string, options ai_model.VoiceOptions) ([]byte, error) {
+	agent := fiber.Post(p.endpoint)
+	if err := prepareAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	voice := catalogVoice(googleVoiceCatalog, options.VoiceID, googleVoiceName.MatchString)
+	format := catalogFormat(googleVoiceCatalog, options.Format)
+	agent.Set("Authorization", "Bearer "+p.apiKey)
+	agent.Set("Accept", AudioContentType(format))
+	agent.Set("Content-Type", "application/json; charset=utf-8")
+	agent.Set("x-goog-user-project", "up-it-aps")
+	agent.JSON(ai_model.GoogleVertexAiRequest{
+		Input: ai_model.GoogleVertexAiAudioRequestInput{
+			Text: text,
+		},
+		Voice: ai_model.GoogleVertexAiAudioRequestVoice{
+			LanguageCode: googleVoiceName.FindStringSubmatch(voice.ID)[1],
+			Name:         voice.ID,
+		},
+		AudioConfig: ai_model.GoogleVertexAiAudioRequestAudioConfig{
+			AudioEncoding: googleAudioEncodings[format],
+			SpeakingRate:  float32(speakingRate(options.SpeakingRate, 0.25, 4)),
+			Pitch:         float32(options.Pitch),
+		},
+	})
+	body, err := audioResponse("vertex", agent)
+	if err != nil {
+		return nil, err
+	}
+	var response ai_model.GoogleVertexAiAudioResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("decode vertex audio response: %w", err)
+	}
+	audio, err := base64.StdEncoding.DecodeString(response.AudioContent)
+	if err != nil {
+		return nil, fmt.Errorf("decode vertex audio content: %w", err)
+	}
+	return audio, nil
+}
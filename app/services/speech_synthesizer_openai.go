@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var openAiVoiceCatalog = ai_model.VoiceCatalog{
+	Provider:      "openai",
+	DefaultVoice:  "alloy",
+	Formats:       []string{AudioFormatMp3, AudioFormatOpus, AudioFormatWav},
+	MaxChunkChars: 4096,
+	Voices: []ai_model.Voice{
+		{ID: "alloy", Name: "Alloy", Accent: "en-US", Gender: "neutral"},
+		{ID: "echo", Name: "Echo", Accent: "en-US", Gender: "male"},
+		{ID: "fable", Name: "Fable", Accent: "en-GB", Gender: "male"},
+		{ID: "onyx", Name: "Onyx", Accent: "en-US", Gender: "male"},
+		{ID: "nova", Name: "Nova", Accent: "en-US", Gender: "female"},
+		{ID: "shimmer", Name: "Shimmer", Accent: "en-US", Gender: "female"},
+	},
+}
+
+// OpenAiSpeechSynthesizer talks to OpenAI's speech endpoint, which has no pitch control.
+type OpenAiSpeechSynthesizer struct {
+	apiKey   string
+	endpoint string
+}
+
+func NewOpenAiSpeechSynthesizer(apiKey string, baseUrl string) *OpenAiSpeechSynthesizer {
+	return &OpenAiSpeechSynthesizer{apiKey: apiKey, endpoint: baseUrl + OpenAiVoiceGenerationPath}
+}
+
+func (p *OpenAiSpeechSynthesizer) Name() string {
+	return "openai"
+}
+
+func (p *OpenAiSpeechSynthesizer) Catalog() ai_model.VoiceCatalog {
+	return openAiVoiceCatalog
+}
+
+func (p *OpenAiSpeechSynthesizer) Synthesize(ctx context.Context, text string, options ai_model.VoiceOptions) ([]byte, error) {
+	agent := fiber.Post(p.endpoint)
+	if err := prepareAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	format := catalogFormat(openAiVoiceCatalog, options.Format)
+	agent.Set("Authorization", "Bearer "+p.apiKey)
+	agent.Set("Accept", AudioContentType(format))
+	agent.Set("Content-Type", "application/json")
+	agent.JSON(ai_model.OpenAiTtsRequest{
+		Model:          "tts-1",
+		Input:          text,
+		Voice:          catalogVoice(openAiVoiceCatalog, options.VoiceID, nil).ID,
+		ResponseFormat: format,
+		Speed:          float32(speakingRate(options.SpeakingRate, 0.25, 4)),
+	})
+	return audioResponse("tts-1", agent)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestCatalogVoice(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog ai_model.VoiceCatalog
+		id      string
+		custom  func(string) bool
+		want    string
+	}{
+		{name: "default", catalog: openAiVoiceCatalog, want: "alloy"},
+		{name: "listed", catalog: openAiVoiceCatalog, id: "nova", want: "nova"},
+		{name: "another provider's voice", catalog: openAiVoiceCatalog, id: ElevenLabsAustralianAccent, want: "alloy"},
+		{name: "cloned voice", catalog: elevenLabsVoiceCatalog, id: "abcdefghij0123456789", custom: elevenLabsVoiceID.MatchString, want: "abcdefghij0123456789"},
+		{name: "not an elevenlabs id", catalog: elevenLabsVoiceCatalog, id: "nova", custom: elevenLabsVoiceID.MatchString, want: ElevenLabsAmericanAccent},
+		{name: "unlisted google voice", catalog: googleVoiceCatalog, id: "en-IN-Wavenet-A", custom: googleVoiceName.MatchString, want: "en-IN-Wavenet-A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := catalogVoice(tt.catalog, tt.id, tt.custom); got.ID != tt.want {
+				t.Errorf("catalogVoice(%q) = %q, want %q", tt.id, got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeechSynthesizers_VoiceOptions(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	voice := ai_model.VoiceOptions{SpeakingRate: 1.5, Pitch: 12, Format: AudioFormatOpus}
+
+	tests := []struct {
+		model string
+		voice string
+		route string
+		want  map[string]interface{}
+	}{
+		{model: "tts-1", voice: "nova", route: fakeproviders.RouteOpenAiSpeech, want: map[string]interface{}{"voice": "nova", "speed": 1.5, "response_format": "opus"}},
+		{model: "vertex", voice: "en-GB-Neural2-A", route: fakeproviders.RouteGoogleTts, want: map[string]interface{}{
+			"voice":       map[string]interface{}{"languageCode": "en-GB", "name": "en-GB-Neural2-A"},
+			"audioConfig": map[string]interface{}{"audioEncoding": "OGG_OPUS", "speakingRate": 1.5, "pitch": 12.0},
+		}},
+		{model: "unreal-speech", voice: "Dan", route: fakeproviders.RouteUnrealSpeech, want: map[string]interface{}{"VoiceId": "Dan", "Speed": "0.5", "Pitch": "1.5", "Codec": "libmp3lame"}},
+		{model: "elevenlabs-multilingual-v1", route: fakeproviders.RouteElevenLabs, want: map[string]interface{}{
+			"voice_settings": map[string]interface{}{"stability": 0.95, "similarity_boost": 0.95, "speed": 1.2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			options := voice
+			options.VoiceID = tt.voice
+			if _, _, err := s.GenerateAudio(context.Background(), tt.model, options, []byte("Hello"), "test@example.com"); err != nil {
+				t.Fatalf("GenerateAudio() failed: %v", err)
+			}
+			var request map[string]interface{}
+			if err := json.Unmarshal(fake.LastRequest(tt.route), &request); err != nil {
+				t.Fatalf("decoding request failed: %v", err)
+			}
+			for key, want := range tt.want {
+				got, _ := json.Marshal(request[key])
+				expected, _ := json.Marshal(want)
+				if string(got) != string(expected) {
+					t.Errorf("request %s = %s, want %s", key, got, expected)
+				}
+			}
+		})
+	}
+
+	if format := s.AudioFormat("unreal-speech", AudioFormatWav); format != AudioFormatMp3 {
+		t.Errorf("AudioFormat() for unreal-speech = %q, want the MP3 fallback", format)
+	}
+	// the format must survive a failover to an MP3-only provider
+	s.failover.Tts = []string{"vertex"}
+	if format := s.AudioFormat("tts-1", AudioFormatWav); format != AudioFormatWav {
+		t.Errorf("AudioFormat() for tts-1 failing over to vertex = %q, want wav", format)
+	}
+	s.failover.Tts = []string{"elevenlabs-multilingual-v1"}
+	if format := s.AudioFormat("tts-1", AudioFormatWav); format != AudioFormatMp3 {
+		t.Errorf("AudioFormat() for tts-1 failing over to elevenlabs = %q, want mp3", format)
+	}
+	if _, _, err := s.GenerateAudio(context.Background(), "tts-1", voice, []byte("Hello again"), "test@example.com"); err != nil {
+		t.Fatalf("GenerateAudio() failed: %v", err)
+	}
+	if request := string(fake.LastRequest(fakeproviders.RouteOpenAiSpeech)); !strings.Contains(request, `"response_format":"mp3"`) {
+		t.Errorf("request = %s, want mp3 asked for when elevenlabs may answer", request)
+	}
+	catalogs := s.SpeechSynthesizers().Catalogs()
+	if len(catalogs) != 4 || catalogs[0].Model != "elevenlabs-multilingual-v1" || catalogs[0].Provider != "elevenlabs" || len(catalogs[0].Voices) == 0 {
+		t.Errorf("Catalogs() = %+v, want the four TTS models with their voices", catalogs)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"math"
+	"strconv"
+	ai_model "up-it-aps-api/app/models/ai"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var unrealVoiceCatalog = ai_model.VoiceCatalog{
+	Provider:      "unreal-speech",
+	DefaultVoice:  "Liv",
+	Formats:       []string{AudioFormatMp3},
+	Pitch:         true,
+	MaxChunkChars: 1000,
+	Voices: []ai_model.Voice{
+		{ID: "Liv", Name: "Liv", Accent: "en-US", Gender: "female"},
+		{ID: "Scarlett", Name: "Scarlett", Accent: "en-US", Gender: "female"},
+		{ID: "Amy", Name: "Amy", Accent: "en-US", Gender: "female"},
+		{ID: "Dan", Name: "Dan", Accent: "en-US", Gender: "male"},
+		{ID: "Will", Name: "Will", Accent: "en-US", Gender: "male"},
+	},
+}
+
+// UnrealSpeechSynthesizer talks to Unreal Speech's streaming endpoint. Its speed is an
+// offset from -1 to 1 rather than a multiple, and its pitch a multiple from 0.5 to 1.5.
+type UnrealSpeechSynthesizer struct {
+	apiKey   string
+	endpoint string
+}
+
+func NewUnrealSpeechSynthesizer(apiKey string, baseUrl string) *UnrealSpeechSynthesizer {
+	return &UnrealSpeechSynthesizer{apiKey: apiKey, endpoint: baseUrl + UnrealSpeechStreamPath}
+}
+
+func (p *UnrealSpeechSynthesizer) Name() string {
+	return "unreal-speech"
+}
+
+func (p *UnrealSpeechSynthesizer) Catalog() ai_model.VoiceCatalog {
+	return unrealVoiceCatalog
+}
+
+func (p *UnrealSpeechSynthesizer) Synthesize(ctx context.Context, text string, options ai_model.VoiceOptions) ([]byte, error) {
+	agent := fiber.Post(p.endpoint)
+	if err := prepareAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	speed := speakingRate(options.SpeakingRate, 0, 2) - 1
+	pitch := math.Max(0.5, math.Min(1.5, math.Pow(2, options.Pitch/12)))
+	agent.Set("Authorization", "Bearer "+p.apiKey)
+	agent.Set("Accept", "audio/mpeg")
+	agent.Set("Content-Type", "application/json; charset=utf-8")
+	agent.JSON(ai_model.UnrealSpeechRequest{
+		Text:    text,
+		VoiceId: catalogVoice(unrealVoiceCatalog, options.VoiceID, nil).ID,
+		Bitrate: "64k",
+		Speed:   strconv.FormatFloat(math.Round(speed*100)/100, 'f', -1, 64),
+		Pitch:   strconv.FormatFloat(math.Round(pitch*100)/100, 'f', -1, 64),
+		Codec:   "libmp3lame",
+	})
+	return audioResponse("unreal-speech", agent)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	ai_model "up-it-aps-api/app/models/ai"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrStarOutput         = errors.New("analyser did not return a valid STAR breakdown")
+	ErrTurnNotAnalysedYet = errors.New("turn has not been analysed")
+	ErrStarSessionType    = errors.New("STAR analysis is only for behavioral sessions")
+)
+
+var (
+	// transcripts often spell numbers out; "one" is left out as it is rarely a measure
+	measurablePattern  = regexp.MustCompile(`(?i)\d|%|\$|\b(two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|fifteen|twenty|thirty|forty|fifty|sixty|seventy|eighty|ninety|hundred|thousand|million|billion|dozen|half|percent|per cent|doubled|tripled|halved|twice)\b`)
+	firstPersonPattern = regexp.MustCompile(`(?i)\b(i|i'm|i've|i'd|me|my|myself)\b`)
+	collectivePattern  = regexp.MustCompile(`(?i)\b(we|we're|we've|we'd|us|our|ourselves)\b`)
+)
+
+// starTips are the coaching tips for each flag: a missing component's tip is keyed by
+// the component, a weak one's by the check that failed.
+var starTips = map[string]string{
+	session_model.StarSituation: "Open with one or two sentences of context: where you were, when, and what was at stake.",
+	session_model.StarTask:      "Say what you were responsible for or asked to achieve before describing what you did.",
+	session_model.StarAction:    "Walk through the specific steps you took, in order, and why you chose them.",
+	session_model.StarResult:    "Finish with the outcome: what changed because of your actions and what you learned.",
+	"long-situation":            "Trim the background to what the panel needs and spend the time on your actions.",
+	"team-action":               "Say \"I\" for your own actions so the panel can see your contribution, not just the team's.",
+	"short-action":              "Make the action the longest part of the answer; it is what you are assessed on.",
+	"unmeasured-result":         "Quantify the result: a number, percentage, time saved, cost avoided or feedback received.",
+}
+
+// Proportions are only judged on answers of at least StarMinWords words: the situation
+// should take no more than StarMaxSituationShare of it, and less than the action.
+const (
+	StarMaxSituationShare = 0.4
+	StarMinWords          = 40
+)
+
+// AnalyseTurn splits the answer of a behavioural session turn into its STAR components,
+// flags the missing and weak ones with a coaching tip each and stores the analysis with
+// the turn. The answer is usually a transcript, so the checks do not rely on punctuation
+// or casing and work the same on OpenAI and Vertex AI transcriptions.
+func (s *ScoringService) AnalyseTurn(ctx context.Context, sessionID uint, email string, turnNumber int) (session_model.StarAnalysis, error) {
+	interview, turn, err := s.answeredTurn(sessionID, email, turnNumber)
+	if err != nil {
+		return session_model.StarAnalysis{}, err
+	}
+	if interview.Type != session_model.TypeBehavioral {
+		return session_model.StarAnalysis{}, ErrStarSessionType
+	}
+
+	var segments starSegments
+	result, attempts, problems, err := s.askJudge(ctx, starRequest(s.judge.Model, turn), func(text string) []string {
+		var problems []string
+		segments, problems = parseStarSegments(text, turn.Answer)
+		return problems
+	})
+	if err != nil {
+		return session_model.StarAnalysis{}, err
+	}
+	if len(problems) > 0 {
+		return session_model.StarAnalysis{}, fmt.Errorf("%w after %d attempts: %s", ErrStarOutput, attempts, strings.Join(problems, "; "))
+	}
+
+	analysis := analyseStar(turn.Answer, segments)
+	analysis.TurnID, analysis.SessionID, analysis.TurnNumber = turn.ID, interview.ID, turn.Number
+	analysis.Provider, analysis.JudgeModel = result.Provider, result.Model
+	var db = database.DBConn
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// soft-deleted rows would still hold the unique turn index
+		if err := tx.Unscoped().Where("turn_id = ?", turn.ID).Delete(&session_model.StarAnalysis{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&analysis).Error
+	})
+	if err != nil {
+		return session_model.StarAnalysis{}, err
+	}
+	return analysis, nil
+}
+
+// GetStarAnalysis returns the stored STAR analysis of a turn of the user's session.
+func (s *ScoringService) GetStarAnalysis(sessionID uint, email string, turnNumber int) (session_model.StarAnalysis, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return session_model.StarAnalysis{}, err
+	}
+	for _, turn := range interview.Turns {
+		if turn.Number != turnNumber {
+			continue
+		}
+		if turn.Star == nil {
+			return session_model.StarAnalysis{}, ErrTurnNotAnalysedYet
+		}
+		return *turn.Star, nil
+	}
+	return session_model.StarAnalysis{}, ErrSessionTurnNotFound
+}
+
+// starSegments is the JSON the analyser is asked to reply with: the answer's own words
+// for each component, or "" when it is not covered.
+type starSegments struct {
+	Situation *string `json:"situation"`
+	Task      *string `json:"task"`
+	Action    *string `json:"action"`
+	Result    *string `json:"result"`
+}
+
+func (s starSegments) field(part string) *string {
+	switch part {
+	case session_model.StarSituation:
+		return s.Situation
+	case session_model.StarTask:
+		return s.Task
+	case session_model.StarAction:
+		return s.Action
+	case session_model.StarResult:
+		return s.Result
+	}
+	return nil
+}
+
+func (s starSegments) text(part string) string {
+	if text := s.field(part); text != nil {
+		return strings.TrimSpace(*text)
+	}
+	return ""
+}
+
+func starRequest(model string, turn session_model.SessionTurn) ai_model.ChatRequest {
+	prompt := "You split a candidate's answer to a behavioural interview question into the STAR method's components: " +
+		"situation (the context), task (what the candidate was responsible for), action (what the candidate did) and result (the outcome). " +
+		"Quote each component word for word from the answer, joining non-adjacent sentences with a space, and use an empty string for a component the answer does not cover. " +
+		"Do not judge or rewrite the answer.\n\nReply with only a JSON object of this shape:\n" +
+		`{"situation": "<quote>", "task": "<quote>", "action": "<quote>", "result": "<quote>"}`
+	temperature := float32(0)
+	return ai_model.ChatRequest{
+		Model:        model,
+		SystemPrompt: prompt,
+		Temperature:  &temperature,
+		MaxTokens:    JudgeMaxTokens,
+		JSONOutput:   true,
+		Messages: []ai_model.MessageRequest{{
+			Role:    "user",
+			Content: fmt.Sprintf("Question: %s\nCandidate's answer: %s", turn.Question, turn.Answer),
+		}},
+	}
+}
+
+// parseStarSegments extracts the analyser's JSON from text and checks every component
+// is present and quoted from answer. It returns what was wrong with it, if anything.
+func parseStarSegments(text string, answer string) (starSegments, []string) {
+	var segments starSegments
+	if err := json.Unmarshal([]byte(extractJSONObject(text)), &segments); err != nil {
+		return starSegments{}, []string{fmt.Sprintf("the reply is not a valid JSON object (%v)", err)}
+	}
+	var problems []string
+	quoted := normalizeWords(answer)
+	for _, part := range session_model.StarParts {
+		quote := segments.field(part)
+		if quote == nil {
+			problems = append(problems, fmt.Sprintf("%q is missing, use \"\" if the answer does not cover it", part))
+			continue
+		}
+		for _, sentence := range splitQuote(*quote) {
+			if !strings.Contains(quoted, sentence) {
+				problems = append(problems, fmt.Sprintf("%q is not quoted word for word from the answer", part))
+				break
+			}
+		}
+	}
+	return segments, problems
+}
+
+// splitQuote normalises a quote into the sentences it joins, since the analyser may put
+// together sentences that are not next to each other in the answer.
+func splitQuote(quote string) []string {
+	var sentences []string
+	for _, sentence := range strings.FieldsFunc(quote, func(r rune) bool {
+		return r == '.' || r == '!' || r == '?' || r == ';' || r == '\n'
+	}) {
+		if sentence = normalizeWords(sentence); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+// normalizeWords lower-cases text and reduces it to its words separated by single
+// spaces, so quotes match regardless of punctuation.
+func normalizeWords(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}), " ")
+}
+
+// analyseStar builds the analysis of answer from its segments: each component with its
+// length, a flag for every missing or weak component and the tips that go with them.
+func analyseStar(answer string, segments starSegments) session_model.StarAnalysis {
+	analysis := session_model.StarAnalysis{Complete: true, Flags: []session_model.StarFlag{}, Tips: []string{}}
+	words := make(map[string]int)
+	for _, part := range session_model.StarParts {
+		text := segments.text(part)
+		words[part] = len(strings.Fields(normalizeWords(text)))
+		analysis.Components = append(analysis.Components, session_model.StarComponent{Part: part, Text: text, Words: words[part]})
+	}
+	flag := func(part, issue, message, tip string) {
+		analysis.Flags = append(analysis.Flags, session_model.StarFlag{Part: part, Issue: issue, Message: message})
+		analysis.Tips = append(analysis.Tips, starTips[tip])
+	}
+
+	total := len(strings.Fields(normalizeWords(answer)))
+	for _, part := range session_model.StarParts {
+		text := segments.text(part)
+		if words[part] == 0 {
+			analysis.Complete = false
+			flag(part, session_model.StarIssueMissing, fmt.Sprintf("The answer has no %s.", part), part)
+			continue
+		}
+		switch part {
+		case session_model.StarSituation:
+			if total >= StarMinWords && float64(words[part]) > StarMaxSituationShare*float64(total) {
+				flag(part, session_model.StarIssueWeak, fmt.Sprintf("The situation takes up %d%% of the answer.", words[part]*100/total), "long-situation")
+			}
+		case session_model.StarAction:
+			mine := len(firstPersonPattern.FindAllString(text, -1))
+			ours := len(collectivePattern.FindAllString(text, -1))
+			if ours > mine {
+				flag(part, session_model.StarIssueWeak, "The action says what \"we\" did more often than what \"I\" did.", "team-action")
+			}
+			if total >= StarMinWords && words[part] < words[session_model.StarSituation] {
+				flag(part, session_model.StarIssueWeak, "The action is shorter than the situation.", "short-action")
+			}
+		case session_model.StarResult:
+			if !measurablePattern.MatchString(text) {
+				flag(part, session_model.StarIssueWeak, "The result has nothing measurable in it.", "unmeasured-result")
+			}
+		}
+	}
+	return analysis
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	session_model "up-it-aps-api/app/models/session"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestParseStarSegments(t *testing.T) {
+	answer := "Last year our intake team had a six week backlog. I was asked to clear it. I triaged the queue, I wrote a checklist and I trained two new staff. The backlog fell to five days!"
+	tests := []struct {
+		name     string
+		answer   string
+		text     string
+		problems []string
+	}{
+		{
+			name:   "quoted with different punctuation and case",
+			answer: answer,
+			text:   `{"situation": "Last year our intake team had a six-week backlog", "task": "I was asked to clear it.", "action": "I triaged the queue. I trained two new staff.", "result": "the backlog fell to five days"}`,
+		},
+		{
+			name:   "unpunctuated transcript",
+			answer: "so last year our intake team had a six week backlog and i was asked to clear it so i triaged the queue",
+			text:   `{"situation": "Last year our intake team had a six week backlog", "task": "I was asked to clear it", "action": "I triaged the queue", "result": ""}`,
+		},
+		{
+			name:     "not json",
+			answer:   answer,
+			text:     "Situation: a backlog.",
+			problems: []string{"the reply is not a valid JSON object"},
+		},
+		{
+			name:   "missing and paraphrased",
+			answer: answer,
+			text:   `{"situation": "Last year our intake team had a six week backlog.", "action": "I improved the process.", "result": "The backlog fell to five days."}`,
+			problems: []string{
+				`"task" is missing`,
+				`"action" is not quoted word for word from the answer`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problems := parseStarSegments(tt.text, tt.answer)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("parseStarSegments() problems = %q, want %q", problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyseStar(t *testing.T) {
+	segment := func(text string) *string { return &text }
+	situation := "Last year our intake team had a six week backlog."
+	tests := []struct {
+		name     string
+		answer   string
+		segments starSegments
+		flags    []string
+		complete bool
+	}{
+		{
+			name:   "complete and measured",
+			answer: "Last year our intake team had a six week backlog. I was asked to clear it. I triaged the queue, wrote a checklist and trained two new staff. The backlog fell to five days.",
+			segments: starSegments{
+				Situation: segment(situation),
+				Task:      segment("I was asked to clear it."),
+				Action:    segment("I triaged the queue, wrote a checklist and trained two new staff."),
+				Result:    segment("The backlog fell to five days."),
+			},
+			flags:    []string{},
+			complete: true,
+		},
+		{
+			name:   "no task and an unmeasured result",
+			answer: "Last year our intake team had a six week backlog. I triaged the queue, wrote a checklist and trained the new staff. Everyone was much happier.",
+			segments: starSegments{
+				Situation: segment(situation),
+				Task:      segment(""),
+				Action:    segment("I triaged the queue, wrote a checklist and trained the new staff."),
+				Result:    segment("Everyone was much happier."),
+			},
+			flags: []string{"task:missing", "result:weak"},
+		},
+		{
+			name:   "team action shorter than a long situation",
+			answer: "We had a six week backlog because two people left, the case system was slow, the policy changed twice, the minister's office kept asking for briefs and nobody owned the queue. I had to fix it. We hired staff. It took 5 days.",
+			segments: starSegments{
+				Situation: segment("We had a six week backlog because two people left, the case system was slow, the policy changed twice, the minister's office kept asking for briefs and nobody owned the queue."),
+				Task:      segment("I had to fix it."),
+				Action:    segment("We hired staff."),
+				Result:    segment("It took 5 days."),
+			},
+			flags:    []string{"situation:weak", "action:weak", "action:weak"},
+			complete: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := analyseStar(tt.answer, tt.segments)
+			flags := []string{}
+			for _, flag := range analysis.Flags {
+				flags = append(flags, flag.Part+":"+flag.Issue)
+			}
+			if strings.Join(flags, ",") != strings.Join(tt.flags, ",") {
+				t.Errorf("flags = %v, want %v", flags, tt.flags)
+			}
+			if len(analysis.Tips) != len(analysis.Flags) {
+				t.Errorf("%d tips for %d flags", len(analysis.Tips), len(analysis.Flags))
+			}
+			if analysis.Complete != tt.complete {
+				t.Errorf("Complete = %v, want %v", analysis.Complete, tt.complete)
+			}
+			if len(analysis.Components) != 4 || analysis.Components[0].Part != session_model.StarSituation {
+				t.Errorf("Components = %+v, want the four parts in STAR order", analysis.Components)
+			}
+		})
+	}
+}
+
+func TestScoringService_AnalyseTurnAgainstFakeJudge(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{Type: session_model.TypeBehavioral, TargetRole: "APS EL1"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Tell me about a time you led change."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	// a Vertex AI transcript comes back without punctuation
+	if _, err := s.Sessions().RecordAnswer(interview.ID, "our team was moving to a new case system i was asked to lead the rollout i ran the training sessions myself and it went well"); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	if _, err := s.Scoring().GetStarAnalysis(interview.ID, email, 1); !errors.Is(err, ErrTurnNotAnalysedYet) {
+		t.Errorf("GetStarAnalysis() before analysing error = %v, want ErrTurnNotAnalysedYet", err)
+	}
+
+	fake.Script(fakeproviders.RouteOpenAiChat,
+		fakeproviders.Response{Text: `{"situation": "We were moving to a new case system.", "task": "", "action": "", "result": ""}`},
+		fakeproviders.Response{Text: `{"situation": "Our team was moving to a new case system.", "task": "I was asked to lead the rollout.", "action": "I ran the training sessions myself.", "result": "It went well."}`},
+	)
+	analysis, err := s.Scoring().AnalyseTurn(context.Background(), interview.ID, email, 1)
+	if err != nil {
+		t.Fatalf("AnalyseTurn() failed: %v", err)
+	}
+	if !analysis.Complete || len(analysis.Flags) != 1 || analysis.Flags[0].Part != session_model.StarResult {
+		t.Errorf("AnalyseTurn() = complete %v, flags %+v, want only a weak result", analysis.Complete, analysis.Flags)
+	}
+	if last := string(fake.LastRequest(fakeproviders.RouteOpenAiChat)); !strings.Contains(last, "not quoted word for word") {
+		t.Errorf("repair request does not name the misquote: %s", last)
+	}
+
+	fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: `{"situation": "Our team was moving to a new case system.", "task": "", "action": "I ran the training sessions myself.", "result": ""}`})
+	if _, err := s.Scoring().AnalyseTurn(context.Background(), interview.ID, email, 1); err != nil {
+		t.Fatalf("AnalyseTurn() again failed: %v", err)
+	}
+	interview, err = s.Sessions().GetSession(interview.ID, email)
+	if err != nil {
+		t.Fatalf("GetSession() failed: %v", err)
+	}
+	if star := interview.Turns[0].Star; star == nil || star.Complete || len(star.Flags) != 2 {
+		t.Errorf("turn Star = %+v, want the second analysis with two missing parts", star)
+	}
+
+	technical, err := s.Sessions().StartSession("other@example.com", &session_model.InputSession{Type: session_model.TypeTechnical, TargetRole: "APS6"})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(technical.ID, "Ready.", "Reverse a linked list."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := s.Sessions().RecordAnswer(technical.ID, "I would walk the list swapping pointers."); err != nil {
+		t.Fatalf("RecordAnswer() failed: %v", err)
+	}
+	if _, err := s.Scoring().AnalyseTurn(context.Background(), technical.ID, "other@example.com", 1); !errors.Is(err, ErrStarSessionType) {
+		t.Errorf("AnalyseTurn() on a technical session error = %v, want ErrStarSessionType", err)
+	}
+}
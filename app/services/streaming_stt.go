@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// Defaults for cutting streamed speech into segments.
+const (
+	DefaultStreamSampleRate = 16000
+	// DefaultSilenceThreshold is the loudness, as RMS out of 32768, below which audio
+	// counts as silence.
+	DefaultSilenceThreshold = 500
+	DefaultSilenceDuration  = 700 * time.Millisecond
+	DefaultMaxSegment       = 15 * time.Second
+	DefaultPartialInterval  = 2 * time.Second
+	MinStreamSampleRate     = 8000
+	MaxStreamSampleRate     = 48000
+	// speechWindow is how much audio is judged loud or silent at a time.
+	speechWindow = 20 * time.Millisecond
+	// preRoll is the silence kept before speech, so its first syllable is not clipped.
+	preRoll = 200 * time.Millisecond
+)
+
+// StreamSettings tune how streamed speech is cut into segments. Zero values use the
+// defaults.
+type StreamSettings struct {
+	SampleRate       int
+	SilenceThreshold float64
+	// SilenceDuration is the pause that ends a segment.
+	SilenceDuration time.Duration
+	// MaxSegment ends a segment even without a pause.
+	MaxSegment time.Duration
+	// PartialInterval is how much new speech there is between partial transcripts.
+	PartialInterval time.Duration
+}
+
+func (settings StreamSettings) withDefaults() StreamSettings {
+	if settings.SampleRate <= 0 {
+		settings.SampleRate = DefaultStreamSampleRate
+	}
+	if settings.SilenceThreshold <= 0 {
+		settings.SilenceThreshold = DefaultSilenceThreshold
+	}
+	if settings.SilenceDuration <= 0 {
+		settings.SilenceDuration = DefaultSilenceDuration
+	}
+	if settings.MaxSegment <= 0 {
+		settings.MaxSegment = DefaultMaxSegment
+	}
+	if settings.PartialInterval <= 0 {
+		settings.PartialInterval = DefaultPartialInterval
+	}
+	return settings
+}
+
+// speechSegment is the audio of a segment so far, or all of it once final. index
+// counts from 1 and start is how far into the stream its audio begins.
+type speechSegment struct {
+	index int
+	final bool
+	start time.Duration
+	pcm   []byte
+}
+
+// silenceSegmenter cuts a stream of 16-bit little-endian mono PCM into segments of
+// speech at pauses, dropping the silence between them.
+type silenceSegmenter struct {
+	settings     StreamSettings
+	windowBytes  int
+	pending      []byte
+	current      []byte
+	position     int
+	start        int
+	voiced       bool
+	silence      int
+	sincePartial int
+	index        int
+}
+
+func newSilenceSegmenter(settings StreamSettings) *silenceSegmenter {
+	s := &silenceSegmenter{settings: settings.withDefaults()}
+	s.windowBytes = s.bytes(speechWindow)
+	return s
+}
+
+// bytes is the length of d of audio.
+func (s *silenceSegmenter) bytes(d time.Duration) int {
+	return int(d.Seconds()*float64(s.settings.SampleRate)) * 2
+}
+
+// Write adds audio and returns the segments it ends, plus a partial of the segment
+// still being spoken whenever PartialInterval more of it has arrived.
+func (s *silenceSegmenter) Write(pcm []byte) []speechSegment {
+	s.pending = append(s.pending, pcm...)
+	var segments []speechSegment
+	for len(s.pending) >= s.windowBytes {
+		window := s.pending[:s.windowBytes]
+		s.pending = s.pending[s.windowBytes:]
+		s.position += len(window)
+		loud := rms(window) >= s.settings.SilenceThreshold
+		s.current = append(s.current, window...)
+		if !s.voiced && !loud {
+			if keep := s.bytes(preRoll); len(s.current) > keep {
+				s.current = s.current[len(s.current)-keep:]
+			}
+			continue
+		}
+		if !s.voiced {
+			s.voiced = true
+			s.index++
+			s.start = s.position - len(s.current)
+		}
+		s.sincePartial += len(window)
+		if loud {
+			s.silence = 0
+		} else {
+			s.silence += len(window)
+		}
+		switch {
+		case s.silence >= s.bytes(s.settings.SilenceDuration) || len(s.current) >= s.bytes(s.settings.MaxSegment):
+			segments = append(segments, s.cut())
+		case s.sincePartial >= s.bytes(s.settings.PartialInterval):
+			s.sincePartial = 0
+			segments = append(segments, speechSegment{index: s.index, start: s.offset(), pcm: append([]byte(nil), s.current...)})
+		}
+	}
+	return segments
+}
+
+// Flush ends the segment being spoken, if there is one.
+func (s *silenceSegmenter) Flush() []speechSegment {
+	if !s.voiced {
+		return nil
+	}
+	s.current = append(s.current, s.pending[:len(s.pending)/2*2]...)
+	s.pending = nil
+	return []speechSegment{s.cut()}
+}
+
+func (s *silenceSegmenter) cut() speechSegment {
+	segment := speechSegment{index: s.index, final: true, start: s.offset(), pcm: s.current}
+	s.current = nil
+	s.voiced = false
+	s.silence = 0
+	s.sincePartial = 0
+	return segment
+}
+
+// offset is when the current segment's audio begins.
+func (s *silenceSegmenter) offset() time.Duration {
+	return time.Duration(float64(s.start/2) / float64(s.settings.SampleRate) * float64(time.Second))
+}
+
+// rms is the loudness of 16-bit samples.
+func rms(pcm []byte) float64 {
+	samples := len(pcm) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(samples))
+}
+
+// wavFile wraps 16-bit mono PCM in a WAV header, which every STT provider accepts.
+func wavFile(pcm []byte, sampleRate int) []byte {
+	wav := make([]byte, 0, 44+len(pcm))
+	wav = append(wav, "RIFF"...)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(36+len(pcm)))
+	wav = append(wav, "WAVEfmt "...)
+	wav = binary.LittleEndian.AppendUint32(wav, 16)
+	wav = binary.LittleEndian.AppendUint16(wav, 1) // PCM
+	wav = binary.LittleEndian.AppendUint16(wav, 1) // mono
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(sampleRate))
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(sampleRate*2))
+	wav = binary.LittleEndian.AppendUint16(wav, 2)
+	wav = binary.LittleEndian.AppendUint16(wav, 16)
+	wav = append(wav, "data"...)
+	wav = binary.LittleEndian.AppendUint32(wav, uint32(len(pcm)))
+	return append(wav, pcm...)
+}
+
+// StreamTranscription transcribes 16-bit little-endian mono PCM as it arrives on frames.
+// The speech is cut into segments at pauses and each segment is transcribed on its own,
+// in order, with the user's STT model. While a segment is being spoken a partial
+// transcript of it is emitted every PartialInterval, unless the provider is still busy,
+// and once a pause ends it its final transcript is emitted. A segment that cannot be
+// transcribed is reported in an error event and left out. Once frames is closed the last
+// segment is finished and the final transcripts are merged into the returned
+// transcription, whose delivery is worked out across all the segments so the pauses
+// between them count. An emit error or ctx ending stops the stream and is returned.
+func (s *AiService) StreamTranscription(ctx context.Context, model string, settings StreamSettings, frames <-chan []byte, emit func(event ai_model.TranscriptEvent) error) (*ai_model.Transcription, error) {
+	settings = settings.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	encoding := AudioEncoding{Name: "LINEAR16", SampleRate: settings.SampleRate}
+
+	finals := make(chan speechSegment, 64)
+	// partials holds the newest partial only, stale ones are never transcribed
+	partials := make(chan speechSegment, 1)
+	type result struct {
+		transcription *ai_model.Transcription
+		err           error
+	}
+	done := make(chan result, 1)
+	go func() {
+		merged := &ai_model.Transcription{}
+		var texts []string
+		timing := ai_model.TimingWords
+		finished := 0
+		for {
+			var segment speechSegment
+			var ok bool
+			// finals go first, a partial only when no final is waiting
+			select {
+			case segment, ok = <-finals:
+			default:
+				select {
+				case segment, ok = <-finals:
+				case segment, ok = <-partials:
+				case <-ctx.Done():
+					done <- result{err: ctx.Err()}
+					return
+				}
+			}
+			if !ok {
+				merged.Text = strings.Join(texts, " ")
+				merged.Segments = finished
+				merged.Delivery = AnalyseDelivery(merged.Words, timing)
+				done <- result{transcription: merged}
+				return
+			}
+			if !segment.final && segment.index <= finished {
+				continue
+			}
+			transcription, err := s.transcribe(ctx, model, wavFile(segment.pcm, settings.SampleRate), encoding)
+			if ctx.Err() != nil {
+				done <- result{err: ctx.Err()}
+				return
+			}
+			text := ""
+			if err == nil {
+				text = strings.TrimSpace(transcription.Text)
+			}
+			var event ai_model.TranscriptEvent
+			switch {
+			case !segment.final:
+				// a failed or empty partial is not worth showing
+				if text == "" {
+					continue
+				}
+				event = ai_model.TranscriptEvent{Type: ai_model.TranscriptPartial, Segment: segment.index, Text: text, AudioSeconds: transcription.AudioSeconds}
+			case err != nil:
+				finished = segment.index
+				event = ai_model.TranscriptEvent{Type: ai_model.TranscriptError, Segment: segment.index, Message: err.Error()}
+			default:
+				finished = segment.index
+				if text != "" {
+					texts = append(texts, text)
+				}
+				merged.Provider = transcription.Provider
+				merged.AudioSeconds += transcription.AudioSeconds
+				merged.FailedOver = append(merged.FailedOver, transcription.FailedOver...)
+				for _, word := range transcription.Words {
+					word.Start += segment.start.Seconds()
+					word.End += segment.start.Seconds()
+					merged.Words = append(merged.Words, word)
+				}
+				if transcription.Delivery != nil && transcription.Delivery.Timing == ai_model.TimingSegments {
+					timing = ai_model.TimingSegments
+				}
+				event = ai_model.TranscriptEvent{Type: ai_model.TranscriptFinal, Segment: segment.index, Text: text, AudioSeconds: transcription.AudioSeconds}
+			}
+			if err := emit(event); err != nil {
+				cancel()
+				done <- result{err: err}
+				return
+			}
+		}
+	}()
+
+	segmenter := newSilenceSegmenter(settings)
+	send := func(segments []speechSegment) bool {
+		for _, segment := range segments {
+			if !segment.final {
+				select {
+				case <-partials:
+				default:
+				}
+				partials <- segment
+				continue
+			}
+			select {
+			case finals <- segment:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+	for open := true; open; {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				open = false
+				if send(segmenter.Flush()) {
+					close(finals)
+				}
+				break
+			}
+			if !send(segmenter.Write(frame)) {
+				open = false
+			}
+		case <-ctx.Done():
+			open = false
+		}
+	}
+	r := <-done
+	return r.transcription, r.err
+}
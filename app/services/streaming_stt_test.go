@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+// pcm is d of 16 kHz audio, a square wave when loud and silence otherwise.
+func pcm(d time.Duration, loud bool) []byte {
+	samples := int(d.Seconds() * DefaultStreamSampleRate)
+	audio := make([]byte, 0, samples*2)
+	for i := 0; i < samples; i++ {
+		var sample int16
+		if loud {
+			sample = 3000
+			if i/20%2 == 0 {
+				sample = -3000
+			}
+		}
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(sample))
+	}
+	return audio
+}
+
+func TestSilenceSegmenter(t *testing.T) {
+	segmenter := newSilenceSegmenter(StreamSettings{SilenceDuration: 500 * time.Millisecond, PartialInterval: time.Second})
+	var audio []byte
+	audio = append(audio, pcm(300*time.Millisecond, false)...)
+	audio = append(audio, pcm(1500*time.Millisecond, true)...)
+	audio = append(audio, pcm(600*time.Millisecond, false)...)
+	audio = append(audio, pcm(400*time.Millisecond, true)...)
+
+	var segments []speechSegment
+	// frames do not line up with samples or windows
+	for len(audio) > 0 {
+		n := 999
+		if n > len(audio) {
+			n = len(audio)
+		}
+		segments = append(segments, segmenter.Write(audio[:n])...)
+		audio = audio[n:]
+	}
+	segments = append(segments, segmenter.Flush()...)
+
+	// 200ms of silence before the speech, and the pause that ended it
+	want := []struct {
+		index int
+		final bool
+		start time.Duration
+		bytes int
+	}{
+		{index: 1, start: 100 * time.Millisecond, bytes: 6400 + 32000},
+		{index: 1, final: true, start: 100 * time.Millisecond, bytes: 6400 + 48000 + 16000},
+		{index: 2, final: true, start: 2300 * time.Millisecond, bytes: 3200 + 12800},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(segments), len(want))
+	}
+	for i, w := range want {
+		if got := segments[i]; got.index != w.index || got.final != w.final || got.start != w.start || len(got.pcm) != w.bytes {
+			t.Errorf("segment %d = index %d, final %v, start %v, %d bytes; want %+v", i, got.index, got.final, got.start, len(got.pcm), w)
+		}
+	}
+}
+
+func TestAiService_StreamTranscription(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	frames := make(chan []byte)
+	events := make(chan ai_model.TranscriptEvent, 16)
+	type result struct {
+		transcription *ai_model.Transcription
+		err           error
+	}
+	done := make(chan result, 1)
+	go func() {
+		transcription, err := s.StreamTranscription(context.Background(), "vertex", StreamSettings{PartialInterval: time.Second}, frames, func(event ai_model.TranscriptEvent) error {
+			events <- event
+			return nil
+		})
+		done <- result{transcription, err}
+	}()
+	next := func() ai_model.TranscriptEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return ai_model.TranscriptEvent{}
+	}
+
+	frames <- pcm(1200*time.Millisecond, true)
+	if event := next(); event.Type != ai_model.TranscriptPartial || event.Segment != 1 || event.Text != fakeproviders.DefaultTranscript {
+		t.Errorf("first event = %+v, want a partial of segment 1", event)
+	}
+	var config struct {
+		Config struct {
+			Encoding        string `json:"encoding"`
+			SampleRateHertz int    `json:"sampleRateHertz"`
+		} `json:"config"`
+	}
+	json.Unmarshal(fake.LastRequest(fakeproviders.RouteGoogleStt), &config)
+	if config.Config.Encoding != "LINEAR16" || config.Config.SampleRateHertz != DefaultStreamSampleRate {
+		t.Errorf("STT request config = %+v, want 16 kHz LINEAR16", config.Config)
+	}
+
+	fake.Script(fakeproviders.RouteGoogleStt, fakeproviders.Response{Text: "Tell me more."})
+	frames <- pcm(time.Second, false)
+	if event := next(); event.Type != ai_model.TranscriptFinal || event.Segment != 1 || event.Text != "Tell me more." {
+		t.Errorf("second event = %+v, want segment 1 final", event)
+	}
+	frames <- pcm(300*time.Millisecond, true)
+	close(frames)
+	if event := next(); event.Type != ai_model.TranscriptFinal || event.Segment != 2 {
+		t.Errorf("third event = %+v, want segment 2 final", event)
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("StreamTranscription() failed: %v", r.err)
+	}
+	if r.transcription.Text != "Tell me more. "+fakeproviders.DefaultTranscript || r.transcription.Segments != 2 || r.transcription.Provider != "vertex" {
+		t.Errorf("StreamTranscription() = %+v, want both segments merged", r.transcription)
+	}
+	// the second segment's words start 2 seconds in, after the pause
+	if delivery := r.transcription.Delivery; delivery == nil || delivery.Words != 17 || delivery.SpeakingSeconds != 7.6 {
+		t.Errorf("StreamTranscription() delivery = %+v, want 17 words over 7.6 seconds", delivery)
+	}
+}
+
+func TestAiService_StreamTranscriptionStops(t *testing.T) {
+	s, _ := newFakeProviderService(t)
+	frames := make(chan []byte, 4)
+	frames <- pcm(300*time.Millisecond, true)
+	frames <- pcm(time.Second, false)
+	frames <- pcm(300*time.Millisecond, true)
+	frames <- pcm(time.Second, false)
+	gone := errors.New("client disconnected")
+	calls := 0
+	_, err := s.StreamTranscription(context.Background(), "whisper-1", StreamSettings{}, frames, func(event ai_model.TranscriptEvent) error {
+		calls++
+		return gone
+	})
+	if !errors.Is(err, gone) || calls != 1 {
+		t.Errorf("StreamTranscription() = %v after %d events, want it to stop at the emit error", err, calls)
+	}
+}
+
+func TestWavFile(t *testing.T) {
+	wav := wavFile(pcm(10*time.Millisecond, true), 16000)
+	if len(wav) != 44+320 || !bytes.HasPrefix(wav, []byte("RIFF")) || string(wav[8:16]) != "WAVEfmt " || binary.LittleEndian.Uint32(wav[24:]) != 16000 {
+		t.Errorf("wavFile() header = %q", wav[:44])
+	}
+}
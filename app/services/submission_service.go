@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	question_model "up-it-aps-api/app/models/question"
+	submission_model "up-it-aps-api/app/models/submission"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/sandbox"
+	"up-it-aps-api/platform/database"
+)
+
+// MaxCodeBytes is the largest program a candidate may submit.
+const MaxCodeBytes = 64 * 1024
+
+var (
+	ErrNotCodingQuestion  = errors.New("the turn is not a coding question")
+	ErrInvalidSubmission  = errors.New("invalid submission")
+	ErrSandboxUnavailable = errors.New("code execution is not available")
+)
+
+// SubmissionService runs the code candidates submit to coding questions against the
+// question's test cases and keeps the results for the judge.
+type SubmissionService struct {
+	sessionService  *SessionService
+	questionService *QuestionService
+	runner          *sandbox.Runner
+}
+
+func NewSubmissionService(sessionService *SessionService, questionService *QuestionService, settings config.SandboxConfig) *SubmissionService {
+	return &SubmissionService{
+		sessionService:  sessionService,
+		questionService: questionService,
+		runner:          newSandboxRunner(settings),
+	}
+}
+
+func newSandboxRunner(settings config.SandboxConfig) *sandbox.Runner {
+	return sandbox.New(sandbox.Settings{
+		TimeLimit:        settings.TimeLimit,
+		CompileTimeLimit: settings.CompileTimeLimit,
+		MemoryMB:         settings.MemoryMB,
+		MaxOutputBytes:   settings.MaxOutputBytes,
+		MaxConcurrent:    settings.MaxConcurrent,
+		MaxProcesses:     settings.MaxProcesses,
+		AllowNetwork:     settings.AllowNetwork,
+		GoBinary:         settings.GoBinary,
+		PythonBinary:     settings.PythonBinary,
+		GoCache:          settings.GoCache,
+	})
+}
+
+// Submit compiles the code and runs it once per test case of the turn's question. A
+// submission that does not compile is stored too, so the candidate and the judge can see
+// why. The first submission answers the turn if the candidate has not answered it yet.
+func (s *SubmissionService) Submit(ctx context.Context, sessionID uint, email string, turnNumber int, input *submission_model.InputSubmission) (submission_model.CodeSubmission, error) {
+	input.Language = strings.ToLower(strings.TrimSpace(input.Language))
+	if err := validateSubmission(input); err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+	interview, err := s.sessionService.ActiveSession(sessionID, email)
+	if err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+	turn, err := s.sessionService.GetTurn(interview.ID, turnNumber)
+	if err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+	if turn.QuestionID == 0 {
+		return submission_model.CodeSubmission{}, ErrNotCodingQuestion
+	}
+	question, err := s.questionService.GetQuestion(turn.QuestionID)
+	if err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+	if question.Type != question_model.TypeCoding {
+		return submission_model.CodeSubmission{}, ErrNotCodingQuestion
+	}
+
+	submission := submission_model.CodeSubmission{
+		SessionID:  interview.ID,
+		TurnID:     turn.ID,
+		TurnNumber: turn.Number,
+		QuestionID: question.ID,
+		Language:   input.Language,
+		Code:       input.Code,
+		Total:      len(question.TestCases),
+		Results:    []submission_model.TestResult{},
+	}
+	if err := s.run(ctx, &submission, question.TestCases); err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+
+	var db = database.DBConn
+	if err := db.Create(&submission).Error; err != nil {
+		return submission_model.CodeSubmission{}, err
+	}
+	if turn.AnsweredAt == nil {
+		if err := answerTurn(db, &turn, input.Code, time.Now()); err != nil {
+			return submission_model.CodeSubmission{}, err
+		}
+	}
+	return submission, nil
+}
+
+// run compiles the submission and fills in its status and test results.
+func (s *SubmissionService) run(ctx context.Context, submission *submission_model.CodeSubmission, tests []question_model.TestCase) error {
+	program, err := s.runner.Prepare(ctx, submission.Language, submission.Code)
+	var compileErr *sandbox.CompileError
+	switch {
+	case errors.As(err, &compileErr):
+		submission.Status, submission.CompileOutput = submission_model.StatusCompileError, compileErr.Output
+		return nil
+	case errors.Is(err, sandbox.ErrIsolationUnavailable):
+		return fmt.Errorf("%w: %v", ErrSandboxUnavailable, err)
+	case err != nil:
+		return err
+	}
+	defer program.Close()
+
+	for i, test := range tests {
+		result, err := program.Run(ctx, test.Input)
+		if err != nil {
+			return err
+		}
+		// a hidden test only says whether it passed; anything more, even an exit code,
+		// lets a submission read the input out one run at a time
+		testResult := submission_model.TestResult{
+			Number: i + 1,
+			Hidden: test.Hidden,
+			Status: testStatus(result, test.ExpectedOutput),
+		}
+		if !test.Hidden {
+			testResult.Input, testResult.Expected = test.Input, test.ExpectedOutput
+			testResult.Stdout, testResult.Stderr = result.Stdout, result.Stderr
+			testResult.ExitCode, testResult.RuntimeMs, testResult.Truncated = result.ExitCode, result.Runtime.Milliseconds(), result.Truncated
+		}
+		if testResult.Status == submission_model.TestPassed {
+			submission.Passed++
+		}
+		submission.Results = append(submission.Results, testResult)
+	}
+	submission.Status = submission_model.StatusFailed
+	if submission.Passed == submission.Total {
+		submission.Status = submission_model.StatusAccepted
+	}
+	return nil
+}
+
+// GetSubmissions returns every submission for the turn, newest first.
+func (s *SubmissionService) GetSubmissions(sessionID uint, email string, turnNumber int) ([]submission_model.CodeSubmission, error) {
+	interview, err := s.sessionService.GetSession(sessionID, email)
+	if err != nil {
+		return nil, err
+	}
+	var db = database.DBConn
+	var submissions []submission_model.CodeSubmission
+	result := db.Where("session_id = ? AND turn_number = ?", interview.ID, turnNumber).Order("id DESC").Find(&submissions)
+	return submissions, result.Error
+}
+
+func testStatus(result sandbox.Result, expected string) string {
+	switch {
+	case result.TimedOut:
+		return submission_model.TestTimeout
+	case result.ExitCode != 0:
+		return submission_model.TestRuntimeError
+	case normalizeOutput(result.Stdout) != normalizeOutput(expected):
+		return submission_model.TestFailed
+	}
+	return submission_model.TestPassed
+}
+
+// normalizeOutput ignores trailing whitespace on each line and trailing blank lines, and
+// Windows line endings.
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func validateSubmission(input *submission_model.InputSubmission) error {
+	supported := false
+	for _, language := range sandbox.Languages {
+		supported = supported || input.Language == language
+	}
+	if !supported {
+		return fmt.Errorf("%w: language must be one of %s", ErrInvalidSubmission, strings.Join(sandbox.Languages, ", "))
+	}
+	if strings.TrimSpace(input.Code) == "" {
+		return fmt.Errorf("%w: code is required", ErrInvalidSubmission)
+	}
+	if len(input.Code) > MaxCodeBytes {
+		return fmt.Errorf("%w: code is longer than %d bytes", ErrInvalidSubmission, MaxCodeBytes)
+	}
+	return nil
+}
+
+// judgeOutputLimit is how much of a program's output the judge sees per test case.
+const judgeOutputLimit = 500
+
+// submissionEvidence describes the turn's latest submission for the judge, or returns
+// an empty string if there is none. Hidden test cases only say whether they passed.
+func submissionEvidence(turnID uint) (string, error) {
+	var db = database.DBConn
+	var submissions []submission_model.CodeSubmission
+	if err := db.Where("turn_id = ?", turnID).Order("id DESC").Limit(1).Find(&submissions).Error; err != nil {
+		return "", err
+	}
+	if len(submissions) == 0 {
+		return "", nil
+	}
+	submission := submissions[0]
+
+	var evidence strings.Builder
+	fmt.Fprintf(&evidence, "Submitted %s code:\n```\n%s\n```\n", submission.Language, submission.Code)
+	if submission.Status == submission_model.StatusCompileError {
+		fmt.Fprintf(&evidence, "It did not compile:\n%s\n", clip(submission.CompileOutput, judgeOutputLimit))
+		return evidence.String(), nil
+	}
+	fmt.Fprintf(&evidence, "It passed %d of %d test cases.\n", submission.Passed, submission.Total)
+	for _, result := range submission.Results {
+		if result.Hidden {
+			fmt.Fprintf(&evidence, "- hidden test %d: %s\n", result.Number, result.Status)
+			continue
+		}
+		fmt.Fprintf(&evidence, "- test %d: %s", result.Number, result.Status)
+		if result.Status != submission_model.TestPassed {
+			fmt.Fprintf(&evidence, "; input %q, expected %q, printed %q", clip(result.Input, judgeOutputLimit), clip(result.Expected, judgeOutputLimit), clip(result.Stdout, judgeOutputLimit))
+			if result.Stderr != "" {
+				fmt.Fprintf(&evidence, ", stderr %q", clip(result.Stderr, judgeOutputLimit))
+			}
+		}
+		evidence.WriteString("\n")
+	}
+	return evidence.String(), nil
+}
+
+func clip(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return text[:limit] + "..."
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+	question_model "up-it-aps-api/app/models/question"
+	session_model "up-it-aps-api/app/models/session"
+	submission_model "up-it-aps-api/app/models/submission"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		got, want string
+		same      bool
+	}{
+		{got: "3\n", want: "3", same: true},
+		{got: "1 2 \r\n3\n\n", want: "1 2\n3\n", same: true},
+		{got: "1 2\n", want: "1  2\n"},
+		{got: "\n3\n", want: "3\n"},
+	}
+	for _, tt := range tests {
+		if same := normalizeOutput(tt.got) == normalizeOutput(tt.want); same != tt.same {
+			t.Errorf("normalizeOutput(%q) == normalizeOutput(%q) is %v, want %v", tt.got, tt.want, same, tt.same)
+		}
+	}
+}
+
+func TestSubmissionService_SubmitAndScore(t *testing.T) {
+	// under root programs run as nobody, who may not reach a python in root's home
+	python := "/usr/bin/python3"
+	if _, err := os.Stat(python); err != nil {
+		python = "python3"
+	}
+	if _, err := exec.LookPath(python); err != nil {
+		t.Skipf("python3 unavailable: %v", err)
+	}
+	s, fake := newFakeProviderService(t)
+	if err := SeedDefaultRubrics(); err != nil {
+		t.Fatalf("SeedDefaultRubrics() failed: %v", err)
+	}
+	questions := NewQuestionService()
+	if _, err := questions.CreateQuestion(&question_model.InputQuestion{
+		Type:       question_model.TypeCoding,
+		Prompt:     "Print the sum of the numbers on stdin.",
+		Competency: "coding",
+		Difficulty: 1,
+		TestCases: []question_model.TestCase{
+			{Input: "1 2\n", ExpectedOutput: "3\n"},
+			{Input: "5 5\n", ExpectedOutput: "10\n"},
+			{Input: "100 -1\n", ExpectedOutput: "99\n", Hidden: true},
+		},
+	}); err != nil {
+		t.Fatalf("CreateQuestion() failed: %v", err)
+	}
+	submissions := NewSubmissionService(s.Sessions(), questions, config.SandboxConfig{TimeLimit: 2 * time.Second, PythonBinary: python})
+
+	email := "test@example.com"
+	interview, err := s.Sessions().StartSession(email, &session_model.InputSession{
+		Type:          session_model.TypeTechnical,
+		TargetRole:    "APS6 developer",
+		Questions:     &question_model.QuestionFilter{Type: question_model.TypeCoding},
+		QuestionCount: 1,
+	})
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if err := s.Sessions().RecordExchange(interview.ID, "Ready.", "Print the sum of the numbers on stdin."); err != nil {
+		t.Fatalf("RecordExchange() failed: %v", err)
+	}
+	if _, err := submissions.Submit(context.Background(), interview.ID, email, 1, &submission_model.InputSubmission{Language: "cobol", Code: "DISPLAY 3."}); !errors.Is(err, ErrInvalidSubmission) {
+		t.Errorf("Submit() in cobol error = %v, want ErrInvalidSubmission", err)
+	}
+
+	wrong, err := submissions.Submit(context.Background(), interview.ID, email, 1, &submission_model.InputSubmission{Language: " Python", Code: "print(3)\n"})
+	if errors.Is(err, ErrSandboxUnavailable) {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Submit() failed: %v", err)
+	}
+	if wrong.Status != submission_model.StatusFailed || wrong.Passed != 1 || wrong.Total != 3 {
+		t.Errorf("Submit() of a wrong solution = %+v, want 1 of 3 passed", wrong)
+	}
+	want := submission_model.TestResult{Number: 3, Hidden: true, Status: submission_model.TestFailed}
+	if hidden := wrong.Results[2]; hidden != want {
+		t.Errorf("hidden result = %+v, want only its number and status", hidden)
+	}
+	if turn, _ := s.Sessions().GetTurn(interview.ID, 1); turn.Answer != "print(3)\n" {
+		t.Errorf("turn answer = %q, want the first submission", turn.Answer)
+	}
+
+	right, err := submissions.Submit(context.Background(), interview.ID, email, 1, &submission_model.InputSubmission{
+		Language: "python",
+		Code:     "import sys\nprint(sum(int(x) for x in sys.stdin.read().split()))\n",
+	})
+	if err != nil || right.Status != submission_model.StatusAccepted || right.Passed != 3 {
+		t.Fatalf("Submit() of a right solution = %+v, %v, want accepted", right, err)
+	}
+	if history, _ := submissions.GetSubmissions(interview.ID, email, 1); len(history) != 2 || history[0].ID != right.ID {
+		t.Errorf("GetSubmissions() = %d submissions, want 2 with the latest first", len(history))
+	}
+
+	fake.Script(fakeproviders.RouteOpenAiChat, fakeproviders.Response{Text: `{"scores": [
+		{"criterion": "correctness", "score": 4, "justification": "Passes every test."},
+		{"criterion": "complexity", "score": 1, "justification": "Not discussed."},
+		{"criterion": "communication", "score": 2, "justification": "Code only."}
+	]}`})
+	if _, err := s.Scoring().ScoreTurn(context.Background(), interview.ID, email, 1, ""); err != nil {
+		t.Fatalf("ScoreTurn() failed: %v", err)
+	}
+	last := string(fake.LastRequest(fakeproviders.RouteOpenAiChat))
+	if !strings.Contains(last, "It passed 3 of 3 test cases") || !strings.Contains(last, "hidden test 3: passed") {
+		t.Errorf("judge request does not describe the latest submission: %s", last)
+	}
+	if strings.Contains(last, "100 -1") {
+		t.Errorf("judge request shows the hidden test input: %s", last)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/audiocache"
+	"up-it-aps-api/pkg/config"
+)
+
+// newAudioCache sizes the TTS cache from config. A disk tier that cannot be opened is
+// dropped rather than stopping the server.
+func newAudioCache(cfg config.TtsCacheConfig) *audiocache.Cache {
+	settings := audiocache.Settings{
+		MemoryBytes: int64(cfg.MemoryMB) << 20,
+		Dir:         cfg.Dir,
+		DiskBytes:   int64(cfg.DiskMB) << 20,
+		TTL:         cfg.TTL,
+	}
+	cache, err := audiocache.New(settings)
+	if err != nil {
+		log.Printf("opening the TTS cache in %s failed, caching in memory only: %v", cfg.Dir, err)
+		settings.Dir = ""
+		cache, _ = audiocache.New(settings)
+	}
+	return cache
+}
+
+// AudioCache exposes the TTS cache for the admin endpoint.
+func (s *AiService) AudioCache() *audiocache.Cache {
+	return s.audioCache
+}
+
+// audioCacheKey addresses the audio synthesizer makes for text with options, by
+// everything that changes how it sounds.
+func audioCacheKey(synthesizer SpeechSynthesizer, model string, options ai_model.VoiceOptions, text string) string {
+	catalog := synthesizer.Catalog()
+	voice := options.VoiceID
+	if voice == "" {
+		voice = catalog.DefaultVoice
+	}
+	pitch := 0.0
+	if catalog.Pitch {
+		pitch = options.Pitch
+	}
+	return audiocache.Key(
+		synthesizer.Name(),
+		model,
+		voice,
+		strconv.FormatFloat(speakingRate(options.SpeakingRate, MinSpeakingRate, MaxSpeakingRate), 'f', 2, 64),
+		strconv.FormatFloat(pitch, 'f', 1, 64),
+		catalogFormat(catalog, options.Format),
+		normalizeSpeechText(text),
+	)
+}
+
+// normalizeSpeechText collapses whitespace, which does not change what is said.
+func normalizeSpeechText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	ai_model "up-it-aps-api/app/models/ai"
+	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func TestAiService_GenerateChunkedAudioCache(t *testing.T) {
+	s, fake := newFakeProviderService(t)
+	s.audioCache = newAudioCache(config.TtsCacheConfig{MemoryMB: 1, Dir: t.TempDir()})
+	email := "test@example.com"
+	chunks := [][]byte{[]byte("Thanks, let's move on."), []byte("Tell me about a time you led a team.")}
+	speak := func(voice ai_model.VoiceOptions, chunks [][]byte) {
+		t.Helper()
+		var audio [][]byte
+		failures, err := s.GenerateChunkedAudio(context.Background(), "tts-1", voice, chunks, email, func(index int, chunk []byte, outcome FailoverOutcome) error {
+			audio = append(audio, chunk)
+			return nil
+		})
+		if err != nil || len(failures) != 0 || len(audio) != len(chunks) {
+			t.Fatalf("GenerateChunkedAudio() = %d chunks, %+v, %v", len(audio), failures, err)
+		}
+		for i, chunk := range chunks {
+			if !bytes.Equal(audio[i], fakeproviders.FakeAudio(normalizeSpeechText(string(chunk)))) {
+				t.Errorf("chunk %d audio = %q", i, audio[i])
+			}
+		}
+	}
+
+	speak(ai_model.VoiceOptions{}, chunks)
+	// the same phrases again, in the default voice named and spaced differently
+	speak(ai_model.VoiceOptions{VoiceID: "alloy", SpeakingRate: 1}, [][]byte{[]byte("Thanks,  let's move on."), chunks[1]})
+	if calls := fake.Calls(fakeproviders.RouteOpenAiSpeech); calls != 2 {
+		t.Errorf("provider called %d times, want the repeats served from the cache", calls)
+	}
+	if credits := s.userService.GetTokenUsage(email); credits != 298 {
+		t.Errorf("credits = %d, want only the synthesised chunks charged", credits)
+	}
+
+	speak(ai_model.VoiceOptions{VoiceID: "echo"}, chunks[:1])
+	if calls := fake.Calls(fakeproviders.RouteOpenAiSpeech); calls != 3 {
+		t.Errorf("provider called %d times, want another voice synthesised", calls)
+	}
+	if stats := s.AudioCache().Stats(); stats.Hits != 2 || stats.Misses != 3 || stats.DiskEntries != 3 {
+		t.Errorf("Stats() = %+v, want 2 hits, 3 misses and 3 files", stats)
+	}
+}
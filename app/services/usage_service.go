@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	usage_model "up-it-aps-api/app/models/usage"
+	"up-it-aps-api/platform/database"
+)
+
+// MaxUsageRecords caps how many rows one usage query returns.
+const MaxUsageRecords = 1000
+
+// usageScope carries who a provider call is made for down to the code that meters it.
+type usageScope struct {
+	email     string
+	requestID string
+	sessionID uint
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope attaches the user and request ID that provider calls made with ctx
+// are billed to.
+func WithUsageScope(ctx context.Context, email string, requestID string) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, usageScope{email: email, requestID: requestID})
+}
+
+// WithUsageSession attaches provider calls made with ctx to an interview session. A zero
+// ID leaves ctx as it is.
+func WithUsageSession(ctx context.Context, sessionID uint) context.Context {
+	if sessionID == 0 {
+		return ctx
+	}
+	scope := usageScopeFrom(ctx)
+	scope.sessionID = sessionID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func usageScopeFrom(ctx context.Context) usageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope
+}
+
+type UsageService struct {
+}
+
+func NewUsageService() *UsageService {
+	return &UsageService{}
+}
+
+// Record stores one provider call. Metering must never fail the request it measures,
+// so database errors are only logged.
+func (s *UsageService) Record(ctx context.Context, record usage_model.UsageRecord, start time.Time, callErr error) {
+	var db = database.DBConn
+	if db == nil {
+		return
+	}
+	scope := usageScopeFrom(ctx)
+	record.Email = scope.email
+	record.RequestID = scope.requestID
+	record.SessionID = scope.sessionID
+	record.LatencyMs = time.Since(start).Milliseconds()
+	record.Success = callErr == nil
+	if callErr != nil {
+		record.Error = callErr.Error()
+	}
+	if err := db.Create(&record).Error; err != nil {
+		log.Printf("Error recording usage: %v", err)
+	}
+}
+
+// chatUsage builds the usage record of a chat completion. result is nil when the call
+// failed; otherwise the model the provider reports wins over the one we asked for.
+func chatUsage(provider string, model string, result *ai_model.ChatResult) usage_model.UsageRecord {
+	record := usage_model.UsageRecord{Kind: usage_model.KindChat, Provider: provider, LlmModel: model}
+	if result == nil {
+		return record
+	}
+	if result.Model != "" {
+		record.LlmModel = result.Model
+	}
+	record.PromptTokens = result.Usage.PromptTokens
+	record.CompletionTokens = result.Usage.CompletionTokens
+	record.TotalTokens = result.Usage.TotalTokens
+	return record
+}
+
+// GetUsage returns the usage records in [from, to), newest first. An empty email
+// returns every user's records.
+func (s *UsageService) GetUsage(email string, from time.Time, to time.Time) ([]usage_model.UsageRecord, error) {
+	var db = database.DBConn
+	var records []usage_model.UsageRecord
+	query := db.Where("created_at >= ? AND created_at < ?", from, to)
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	result := query.Order("created_at DESC").Limit(MaxUsageRecords).Find(&records)
+	return records, result.Error
+}
+
+// SummarizeUsage totals the usage in [from, to) per kind, provider and model.
+func (s *UsageService) SummarizeUsage(email string, from time.Time, to time.Time) ([]usage_model.UsageSummary, error) {
+	var db = database.DBConn
+	var summaries []usage_model.UsageSummary
+	query := db.Model(&usage_model.UsageRecord{}).
+		Select(`kind, provider, llm_model,
+			COUNT(*) AS requests,
+			SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures,
+			SUM(prompt_tokens) AS prompt_tokens,
+			SUM(completion_tokens) AS completion_tokens,
+			SUM(total_tokens) AS total_tokens,
+			SUM(characters) AS characters,
+			SUM(audio_seconds) AS audio_seconds,
+			AVG(latency_ms) AS avg_latency_ms`).
+		Where("created_at >= ? AND created_at < ?", from, to)
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	result := query.Group("kind, provider, llm_model").Order("kind, provider, llm_model").Scan(&summaries)
+	return summaries, result.Error
+}
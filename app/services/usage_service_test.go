@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+	usage_model "up-it-aps-api/app/models/usage"
+	"up-it-aps-api/platform/database"
+)
+
+func TestUsageService_RecordsEveryChatAttempt(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	s := newFailoverTestService(&failingChatProvider{name: "openai"}, &stubChatProvider{name: "gemini"})
+	s.usageService = NewUsageService()
+
+	ctx := WithUsageScope(context.Background(), "test@example.com", "req-1")
+	if _, err := s.CreateChatCompletion(ctx, ai_model.ChatRequest{Model: "gpt-4"}); err != nil {
+		t.Fatalf("CreateChatCompletion() failed: %v", err)
+	}
+
+	records, err := s.Usage().GetUsage("test@example.com", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetUsage() failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("GetUsage() returned %d records, want 2", len(records))
+	}
+	byProvider := map[string]usage_model.UsageRecord{}
+	for _, record := range records {
+		if record.RequestID != "req-1" || record.Kind != usage_model.KindChat {
+			t.Errorf("record = %+v, want chat record for req-1", record)
+		}
+		byProvider[record.Provider] = record
+	}
+	if byProvider["openai"].Success || byProvider["openai"].Error == "" {
+		t.Errorf("openai record = %+v, want a failure with its error", byProvider["openai"])
+	}
+	if !byProvider["gemini"].Success || byProvider["gemini"].LlmModel != "gemini-pro" {
+		t.Errorf("gemini record = %+v, want a gemini-pro success", byProvider["gemini"])
+	}
+}
+
+func TestUsageService_QueryByUserAndDateRange(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewUsageService()
+	day := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	seed := []usage_model.UsageRecord{
+		{Email: "a@example.com", Kind: usage_model.KindChat, Provider: "openai", LlmModel: "gpt-4", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, LatencyMs: 100, Success: true},
+		{Email: "a@example.com", Kind: usage_model.KindChat, Provider: "openai", LlmModel: "gpt-4", PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, LatencyMs: 300, Success: true},
+		{Email: "a@example.com", Kind: usage_model.KindTts, Provider: "elevenlabs", LlmModel: "elevenlabs-multilingual-v1", Characters: 42, LatencyMs: 50, Success: false},
+		{Email: "b@example.com", Kind: usage_model.KindStt, Provider: "openai", LlmModel: "whisper-1", AudioSeconds: 3.5, LatencyMs: 80, Success: true},
+	}
+	for i := range seed {
+		seed[i].CreatedAt = day
+		db.Create(&seed[i])
+	}
+	outside := usage_model.UsageRecord{Email: "a@example.com", Kind: usage_model.KindChat, Provider: "openai", LlmModel: "gpt-4", TotalTokens: 999, Success: true}
+	outside.CreatedAt = day.AddDate(0, 0, -2)
+	db.Create(&outside)
+
+	from, to := day.Add(-time.Hour), day.Add(time.Hour)
+	records, err := service.GetUsage("a@example.com", from, to)
+	if err != nil {
+		t.Fatalf("GetUsage() failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Errorf("GetUsage() returned %d records, want 3", len(records))
+	}
+	all, _ := service.GetUsage("", from, to)
+	if len(all) != 4 {
+		t.Errorf("GetUsage() for all users returned %d records, want 4", len(all))
+	}
+
+	summary, err := service.SummarizeUsage("a@example.com", from, to)
+	if err != nil {
+		t.Fatalf("SummarizeUsage() failed: %v", err)
+	}
+	if len(summary) != 2 {
+		t.Fatalf("SummarizeUsage() returned %d rows, want 2: %+v", len(summary), summary)
+	}
+	chat := summary[0]
+	if chat.Kind != usage_model.KindChat || chat.Requests != 2 || chat.TotalTokens != 45 || chat.AvgLatencyMs != 200 {
+		t.Errorf("chat summary = %+v, want 2 requests, 45 tokens, 200ms", chat)
+	}
+	tts := summary[1]
+	if tts.Kind != usage_model.KindTts || tts.Characters != 42 || tts.Failures != 1 {
+		t.Errorf("tts summary = %+v, want 42 characters and 1 failure", tts)
+	}
+}
+
+func TestVertexAudioSeconds(t *testing.T) {
+	tests := []struct {
+		name     string
+		response ai_model.GoogleVertexAiSpeechToTextResponse
+		want     float64
+	}{
+		{name: "billed time", response: ai_model.GoogleVertexAiSpeechToTextResponse{TotalBilledTime: "4s"}, want: 4},
+		{
+			name: "last result end",
+			response: ai_model.GoogleVertexAiSpeechToTextResponse{
+				VertexAiSpeechToTextResponseResults: []ai_model.GoogleVertexAiSpeechToTextResponseResults{
+					{ResultEndTime: "1.200s"},
+					{ResultEndTime: "3.500s"},
+				},
+			},
+			want: 3.5,
+		},
+		{name: "nothing", response: ai_model.GoogleVertexAiSpeechToTextResponse{}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vertexAudioSeconds(tt.response); got != tt.want {
+				t.Errorf("vertexAudioSeconds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
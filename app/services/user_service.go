@@ -1,10 +1,17 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	user_model "up-it-aps-api/app/models/user"
 	"up-it-aps-api/platform/database"
+
+	"gorm.io/gorm"
 )
 
+var ErrInvalidSettings = errors.New("invalid user settings")
+
 type UserService struct {
 }
 
@@ -17,20 +24,29 @@ func (s *UserService) GetTokenUsage(email string) uint64 {
 	return user.Credits
 }
 
-func (s *UserService) DecreaseTokenUsage(email string) user_model.User {
+// DecreaseTokenUsage takes one credit from the user, or returns ErrNoCredits if they
+// have none left. The decrement is a single statement, so concurrent calls, such as
+// the chunks of one reply, each take their own credit.
+func (s *UserService) DecreaseTokenUsage(email string) error {
 	var db = database.DBConn
-	user := s.GetUserByEmail(email)
-	if user.Credits == 0 {
-		return user
+	result := db.Model(&user_model.User{}).Where("email = ? AND credits > 0", email).
+		Update("credits", gorm.Expr("credits - 1"))
+	if result.Error != nil {
+		return result.Error
 	}
-	db.Where("email = ?", email).First(&user).Update("credits", user.Credits-1)
-	return user
+	if result.RowsAffected == 0 {
+		return ErrNoCredits
+	}
+	return nil
 }
 
 func (s *UserService) UpdateTokens(email string, newTokens uint64) user_model.User {
 	var db = database.DBConn
 	user := s.GetUserByEmail(email)
-	db.Where("email = ?", email).First(&user).Update("credits", user.Credits+newTokens)
+	if user.Email == "" {
+		return user
+	}
+	db.Model(&user).Update("credits", user.Credits+newTokens)
 	return user
 }
 
@@ -55,14 +71,32 @@ func (s *UserService) GetUserSettingsByEmail(email string) user_model.UserSettin
 	return user.UserSettings
 }
 
-func (s *UserService) UpdateUserSettings(email string, newUserSettings *user_model.UserSettings) (user_model.UserSettings, error) {
+// UpdateUserSettings stores the settings. max_follow_ups is left as it is when the
+// update does not include it.
+func (s *UserService) UpdateUserSettings(email string, input *user_model.InputUserSettings) (user_model.UserSettings, error) {
+	newUserSettings := input.UserSettings
+	if err := normalizeVoiceSettings(&newUserSettings); err != nil {
+		return user_model.UserSettings{}, err
+	}
+	if input.MaxFollowUps != nil && (*input.MaxFollowUps < 0 || *input.MaxFollowUps > MaxFollowUpsLimit) {
+		return user_model.UserSettings{}, fmt.Errorf("%w: max_follow_ups must be between 0 and %d", ErrInvalidSettings, MaxFollowUpsLimit)
+	}
 	var db = database.DBConn
 	var user user_model.User
-	result := db.Where("email = ?", email).First(&user).Select("llm_model", "stt_model", "tts_model", "auto_play_audio").Updates(newUserSettings)
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return user_model.UserSettings{}, err
+	}
+	columns := []interface{}{"stt_model", "tts_model", "auto_play_audio", "persona", "tts_voice", "speaking_rate", "pitch", "audio_format"}
+	newUserSettings.MaxFollowUps = user.UserSettings.MaxFollowUps
+	if input.MaxFollowUps != nil {
+		newUserSettings.MaxFollowUps = *input.MaxFollowUps
+		columns = append(columns, "max_follow_ups")
+	}
+	result := db.Model(&user).Select("llm_model", columns...).Updates(user_model.User{UserSettings: newUserSettings})
 	if result.Error != nil {
 		return user_model.UserSettings{}, result.Error
 	}
-	return *newUserSettings, nil
+	return newUserSettings, nil
 }
 
 func (s *UserService) CreateUser(user *user_model.InputUser) (user_model.User, error) {
@@ -76,3 +110,32 @@ func (s *UserService) CreateUser(user *user_model.InputUser) (user_model.User, e
 	}
 	return newUser, nil
 }
+
+// normalizeVoiceSettings fills in the defaults for voice settings a client left out and
+// checks the rest. Voice IDs are not checked: providers fall back to their default voice
+// for IDs they do not know.
+func normalizeVoiceSettings(settings *user_model.UserSettings) error {
+	settings.TtsVoice = strings.TrimSpace(settings.TtsVoice)
+	settings.AudioFormat = strings.ToLower(strings.TrimSpace(settings.AudioFormat))
+	if settings.SpeakingRate == 0 {
+		settings.SpeakingRate = 1
+	}
+	if settings.AudioFormat == "" {
+		settings.AudioFormat = AudioFormatMp3
+	}
+	if len(settings.TtsVoice) > 64 {
+		return fmt.Errorf("%w: tts_voice is longer than 64 characters", ErrInvalidSettings)
+	}
+	if settings.SpeakingRate < MinSpeakingRate || settings.SpeakingRate > MaxSpeakingRate {
+		return fmt.Errorf("%w: speaking_rate must be between %g and %g", ErrInvalidSettings, MinSpeakingRate, MaxSpeakingRate)
+	}
+	if settings.Pitch < -MaxPitch || settings.Pitch > MaxPitch {
+		return fmt.Errorf("%w: pitch must be between %g and %g semitones", ErrInvalidSettings, -MaxPitch, MaxPitch)
+	}
+	for _, format := range AudioFormats {
+		if settings.AudioFormat == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: audio_format must be one of %s", ErrInvalidSettings, strings.Join(AudioFormats, ", "))
+}
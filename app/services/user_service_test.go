@@ -1,10 +1,21 @@
 package service
 
 import (
-	"os"
+	"encoding/json"
+	"errors"
+	"sync"
 	"testing"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	persona_model "up-it-aps-api/app/models/persona"
+	practice_model "up-it-aps-api/app/models/practice"
+	question_model "up-it-aps-api/app/models/question"
+	report_model "up-it-aps-api/app/models/report"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	skill_model "up-it-aps-api/app/models/skill"
+	submission_model "up-it-aps-api/app/models/submission"
+	usage_model "up-it-aps-api/app/models/usage"
 	user_model "up-it-aps-api/app/models/user"
-	"up-it-aps-api/pkg/config"
 	"up-it-aps-api/platform/database"
 
 	"gorm.io/driver/sqlite"
@@ -17,7 +28,26 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to open test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&user_model.User{}, &user_model.UserSettings{})
+	err = db.AutoMigrate(
+		&user_model.User{},
+		&user_model.UserSettings{},
+		&conversation_model.Conversation{},
+		&conversation_model.ConversationMessage{},
+		&persona_model.Persona{},
+		&persona_model.PersonaVersion{},
+		&usage_model.UsageRecord{},
+		&session_model.InterviewSession{},
+		&session_model.SessionTurn{},
+		&session_model.StarAnalysis{},
+		&question_model.Question{},
+		&scoring_model.Rubric{},
+		&scoring_model.TurnScore{},
+		&scoring_model.CriterionScore{},
+		&report_model.SessionReport{},
+		&skill_model.SkillEstimate{},
+		&practice_model.ReviewItem{},
+		&submission_model.CodeSubmission{},
+	)
 	if err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
@@ -112,16 +142,36 @@ func TestUserService_DecreaseTokenUsage(t *testing.T) {
 	}
 
 	// Decrease credits
-	user := service.DecreaseTokenUsage("test@example.com")
+	if err := service.DecreaseTokenUsage("test@example.com"); err != nil {
+		t.Fatalf("DecreaseTokenUsage() failed: %v", err)
+	}
+
+	if credits := service.GetTokenUsage("test@example.com"); credits != 299 {
+		t.Errorf("DecreaseTokenUsage() credits = %v, want 299", credits)
+	}
 
-	if user.Credits != 299 {
-		t.Errorf("DecreaseTokenUsage() credits = %v, want 299", user.Credits)
+	// Concurrent decrements each take a credit
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // every connection to :memory: is a new database
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service.DecreaseTokenUsage("test@example.com")
+		}()
+	}
+	wg.Wait()
+	if credits := service.GetTokenUsage("test@example.com"); credits != 279 {
+		t.Errorf("credits after 20 concurrent decrements = %v, want 279", credits)
 	}
 
 	// Test with zero credits
-	service.UpdateTokens("test@example.com", 0)
-	user = service.DecreaseTokenUsage("test@example.com")
-	if user.Credits != 0 {
+	db.Model(&user_model.User{}).Where("email = ?", "test@example.com").Update("credits", 0)
+	if err := service.DecreaseTokenUsage("test@example.com"); !errors.Is(err, ErrNoCredits) {
+		t.Errorf("DecreaseTokenUsage() with no credits error = %v, want ErrNoCredits", err)
+	}
+	if credits := service.GetTokenUsage("test@example.com"); credits != 0 {
 		t.Error("DecreaseTokenUsage() should not decrease below 0")
 	}
 }
@@ -176,3 +226,65 @@ func TestUserService_GetTokenUsage(t *testing.T) {
 	}
 }
 
+
+func TestUserService_UpdateUserSettings(t *testing.T) {
+	db := setupTestDB(t)
+	database.DBConn = db
+	defer func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}()
+
+	service := NewUserService()
+	if _, err := service.CreateUser(&user_model.InputUser{Email: "test@example.com"}); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	if settings := service.GetUserSettingsByEmail("test@example.com"); settings.SpeakingRate != 1 || settings.AudioFormat != "mp3" {
+		t.Errorf("new user settings = %+v, want normal speed MP3", settings)
+	}
+
+	tests := []struct {
+		name     string
+		settings user_model.UserSettings
+		wantErr  bool
+	}{
+		{name: "voice", settings: user_model.UserSettings{TtsModel: "vertex", TtsVoice: "en-GB-Neural2-A", SpeakingRate: 1.25, Pitch: -2, AudioFormat: "OPUS"}},
+		{name: "too fast", settings: user_model.UserSettings{SpeakingRate: 3}, wantErr: true},
+		{name: "pitch too low", settings: user_model.UserSettings{Pitch: -13}, wantErr: true},
+		{name: "unknown format", settings: user_model.UserSettings{AudioFormat: "flac"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := user_model.InputUserSettings{UserSettings: tt.settings}
+			_, err := service.UpdateUserSettings("test@example.com", &settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateUserSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	settings := service.GetUserSettingsByEmail("test@example.com")
+	if settings.TtsVoice != "en-GB-Neural2-A" || settings.SpeakingRate != 1.25 || settings.Pitch != -2 || settings.AudioFormat != "opus" {
+		t.Errorf("stored settings = %+v, want the valid update only", settings)
+	}
+
+	// clients that predate max_follow_ups keep the default of 2
+	if settings.MaxFollowUps != 2 {
+		t.Errorf("max_follow_ups after updates without it = %d, want 2", settings.MaxFollowUps)
+	}
+	var input user_model.InputUserSettings
+	if err := json.Unmarshal([]byte(`{"tts_model": "tts-1", "max_follow_ups": 0}`), &input); err != nil {
+		t.Fatalf("decode settings: %v", err)
+	}
+	if updated, err := service.UpdateUserSettings("test@example.com", &input); err != nil || updated.MaxFollowUps != 0 {
+		t.Errorf("UpdateUserSettings() turning follow-ups off = %+v, %v", updated, err)
+	}
+	if settings := service.GetUserSettingsByEmail("test@example.com"); settings.MaxFollowUps != 0 {
+		t.Errorf("stored max_follow_ups = %d, want 0", settings.MaxFollowUps)
+	}
+	tooMany := MaxFollowUpsLimit + 1
+	if _, err := service.UpdateUserSettings("test@example.com", &user_model.InputUserSettings{MaxFollowUps: &tooMany}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("UpdateUserSettings() with %d follow-ups error = %v, want ErrInvalidSettings", tooMany, err)
+	}
+}
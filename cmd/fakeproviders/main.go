@@ -0,0 +1,58 @@
+// Command fakeproviders serves pkg/fakeproviders on a local port so the API can run
+// without network access or provider keys. Point the *_BASE_URL variables at it, see
+// env.example.
+//
+//	go run ./cmd/fakeproviders -addr :8089 -latency 200ms -script script.json
+//
+// A script file maps route names to queued responses, for example
+//
+//	{"openai.chat": [{"text": "Tell me about a conflict."}, {"status": 500}]}
+//
+// and can also be posted to /_fake/script while the server runs.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+	"up-it-aps-api/pkg/fakeproviders"
+)
+
+func main() {
+	addr := flag.String("addr", ":8089", "address to listen on")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	script := flag.String("script", "", "JSON file with scripted responses per route")
+	flag.Parse()
+
+	fake := fakeproviders.New()
+	fake.SetLatency("", *latency)
+	if *script != "" {
+		file, err := os.Open(*script)
+		if err != nil {
+			log.Fatalf("open script: %v", err)
+		}
+		err = fake.LoadScript(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("load script: %v", err)
+		}
+	}
+
+	endpoints := fakeproviders.EndpointsFor("http://localhost" + *addr)
+	log.Printf("OPEN_AI_BASE_URL=%s", endpoints.OpenAI)
+	log.Printf("GEMINI_BASE_URL=%s", endpoints.Gemini)
+	log.Printf("GOOGLE_TTS_BASE_URL=%s", endpoints.GoogleTts)
+	log.Printf("GOOGLE_STT_BASE_URL=%s", endpoints.GoogleStt)
+	log.Printf("ELEVEN_LABS_BASE_URL=%s", endpoints.ElevenLabs)
+	log.Printf("UNREAL_SPEECH_BASE_URL=%s", endpoints.UnrealSpeech)
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           fake,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("fake providers listening on %s", *addr)
+	log.Fatal(server.ListenAndServe())
+}
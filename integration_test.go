@@ -5,19 +5,36 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"time"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	persona_model "up-it-aps-api/app/models/persona"
+	practice_model "up-it-aps-api/app/models/practice"
+	question_model "up-it-aps-api/app/models/question"
+	report_model "up-it-aps-api/app/models/report"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	skill_model "up-it-aps-api/app/models/skill"
+	submission_model "up-it-aps-api/app/models/submission"
+	usage_model "up-it-aps-api/app/models/usage"
+	service "up-it-aps-api/app/services"
 	"up-it-aps-api/pkg/config"
+	"up-it-aps-api/pkg/fakeproviders"
 	"up-it-aps-api/pkg/logger"
 	"up-it-aps-api/pkg/middleware"
 	"up-it-aps-api/pkg/routes"
 	"up-it-aps-api/platform/database"
 
+	"github.com/fasthttp/websocket"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -47,19 +64,37 @@ func setupTestApp(t *testing.T) *fiber.App {
 		t.Fatalf("db init failed: %v", err)
 	}
 
-	err = db.AutoMigrate(&user_model.User{}, &user_model.UserSettings{})
+	err = db.AutoMigrate(
+		&user_model.User{},
+		&user_model.UserSettings{},
+		&conversation_model.Conversation{},
+		&conversation_model.ConversationMessage{},
+		&persona_model.Persona{},
+		&persona_model.PersonaVersion{},
+		&usage_model.UsageRecord{},
+		&session_model.InterviewSession{},
+		&session_model.SessionTurn{},
+		&session_model.StarAnalysis{},
+		&question_model.Question{},
+		&scoring_model.Rubric{},
+		&scoring_model.TurnScore{},
+		&scoring_model.CriterionScore{},
+		&report_model.SessionReport{},
+		&skill_model.SkillEstimate{},
+		&practice_model.ReviewItem{},
+		&submission_model.CodeSubmission{},
+	)
 	if err != nil {
 		t.Fatalf("migration failed: %v", err)
 	}
 
 	database.DBConn = db
 
-	app := fiber.New(fiber.Config{
-		ErrorHandler: middleware.ErrorHandler(appLogger.Logger),
-	})
+	app := fiber.New()
 
 	app.Use(middleware.Recovery(appLogger.Logger))
 	app.Use(middleware.RequestID())
+	app.Use(middleware.ErrorHandler(appLogger.Logger))
 
 	store := session.New(session.Config{
 		Expiration:     cfg.Auth.SessionExpiration,
@@ -75,6 +110,19 @@ func setupTestApp(t *testing.T) *fiber.App {
 	api := app.Group("/api")
 	api.Use(middleware.APIKeyAuth(cfg.Auth.APIKey, appLogger.Logger))
 
+	// Every AI provider call goes to the offline fake
+	fake := fakeproviders.NewServer()
+	t.Cleanup(fake.Close)
+	cfg.AI.Endpoints = fake.Endpoints()
+	cfg.AI.TtsCache.Dir = t.TempDir()
+
+	aiService := service.NewAiService(service.NewUserService(), cfg.AI)
+	routes.AiRoutes(api, store, aiService, cfg.CORS.AllowedOrigins)
+	routes.SessionRoutes(api, aiService)
+	routes.QuestionRoutes(api)
+	routes.SkillRoutes(api, aiService)
+	routes.PracticeRoutes(api, aiService)
+	routes.SubmissionRoutes(api, aiService, cfg.Sandbox)
 	routes.UserRoutes(api, store)
 
 	return app
@@ -148,3 +196,227 @@ func TestAPIKeyAuth(t *testing.T) {
 	}
 }
 
+
+func TestSendMessage(t *testing.T) {
+	app := setupTestApp(t)
+
+	if _, err := service.NewUserService().CreateUser(&user_model.InputUser{Email: "test@example.com"}); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"message": "Hi, I am ready to start."})
+	req := httptest.NewRequest(http.MethodPost, "/api/ai/message?email=test@example.com", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "test-api-key-for-integration")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test() failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var reply struct {
+		Message        string `json:"message"`
+		ConversationID uint   `json:"conversation_id"`
+		Provider       string `json:"provider"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if reply.Message != fakeproviders.DefaultReply || reply.ConversationID == 0 {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+}
+
+func TestSpeechToText(t *testing.T) {
+	app := setupTestApp(t)
+
+	body, _ := json.Marshal(map[string][]byte{"audioData": make([]byte, 32000)})
+	req := httptest.NewRequest(http.MethodPost, "/api/ai/speech-to-text?email=test@example.com", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "test-api-key-for-integration")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("app.Test() failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var transcription struct {
+		Text     string `json:"text"`
+		Delivery struct {
+			Words          int     `json:"words"`
+			WordsPerMinute float64 `json:"words_per_minute"`
+		} `json:"delivery"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&transcription); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if transcription.Text != fakeproviders.DefaultTranscript {
+		t.Errorf("unexpected transcript %q", transcription.Text)
+	}
+	if transcription.Delivery.Words != 14 || transcription.Delivery.WordsPerMinute != 150 {
+		t.Errorf("delivery = %+v, want 14 words at 150 wpm", transcription.Delivery)
+	}
+}
+
+func TestStreamSpeechToText(t *testing.T) {
+	app := setupTestApp(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+
+	url := "ws://" + listener.Addr().String() + "/api/ai/speech-to-text/stream?email=test@example.com"
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Fatal("Dial() without an API key succeeded")
+	}
+	if _, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Api-Key": {"test-api-key-for-integration"}, "Origin": {"https://evil.example.net"}}); err == nil {
+		t.Fatal("Dial() from another origin succeeded")
+	}
+	// as a browser would, with the key offered as a subprotocol
+	dialer := websocket.Dialer{Subprotocols: []string{"x-api-key", "test-api-key-for-integration"}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol() != "x-api-key" {
+		t.Errorf("subprotocol = %q, want x-api-key and never the key", conn.Subprotocol())
+	}
+	// a second of speech then a pause, as 16 kHz PCM in 100ms frames
+	for i := 0; i < 20; i++ {
+		frame := make([]byte, 0, 3200)
+		for j := 0; j < 1600; j++ {
+			sample := int16(0)
+			if i < 10 && j/20%2 == 0 {
+				sample = 3000
+			}
+			frame = binary.LittleEndian.AppendUint16(frame, uint16(sample))
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatalf("WriteMessage() failed: %v", err)
+		}
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "stop"}`))
+
+	var types []string
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("stream closed before the transcript: %v (events %v)", err, types)
+		}
+		var event struct {
+			Type          string `json:"type"`
+			Transcription struct {
+				Text     string `json:"text"`
+				Segments int    `json:"segments"`
+			} `json:"transcription"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		types = append(types, event.Type)
+		if event.Type == "transcript" {
+			if event.Transcription.Text != fakeproviders.DefaultTranscript || event.Transcription.Segments != 1 {
+				t.Errorf("transcript = %+v (events %v)", event.Transcription, types)
+			}
+			break
+		}
+	}
+	if types[len(types)-2] != "final" {
+		t.Errorf("events = %v, want the final segment before the transcript", types)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("read after the transcript = %v, want a normal close", err)
+	}
+}
+
+func TestInterviewSession(t *testing.T) {
+	app := setupTestApp(t)
+
+	if _, err := service.NewUserService().CreateUser(&user_model.InputUser{Email: "test@example.com"}); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+
+	send := func(method string, path string, payload interface{}) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", "test-api-key-for-integration")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("app.Test() failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := send(http.MethodPost, "/api/sessions?email=test@example.com", map[string]string{
+		"type":        session_model.TypeBehavioral,
+		"target_role": "APS EL1",
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	var interview session_model.InterviewSession
+	if err := json.NewDecoder(resp.Body).Decode(&interview); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	for _, message := range []string{"Hi, I am ready to start.", "I led the migration to the new platform."} {
+		resp = send(http.MethodPost, "/api/ai/message?email=test@example.com", map[string]interface{}{
+			"message":    message,
+			"session_id": interview.ID,
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	resp = send(http.MethodPost, "/api/sessions/"+fmt.Sprint(interview.ID)+"/end?email=test@example.com", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	// an ended session no longer accepts calls
+	resp = send(http.MethodPost, "/api/ai/message?email=test@example.com", map[string]interface{}{
+		"message":    "One more thing.",
+		"session_id": interview.ID,
+	})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected status 409, got %d", resp.StatusCode)
+	}
+
+	resp = send(http.MethodGet, "/api/sessions/"+fmt.Sprint(interview.ID)+"?email=test@example.com", nil)
+	if err := json.NewDecoder(resp.Body).Decode(&interview); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if interview.Status != session_model.StatusCompleted || interview.ConversationID == 0 {
+		t.Errorf("unexpected session %+v", interview)
+	}
+	if len(interview.Turns) != 2 || interview.Turns[0].Answer != "I led the migration to the new platform." {
+		t.Errorf("unexpected turns %+v", interview.Turns)
+	}
+
+	// the report is generated in the background after the session ends
+	reportPath := "/api/sessions/" + fmt.Sprint(interview.ID) + "/report?email=test@example.com&format=pdf"
+	resp = send(http.MethodGet, reportPath, nil)
+	for attempt := 0; resp.StatusCode == http.StatusAccepted && attempt < 50; attempt++ {
+		time.Sleep(20 * time.Millisecond)
+		resp = send(http.MethodGet, reportPath, nil)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("expected a PDF report, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	resp = send(http.MethodGet, "/api/sessions/"+fmt.Sprint(interview.ID)+"/report?email=test@example.com&format=docx", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown format, got %d", resp.StatusCode)
+	}
+}
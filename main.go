@@ -5,8 +5,19 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	conversation_model "up-it-aps-api/app/models/conversation"
+	persona_model "up-it-aps-api/app/models/persona"
+	practice_model "up-it-aps-api/app/models/practice"
+	question_model "up-it-aps-api/app/models/question"
+	report_model "up-it-aps-api/app/models/report"
+	scoring_model "up-it-aps-api/app/models/scoring"
+	session_model "up-it-aps-api/app/models/session"
+	skill_model "up-it-aps-api/app/models/skill"
+	submission_model "up-it-aps-api/app/models/submission"
+	usage_model "up-it-aps-api/app/models/usage"
 	user_model "up-it-aps-api/app/models/user"
 	service "up-it-aps-api/app/services"
 	_ "up-it-aps-api/docs"
@@ -61,7 +72,6 @@ func main() {
 		ReadTimeout:                  cfg.Server.ReadTimeout,
 		WriteTimeout:                 cfg.Server.WriteTimeout,
 		IdleTimeout:                  cfg.Server.IdleTimeout,
-		ErrorHandler: middleware.ErrorHandler(appLogger),
 	})
 
 	setupMiddleware(app, cfg, appLogger)
@@ -103,12 +113,13 @@ func setupMiddleware(app *fiber.App, cfg *config.Config, appLogger *logger.Logge
 	app.Use(middleware.Recovery(appLogger.Logger))
 	app.Use(middleware.RequestID())
 	app.Use(appLogger.FiberLogger())
+	app.Use(middleware.ErrorHandler(appLogger.Logger))
 
 	app.Use(cors.New(cors.Config{
 		AllowCredentials: true,
 		AllowOrigins:     cfg.CORS.AllowedOrigins[0],
-		AllowHeaders:     cfg.CORS.AllowedHeaders,
-		AllowMethods:     cfg.CORS.AllowedMethods,
+		AllowHeaders:     strings.Join(cfg.CORS.AllowedHeaders, ","),
+		AllowMethods:     strings.Join(cfg.CORS.AllowedMethods, ","),
 	}))
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
@@ -125,7 +136,15 @@ func setupRoutes(app *fiber.App, store *session.Store, cfg *config.Config, appLo
 	auth.Get("/callback", handleLoginCallback(cfg.Auth.JWTSecret, appLogger))
 	auth.Get("/logout", handleLogout(store))
 
-	routes.AiRoutes(api, store)
+	aiService := service.NewAiService(service.NewUserService(), cfg.AI)
+	go aiService.Sessions().WatchTimeLimits(context.Background(), service.TimeLimitSweepInterval)
+	routes.AiRoutes(api, store, aiService, cfg.CORS.AllowedOrigins)
+	routes.AdminRoutes(api, aiService, middleware.AdminKeyAuth(cfg.Auth.AdminAPIKey, appLogger.Logger))
+	routes.SessionRoutes(api, aiService)
+	routes.QuestionRoutes(api)
+	routes.SkillRoutes(api, aiService)
+	routes.PracticeRoutes(api, aiService)
+	routes.SubmissionRoutes(api, aiService, cfg.Sandbox)
 	routes.UserRoutes(api, store)
 	routes.DebuggingRoutes(api, store)
 }
@@ -147,10 +166,37 @@ func initDatabase(cfg *config.Config, appLogger *logger.Logger) (*gorm.DB, error
 
 	database.DBConn = db
 
-	if err := db.AutoMigrate(&user_model.User{}, &user_model.UserSettings{}); err != nil {
+	if err := db.AutoMigrate(
+		&user_model.User{},
+		&user_model.UserSettings{},
+		&conversation_model.Conversation{},
+		&conversation_model.ConversationMessage{},
+		&persona_model.Persona{},
+		&persona_model.PersonaVersion{},
+		&usage_model.UsageRecord{},
+		&session_model.InterviewSession{},
+		&session_model.SessionTurn{},
+		&session_model.StarAnalysis{},
+		&question_model.Question{},
+		&scoring_model.Rubric{},
+		&scoring_model.TurnScore{},
+		&scoring_model.CriterionScore{},
+		&report_model.SessionReport{},
+		&skill_model.SkillEstimate{},
+		&practice_model.ReviewItem{},
+		&submission_model.CodeSubmission{},
+	); err != nil {
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
 
+	if err := service.NewPersonaService().SeedDefaults(); err != nil {
+		return nil, fmt.Errorf("persona seed failed: %w", err)
+	}
+
+	if err := service.SeedDefaultRubrics(); err != nil {
+		return nil, fmt.Errorf("rubric seed failed: %w", err)
+	}
+
 	appLogger.Info("db connected")
 	return db, nil
 }
@@ -0,0 +1,279 @@
+package audiocache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Settings struct {
+	// MemoryBytes caps the in-memory tier. 0 turns it off.
+	MemoryBytes int64
+	// Dir holds the disk tier. Empty turns it off.
+	Dir string
+	// DiskBytes caps the disk tier. 0 means no cap.
+	DiskBytes int64
+	// TTL is how long audio is kept after it was stored. 0 keeps it until evicted.
+	TTL time.Duration
+}
+
+// Stats is a point-in-time view of the cache, safe to serialise.
+type Stats struct {
+	Hits          int64   `json:"hits"`
+	MemoryHits    int64   `json:"memory_hits"`
+	DiskHits      int64   `json:"disk_hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	MemoryEntries int     `json:"memory_entries"`
+	MemoryBytes   int64   `json:"memory_bytes"`
+	DiskEntries   int     `json:"disk_entries"`
+	DiskBytes     int64   `json:"disk_bytes"`
+}
+
+type memoryEntry struct {
+	key      string
+	data     []byte
+	storedAt time.Time
+}
+
+type diskEntry struct {
+	size     int64
+	storedAt time.Time
+}
+
+// Cache is a content-addressed store for synthesised audio. Recently used audio is kept
+// in memory, least recently used first out, in front of a disk tier that evicts the
+// oldest files first. Audio found on disk is promoted to memory.
+type Cache struct {
+	settings Settings
+	now      func() time.Time
+
+	mu          sync.Mutex
+	lru         *list.List
+	memory      map[string]*list.Element
+	memoryBytes int64
+	disk        map[string]diskEntry
+	diskBytes   int64
+	memoryHits  int64
+	diskHits    int64
+	misses      int64
+}
+
+// Key addresses the audio for parts, which should include everything that changes
+// how it sounds.
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// New creates a cache, picking up audio left in Dir by an earlier run.
+func New(settings Settings) (*Cache, error) {
+	c := &Cache{
+		settings: settings,
+		now:      time.Now,
+		lru:      list.New(),
+		memory:   make(map[string]*list.Element),
+		disk:     make(map[string]diskEntry),
+	}
+	if settings.Dir == "" {
+		return c, nil
+	}
+	if err := os.MkdirAll(settings.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	err := filepath.WalkDir(settings.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// left over from a write that never finished
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			return os.Remove(path)
+		}
+		if len(d.Name()) != sha256.Size*2 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if c.expired(info.ModTime()) {
+			return os.Remove(path)
+		}
+		c.disk[d.Name()] = diskEntry{size: info.Size(), storedAt: info.ModTime()}
+		c.diskBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.evictDisk()
+	return c, nil
+}
+
+// Get returns the audio stored under key. The returned slice must not be modified.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	if element, ok := c.memory[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if !c.expired(entry.storedAt) {
+			c.lru.MoveToFront(element)
+			c.memoryHits++
+			c.mu.Unlock()
+			return entry.data, true
+		}
+		c.removeMemory(element)
+	}
+	entry, ok := c.disk[key]
+	if ok && c.expired(entry.storedAt) {
+		c.removeDisk(key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(key))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		if _, ok := c.disk[key]; ok {
+			c.removeDisk(key)
+		}
+		c.misses++
+		return nil, false
+	}
+	c.diskHits++
+	c.addMemory(key, data, entry.storedAt)
+	return data, true
+}
+
+// Put stores data under key in both tiers. Failing to write to disk only loses the
+// disk copy, so it is not reported.
+func (c *Cache) Put(key string, data []byte) {
+	now := c.now()
+	c.mu.Lock()
+	c.addMemory(key, data, now)
+	c.mu.Unlock()
+	if c.settings.Dir == "" || c.settings.DiskBytes > 0 && int64(len(data)) > c.settings.DiskBytes {
+		return
+	}
+
+	path := c.path(key)
+	if err := writeFile(path, data, now); err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.disk[key]; ok {
+		c.diskBytes -= old.size
+	}
+	c.disk[key] = diskEntry{size: int64(len(data)), storedAt: now}
+	c.diskBytes += int64(len(data))
+	c.evictDisk()
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := Stats{
+		Hits:          c.memoryHits + c.diskHits,
+		MemoryHits:    c.memoryHits,
+		DiskHits:      c.diskHits,
+		Misses:        c.misses,
+		MemoryEntries: c.lru.Len(),
+		MemoryBytes:   c.memoryBytes,
+		DiskEntries:   len(c.disk),
+		DiskBytes:     c.diskBytes,
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+func (c *Cache) expired(storedAt time.Time) bool {
+	return c.settings.TTL > 0 && c.now().Sub(storedAt) >= c.settings.TTL
+}
+
+// path spreads files over 256 directories, so none gets too big to list.
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.settings.Dir, key[:2], key)
+}
+
+func (c *Cache) addMemory(key string, data []byte, storedAt time.Time) {
+	if element, ok := c.memory[key]; ok {
+		c.removeMemory(element)
+	}
+	if c.settings.MemoryBytes <= 0 || int64(len(data)) > c.settings.MemoryBytes {
+		return
+	}
+	c.memory[key] = c.lru.PushFront(&memoryEntry{key: key, data: data, storedAt: storedAt})
+	c.memoryBytes += int64(len(data))
+	for c.memoryBytes > c.settings.MemoryBytes {
+		c.removeMemory(c.lru.Back())
+	}
+}
+
+func (c *Cache) removeMemory(element *list.Element) {
+	entry := c.lru.Remove(element).(*memoryEntry)
+	delete(c.memory, entry.key)
+	c.memoryBytes -= int64(len(entry.data))
+}
+
+func (c *Cache) removeDisk(key string) {
+	c.diskBytes -= c.disk[key].size
+	delete(c.disk, key)
+	os.Remove(c.path(key))
+}
+
+// evictDisk removes the oldest files until the disk tier is under its cap.
+func (c *Cache) evictDisk() {
+	if c.settings.DiskBytes <= 0 || c.diskBytes <= c.settings.DiskBytes {
+		return
+	}
+	keys := make([]string, 0, len(c.disk))
+	for key := range c.disk {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return c.disk[keys[i]].storedAt.Before(c.disk[keys[j]].storedAt) })
+	for _, key := range keys {
+		if c.diskBytes <= c.settings.DiskBytes {
+			return
+		}
+		c.removeDisk(key)
+	}
+}
+
+// writeFile writes data next to path and renames it into place, so a reader never sees
+// half a file. The modification time is when it was stored.
+func writeFile(path string, data []byte, storedAt time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), storedAt, storedAt); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,79 @@
+package audiocache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCache_MemoryLRU(t *testing.T) {
+	c, err := New(Settings{MemoryBytes: 10})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	c.Put("a", []byte("aaaa"))
+	c.Put("b", []byte("bbbb"))
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) missed")
+	}
+	// b is now the least recently used, so it makes room for c
+	c.Put("c", []byte("cccc"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) hit, want it evicted")
+	}
+	if data, ok := c.Get("c"); !ok || string(data) != "cccc" {
+		t.Errorf("Get(c) = %q, %v", data, ok)
+	}
+	c.Put("big", []byte("more than ten bytes"))
+
+	stats := c.Stats()
+	if stats.MemoryHits != 2 || stats.Misses != 1 || stats.MemoryEntries != 2 || stats.MemoryBytes != 8 {
+		t.Errorf("Stats() = %+v, want 2 hits, 1 miss and 2 entries in memory", stats)
+	}
+}
+
+func TestCache_DiskTier(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	c, err := New(Settings{MemoryBytes: 4, Dir: dir, DiskBytes: 20, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	c.now = func() time.Time { return now }
+
+	first, second, third := Key("openai", "alloy", "Hello"), Key("openai", "alloy", "Thanks"), Key("openai", "echo", "Hello")
+	c.Put(first, []byte("hello audio"))
+	now = now.Add(time.Minute)
+	c.Put(second, []byte("thanks"))
+	if data, ok := c.Get(first); !ok || string(data) != "hello audio" {
+		t.Fatalf("Get() from disk = %q, %v", data, ok)
+	}
+	// over the disk cap, the oldest file goes
+	now = now.Add(time.Minute)
+	c.Put(third, []byte("hello echo"))
+	if _, err := os.Stat(c.path(first)); !os.IsNotExist(err) {
+		t.Errorf("oldest file still on disk: %v", err)
+	}
+
+	// a new cache finds what the last one left
+	reopened, err := New(Settings{MemoryBytes: 4, Dir: dir, DiskBytes: 20, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("New() reopening failed: %v", err)
+	}
+	reopened.now = func() time.Time { return now }
+	if data, ok := reopened.Get(third); !ok || !bytes.Equal(data, []byte("hello echo")) {
+		t.Errorf("Get() after reopening = %q, %v", data, ok)
+	}
+	if stats := reopened.Stats(); stats.DiskHits != 1 || stats.DiskEntries != 2 || stats.DiskBytes != 16 {
+		t.Errorf("Stats() = %+v, want one disk hit and two files", stats)
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := reopened.Get(second); ok {
+		t.Error("Get() after the TTL hit, want it expired")
+	}
+	if _, err := os.Stat(reopened.path(second)); !os.IsNotExist(err) {
+		t.Errorf("expired file still on disk: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker_TripsAndRecovers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New("chat:openai", Settings{FailureThreshold: 3, OpenTimeout: 10 * time.Second, HalfOpenProbes: 1})
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() before threshold failed: %v", err)
+		}
+		b.Failure(errors.New("upstream 500"))
+	}
+
+	if b.State() != Open {
+		t.Fatalf("State() = %v, want open after 3 failures", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() while open = %v, want ErrOpen", err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() probe after timeout failed: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("Allow() second concurrent probe = %v, want ErrOpen", err)
+	}
+
+	b.Success()
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed after successful probe", b.State())
+	}
+}
+
+func TestBreaker_FailedProbeReopens(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New("tts:vertex", Settings{FailureThreshold: 1, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	_ = b.Allow()
+	b.Failure(errors.New("timeout"))
+
+	now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() probe failed: %v", err)
+	}
+	b.Failure(errors.New("timeout again"))
+
+	snapshot := b.Snapshot()
+	if snapshot.State != "open" || snapshot.LastError != "timeout again" {
+		t.Errorf("Snapshot() = %+v, want re-opened with last error", snapshot)
+	}
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := New("stt:whisper-1", Settings{FailureThreshold: 2})
+
+	_ = b.Allow()
+	b.Failure(errors.New("boom"))
+	_ = b.Allow()
+	b.Success()
+	_ = b.Allow()
+	b.Failure(errors.New("boom"))
+
+	if b.State() != Closed {
+		t.Errorf("State() = %v, want closed, failures are only counted consecutively", b.State())
+	}
+}
+
+func TestRegistry_Snapshots(t *testing.T) {
+	r := NewRegistry(Settings{})
+	r.Get("tts:vertex")
+	r.Get("chat:openai")
+	if r.Get("chat:openai") != r.Get("chat:openai") {
+		t.Error("Get() should return the same breaker for the same name")
+	}
+
+	snapshots := r.Snapshots()
+	if len(snapshots) != 2 || snapshots[0].Name != "chat:openai" {
+		t.Errorf("Snapshots() = %+v, want two breakers sorted by name", snapshots)
+	}
+}
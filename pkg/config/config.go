@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ type Config struct {
 	Database DatabaseConfig
 	Auth     AuthConfig
 	AI       AIConfig
+	Sandbox  SandboxConfig
 	CORS     CORSConfig
 }
 
@@ -37,6 +39,7 @@ type DatabaseConfig struct {
 type AuthConfig struct {
 	JWTSecret              string
 	APIKey                 string
+	AdminAPIKey            string
 	GoogleOAuthClientID    string
 	GoogleOAuthSecret      string
 	SessionExpiration      time.Duration
@@ -52,6 +55,107 @@ type AIConfig struct {
 	GCloudApiKey      string
 	PineconeApiKey    string
 	PineconeConnection string
+	Failover           FailoverConfig
+	Endpoints          ProviderEndpoints
+	OpenAICompatible   OpenAICompatibleConfig
+	Judge              JudgeConfig
+	// TtsConcurrency is how many chunks of one reply are synthesised at once.
+	TtsConcurrency int
+	TtsCache       TtsCacheConfig
+}
+
+// TtsCacheConfig sizes the cache of synthesised audio. A memory size of 0 or an empty
+// Dir turns that tier off, and a TTL of 0 keeps audio until it is evicted.
+type TtsCacheConfig struct {
+	MemoryMB int
+	Dir      string
+	DiskMB   int
+	TTL      time.Duration
+}
+
+// JudgeConfig is the model that scores answers against rubrics, and how many times it
+// may be asked to repair malformed output before scoring fails.
+type JudgeConfig struct {
+	Model       string
+	MaxAttempts int
+}
+
+// OpenAICompatibleConfig points at a self-hosted server that speaks the OpenAI chat
+// completions API, such as llama.cpp server, vLLM, LocalAI or Ollama. Models lists the
+// UserSettings.LlmModel values it serves.
+type OpenAICompatibleConfig struct {
+	BaseURL string
+	APIKey  string
+	Models  []string
+}
+
+// ProviderEndpoints holds the base URL of every upstream AI provider, so development and
+// tests can point the app at cmd/fakeproviders instead of the real APIs.
+type ProviderEndpoints struct {
+	OpenAI       string
+	Gemini       string
+	GoogleTts    string
+	GoogleStt    string
+	ElevenLabs   string
+	UnrealSpeech string
+}
+
+// DefaultProviderEndpoints are the public provider APIs.
+func DefaultProviderEndpoints() ProviderEndpoints {
+	return ProviderEndpoints{
+		OpenAI:       "https://api.openai.com/v1",
+		Gemini:       "https://generativelanguage.googleapis.com/v1beta",
+		GoogleTts:    "https://texttospeech.googleapis.com/v1",
+		GoogleStt:    "https://speech.googleapis.com/v1p1beta1",
+		ElevenLabs:   "https://api.elevenlabs.io/v1",
+		UnrealSpeech: "https://api.v6.unrealspeech.com",
+	}
+}
+
+// WithDefaults fills every blank base URL with its public default and drops trailing
+// slashes, so callers can append paths directly.
+func (e ProviderEndpoints) WithDefaults() ProviderEndpoints {
+	defaults := DefaultProviderEndpoints()
+	pick := func(value, fallback string) string {
+		if value == "" {
+			value = fallback
+		}
+		return strings.TrimRight(value, "/")
+	}
+	return ProviderEndpoints{
+		OpenAI:       pick(e.OpenAI, defaults.OpenAI),
+		Gemini:       pick(e.Gemini, defaults.Gemini),
+		GoogleTts:    pick(e.GoogleTts, defaults.GoogleTts),
+		GoogleStt:    pick(e.GoogleStt, defaults.GoogleStt),
+		ElevenLabs:   pick(e.ElevenLabs, defaults.ElevenLabs),
+		UnrealSpeech: pick(e.UnrealSpeech, defaults.UnrealSpeech),
+	}
+}
+
+// FailoverConfig lists, per capability, the models to fall back to (in order) after the
+// user's own choice. Breaker settings apply to every provider.
+type FailoverConfig struct {
+	Chat                    []string
+	Tts                     []string
+	Stt                     []string
+	BreakerFailureThreshold int
+	BreakerOpenTimeout      time.Duration
+	BreakerHalfOpenProbes   int
+}
+
+// SandboxConfig limits the programs candidates submit to coding questions. AllowNetwork
+// is for development hosts that cannot create network namespaces.
+type SandboxConfig struct {
+	TimeLimit        time.Duration
+	CompileTimeLimit time.Duration
+	MemoryMB         int
+	MaxOutputBytes   int
+	MaxConcurrent    int
+	MaxProcesses     int
+	AllowNetwork     bool
+	GoBinary         string
+	PythonBinary     string
+	GoCache          string
 }
 
 type CORSConfig struct {
@@ -79,6 +183,7 @@ func Load() (*Config, error) {
 
 	cfg.Auth.JWTSecret = getRequiredEnv("JWT_SECRET")
 	cfg.Auth.APIKey = getRequiredEnv("API_KEY")
+	cfg.Auth.AdminAPIKey = getEnv("ADMIN_API_KEY", "")
 	cfg.Auth.GoogleOAuthClientID = getEnv("GOOGLE_OAUTH_CLIENT_ID", "")
 	cfg.Auth.GoogleOAuthSecret = getEnv("GOOGLE_OAUTH_CLIENT_SECRET", "")
 	cfg.Auth.SessionExpiration = getDurationEnv("SESSION_EXPIRATION", 24*time.Hour)
@@ -92,6 +197,41 @@ func Load() (*Config, error) {
 	cfg.AI.GCloudApiKey = getEnv("GCLOUD_API_KEY", "")
 	cfg.AI.PineconeApiKey = getEnv("PINECONE_API_KEY", "")
 	cfg.AI.PineconeConnection = getEnv("PINECONE_CONNECTION", "")
+	cfg.AI.Failover.Chat = getListEnv("CHAT_FAILOVER", "gpt-3.5-turbo,gemini-pro")
+	cfg.AI.Failover.Tts = getListEnv("TTS_FAILOVER", "elevenlabs-multilingual-v1,tts-1,vertex")
+	cfg.AI.Failover.Stt = getListEnv("STT_FAILOVER", "whisper-1,vertex")
+	cfg.AI.Failover.BreakerFailureThreshold = getIntEnv("BREAKER_FAILURE_THRESHOLD", 5)
+	cfg.AI.Failover.BreakerOpenTimeout = getDurationEnv("BREAKER_OPEN_TIMEOUT", 30*time.Second)
+	cfg.AI.Failover.BreakerHalfOpenProbes = getIntEnv("BREAKER_HALF_OPEN_PROBES", 1)
+	cfg.AI.Endpoints = ProviderEndpoints{
+		OpenAI:       getEnv("OPEN_AI_BASE_URL", ""),
+		Gemini:       getEnv("GEMINI_BASE_URL", ""),
+		GoogleTts:    getEnv("GOOGLE_TTS_BASE_URL", ""),
+		GoogleStt:    getEnv("GOOGLE_STT_BASE_URL", ""),
+		ElevenLabs:   getEnv("ELEVEN_LABS_BASE_URL", ""),
+		UnrealSpeech: getEnv("UNREAL_SPEECH_BASE_URL", ""),
+	}.WithDefaults()
+	cfg.AI.OpenAICompatible.BaseURL = strings.TrimRight(getEnv("OPEN_AI_COMPATIBLE_BASE_URL", ""), "/")
+	cfg.AI.OpenAICompatible.APIKey = getEnv("OPEN_AI_COMPATIBLE_API_KEY", "")
+	cfg.AI.OpenAICompatible.Models = getListEnv("OPEN_AI_COMPATIBLE_MODELS", "")
+	cfg.AI.Judge.Model = getEnv("JUDGE_MODEL", "gpt-4")
+	cfg.AI.Judge.MaxAttempts = getIntEnv("JUDGE_MAX_ATTEMPTS", 3)
+	cfg.AI.TtsConcurrency = getIntEnv("TTS_CONCURRENCY", 3)
+	cfg.AI.TtsCache.MemoryMB = getIntEnv("TTS_CACHE_MEMORY_MB", 64)
+	cfg.AI.TtsCache.Dir = getEnv("TTS_CACHE_DIR", filepath.Join(os.TempDir(), "up-it-aps-tts-cache"))
+	cfg.AI.TtsCache.DiskMB = getIntEnv("TTS_CACHE_DISK_MB", 1024)
+	cfg.AI.TtsCache.TTL = getDurationEnv("TTS_CACHE_TTL", 30*24*time.Hour)
+
+	cfg.Sandbox.TimeLimit = getDurationEnv("SANDBOX_TIME_LIMIT", 5*time.Second)
+	cfg.Sandbox.CompileTimeLimit = getDurationEnv("SANDBOX_COMPILE_TIME_LIMIT", 30*time.Second)
+	cfg.Sandbox.MemoryMB = getIntEnv("SANDBOX_MEMORY_MB", 256)
+	cfg.Sandbox.MaxOutputBytes = getIntEnv("SANDBOX_MAX_OUTPUT_BYTES", 64*1024)
+	cfg.Sandbox.MaxConcurrent = getIntEnv("SANDBOX_MAX_CONCURRENT", 2)
+	cfg.Sandbox.MaxProcesses = getIntEnv("SANDBOX_MAX_PROCESSES", 32)
+	cfg.Sandbox.AllowNetwork = getBoolEnv("SANDBOX_ALLOW_NETWORK", false)
+	cfg.Sandbox.GoBinary = getEnv("SANDBOX_GO_BINARY", "go")
+	cfg.Sandbox.PythonBinary = getEnv("SANDBOX_PYTHON_BINARY", "python3")
+	cfg.Sandbox.GoCache = getEnv("SANDBOX_GO_CACHE", "")
 
 	allowedOrigins := getEnv("ALLOWED_ORIGINS", "*")
 	cfg.CORS.AllowedOrigins = strings.Split(allowedOrigins, ",")
@@ -101,6 +241,7 @@ func Load() (*Config, error) {
 		"Accept",
 		"Authorization",
 		"X-API-KEY",
+		"X-ADMIN-KEY",
 		"X-Request-ID",
 	}
 	cfg.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
@@ -121,6 +262,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("API_KEY must be set")
 	}
 
+	if c.Auth.AdminAPIKey != "" && c.Auth.AdminAPIKey == c.Auth.APIKey {
+		return fmt.Errorf("ADMIN_API_KEY must differ from API_KEY")
+	}
+
 	if c.Database.DSN == "" {
 		return fmt.Errorf("DSN must be set")
 	}
@@ -143,6 +288,17 @@ func getRequiredEnv(key string) string {
 	return value
 }
 
+// getListEnv reads a comma-separated list, dropping blank entries.
+func getListEnv(key, defaultValue string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getIntEnv(key string, defaultValue int) int {
 	value := os.Getenv(key)
 	if value == "" {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -58,6 +59,18 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.Server.Port != "8080" {
 		t.Errorf("Expected default port 8080, got %s", cfg.Server.Port)
 	}
+
+	if cfg.AI.Judge.Model != "gpt-4" || cfg.AI.Judge.MaxAttempts != 3 {
+		t.Errorf("Expected judge gpt-4 with 3 attempts, got %s with %d", cfg.AI.Judge.Model, cfg.AI.Judge.MaxAttempts)
+	}
+
+	if cfg.AI.TtsConcurrency != 3 {
+		t.Errorf("Expected TTS concurrency 3, got %d", cfg.AI.TtsConcurrency)
+	}
+
+	if cfg.AI.TtsCache.MemoryMB != 64 || cfg.AI.TtsCache.DiskMB != 1024 || cfg.AI.TtsCache.TTL != 30*24*time.Hour || cfg.AI.TtsCache.Dir == "" {
+		t.Errorf("Expected a 64MB memory and 1GB disk TTS cache for 30 days, got %+v", cfg.AI.TtsCache)
+	}
 }
 
 func TestValidate(t *testing.T) {
@@ -110,6 +123,18 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "admin key same as API key",
+			cfg: &Config{
+				Database: DatabaseConfig{DSN: "test:test@tcp(localhost:3306)/test"},
+				Auth: AuthConfig{
+					JWTSecret:   "valid-secret",
+					APIKey:      "valid-key",
+					AdminAPIKey: "valid-key",
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,3 +179,36 @@ func TestGetIntEnv(t *testing.T) {
 	}
 }
 
+
+func TestGetListEnv(t *testing.T) {
+	os.Setenv("TEST_LIST", " elevenlabs-multilingual-v1, tts-1,,vertex ")
+	defer os.Unsetenv("TEST_LIST")
+
+	got := getListEnv("TEST_LIST", "")
+	want := []string{"elevenlabs-multilingual-v1", "tts-1", "vertex"}
+	if len(got) != len(want) {
+		t.Fatalf("getListEnv() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("getListEnv()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if got := getListEnv("TEST_LIST_UNSET", ""); got != nil {
+		t.Errorf("getListEnv() for empty value = %v, want nil", got)
+	}
+}
+
+func TestProviderEndpoints_WithDefaults(t *testing.T) {
+	endpoints := ProviderEndpoints{
+		OpenAI: "http://localhost:8089/openai/v1/",
+	}.WithDefaults()
+
+	if endpoints.OpenAI != "http://localhost:8089/openai/v1" {
+		t.Errorf("OpenAI = %q, want the override without trailing slash", endpoints.OpenAI)
+	}
+	if endpoints.ElevenLabs != DefaultProviderEndpoints().ElevenLabs {
+		t.Errorf("ElevenLabs = %q, want the public default", endpoints.ElevenLabs)
+	}
+}
@@ -0,0 +1,166 @@
+package fakeproviders
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// assistantsState holds the threads and runs of the fake Assistants API. Runs are
+// queued when created and reach their terminal status on the first poll.
+type assistantsState struct {
+	nextID   int
+	threads  map[string][]ai_model.OpenAiThreadMessageResponse
+	runs     map[string]*ai_model.OpenAiRun
+	replies  map[string]string
+	terminal map[string]string
+}
+
+func newAssistantsState() *assistantsState {
+	return &assistantsState{
+		threads:  map[string][]ai_model.OpenAiThreadMessageResponse{},
+		runs:     map[string]*ai_model.OpenAiRun{},
+		replies:  map[string]string{},
+		terminal: map[string]string{},
+	}
+}
+
+func (s *assistantsState) id(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s_fake%d", prefix, s.nextID)
+}
+
+func serveAssistants(f *Fake, w http.ResponseWriter, r *request) {
+	// /threads, /threads/{id}/messages, /threads/{id}/runs, /threads/{id}/runs/{run}[/cancel]
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, openAiPrefix), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		f.mu.Lock()
+		threadId := f.assistants.id("thread")
+		f.assistants.threads[threadId] = nil
+		f.mu.Unlock()
+		writeJSON(w, http.StatusOK, ai_model.OpenAiThreadResponse{ID: threadId})
+
+	case len(parts) == 3 && parts[2] == "messages" && r.Method == http.MethodPost:
+		var message ai_model.OpenAiThreadMessageRequest
+		if err := json.Unmarshal(r.body, &message); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.assistants.threads[parts[1]]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such thread"})
+			return
+		}
+		stored := threadMessage(f.assistants.id("msg"), parts[1], message.Role, message.Content, "")
+		f.assistants.threads[parts[1]] = append(f.assistants.threads[parts[1]], stored)
+		writeJSON(w, http.StatusOK, stored)
+
+	case len(parts) == 3 && parts[2] == "messages" && r.Method == http.MethodGet:
+		runId := r.URL.Query().Get("run_id")
+		f.mu.Lock()
+		var list ai_model.OpenAiThreadMessageList
+		list.Object = "list"
+		for _, message := range f.assistants.threads[parts[1]] {
+			if runId == "" || message.RunID == runId {
+				list.Data = append(list.Data, message)
+			}
+		}
+		f.mu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+
+	case len(parts) == 3 && parts[2] == "runs" && r.Method == http.MethodPost:
+		var runRequest ai_model.OpenAiRunRequest
+		if err := json.Unmarshal(r.body, &runRequest); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		script, _ := f.nextScript(RouteOpenAiAssistants)
+		if script.Latency > 0 {
+			time.Sleep(script.Latency)
+		}
+		if script.Status >= http.StatusBadRequest {
+			writeError(w, script)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.assistants.threads[parts[1]]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such thread"})
+			return
+		}
+		run := &ai_model.OpenAiRun{
+			ID:          f.assistants.id("run"),
+			ThreadID:    parts[1],
+			AssistantID: runRequest.AssistantID,
+			Status:      "queued",
+		}
+		f.assistants.runs[run.ID] = run
+		f.assistants.replies[run.ID] = textOr(script.Text, DefaultReply)
+		f.assistants.terminal[run.ID] = textOr(script.RunStatus, "completed")
+		writeJSON(w, http.StatusOK, run)
+
+	case len(parts) == 4 && parts[2] == "runs" && r.Method == http.MethodGet:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		run, ok := f.assistants.runs[parts[3]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such run"})
+			return
+		}
+		if run.Status == "queued" {
+			f.finishRun(run)
+		}
+		writeJSON(w, http.StatusOK, run)
+
+	case len(parts) == 5 && parts[2] == "runs" && parts[4] == "cancel" && r.Method == http.MethodPost:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		run, ok := f.assistants.runs[parts[3]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such run"})
+			return
+		}
+		run.Status = "cancelled"
+		writeJSON(w, http.StatusOK, run)
+
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unsupported assistants call"})
+	}
+}
+
+// finishRun moves a run to its terminal status; completed runs add the reply to the
+// thread. Callers hold f.mu.
+func (f *Fake) finishRun(run *ai_model.OpenAiRun) {
+	run.Status = f.assistants.terminal[run.ID]
+	switch run.Status {
+	case "completed":
+		reply := f.assistants.replies[run.ID]
+		message := threadMessage(f.assistants.id("msg"), run.ThreadID, "assistant", reply, run.ID)
+		f.assistants.threads[run.ThreadID] = append(f.assistants.threads[run.ThreadID], message)
+		run.Usage = &ai_model.OpenAiUsage{CompletionTokens: countWords(reply), TotalTokens: countWords(reply)}
+	case "failed":
+		run.LastError = &ai_model.OpenAiRunError{Code: "server_error", Message: "injected failure from fake provider"}
+	case "incomplete":
+		run.Incomplete = &ai_model.OpenAiIncomplete{Reason: "max_completion_tokens"}
+	}
+}
+
+func threadMessage(id string, threadId string, role string, text string, runId string) ai_model.OpenAiThreadMessageResponse {
+	return ai_model.OpenAiThreadMessageResponse{
+		ID:        id,
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadID:  threadId,
+		Role:      role,
+		RunID:     runId,
+		Content: []ai_model.OpenAiContentItem{
+			{Type: "text", Text: ai_model.OpenAiTextContent{Value: text}},
+		},
+	}
+}
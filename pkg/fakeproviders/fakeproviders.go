@@ -0,0 +1,363 @@
+// Package fakeproviders emulates the upstream AI providers the API talks to: OpenAI chat,
+// assistants and audio, Gemini generateContent, Google text-to-speech and speech-to-text,
+// ElevenLabs and Unreal Speech. Every route answers with a canned response unless a
+// scripted one is queued, and errors and latency can be injected per route.
+//
+// Tests start it with NewServer and pass Endpoints() to config.AIConfig; cmd/fakeproviders
+// serves the same handler for local development.
+package fakeproviders
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+	"up-it-aps-api/pkg/config"
+)
+
+// Route names, used to script responses, inject latency and count calls.
+const (
+	RouteOpenAiChat          = "openai.chat"
+	RouteOpenAiAssistants    = "openai.assistants"
+	RouteOpenAiSpeech        = "openai.speech"
+	RouteOpenAiTranscription = "openai.transcription"
+	RouteGeminiGenerate      = "gemini.generate"
+	RouteGoogleTts           = "google.tts"
+	RouteGoogleStt           = "google.stt"
+	RouteElevenLabs          = "elevenlabs.tts"
+	RouteUnrealSpeech        = "unrealspeech.tts"
+)
+
+// Path prefixes the providers are mounted under, see EndpointsFor.
+const (
+	openAiPrefix       = "/openai/v1"
+	geminiPrefix       = "/gemini/v1beta"
+	googleTtsPrefix    = "/google-tts/v1"
+	googleSttPrefix    = "/google-stt/v1p1beta1"
+	elevenLabsPrefix   = "/elevenlabs/v1"
+	unrealSpeechPrefix = "/unrealspeech"
+)
+
+const (
+	DefaultReply      = "Thanks for that. Can you walk me through the result you achieved?"
+	DefaultTranscript = "I led the migration of our billing platform and cut costs by twenty percent."
+)
+
+// Response is one scripted reply. Zero fields fall back to the canned response.
+type Response struct {
+	// Status is the HTTP status to answer with, 200 when zero. Error statuses get Body,
+	// or a provider-style error payload when Body is empty.
+	Status int `json:"status"`
+	// Body replaces the whole response body.
+	Body string `json:"body"`
+	// Text replaces the reply, transcript or synthesised text of the canned response.
+	Text string `json:"text"`
+	// RunStatus is the terminal status of an assistants run, "completed" when empty.
+	RunStatus string `json:"run_status"`
+	// Latency is added before answering.
+	Latency time.Duration `json:"latency"`
+}
+
+// Fake is the provider emulator. It is safe for concurrent use.
+type Fake struct {
+	mu          sync.Mutex
+	scripts     map[string][]Response
+	latency     map[string]time.Duration
+	calls       map[string]int
+	lastRequest map[string][]byte
+	assistants  *assistantsState
+}
+
+func New() *Fake {
+	f := &Fake{}
+	f.Reset()
+	return f
+}
+
+// Script queues responses for route; each request on the route consumes one. Assistants
+// scripts are consumed when a run is created.
+func (f *Fake) Script(route string, responses ...Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[route] = append(f.scripts[route], responses...)
+}
+
+// Fail makes the next n requests on route answer with status.
+func (f *Fake) Fail(route string, status int, n int) {
+	responses := make([]Response, n)
+	for i := range responses {
+		responses[i] = Response{Status: status}
+	}
+	f.Script(route, responses...)
+}
+
+// SetLatency delays every response on route. An empty route applies to all routes.
+func (f *Fake) SetLatency(route string, latency time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency[route] = latency
+}
+
+// Calls returns how many requests route has received.
+func (f *Fake) Calls(route string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[route]
+}
+
+// LastRequest returns the body of the most recent request on route.
+func (f *Fake) LastRequest(route string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastRequest[route]
+}
+
+// Reset drops scripts, latency, counters and assistants state.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = map[string][]Response{}
+	f.latency = map[string]time.Duration{}
+	f.calls = map[string]int{}
+	f.lastRequest = map[string][]byte{}
+	f.assistants = newAssistantsState()
+}
+
+// EndpointsFor returns the provider base URLs of a fake served at baseUrl.
+func EndpointsFor(baseUrl string) config.ProviderEndpoints {
+	baseUrl = strings.TrimRight(baseUrl, "/")
+	return config.ProviderEndpoints{
+		OpenAI:       baseUrl + openAiPrefix,
+		Gemini:       baseUrl + geminiPrefix,
+		GoogleTts:    baseUrl + googleTtsPrefix,
+		GoogleStt:    baseUrl + googleSttPrefix,
+		ElevenLabs:   baseUrl + elevenLabsPrefix,
+		UnrealSpeech: baseUrl + unrealSpeechPrefix,
+	}
+}
+
+// Server is a Fake listening on a local httptest server.
+type Server struct {
+	*Fake
+	*httptest.Server
+}
+
+// NewServer starts a Fake on a random local port. Call Close when done.
+func NewServer() *Server {
+	fake := New()
+	return &Server{Fake: fake, Server: httptest.NewServer(fake)}
+}
+
+func (s *Server) Endpoints() config.ProviderEndpoints {
+	return EndpointsFor(s.URL)
+}
+
+// request is what a route handler gets: the body already read and the scripted response,
+// if any, for this call.
+type request struct {
+	*http.Request
+	body   []byte
+	script Response
+}
+
+type routeHandler func(f *Fake, w http.ResponseWriter, r *request)
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/_fake/") {
+		f.serveControl(w, r)
+		return
+	}
+
+	route, handler := match(r)
+	if handler == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no fake provider for " + r.Method + " " + r.URL.Path})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	script, latency := f.begin(route, body, route != RouteOpenAiAssistants)
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if script.Status >= http.StatusBadRequest {
+		writeError(w, script)
+		return
+	}
+	if script.Body != "" {
+		w.WriteHeader(statusOr(script.Status))
+		_, _ = io.WriteString(w, script.Body)
+		return
+	}
+	handler(f, w, &request{Request: r, body: body, script: script})
+}
+
+// begin records the call and pops the next scripted response when consume is set.
+func (f *Fake) begin(route string, body []byte, consume bool) (Response, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[route]++
+	f.lastRequest[route] = body
+
+	var script Response
+	if queue := f.scripts[route]; consume && len(queue) > 0 {
+		script, f.scripts[route] = queue[0], queue[1:]
+	}
+	return script, f.latency[""] + f.latency[route] + script.Latency
+}
+
+// nextScript pops a scripted response outside of begin, used by the assistants run route.
+func (f *Fake) nextScript(route string) (Response, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queue := f.scripts[route]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+	f.scripts[route] = queue[1:]
+	return queue[0], true
+}
+
+func match(r *http.Request) (string, routeHandler) {
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPost && path == openAiPrefix+"/chat/completions":
+		return RouteOpenAiChat, serveOpenAiChat
+	case r.Method == http.MethodPost && path == openAiPrefix+"/audio/speech":
+		return RouteOpenAiSpeech, serveOpenAiSpeech
+	case r.Method == http.MethodPost && path == openAiPrefix+"/audio/transcriptions":
+		return RouteOpenAiTranscription, serveOpenAiTranscription
+	case strings.HasPrefix(path, openAiPrefix+"/threads"):
+		return RouteOpenAiAssistants, serveAssistants
+	case r.Method == http.MethodPost && strings.HasPrefix(path, geminiPrefix+"/models/"):
+		return RouteGeminiGenerate, serveGemini
+	case r.Method == http.MethodPost && path == googleTtsPrefix+"/text:synthesize":
+		return RouteGoogleTts, serveGoogleTts
+	case r.Method == http.MethodPost && path == googleSttPrefix+"/speech:recognize":
+		return RouteGoogleStt, serveGoogleStt
+	case r.Method == http.MethodPost && strings.HasPrefix(path, elevenLabsPrefix+"/text-to-speech/"):
+		return RouteElevenLabs, serveElevenLabs
+	case r.Method == http.MethodPost && path == unrealSpeechPrefix+"/stream":
+		return RouteUnrealSpeech, serveUnrealSpeech
+	}
+	return "", nil
+}
+
+// scriptEntry is the wire form of Response for the control API and script files, with
+// latency as a duration string like "250ms".
+type scriptEntry struct {
+	Status    int    `json:"status"`
+	Body      string `json:"body"`
+	Text      string `json:"text"`
+	RunStatus string `json:"run_status"`
+	Latency   string `json:"latency"`
+}
+
+func (e scriptEntry) response() (Response, error) {
+	response := Response{Status: e.Status, Body: e.Body, Text: e.Text, RunStatus: e.RunStatus}
+	if e.Latency != "" {
+		latency, err := time.ParseDuration(e.Latency)
+		if err != nil {
+			return Response{}, fmt.Errorf("latency %q: %w", e.Latency, err)
+		}
+		response.Latency = latency
+	}
+	return response, nil
+}
+
+// LoadScript queues the responses of a script document: a JSON object mapping route
+// names to lists of responses.
+func (f *Fake) LoadScript(r io.Reader) error {
+	var document map[string][]scriptEntry
+	if err := json.NewDecoder(r).Decode(&document); err != nil {
+		return fmt.Errorf("decode script: %w", err)
+	}
+	for route, entries := range document {
+		for _, entry := range entries {
+			response, err := entry.response()
+			if err != nil {
+				return fmt.Errorf("%s: %w", route, err)
+			}
+			f.Script(route, response)
+		}
+	}
+	return nil
+}
+
+// serveControl lets a running fake be scripted over HTTP:
+// POST /_fake/script with a script document, POST /_fake/reset, GET /_fake/calls.
+func (f *Fake) serveControl(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/_fake/script":
+		if err := f.LoadScript(r.Body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/_fake/reset":
+		f.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == "/_fake/calls":
+		f.mu.Lock()
+		calls := make(map[string]int, len(f.calls))
+		for route, count := range f.calls {
+			calls[route] = count
+		}
+		f.mu.Unlock()
+		writeJSON(w, http.StatusOK, calls)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown control endpoint"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// writeError answers like the real providers do, with an {"error": {...}} object.
+func writeError(w http.ResponseWriter, script Response) {
+	if script.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(script.Status)
+		_, _ = io.WriteString(w, script.Body)
+		return
+	}
+	writeJSON(w, script.Status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    script.Status,
+			"message": fmt.Sprintf("injected %d from fake provider", script.Status),
+		},
+	})
+}
+
+func statusOr(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+func textOr(text string, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	return text
+}
+
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
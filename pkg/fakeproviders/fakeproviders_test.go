@@ -0,0 +1,126 @@
+package fakeproviders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+func postJSON(t *testing.T, url string, payload interface{}) *http.Response {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	response, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", url, err)
+	}
+	return response
+}
+
+func TestFake_CannedAndScriptedChat(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	url := server.Endpoints().OpenAI + "/chat/completions"
+	request := ai_model.OpenAiRequest{Model: "gpt-4", Messages: []ai_model.MessageRequest{{Role: "user", Content: "hello there"}}}
+
+	server.Script(RouteOpenAiChat, Response{Text: "Scripted question?"})
+	server.Fail(RouteOpenAiChat, http.StatusTooManyRequests, 1)
+
+	tests := []struct {
+		name       string
+		wantStatus int
+		wantText   string
+	}{
+		{name: "scripted", wantStatus: http.StatusOK, wantText: "Scripted question?"},
+		{name: "injected error", wantStatus: http.StatusTooManyRequests},
+		{name: "canned", wantStatus: http.StatusOK, wantText: DefaultReply},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := postJSON(t, url, request)
+			defer response.Body.Close()
+			if response.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			if tt.wantText == "" {
+				return
+			}
+			var chatResponse ai_model.OpenAiChatResponse
+			_ = json.NewDecoder(response.Body).Decode(&chatResponse)
+			if got := chatResponse.Choices[0].Message.Content; got != tt.wantText {
+				t.Errorf("reply = %q, want %q", got, tt.wantText)
+			}
+			if chatResponse.Usage.PromptTokens != 2 {
+				t.Errorf("prompt tokens = %d, want 2", chatResponse.Usage.PromptTokens)
+			}
+		})
+	}
+
+	if calls := server.Calls(RouteOpenAiChat); calls != 3 {
+		t.Errorf("Calls() = %d, want 3", calls)
+	}
+}
+
+func TestFake_Latency(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetLatency(RouteUnrealSpeech, 200*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	body, _ := json.Marshal(ai_model.UnrealSpeechRequest{Text: "hi"})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.Endpoints().UnrealSpeech+"/stream", bytes.NewReader(body))
+	if _, err := http.DefaultClient.Do(request); err == nil {
+		t.Fatal("request finished before the injected latency")
+	}
+
+	server.SetLatency(RouteUnrealSpeech, 0)
+	response := postJSON(t, server.Endpoints().UnrealSpeech+"/stream", ai_model.UnrealSpeechRequest{Text: "hi"})
+	defer response.Body.Close()
+	audio, _ := io.ReadAll(response.Body)
+	if !bytes.Equal(audio, FakeAudio("hi")) {
+		t.Errorf("audio = %q, want FakeAudio(\"hi\")", audio)
+	}
+}
+
+func TestFake_ControlAPI(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/_fake/script", "application/json", strings.NewReader(`{"elevenlabs.tts": [{"status": 503}]}`))
+	if err != nil {
+		t.Fatalf("POST /_fake/script failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST /_fake/script status = %d, want 204", response.StatusCode)
+	}
+
+	response = postJSON(t, server.Endpoints().ElevenLabs+"/text-to-speech/voice/stream", ai_model.ElevenLabsRequest{Text: "hi"})
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want the scripted 503", response.StatusCode)
+	}
+
+	response, _ = http.Get(server.URL + "/_fake/calls")
+	var calls map[string]int
+	_ = json.NewDecoder(response.Body).Decode(&calls)
+	response.Body.Close()
+	if calls[RouteElevenLabs] != 1 {
+		t.Errorf("calls = %v, want one elevenlabs call", calls)
+	}
+
+	response, err = http.Post(server.URL+"/_fake/script", "application/json", strings.NewReader(`{"openai.chat": [{"latency": "soon"}]}`))
+	if err != nil {
+		t.Fatalf("POST /_fake/script failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid script status = %d, want 400", response.StatusCode)
+	}
+}
@@ -0,0 +1,108 @@
+package fakeproviders
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+// serveGemini answers both generateContent and streamGenerateContent?alt=sse.
+func serveGemini(f *Fake, w http.ResponseWriter, r *request) {
+	var googleRequest ai_model.GoogleRequest
+	if err := json.Unmarshal(r.body, &googleRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	reply := textOr(r.script.Text, DefaultReply)
+	promptTokens := 0
+	for _, content := range googleRequest.Contents {
+		for _, part := range content.Parts {
+			promptTokens += countWords(part.Text)
+		}
+	}
+
+	if !strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+		writeJSON(w, http.StatusOK, geminiResponse(reply, "STOP", promptTokens, countWords(reply)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	words := strings.SplitAfter(reply, " ")
+	for i, word := range words {
+		finishReason := ""
+		if i == len(words)-1 {
+			finishReason = "STOP"
+		}
+		// usageMetadata is cumulative on every chunk, like the real API
+		writeEvent(w, geminiResponse(word, finishReason, promptTokens, i+1))
+	}
+}
+
+func geminiResponse(text string, finishReason string, promptTokens int, candidateTokens int) ai_model.GoogleResponse {
+	return ai_model.GoogleResponse{
+		Candidates: []ai_model.GoogleResponseCandidate{{
+			Content: ai_model.GoogleRequestContent{
+				Role:  "model",
+				Parts: []ai_model.GoogleRequestPart{{Text: text}},
+			},
+			FinishReason: finishReason,
+		}},
+		UsageMetadata: ai_model.GoogleUsageMetadata{
+			PromptTokenCount:     promptTokens,
+			CandidatesTokenCount: candidateTokens,
+			TotalTokenCount:      promptTokens + candidateTokens,
+		},
+	}
+}
+
+func serveGoogleTts(f *Fake, w http.ResponseWriter, r *request) {
+	var ttsRequest ai_model.GoogleVertexAiRequest
+	if err := json.Unmarshal(r.body, &ttsRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	audio := FakeAudio(textOr(r.script.Text, ttsRequest.Input.Text))
+	writeJSON(w, http.StatusOK, ai_model.GoogleVertexAiAudioResponse{
+		AudioContent: base64.StdEncoding.EncodeToString(audio),
+	})
+}
+
+// serveGoogleStt returns one result with evenly spaced word offsets, 400ms per word.
+func serveGoogleStt(f *Fake, w http.ResponseWriter, r *request) {
+	var sttRequest ai_model.GoogleVertexAiSpeechToTextRequest
+	if err := json.Unmarshal(r.body, &sttRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	transcript := textOr(r.script.Text, DefaultTranscript)
+	words := make([]ai_model.GoogleWord, 0, countWords(transcript))
+	for i, word := range strings.Fields(transcript) {
+		words = append(words, ai_model.GoogleWord{
+			StartTime:  seconds(float64(i) * 0.4),
+			EndTime:    seconds(float64(i+1) * 0.4),
+			Word:       word,
+			Confidence: 0.92,
+		})
+	}
+	end := float64(len(words)) * 0.4
+	writeJSON(w, http.StatusOK, ai_model.GoogleVertexAiSpeechToTextResponse{
+		VertexAiSpeechToTextResponseResults: []ai_model.GoogleVertexAiSpeechToTextResponseResults{{
+			Alternatives:  []ai_model.GoogleAlternative{{Transcript: transcript, Confidence: 0.92, Words: words}},
+			ResultEndTime: seconds(end),
+			LanguageCode:  sttRequest.Config.LanguageCode,
+		}},
+		TotalBilledTime: seconds(float64(int(end) + 1)),
+		RequestId:       "fake",
+	})
+}
+
+// seconds formats a duration the way Google does, e.g. "1.200s".
+func seconds(value float64) string {
+	return fmt.Sprintf("%.3fs", value)
+}
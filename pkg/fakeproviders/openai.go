@@ -0,0 +1,134 @@
+package fakeproviders
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+func serveOpenAiChat(f *Fake, w http.ResponseWriter, r *request) {
+	var chatRequest ai_model.OpenAiRequest
+	if err := json.Unmarshal(r.body, &chatRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	reply := textOr(r.script.Text, DefaultReply)
+	promptTokens := 0
+	for _, message := range chatRequest.Messages {
+		promptTokens += countWords(message.Content)
+	}
+	usage := ai_model.OpenAiUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: countWords(reply),
+		TotalTokens:      promptTokens + countWords(reply),
+	}
+
+	if !chatRequest.Stream {
+		writeJSON(w, http.StatusOK, ai_model.OpenAiChatResponse{
+			ID:      "chatcmpl-fake",
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   chatRequest.Model,
+			Choices: []ai_model.OpenAiChoice{
+				{FinishReason: "stop", Message: ai_model.MessageResponse{Role: "assistant", Content: reply}},
+			},
+			Usage: usage,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	for _, word := range strings.SplitAfter(reply, " ") {
+		writeEvent(w, ai_model.OpenAiChatStreamChunk{
+			ID:      "chatcmpl-fake",
+			Model:   chatRequest.Model,
+			Choices: []ai_model.OpenAiStreamChoice{{Delta: ai_model.MessageResponse{Content: word}}},
+		})
+	}
+	stop := "stop"
+	writeEvent(w, ai_model.OpenAiChatStreamChunk{
+		ID:      "chatcmpl-fake",
+		Model:   chatRequest.Model,
+		Choices: []ai_model.OpenAiStreamChoice{{FinishReason: &stop}},
+	})
+	if chatRequest.StreamOptions != nil && chatRequest.StreamOptions.IncludeUsage {
+		writeEvent(w, ai_model.OpenAiChatStreamChunk{ID: "chatcmpl-fake", Model: chatRequest.Model, Usage: &usage})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func serveOpenAiSpeech(f *Fake, w http.ResponseWriter, r *request) {
+	var ttsRequest ai_model.OpenAiTtsRequest
+	if err := json.Unmarshal(r.body, &ttsRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeAudio(w, textOr(r.script.Text, ttsRequest.Input))
+}
+
+// serveOpenAiTranscription answers in the verbose_json shape. The duration is derived
+// from the upload size, assuming 16 kHz 16-bit mono audio. The transcript comes back as
+// one segment per sentence at 400ms per word, like the Google fake's word offsets.
+func serveOpenAiTranscription(f *Fake, w http.ResponseWriter, r *request) {
+	r.Body = nopCloser(r.body)
+	audioSize := 0
+	if err := r.ParseMultipartForm(32 << 20); err == nil {
+		if files := r.MultipartForm.File["file"]; len(files) > 0 {
+			audioSize = int(files[0].Size)
+		}
+	}
+	transcript := textOr(r.script.Text, DefaultTranscript)
+	var segments []ai_model.OpenAiTranscriptionSegment
+	var sentence []string
+	start := 0.0
+	fields := strings.Fields(transcript)
+	for i, word := range fields {
+		sentence = append(sentence, word)
+		if i < len(fields)-1 && !strings.ContainsAny(word[len(word)-1:], ".?!") {
+			continue
+		}
+		segmentEnd := start + float64(len(sentence))*0.4
+		segments = append(segments, ai_model.OpenAiTranscriptionSegment{
+			ID:         len(segments),
+			Start:      start,
+			End:        segmentEnd,
+			Text:       " " + strings.Join(sentence, " "),
+			AvgLogprob: -0.1,
+		})
+		start, sentence = segmentEnd, nil
+	}
+	writeJSON(w, http.StatusOK, ai_model.OpenAiTranscriptionResponse{
+		Text:     transcript,
+		Language: "english",
+		Duration: audioSeconds(audioSize),
+		Segments: segments,
+	})
+}
+
+func writeEvent(w http.ResponseWriter, payload interface{}) {
+	data, _ := json.Marshal(payload)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// FakeAudio is the "MP3" every fake TTS route returns for text.
+func FakeAudio(text string) []byte {
+	return []byte("ID3fake-audio:" + text)
+}
+
+func writeAudio(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(FakeAudio(text))
+}
+
+func audioSeconds(size int) float64 {
+	return float64(size) / 32000
+}
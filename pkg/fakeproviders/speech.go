@@ -0,0 +1,31 @@
+package fakeproviders
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	ai_model "up-it-aps-api/app/models/ai"
+)
+
+func serveElevenLabs(f *Fake, w http.ResponseWriter, r *request) {
+	var ttsRequest ai_model.ElevenLabsRequest
+	if err := json.Unmarshal(r.body, &ttsRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeAudio(w, textOr(r.script.Text, ttsRequest.Text))
+}
+
+func serveUnrealSpeech(f *Fake, w http.ResponseWriter, r *request) {
+	var ttsRequest ai_model.UnrealSpeechRequest
+	if err := json.Unmarshal(r.body, &ttsRequest); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeAudio(w, textOr(r.script.Text, ttsRequest.Text))
+}
+
+func nopCloser(body []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(body))
+}
@@ -1,21 +1,34 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"net/url"
+	"strings"
 	"up-it-aps-api/pkg/errors"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
+// APIKeyProtocol is the subprotocol a browser offers before its API key, since it cannot
+// set headers on a WebSocket: new WebSocket(url, ["x-api-key", key]). The server
+// accepts the protocol but never echoes the key.
+const APIKeyProtocol = "x-api-key"
+
 func APIKeyAuth(apiKey string, logger *zap.Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		requestKey := c.Get("x-api-key")
+		// browsers cannot set headers on a WebSocket, so they offer the key as a subprotocol
+		if requestKey == "" && websocket.IsWebSocketUpgrade(c) {
+			requestKey = protocolAPIKey(c)
+		}
 		if requestKey == "" {
 			logger.Warn("Missing API key",
 				zap.String("path", c.Path()),
 				zap.String("ip", c.IP()),
 			)
-			return errors.ErrUnauthorized
+			return fiber.NewError(errors.ErrUnauthorized.Code, errors.ErrUnauthorized.Message)
 		}
 
 		if requestKey != apiKey {
@@ -23,9 +36,72 @@ func APIKeyAuth(apiKey string, logger *zap.Logger) fiber.Handler {
 				zap.String("path", c.Path()),
 				zap.String("ip", c.IP()),
 			)
-			return errors.ErrUnauthorized
+			return fiber.NewError(errors.ErrUnauthorized.Code, errors.ErrUnauthorized.Message)
 		}
 
 		return c.Next()
 	}
 }
+
+// AdminKeyAuth lets a request through only with the admin key in x-admin-key. The
+// client API key is shared with browsers, so it must not be enough. An empty adminKey
+// refuses every request.
+func AdminKeyAuth(adminKey string, logger *zap.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestKey := c.Get("x-admin-key")
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(requestKey), []byte(adminKey)) != 1 {
+			logger.Warn("Invalid admin key",
+				zap.String("path", c.Path()),
+				zap.String("ip", c.IP()),
+			)
+			return fiber.NewError(errors.ErrForbidden.Code, errors.ErrForbidden.Message)
+		}
+
+		return c.Next()
+	}
+}
+
+// WebSocketOrigin refuses WebSocket upgrades from browser pages on other origins than
+// the server's own and allowedOrigins. WebSockets are not covered by CORS.
+func WebSocketOrigin(allowedOrigins []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if websocket.IsWebSocketUpgrade(c) && !sameOrigin(c, allowedOrigins) {
+			return fiber.NewError(errors.ErrForbidden.Code, errors.ErrForbidden.Message)
+		}
+		return c.Next()
+	}
+}
+
+// protocolAPIKey returns the API key the client offered after APIKeyProtocol in
+// Sec-WebSocket-Protocol, or an empty string.
+func protocolAPIKey(c *fiber.Ctx) string {
+	var protocols []string
+	for _, protocol := range strings.Split(c.Get("Sec-WebSocket-Protocol"), ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	for i, protocol := range protocols {
+		if protocol == APIKeyProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// sameOrigin reports whether the request comes from a page on the server's own host or
+// one of allowed. A "*" in allowed is ignored, as any page could then use a visitor's
+// connection. Requests without an Origin do not come from a browser and are allowed.
+func sameOrigin(c *fiber.Ctx, allowed []string) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	for _, candidate := range allowed {
+		if strings.EqualFold(strings.TrimSpace(candidate), origin) {
+			return true
+		}
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, c.Hostname())
+}
@@ -6,7 +6,6 @@ import (
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
-	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 )
 
@@ -61,6 +60,146 @@ func TestAPIKeyAuth(t *testing.T) {
 	}
 }
 
+func TestAPIKeyAuth_WebSocket(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	validAPIKey := "test-api-key-12345"
+
+	app := fiber.New()
+	app.Use(APIKeyAuth(validAPIKey, logger))
+	app.Use(WebSocketOrigin([]string{"https://app.example.com"}))
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	tests := []struct {
+		name           string
+		upgrade        bool
+		protocol       string
+		origin         string
+		expectedStatus int
+	}{
+		{
+			name:           "key offered as a subprotocol",
+			upgrade:        true,
+			protocol:       "x-api-key, " + validAPIKey,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong key offered as a subprotocol",
+			upgrade:        true,
+			protocol:       "x-api-key, wrong-key",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "subprotocol without an upgrade",
+			protocol:       "x-api-key, " + validAPIKey,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "allowed origin",
+			upgrade:        true,
+			protocol:       "x-api-key, " + validAPIKey,
+			origin:         "https://app.example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "same origin",
+			upgrade:        true,
+			protocol:       "x-api-key, " + validAPIKey,
+			origin:         "http://example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other origin",
+			upgrade:        true,
+			protocol:       "x-api-key, " + validAPIKey,
+			origin:         "https://evil.example.net",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			if tt.upgrade {
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Connection", "Upgrade")
+			}
+			req.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() failed: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAdminKeyAuth(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	validAdminKey := "test-admin-key-67890"
+
+	tests := []struct {
+		name           string
+		adminKey       string
+		requestKey     string
+		expectedStatus int
+	}{
+		{
+			name:           "valid admin key",
+			adminKey:       validAdminKey,
+			requestKey:     validAdminKey,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing admin key",
+			adminKey:       validAdminKey,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "invalid admin key",
+			adminKey:       validAdminKey,
+			requestKey:     "test-api-key-12345",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "no admin key configured",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(AdminKeyAuth(tt.adminKey, logger))
+			app.Get("/admin", func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.requestKey != "" {
+				req.Header.Set("x-admin-key", tt.requestKey)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() failed: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
 func TestRequestID(t *testing.T) {
 	app := fiber.New()
 	app.Use(RequestID())
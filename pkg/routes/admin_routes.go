@@ -0,0 +1,40 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminRoutes registers the admin routes behind auth, which must check a credential
+// clients are not given.
+func AdminRoutes(api fiber.Router, aiService *service.AiService, auth fiber.Handler) {
+	adminHandler := handler.NewAdminHandler(aiService)
+	personaHandler := handler.NewPersonaHandler(aiService.Personas())
+	questionHandler := handler.NewQuestionHandler(service.NewQuestionService())
+	scoringHandler := handler.NewScoringHandler(aiService.Scoring())
+	admin := api.Group("/admin", auth)
+
+	admin.Get("/breakers", adminHandler.GetBreakers)
+	admin.Get("/usage", adminHandler.GetUsage)
+	admin.Get("/tts-cache", adminHandler.GetTtsCache)
+	admin.Get("/personas", personaHandler.GetPersonas)
+	admin.Post("/personas", personaHandler.CreatePersona)
+	admin.Get("/personas/:id", personaHandler.GetPersona)
+	admin.Put("/personas/:id", personaHandler.UpdatePersona)
+	admin.Delete("/personas/:id", personaHandler.DeletePersona)
+	admin.Get("/personas/:id/versions", personaHandler.GetPersonaVersions)
+	admin.Get("/personas/:id/versions/:version", personaHandler.GetPersonaVersion)
+	admin.Get("/questions", questionHandler.GetQuestions)
+	admin.Post("/questions", questionHandler.CreateQuestion)
+	admin.Post("/questions/import", questionHandler.ImportQuestions)
+	admin.Get("/questions/export", questionHandler.ExportQuestions)
+	admin.Get("/questions/:id", questionHandler.GetQuestion)
+	admin.Put("/questions/:id", questionHandler.UpdateQuestion)
+	admin.Delete("/questions/:id", questionHandler.DeleteQuestion)
+	admin.Get("/rubrics", scoringHandler.GetRubrics)
+	admin.Post("/rubrics", scoringHandler.CreateRubric)
+	admin.Get("/rubrics/:id", scoringHandler.GetRubric)
+	admin.Put("/rubrics/:id", scoringHandler.UpdateRubric)
+}
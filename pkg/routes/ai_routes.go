@@ -9,15 +9,22 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/session"
 )
 
-func AiRoutes(api fiber.Router, store *session.Store) {
-	userService := service.NewUserService()
-	aiService := service.NewAiService(userService)
+func AiRoutes(api fiber.Router, store *session.Store, aiService *service.AiService, allowedOrigins []string) {
 	helperService := &service.HelperService{}
 	aiHandler := handler.NewAiHandler(aiService, helperService, store)
+	conversationHandler := handler.NewConversationHandler(service.NewConversationService())
+	personaHandler := handler.NewPersonaHandler(aiService.Personas())
 	ai := api.Group("/ai")
 
 	ai.Post("/generate-audio", aiHandler.GenerateChunkedAudio)
 	ai.Post("/chunk", aiHandler.ChunkString)
 	ai.Post("/message", aiHandler.ReceiveMessage)
+	ai.Post("/message/stream", aiHandler.StreamMessage)
+	ai.Get("/models", aiHandler.GetModels)
+	ai.Get("/voices", aiHandler.GetVoices)
 	ai.Post("/speech-to-text", aiHandler.WhisperGenerateTextFromSpeech)
+	ai.Get("/speech-to-text/stream", middleware.WebSocketOrigin(allowedOrigins), aiHandler.StreamSpeechToText)
+	ai.Get("/conversations", conversationHandler.GetConversations)
+	ai.Get("/conversations/:id", conversationHandler.GetConversation)
+	ai.Get("/personas", personaHandler.GetPersonas)
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func PracticeRoutes(api fiber.Router, aiService *service.AiService) {
+	practiceHandler := handler.NewPracticeHandler(aiService.Practice())
+	practice := api.Group("/practice")
+
+	practice.Get("/", practiceHandler.GetSchedule)
+	practice.Get("/due", practiceHandler.GetDue)
+	practice.Post("/sessions", practiceHandler.StartPracticeSession)
+	practice.Post("/rebuild", practiceHandler.Rebuild)
+}
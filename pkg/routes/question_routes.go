@@ -0,0 +1,17 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QuestionRoutes exposes the question bank read-only. Curation lives under /admin/questions.
+func QuestionRoutes(api fiber.Router) {
+	questionHandler := handler.NewPublicQuestionHandler(service.NewQuestionService())
+	questions := api.Group("/questions")
+
+	questions.Get("/", questionHandler.GetQuestions)
+	questions.Get("/:id", questionHandler.GetQuestion)
+}
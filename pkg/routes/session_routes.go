@@ -0,0 +1,33 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SessionRoutes(api fiber.Router, aiService *service.AiService) {
+	sessionHandler := handler.NewSessionHandler(aiService.Sessions(), aiService.Reports())
+	scoringHandler := handler.NewScoringHandler(aiService.Scoring())
+	reportHandler := handler.NewReportHandler(aiService.Reports())
+	sessions := api.Group("/sessions")
+
+	sessions.Get("/", sessionHandler.GetSessions)
+	sessions.Post("/", sessionHandler.StartSession)
+	sessions.Get("/:id", sessionHandler.GetSession)
+	sessions.Post("/:id/start", sessionHandler.StartScheduledSession)
+	sessions.Post("/:id/pause", sessionHandler.PauseSession)
+	sessions.Post("/:id/resume", sessionHandler.ResumeSession)
+	sessions.Post("/:id/end", sessionHandler.EndSession)
+	sessions.Post("/:id/abandon", sessionHandler.AbandonSession)
+	sessions.Get("/:id/timer", sessionHandler.GetTimer)
+	sessions.Get("/:id/timer/events", sessionHandler.StreamTimer)
+	sessions.Get("/:id/report", reportHandler.GetReport)
+	sessions.Post("/:id/report", reportHandler.RegenerateReport)
+	sessions.Post("/:id/turns/:turn/score", scoringHandler.ScoreTurn)
+	sessions.Get("/:id/turns/:turn/score", scoringHandler.GetTurnScores)
+	sessions.Post("/:id/turns/:turn/star", scoringHandler.AnalyseTurn)
+	sessions.Get("/:id/turns/:turn/star", scoringHandler.GetStarAnalysis)
+	sessions.Post("/:id/turns/:turn/follow-ups", scoringHandler.GenerateFollowUps)
+}
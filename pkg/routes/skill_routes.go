@@ -0,0 +1,16 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func SkillRoutes(api fiber.Router, aiService *service.AiService) {
+	skillHandler := handler.NewSkillHandler(aiService.Skills())
+	skills := api.Group("/skills")
+
+	skills.Get("/", skillHandler.GetSkills)
+	skills.Get("/next", skillHandler.NextQuestion)
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	handler "up-it-aps-api/app/handlers"
+	service "up-it-aps-api/app/services"
+	"up-it-aps-api/pkg/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SubmissionRoutes runs code submitted to the coding questions of a session.
+func SubmissionRoutes(api fiber.Router, aiService *service.AiService, settings config.SandboxConfig) {
+	submissionService := service.NewSubmissionService(aiService.Sessions(), service.NewQuestionService(), settings)
+	submissionHandler := handler.NewSubmissionHandler(submissionService)
+	sessions := api.Group("/sessions")
+
+	sessions.Post("/:id/turns/:turn/submissions", submissionHandler.Submit)
+	sessions.Get("/:id/turns/:turn/submissions", submissionHandler.GetSubmissions)
+}
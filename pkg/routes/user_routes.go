@@ -14,6 +14,7 @@ func UserRoutes(api fiber.Router, store *session.Store) {
 	user := api.Group("/users")
 
 	user.Get("/", userHandler.GetUserByEmail)
+	user.Post("/", userHandler.CreateUser)
 	user.Get("/settings", userHandler.GetUserSettingsByEmail)
 	user.Post("/settings", userHandler.UpdateUserSettings)
 }
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package sandbox
+
+import (
+	"os/exec"
+)
+
+// killProcessGroup leaves cmd to exec's default of killing only the process, as process
+// groups are a Unix feature.
+func killProcessGroup(cmd *exec.Cmd) {}
+
+func exitSignal(err *exec.ExitError) int {
+	return 0
+}
+
+func runAs(cmd *exec.Cmd, uid int, gid int) {}
+
+func runningAsRoot() bool {
+	return false
+}
@@ -0,0 +1,465 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Go     = "go"
+	Python = "python"
+)
+
+// Languages are the languages a Runner can compile and run.
+var Languages = []string{Go, Python}
+
+var (
+	ErrUnsupportedLanguage  = errors.New("unsupported language")
+	ErrIsolationUnavailable = errors.New("sandbox isolation is not available on this host")
+)
+
+// CompileError is returned by Prepare when the source does not compile. Output is the
+// compiler's diagnostics.
+type CompileError struct {
+	Output string
+}
+
+func (e *CompileError) Error() string {
+	return "compilation failed: " + e.Output
+}
+
+type Settings struct {
+	// TimeLimit is the wall-clock limit of one run. CPU time is capped at the same.
+	TimeLimit time.Duration
+	// CompileTimeLimit is the wall-clock limit of compiling a Go program.
+	CompileTimeLimit time.Duration
+	// MemoryMB caps the heap of a running program. It limits RLIMIT_DATA rather than the
+	// address space, which the Go runtime reserves far more of than it uses.
+	MemoryMB int
+	// MaxOutputBytes is how much of stdout and stderr is kept per run.
+	MaxOutputBytes int
+	// MaxConcurrent is how many compiles and runs may happen at once.
+	MaxConcurrent int
+	// MaxProcesses caps the processes and threads of a running program, so a fork bomb
+	// cannot fill the host's process table.
+	MaxProcesses int
+	// Programs run as RunAsUID and RunAsGID, by default nobody, who must be able to
+	// execute PythonBinary. Switching user needs the server to run as root.
+	RunAsUID int
+	RunAsGID int
+	// AllowNetwork skips the network namespace on hosts that cannot create one. It is
+	// meant for development only.
+	AllowNetwork bool
+	GoBinary     string
+	PythonBinary string
+	// GoCache is where the Runner builds the standard library packages programs usually
+	// import, before compiling any of them. Each compile starts from its own copy, so no
+	// program's build output reaches another's. Empty uses a new temporary directory.
+	GoCache string
+}
+
+// Runner compiles and runs untrusted programs. Every program gets its own temporary
+// directory and runs as a separate user in a separate process group with CPU, memory,
+// file size, process and time limits, in PID and mount namespaces that hide the host's
+// processes and a network namespace with no interfaces but loopback.
+type Runner struct {
+	settings Settings
+	slots    chan struct{}
+
+	isolateOnce sync.Once
+	isolateErr  error
+
+	goCacheMu    sync.Mutex
+	goCacheReady bool
+}
+
+func New(settings Settings) *Runner {
+	if settings.TimeLimit <= 0 {
+		settings.TimeLimit = 5 * time.Second
+	}
+	if settings.CompileTimeLimit <= 0 {
+		settings.CompileTimeLimit = 30 * time.Second
+	}
+	if settings.MemoryMB <= 0 {
+		settings.MemoryMB = 256
+	}
+	if settings.MaxOutputBytes <= 0 {
+		settings.MaxOutputBytes = 64 * 1024
+	}
+	if settings.MaxConcurrent <= 0 {
+		settings.MaxConcurrent = 2
+	}
+	if settings.MaxProcesses <= 0 {
+		settings.MaxProcesses = 32
+	}
+	if settings.RunAsUID <= 0 {
+		settings.RunAsUID = nobody
+	}
+	if settings.RunAsGID <= 0 {
+		settings.RunAsGID = nobody
+	}
+	if settings.GoBinary == "" {
+		settings.GoBinary = "go"
+	}
+	if settings.PythonBinary == "" {
+		settings.PythonBinary = "python3"
+	}
+	return &Runner{settings: settings, slots: make(chan struct{}, settings.MaxConcurrent)}
+}
+
+// Result is the outcome of one run.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Runtime  time.Duration
+	TimedOut bool
+	// Truncated is set when stdout or stderr went over MaxOutputBytes.
+	Truncated bool
+}
+
+// Program is a prepared solution that can be run once per test input. Close removes its
+// directory.
+type Program struct {
+	runner  *Runner
+	dir     string
+	command []string
+}
+
+// Prepare writes source into a new temporary directory and compiles it if the language
+// needs it. A *CompileError means the source is at fault.
+func (r *Runner) Prepare(ctx context.Context, language string, source string) (*Program, error) {
+	if language != Go && language != Python {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedLanguage, language)
+	}
+	if err := r.checkIsolation(); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	program := &Program{runner: r, dir: dir}
+	if err := program.build(ctx, language, source); err != nil {
+		program.Close()
+		return nil, err
+	}
+	// the program runs as RunAsUID, which needs its files and a writable home
+	if err := chownTree(dir, r.settings.RunAsUID, r.settings.RunAsGID); err != nil {
+		program.Close()
+		return nil, err
+	}
+	return program, nil
+}
+
+func (p *Program) build(ctx context.Context, language string, source string) error {
+	settings := p.runner.settings
+	switch language {
+	case Python:
+		path := filepath.Join(p.dir, "main.py")
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			return err
+		}
+		python, err := exec.LookPath(settings.PythonBinary)
+		if err != nil {
+			return err
+		}
+		p.command = []string{python, "-I", path}
+		return nil
+	case Go:
+		path := filepath.Join(p.dir, "main.go")
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			return err
+		}
+		goBinary, err := exec.LookPath(settings.GoBinary)
+		if err != nil {
+			return err
+		}
+		seed, err := p.runner.warmGoCache(goBinary)
+		if err != nil {
+			return err
+		}
+		cache := filepath.Join(p.dir, "gocache")
+		if err := copyTree(seed, cache); err != nil {
+			return err
+		}
+		binary := filepath.Join(p.dir, "main")
+		ctx, cancel := context.WithTimeout(ctx, settings.CompileTimeLimit)
+		defer cancel()
+		// the compiler is trusted, so it only gets the time limit and no network
+		result, err := p.runner.exec(ctx, p.dir, goEnv(p.dir, cache), "", 0, goBinary, "build", "-o", binary, path)
+		if err != nil {
+			return err
+		}
+		if result.TimedOut {
+			return &CompileError{Output: fmt.Sprintf("compilation took longer than %s", settings.CompileTimeLimit)}
+		}
+		if result.ExitCode != 0 {
+			// paths in diagnostics should not leak the host's temp dir
+			return &CompileError{Output: strings.ReplaceAll(result.Stderr, p.dir+string(filepath.Separator), "")}
+		}
+		p.command = []string{binary}
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedLanguage, language)
+}
+
+// Run runs the program with stdin as its input, within the time and memory limits.
+func (p *Program) Run(ctx context.Context, stdin string) (Result, error) {
+	settings := p.runner.settings
+	ctx, cancel := context.WithTimeout(ctx, settings.TimeLimit)
+	defer cancel()
+	// Go programs get few Ps so their runtime threads stay well within MaxProcesses
+	env := []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + p.dir, "TMPDIR=" + p.dir, "LANG=C.UTF-8", "PYTHONDONTWRITEBYTECODE=1", "GOMAXPROCS=2"}
+	return p.runner.exec(ctx, p.dir, env, stdin, settings.MemoryMB, p.command...)
+}
+
+func (p *Program) Close() error {
+	return os.RemoveAll(p.dir)
+}
+
+func goEnv(dir string, cache string) []string {
+	return []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"GOPATH=" + filepath.Join(dir, "gopath"),
+		"GOCACHE=" + cache,
+		"GO111MODULE=off",
+		"GOPROXY=off",
+		"GOTOOLCHAIN=local",
+		"CGO_ENABLED=0",
+	}
+}
+
+// fileSizeBlocks caps the size of any file a program writes.
+const fileSizeBlocks = 32 * 1024
+
+// nobody is the usual uid and gid of the unprivileged nobody user.
+const nobody = 65534
+
+// exec runs command in dir inside the sandbox. memoryMB of 0 leaves the compiler without
+// resource limits other than time, and running as the server's own user.
+func (r *Runner) exec(ctx context.Context, dir string, env []string, stdin string, memoryMB int, command ...string) (Result, error) {
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+
+	script := `exec "$@"`
+	if memoryMB > 0 {
+		// one limit per ulimit call, as not every sh accepts several; -f counts blocks of
+		// up to 1 KiB depending on the shell, so it is generous
+		cpuSeconds := int(r.settings.TimeLimit/time.Second) + 1
+		script = fmt.Sprintf("ulimit -d %d && ulimit -t %d && ulimit -f %d && %s", memoryMB*1024, cpuSeconds, fileSizeBlocks, script)
+	}
+	args := []string{"/bin/sh", "-c", script, "sandbox"}
+	args = append(args, command...)
+	if memoryMB > 0 {
+		// sh has no portable ulimit for processes
+		args = append([]string{"prlimit", fmt.Sprintf("--nproc=%d", r.settings.MaxProcesses), "--"}, args...)
+	}
+	args = append(r.namespaces(), args...)
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout := &limitedBuffer{limit: r.settings.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: r.settings.MaxOutputBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	killProcessGroup(cmd)
+	if memoryMB > 0 {
+		runAs(cmd, r.settings.RunAsUID, r.settings.RunAsGID)
+	}
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	result := Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Runtime:   time.Since(start),
+		TimedOut:  ctx.Err() == context.DeadlineExceeded,
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		if result.ExitCode < 0 {
+			// killed by a signal, such as SIGXCPU from the CPU limit
+			result.ExitCode = 128 + exitSignal(exitErr)
+		}
+	case result.TimedOut:
+		result.ExitCode = -1
+	default:
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// namespaces is the unshare command that gives a process its own PID, mount and, unless
+// AllowNetwork is set, network namespaces. /proc is remounted so the host's processes,
+// the server's among them, cannot be seen or signalled.
+func (r *Runner) namespaces() []string {
+	args := []string{"unshare", "--map-root-user", "--pid", "--fork", "--mount-proc"}
+	if !r.settings.AllowNetwork {
+		args = append(args, "--net")
+	}
+	return args
+}
+
+// checkIsolation makes sure programs can run as RunAsUID, process limits can be set and
+// the namespaces can be created, once per Runner. Without a user of their own, programs
+// could read the server's files and environment.
+func (r *Runner) checkIsolation() error {
+	r.isolateOnce.Do(func() {
+		if !runningAsRoot() {
+			r.isolateErr = fmt.Errorf("%w: programs must run as their own user, which needs the server to run as root", ErrIsolationUnavailable)
+			return
+		}
+		if _, err := exec.LookPath("prlimit"); err != nil {
+			r.isolateErr = fmt.Errorf("%w: %v", ErrIsolationUnavailable, err)
+			return
+		}
+		args := append(r.namespaces(), "true")
+		cmd := exec.CommandContext(context.Background(), args[0], args[1:]...)
+		killProcessGroup(cmd)
+		runAs(cmd, r.settings.RunAsUID, r.settings.RunAsGID)
+		if err := cmd.Run(); err != nil {
+			r.isolateErr = fmt.Errorf("%w: %v", ErrIsolationUnavailable, err)
+		}
+	})
+	return r.isolateErr
+}
+
+// goCacheWarmup imports the packages programs usually need, so building it fills the
+// shared cache with them.
+const goCacheWarmup = `package main
+
+import (
+	_ "bufio"
+	_ "container/heap"
+	_ "fmt"
+	_ "math"
+	_ "os"
+	_ "sort"
+	_ "strconv"
+	_ "strings"
+)
+
+func main() {}
+`
+
+// warmupTimeLimit bounds building the shared cache, which takes far longer than
+// compiling one program.
+const warmupTimeLimit = 5 * time.Minute
+
+// warmGoCache builds goCacheWarmup into GoCache the first time it is needed and returns
+// GoCache. Only this trusted source is ever built there. A failed build is retried by
+// the next compile.
+func (r *Runner) warmGoCache(goBinary string) (string, error) {
+	r.goCacheMu.Lock()
+	defer r.goCacheMu.Unlock()
+	if r.goCacheReady {
+		return r.settings.GoCache, nil
+	}
+	if r.settings.GoCache == "" {
+		cache, err := os.MkdirTemp("", "sandbox-go-cache-")
+		if err != nil {
+			return "", err
+		}
+		r.settings.GoCache = cache
+	}
+	dir, err := os.MkdirTemp("", "sandbox-warmup-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(goCacheWarmup), 0o644); err != nil {
+		return "", err
+	}
+	// not the request's context, so one cancelled submission does not fail the warmup
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeLimit)
+	defer cancel()
+	result, err := r.exec(ctx, dir, goEnv(dir, r.settings.GoCache), "", 0, goBinary, "build", "-o", filepath.Join(dir, "main"), path)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 || result.TimedOut {
+		return "", fmt.Errorf("building the Go cache failed: %s", result.Stderr)
+	}
+	r.goCacheReady = true
+	return r.settings.GoCache, nil
+}
+
+// copyTree copies the regular files and directories under src to dst.
+func copyTree(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case entry.Type().IsRegular():
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, 0o644)
+		}
+		return nil
+	})
+}
+
+// chownTree hands dir and everything in it to uid and gid.
+func chownTree(dir string, uid int, gid int) error {
+	return filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest, so a
+// chatty program cannot exhaust memory or block on a full pipe.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
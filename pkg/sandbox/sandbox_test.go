@@ -0,0 +1,138 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRunner skips the test when the host cannot run the sandbox or language.
+func newTestRunner(t *testing.T, language string, settings Settings) *Runner {
+	t.Helper()
+	r := New(settings)
+	if err := r.checkIsolation(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	if language == Go {
+		if _, err := exec.LookPath(r.settings.GoBinary); err != nil {
+			t.Skipf("go unavailable: %v", err)
+		}
+		return r
+	}
+	// programs run as RunAsUID, which cannot use an interpreter in root's home
+	for _, python := range []string{r.settings.PythonBinary, "/usr/bin/python3"} {
+		cmd := exec.CommandContext(context.Background(), python, "--version")
+		killProcessGroup(cmd)
+		runAs(cmd, r.settings.RunAsUID, r.settings.RunAsGID)
+		if cmd.Run() == nil {
+			r.settings.PythonBinary = python
+			return r
+		}
+	}
+	t.Skipf("no python the sandbox user can run")
+	return nil
+}
+
+func TestRunner_Python(t *testing.T) {
+	r := newTestRunner(t, Python, Settings{TimeLimit: time.Second, MemoryMB: 64})
+	program, err := r.Prepare(context.Background(), Python, "import sys\nprint(sum(int(x) for x in sys.stdin.read().split()))\n")
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	defer program.Close()
+
+	result, err := program.Run(context.Background(), "1 2 3\n")
+	if err != nil || result.Stdout != "6\n" || result.ExitCode != 0 || result.TimedOut {
+		t.Errorf("Run() = %+v, %v, want 6", result, err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		check  func(Result) bool
+	}{
+		{name: "runtime error", source: "raise ValueError('boom')", check: func(r Result) bool {
+			return r.ExitCode != 0 && strings.Contains(r.Stderr, "Value")
+		}},
+		{name: "infinite loop", source: "while True:\n    pass\n", check: func(r Result) bool {
+			return r.TimedOut || r.ExitCode != 0
+		}},
+		{name: "too much output", source: "print('x' * 100000)", check: func(r Result) bool {
+			return r.Truncated && len(r.Stdout) == 64*1024
+		}},
+		{name: "too much memory", source: "x = bytearray(128 * 1024 * 1024)", check: func(r Result) bool {
+			return r.ExitCode != 0 && strings.Contains(r.Stderr, "MemoryError")
+		}},
+		// a bomb that stops itself, so a broken limit cannot take the host down
+		{name: "fork bomb", source: "import os, time\nfor i in range(500):\n    try:\n        if os.fork() == 0:\n            os.close(1)\n            os.close(2)\n            time.sleep(1)\n            os._exit(0)\n    except OSError:\n        print('stopped after', i)\n        break\n", check: func(r Result) bool {
+			return strings.HasPrefix(r.Stdout, "stopped after") && !r.TimedOut
+		}},
+		{name: "no host processes", source: fmt.Sprintf("import os\ntry:\n    os.kill(%d, 0)\n    print('visible')\nexcept OSError:\n    print('hidden')\n", os.Getpid()), check: func(r Result) bool {
+			return r.Stdout == "hidden\n"
+		}},
+		{name: "no network", source: "import socket\nsocket.create_connection(('1.1.1.1', 53), timeout=0.5)\n", check: func(r Result) bool {
+			return r.ExitCode != 0 && strings.Contains(r.Stderr, "unreachable")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := r.Prepare(context.Background(), Python, tt.source)
+			if err != nil {
+				t.Fatalf("Prepare() failed: %v", err)
+			}
+			defer program.Close()
+			result, err := program.Run(context.Background(), "")
+			if err != nil || !tt.check(result) {
+				t.Errorf("Run() = %+v, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestRunner_Go(t *testing.T) {
+	r := newTestRunner(t, Go, Settings{TimeLimit: 2 * time.Second, GoCache: t.TempDir()})
+	if _, err := r.Prepare(context.Background(), Go, "package main\nfunc main() { undefined() }\n"); !errors.As(err, new(*CompileError)) {
+		t.Fatalf("Prepare() with a compile error = %v, want a CompileError", err)
+	}
+	// each compile builds in a copy of the cache, so nothing it builds is shared
+	cached := countFiles(t, r.settings.GoCache)
+	program, err := r.Prepare(context.Background(), Go, "package main\nimport (\"fmt\"; \"regexp\")\nfunc main() { var n int; fmt.Scan(&n); fmt.Println(n * 2, regexp.QuoteMeta(\"\")) }\n")
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	defer program.Close()
+	if result, err := program.Run(context.Background(), "21"); err != nil || result.Stdout != "42 \n" {
+		t.Errorf("Run() = %+v, %v, want 42", result, err)
+	}
+	if after := countFiles(t, r.settings.GoCache); after != cached {
+		t.Errorf("shared cache went from %d to %d files, want it left alone", cached, after)
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walking %s failed: %v", dir, err)
+	}
+	return count
+}
+
+func TestRunner_UnsupportedLanguage(t *testing.T) {
+	r := New(Settings{AllowNetwork: true})
+	if _, err := r.Prepare(context.Background(), "cobol", "DISPLAY 'HI'."); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Prepare() error = %v, want ErrUnsupportedLanguage", err)
+	}
+}